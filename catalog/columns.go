@@ -0,0 +1,281 @@
+// Package catalog moves products in and out of CSV and XLSX spreadsheets.
+// An export can be edited and imported again: both use the same columns,
+// with category, brand and groups by name.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/repository"
+)
+
+// Separators of the list columns, e.g. sizes "Small: 5; Large: 3: 1200".
+const (
+	listSeparator  = ";"
+	fieldSeparator = ":"
+)
+
+// productColumn converts one column between cells and product rows. Get
+// returns a string, int or float64 cell; Set parses a cell into the row.
+type productColumn struct {
+	Key string
+	Get func(row *repository.ProductRow) interface{}
+	Set func(row *repository.ProductRow, cell string) error
+}
+
+// ProductColumns lists the columns of a product file in export order. Only
+// "sku" is required in an import; missing columns leave products unchanged.
+var ProductColumns = []productColumn{
+	{"sku", func(row *repository.ProductRow) interface{} { return row.SKU },
+		func(row *repository.ProductRow, cell string) error { row.SKU = cell; return nil }},
+	textColumn("name", func(row *repository.ProductRow) **string { return &row.Name }),
+	textColumn("description", func(row *repository.ProductRow) **string { return &row.Description }),
+	textColumn("category", func(row *repository.ProductRow) **string { return &row.Category }),
+	textColumn("brand", func(row *repository.ProductRow) **string { return &row.Brand }),
+	textColumn("model_number", func(row *repository.ProductRow) **string { return &row.ModelNumber }),
+	textColumn("warranty", func(row *repository.ProductRow) **string { return &row.Warranty }),
+	floatColumn("weight", func(row *repository.ProductRow) **float64 { return &row.Weight }),
+	textColumn("dimensions", func(row *repository.ProductRow) **string { return &row.Dimensions }),
+	textColumn("power", func(row *repository.ProductRow) **string { return &row.Power }),
+	textColumn("material", func(row *repository.ProductRow) **string { return &row.Material }),
+	textColumn("capacity", func(row *repository.ProductRow) **string { return &row.Capacity }),
+	textColumn("features", func(row *repository.ProductRow) **string { return &row.Features }),
+	{"is_active", func(row *repository.ProductRow) interface{} {
+		if row.IsActive == nil {
+			return ""
+		}
+		return strconv.FormatBool(*row.IsActive)
+	}, func(row *repository.ProductRow, cell string) error {
+		if cell == "" {
+			return nil
+		}
+		switch strings.ToLower(cell) {
+		case "true", "yes", "1":
+			row.IsActive = boolPtr(true)
+		case "false", "no", "0":
+			row.IsActive = boolPtr(false)
+		default:
+			return errors.New("must be true or false")
+		}
+		return nil
+	}},
+	{"stock", func(row *repository.ProductRow) interface{} {
+		if row.Stock == nil {
+			return ""
+		}
+		return *row.Stock
+	}, func(row *repository.ProductRow, cell string) error {
+		if cell == "" {
+			return nil
+		}
+		n, err := parseInt(cell)
+		if err != nil {
+			return err
+		}
+		row.Stock = &n
+		return nil
+	}},
+	textColumn("stock_policy", func(row *repository.ProductRow) **string { return &row.StockPolicy }),
+	floatColumn("price", func(row *repository.ProductRow) **float64 { return &row.Price }),
+	{"group_prices", func(row *repository.ProductRow) interface{} {
+		if row.GroupPrices == nil {
+			return ""
+		}
+		items := make([][]string, len(*row.GroupPrices))
+		for i, p := range *row.GroupPrices {
+			items[i] = []string{p.Group, formatFloat(p.Price)}
+		}
+		return joinList(items)
+	}, func(row *repository.ProductRow, cell string) error {
+		prices := []repository.GroupPriceRow{}
+		for _, fields := range splitList(cell) {
+			if len(fields) != 2 {
+				return fmt.Errorf("%q should be group%s price", strings.Join(fields, fieldSeparator), fieldSeparator)
+			}
+			price, err := parseFloat(fields[1])
+			if err != nil {
+				return fmt.Errorf("price for %s %v", fields[0], err)
+			}
+			prices = append(prices, repository.GroupPriceRow{Group: fields[0], Price: price})
+		}
+		row.GroupPrices = &prices
+		return nil
+	}},
+	{"sizes", func(row *repository.ProductRow) interface{} {
+		if row.Sizes == nil {
+			return ""
+		}
+		items := make([][]string, len(*row.Sizes))
+		for i, s := range *row.Sizes {
+			items[i] = []string{s.Name, strconv.Itoa(s.Stock)}
+			if s.Price != 0 {
+				items[i] = append(items[i], formatFloat(s.Price))
+			}
+		}
+		return joinList(items)
+	}, func(row *repository.ProductRow, cell string) error {
+		sizes := []repository.SizeRow{}
+		for _, fields := range splitList(cell) {
+			if len(fields) > 3 {
+				return fmt.Errorf("%q should be name%[2]s stock%[2]s price", strings.Join(fields, fieldSeparator), fieldSeparator)
+			}
+			if fields[0] == "" {
+				return errors.New("every size needs a name")
+			}
+			size := repository.SizeRow{Name: fields[0]}
+			var err error
+			if len(fields) > 1 && fields[1] != "" {
+				if size.Stock, err = parseInt(fields[1]); err != nil {
+					return fmt.Errorf("stock of %s %v", size.Name, err)
+				}
+			}
+			if len(fields) > 2 && fields[2] != "" {
+				if size.Price, err = parseFloat(fields[2]); err != nil {
+					return fmt.Errorf("price of %s %v", size.Name, err)
+				}
+			}
+			sizes = append(sizes, size)
+		}
+		row.Sizes = &sizes
+		return nil
+	}},
+	{"colors", func(row *repository.ProductRow) interface{} {
+		if row.Colors == nil {
+			return ""
+		}
+		items := make([][]string, len(*row.Colors))
+		for i, c := range *row.Colors {
+			items[i] = []string{c.Name, c.HexCode, strconv.Itoa(c.Stock)}
+		}
+		return joinList(items)
+	}, func(row *repository.ProductRow, cell string) error {
+		colors := []repository.ColorRow{}
+		for _, fields := range splitList(cell) {
+			if len(fields) > 3 {
+				return fmt.Errorf("%q should be name%[2]s hex code%[2]s stock", strings.Join(fields, fieldSeparator), fieldSeparator)
+			}
+			if fields[0] == "" {
+				return errors.New("every color needs a name")
+			}
+			color := repository.ColorRow{Name: fields[0]}
+			if len(fields) > 1 {
+				color.HexCode = fields[1]
+			}
+			if len(fields) > 2 && fields[2] != "" {
+				var err error
+				if color.Stock, err = parseInt(fields[2]); err != nil {
+					return fmt.Errorf("stock of %s %v", color.Name, err)
+				}
+			}
+			colors = append(colors, color)
+		}
+		row.Colors = &colors
+		return nil
+	}},
+	{"images", func(row *repository.ProductRow) interface{} {
+		if row.Images == nil {
+			return ""
+		}
+		return strings.Join(*row.Images, listSeparator+" ")
+	}, func(row *repository.ProductRow, cell string) error {
+		images := []string{}
+		seen := make(map[string]bool)
+		for _, url := range strings.Split(cell, listSeparator) {
+			url = strings.TrimSpace(url)
+			if url == "" || seen[url] {
+				continue
+			}
+			if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "/") {
+				return fmt.Errorf("%q is not an absolute URL or path", url)
+			}
+			seen[url] = true
+			images = append(images, url)
+		}
+		row.Images = &images
+		return nil
+	}},
+}
+
+func textColumn(key string, field func(row *repository.ProductRow) **string) productColumn {
+	return productColumn{key, func(row *repository.ProductRow) interface{} {
+		if v := *field(row); v != nil {
+			return *v
+		}
+		return ""
+	}, func(row *repository.ProductRow, cell string) error {
+		*field(row) = &cell
+		return nil
+	}}
+}
+
+// floatColumn leaves the field unchanged for an empty cell.
+func floatColumn(key string, field func(row *repository.ProductRow) **float64) productColumn {
+	return productColumn{key, func(row *repository.ProductRow) interface{} {
+		if v := *field(row); v != nil {
+			return *v
+		}
+		return ""
+	}, func(row *repository.ProductRow, cell string) error {
+		if cell == "" {
+			return nil
+		}
+		f, err := parseFloat(cell)
+		if err != nil {
+			return err
+		}
+		*field(row) = &f
+		return nil
+	}}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, errors.New("must be a number")
+	}
+	return f, nil
+}
+
+// parseInt accepts whole numbers written as decimals, as spreadsheets do.
+func parseInt(s string) (int, error) {
+	f, err := parseFloat(s)
+	if err != nil || f != float64(int(f)) {
+		return 0, errors.New("must be a whole number")
+	}
+	return int(f), nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// splitList splits a list cell into its items and their fields.
+func splitList(cell string) [][]string {
+	var items [][]string
+	for _, item := range strings.Split(cell, listSeparator) {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		fields := strings.Split(item, fieldSeparator)
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		items = append(items, fields)
+	}
+	return items
+}
+
+func joinList(items [][]string) string {
+	parts := make([]string, len(items))
+	for i, fields := range items {
+		parts[i] = strings.Join(fields, fieldSeparator+" ")
+	}
+	return strings.Join(parts, listSeparator+" ")
+}
@@ -0,0 +1,162 @@
+package catalog
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"gorm.io/gorm"
+)
+
+// saveEvery is how often a running job's progress is written.
+const saveEvery = time.Second
+
+// Importer runs product imports as background jobs, one at a time.
+type Importer struct {
+	mu         sync.Mutex
+	jobs       *repository.ImportJobRepository
+	catalog    *repository.CatalogRepository
+	products   *repository.ProductRepository
+	specs      *repository.SpecRepository
+	backorders *repository.BackorderRepository
+	alerts     *repository.StockAlertRepository
+}
+
+func NewImporter(db *gorm.DB) *Importer {
+	return &Importer{
+		jobs:       repository.NewImportJobRepository(db),
+		catalog:    repository.NewCatalogRepository(db),
+		products:   repository.NewProductRepository(db),
+		specs:      repository.NewSpecRepository(db),
+		backorders: repository.NewBackorderRepository(db),
+		alerts:     repository.NewStockAlertRepository(db),
+	}
+}
+
+// Start records the job and imports the rows in the background. Poll the
+// job for progress.
+func (im *Importer) Start(job *models.ImportJob, rows []FileRow) error {
+	job.Status = models.ImportPending
+	job.Total = len(rows)
+	job.Errors = []models.ImportRowError{}
+	if err := im.jobs.Create(job); err != nil {
+		return err
+	}
+	running := *job // job goes back to the caller as it was created
+	go im.run(&running, rows)
+	return nil
+}
+
+func (im *Importer) run(job *models.ImportJob, rows []FileRow) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	now := time.Now()
+	job.Status = models.ImportRunning
+	job.StartedAt = &now
+	im.save(job)
+
+	lookup, err := im.catalog.Lookup()
+	if err != nil {
+		log.Printf("import job %d failed: %v", job.ID, err)
+		job.Error = "failed to load categories, brands and groups"
+		im.finish(job, models.ImportFailed)
+		return
+	}
+
+	saved := time.Now()
+	for i := range rows {
+		im.importRow(job, lookup, &rows[i])
+		job.Processed = i + 1
+		if time.Since(saved) >= saveEvery {
+			im.save(job)
+			saved = time.Now()
+		}
+	}
+	im.finish(job, models.ImportCompleted)
+}
+
+// importRow saves one row, or only validates it in a dry run, and counts
+// the outcome on the job.
+func (im *Importer) importRow(job *models.ImportJob, lookup *repository.CatalogLookup, row *FileRow) {
+	if len(row.Errors) > 0 {
+		im.fail(job, row, row.Errors)
+		return
+	}
+
+	result, err := im.catalog.Upsert(&row.Product, lookup, job.UserID, job.DryRun)
+	if err != nil {
+		var rowErrs repository.RowErrors
+		if !errors.As(err, &rowErrs) {
+			log.Printf("import job %d: row %d failed: %v", job.ID, row.Row, err)
+			rowErrs = repository.RowErrors{"": "failed to save the product"}
+		}
+		im.fail(job, row, rowErrs)
+		return
+	}
+	if result.Created {
+		job.Created++
+	} else {
+		job.Updated++
+	}
+	if job.DryRun {
+		return
+	}
+
+	if err := im.products.RefreshSearch(result.ProductID); err != nil {
+		log.Printf("failed to index product %d for search: %v", result.ProductID, err)
+	}
+	// Specs of the old category's schema no longer apply
+	if result.CategoryChanged {
+		if err := im.specs.Prune(result.ProductID); err != nil {
+			log.Printf("failed to prune specs of product %d: %v", result.ProductID, err)
+		}
+	}
+	// New stock goes to waiting back-orders first, then to stock alerts
+	if result.StockRaised {
+		if _, err := im.backorders.Allocate(result.ProductID); err != nil {
+			log.Printf("back-order allocation for product %d failed: %v", result.ProductID, err)
+		}
+		if _, err := im.alerts.Restocked(result.ProductID); err != nil {
+			log.Printf("stock alerts for product %d failed: %v", result.ProductID, err)
+		}
+	}
+}
+
+// fail counts a failed row and records its errors, one per column.
+func (im *Importer) fail(job *models.ImportJob, row *FileRow, errs repository.RowErrors) {
+	job.Failed++
+	columns := make([]string, 0, len(errs))
+	for column := range errs {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if len(job.Errors) >= models.MaxImportErrors {
+			return
+		}
+		job.Errors = append(job.Errors, models.ImportRowError{
+			Row:     row.Row,
+			SKU:     row.Product.SKU,
+			Column:  column,
+			Message: errs[column],
+		})
+	}
+}
+
+func (im *Importer) finish(job *models.ImportJob, status string) {
+	now := time.Now()
+	job.Status = status
+	job.FinishedAt = &now
+	im.save(job)
+}
+
+func (im *Importer) save(job *models.ImportJob) {
+	if err := im.jobs.Save(job); err != nil {
+		log.Printf("failed to save progress of import job %d: %v", job.ID, err)
+	}
+}
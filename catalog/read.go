@@ -0,0 +1,151 @@
+package catalog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/export"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+)
+
+// FileRow is one product row of an import file. Row is its number in the
+// file, the header being row 1.
+type FileRow struct {
+	Row     int
+	Product repository.ProductRow
+	Errors  repository.RowErrors
+}
+
+// ReadProducts parses a product file. Problems with the file as a whole
+// (format, header) are returned as an error; problems with single rows are
+// kept on the row. Empty rows are skipped.
+func ReadProducts(data []byte, format string) ([]FileRow, error) {
+	var records [][]string
+	switch format {
+	case export.FormatCSV:
+		var err error
+		if records, err = readCSV(data); err != nil {
+			return nil, err
+		}
+	case export.FormatXLSX:
+		var err error
+		if records, err = utils.ReadXLSX(bytes.NewReader(data), int64(len(data))); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if len(records) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+
+	columns, err := headerColumns(records[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []FileRow
+	seen := make(map[string]int)
+	for i, record := range records[1:] {
+		if blank(record) {
+			continue
+		}
+		row := FileRow{Row: i + 2, Errors: repository.RowErrors{}}
+		for j, cell := range record {
+			if j >= len(columns) {
+				if strings.TrimSpace(cell) != "" {
+					row.Errors["row"] = "has more cells than the header"
+				}
+				continue
+			}
+			if columns[j].Set == nil {
+				continue
+			}
+			if err := columns[j].Set(&row.Product, strings.TrimSpace(cell)); err != nil {
+				row.Errors[columns[j].Key] = err.Error()
+			}
+		}
+		// Short rows: the remaining columns are empty
+		for j := len(record); j < len(columns); j++ {
+			if columns[j].Set == nil {
+				continue
+			}
+			if err := columns[j].Set(&row.Product, ""); err != nil {
+				row.Errors[columns[j].Key] = err.Error()
+			}
+		}
+		if sku := row.Product.SKU; sku != "" {
+			if first, ok := seen[sku]; ok {
+				row.Errors["sku"] = fmt.Sprintf("duplicate of row %d", first)
+			} else {
+				seen[sku] = row.Row
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// headerColumns maps the header cells to columns. Keys are matched without
+// regard to case, spaces or dashes; empty header cells map to no column.
+func headerColumns(header []string) ([]productColumn, error) {
+	columns := make([]productColumn, len(header))
+	used := make(map[string]bool, len(header))
+	for i, cell := range header {
+		key := strings.ToLower(strings.TrimSpace(cell))
+		key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+		if key == "" {
+			continue // cells under an empty header are ignored
+		}
+		found := false
+		for _, c := range ProductColumns {
+			if c.Key == key {
+				columns[i] = c
+				found = true
+				break
+			}
+		}
+		switch {
+		case !found:
+			return nil, fmt.Errorf("unknown column %q", cell)
+		case used[key]:
+			return nil, fmt.Errorf("column %q appears twice", cell)
+		}
+		used[key] = true
+	}
+	if !used["sku"] {
+		return nil, errors.New(`the "sku" column is required`)
+	}
+	return columns, nil
+}
+
+// readCSV reads comma or semicolon separated values, picking the separator
+// that splits the header.
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+
+	r := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		r.Comma = ';'
+	}
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+	return records, nil
+}
+
+func blank(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
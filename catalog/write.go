@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/aminasadiam/Kasra/export"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+)
+
+// flushEvery controls how many rows are buffered before the output is
+// flushed to a client that supports it.
+const flushEvery = 500
+
+// WriteProducts streams every product to w with all ProductColumns, in the
+// given format. The result can be imported again as is.
+func WriteProducts(w io.Writer, format string, repo *repository.CatalogRepository) error {
+	lookup, err := repo.Lookup()
+	if err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(ProductColumns))
+	for i, c := range ProductColumns {
+		header[i] = c.Key
+	}
+	cells := make([]interface{}, len(ProductColumns))
+	row := func(p *repository.ProductRow) []interface{} {
+		for i, c := range ProductColumns {
+			cells[i] = c.Get(p)
+		}
+		return cells
+	}
+
+	switch format {
+	case export.FormatCSV:
+		// UTF-8 BOM so spreadsheet software detects the Persian text correctly
+		if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		record := make([]string, len(ProductColumns))
+		write := func(cells []interface{}) error {
+			for i, cell := range cells {
+				record[i] = cellString(cell)
+			}
+			return cw.Write(record)
+		}
+		if err := write(header); err != nil {
+			return err
+		}
+		count := 0
+		err := repo.ExportRows(lookup, func(p *repository.ProductRow) error {
+			if err := write(row(p)); err != nil {
+				return err
+			}
+			if count++; count%flushEvery == 0 {
+				cw.Flush()
+				flush(w)
+			}
+			return cw.Error()
+		})
+		if err != nil {
+			return err
+		}
+		cw.Flush()
+		flush(w)
+		return cw.Error()
+
+	case export.FormatXLSX:
+		xw, err := utils.NewXLSXWriter(w, "Products")
+		if err != nil {
+			return err
+		}
+		if err := xw.WriteRow(header); err != nil {
+			return err
+		}
+		count := 0
+		err = repo.ExportRows(lookup, func(p *repository.ProductRow) error {
+			if err := xw.WriteRow(row(p)); err != nil {
+				return err
+			}
+			if count++; count%flushEvery == 0 {
+				if err := xw.Flush(); err != nil {
+					return err
+				}
+				flush(w)
+			}
+			return nil
+		})
+		if err != nil {
+			xw.Close()
+			return err
+		}
+		return xw.Close()
+
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func cellString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case float64:
+		return formatFloat(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func flush(w io.Writer) {
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
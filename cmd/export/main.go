@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aminasadiam/Kasra/config"
+	"github.com/aminasadiam/Kasra/database"
+	"github.com/aminasadiam/Kasra/export"
+	"github.com/aminasadiam/Kasra/repository"
+)
+
+func main() {
+	from := flag.String("from", "", "start date (YYYY-MM-DD), inclusive")
+	to := flag.String("to", "", "end date (YYYY-MM-DD), inclusive")
+	format := flag.String("format", export.FormatCSV, "output format: csv or xlsx")
+	columns := flag.String("columns", "", "comma separated columns (default: all)")
+	status := flag.String("status", "", "only export orders with this status")
+	out := flag.String("out", "", "output file (default: stdout)")
+	flag.Parse()
+
+	if *format != export.FormatCSV && *format != export.FormatXLSX {
+		log.Fatalf("unsupported format %q", *format)
+	}
+
+	cols, err := export.ParseOrderColumns(*columns)
+	if err != nil {
+		log.Fatalf("invalid columns: %v", err)
+	}
+
+	filter := repository.OrderFilter{Status: *status}
+	if *from != "" {
+		t, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			log.Fatalf("invalid from date: %v", err)
+		}
+		filter.From = &t
+	}
+	if *to != "" {
+		t, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			log.Fatalf("invalid to date: %v", err)
+		}
+		t = t.AddDate(0, 0, 1)
+		filter.To = &t
+	}
+
+	cfg := config.Load()
+	db, err := database.Connect(cfg.Dsn)
+	if err != nil {
+		log.Fatalf("failed to connect to db: %v", err)
+	}
+
+	output := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("failed to create output file: %v", err)
+		}
+		defer f.Close()
+		output = f
+	}
+
+	if err := export.WriteOrders(output, *format, repository.NewOrderRepository(db), filter, cols); err != nil {
+		log.Fatalf("export failed: %v", err)
+	}
+
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Exported orders to %s\n", *out)
+	}
+}
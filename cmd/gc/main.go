@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aminasadiam/Kasra/config"
+	"github.com/aminasadiam/Kasra/database"
+	"github.com/aminasadiam/Kasra/storage"
+	"github.com/aminasadiam/Kasra/uploadgc"
+)
+
+func main() {
+	grace := flag.Duration("grace", 24*time.Hour, "only files stored, and rows deleted, longer ago than this are orphans")
+	del := flag.Bool("delete", false, "delete orphaned files (default: only report them)")
+	asJSON := flag.Bool("json", false, "print the full report as JSON")
+	flag.Parse()
+
+	cfg := config.Load()
+	db, err := database.Connect(cfg.Dsn)
+	if err != nil {
+		log.Fatalf("failed to connect to db: %v", err)
+	}
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("failed to open storage: %v", err)
+	}
+
+	report, err := uploadgc.NewCollector(db, store).Run(context.Background(), *grace, *del)
+	if err != nil {
+		log.Fatalf("garbage collection failed: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	for _, o := range report.Orphans {
+		status := "orphan"
+		if o.Deleted {
+			status = "deleted"
+		}
+		fmt.Printf("%-8s %s (%d bytes, %s)\n", status, o.Key, o.Size, o.ModTime.Format("2006-01-02 15:04"))
+	}
+	for _, m := range report.Missing {
+		fmt.Printf("missing  %s %d: %s\n", m.Table, m.ID, m.URL)
+	}
+	fmt.Fprintf(os.Stderr, "%d files, %d orphans (%d bytes), %d deleted, %d rows with missing files\n",
+		report.Files, len(report.Orphans), report.OrphanBytes, report.Deleted, len(report.Missing))
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -12,6 +14,40 @@ type Configuration struct {
 	Dsn            string
 	JWTSecret      string
 	AllowedOrigins string
+
+	// Seller details printed on invoices and packing slips
+	SellerName         string
+	SellerAddress      string
+	SellerPhone        string
+	SellerEconomicCode string
+	InvoiceCurrency    string
+
+	// File storage for uploads: "local" (StorageDir) or "s3"
+	StorageBackend   string
+	StorageDir       string
+	StoragePublicURL string // base URL of stored files, without a trailing slash
+	// SignedURLs makes private files (return photos) reachable only through
+	// URLs that expire after SignedURLTTL.
+	SignedURLs   bool
+	SignedURLTTL time.Duration
+	SigningKey   string
+
+	// S3-compatible object storage (AWS S3, MinIO...)
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+
+	// Orphaned upload clean-up: runs every UploadGCInterval (0 disables it)
+	// and deletes orphans older than UploadGCGrace only with UploadGCDelete.
+	UploadGCInterval time.Duration
+	UploadGCGrace    time.Duration
+	UploadGCDelete   bool
+
+	// How often scheduled product publishing runs (0 disables it)
+	PublishInterval time.Duration
 }
 
 func Load() *Configuration {
@@ -42,10 +78,114 @@ func Load() *Configuration {
 		allowedOrigins = "http://localhost:3000"
 	}
 
+	sellerName := os.Getenv("SELLER_NAME")
+	if sellerName == "" {
+		sellerName = "مهر سپهر"
+	}
+
+	invoiceCurrency := os.Getenv("INVOICE_CURRENCY")
+	if invoiceCurrency == "" {
+		invoiceCurrency = "ریال"
+	}
+
+	storageBackend := strings.ToLower(os.Getenv("STORAGE_BACKEND"))
+	if storageBackend == "" {
+		storageBackend = "local"
+	}
+	if storageBackend != "local" && storageBackend != "s3" {
+		log.Fatal("STORAGE_BACKEND must be local or s3")
+	}
+
+	storageDir := os.Getenv("STORAGE_DIR")
+	if storageDir == "" {
+		storageDir = "./uploads"
+	}
+
+	// Without a public URL files are linked relative to the app's own host
+	storagePublicURL := strings.TrimSuffix(os.Getenv("STORAGE_PUBLIC_URL"), "/")
+	if storagePublicURL == "" {
+		storagePublicURL = "/api/assets"
+	}
+
+	signedURLs := os.Getenv("STORAGE_SIGNED_URLS") == "true"
+	signedURLTTL := 15 * time.Minute
+	if v := os.Getenv("STORAGE_SIGNED_URL_TTL"); v != "" {
+		signedURLTTL, err = time.ParseDuration(v)
+		if err != nil || signedURLTTL <= 0 {
+			log.Fatal("STORAGE_SIGNED_URL_TTL must be a positive duration such as 15m")
+		}
+	}
+
+	// Asset URLs get their own key so that it never signs auth tokens too
+	signingKey := os.Getenv("STORAGE_SIGNING_KEY")
+	if signedURLs && signingKey == "" {
+		log.Fatal("STORAGE_SIGNING_KEY is required when STORAGE_SIGNED_URLS is true")
+	}
+	if signedURLs && signingKey == jwtSecret {
+		log.Fatal("STORAGE_SIGNING_KEY must differ from JWT_SECRET")
+	}
+
+	s3Region := os.Getenv("S3_REGION")
+	if s3Region == "" {
+		s3Region = "us-east-1"
+	}
+	if storageBackend == "s3" && (os.Getenv("S3_ENDPOINT") == "" || os.Getenv("S3_BUCKET") == "") {
+		log.Fatal("S3_ENDPOINT and S3_BUCKET are required when STORAGE_BACKEND is s3")
+	}
+
+	uploadGCInterval := 24 * time.Hour
+	if v := os.Getenv("UPLOAD_GC_INTERVAL"); v != "" {
+		uploadGCInterval, err = time.ParseDuration(v)
+		if err != nil || uploadGCInterval < 0 {
+			log.Fatal("UPLOAD_GC_INTERVAL must be a duration such as 24h, or 0 to disable")
+		}
+	}
+	uploadGCGrace := 24 * time.Hour
+	if v := os.Getenv("UPLOAD_GC_GRACE"); v != "" {
+		uploadGCGrace, err = time.ParseDuration(v)
+		if err != nil || uploadGCGrace < 0 {
+			log.Fatal("UPLOAD_GC_GRACE must be a duration such as 24h")
+		}
+	}
+
+	publishInterval := time.Minute
+	if v := os.Getenv("PUBLISH_INTERVAL"); v != "" {
+		publishInterval, err = time.ParseDuration(v)
+		if err != nil || publishInterval < 0 {
+			log.Fatal("PUBLISH_INTERVAL must be a duration such as 1m, or 0 to disable")
+		}
+	}
+
 	return &Configuration{
 		Port:           port,
 		Dsn:            dsn,
 		JWTSecret:      jwtSecret,
 		AllowedOrigins: allowedOrigins,
+
+		SellerName:         sellerName,
+		SellerAddress:      os.Getenv("SELLER_ADDRESS"),
+		SellerPhone:        os.Getenv("SELLER_PHONE"),
+		SellerEconomicCode: os.Getenv("SELLER_ECONOMIC_CODE"),
+		InvoiceCurrency:    invoiceCurrency,
+
+		StorageBackend:   storageBackend,
+		StorageDir:       storageDir,
+		StoragePublicURL: storagePublicURL,
+		SignedURLs:       signedURLs,
+		SignedURLTTL:     signedURLTTL,
+		SigningKey:       signingKey,
+
+		S3Endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+		S3Region:    s3Region,
+		S3Bucket:    os.Getenv("S3_BUCKET"),
+		S3AccessKey: os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey: os.Getenv("S3_SECRET_KEY"),
+		S3PathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+
+		UploadGCInterval: uploadGCInterval,
+		UploadGCGrace:    uploadGCGrace,
+		UploadGCDelete:   os.Getenv("UPLOAD_GC_DELETE") == "true",
+
+		PublishInterval: publishInterval,
 	}
 }
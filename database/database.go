@@ -4,6 +4,8 @@ import (
 	"log"
 
 	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/search"
 	"github.com/aminasadiam/Kasra/utils"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -17,10 +19,50 @@ func Connect(dsn string) (*gorm.DB, error) {
 
 	log.Println("Connected to Database.")
 
-	db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Wallet{}, &models.Brand{}, &models.Product{}, &models.ProductImage{}, &models.ProductPrice{}, &models.ProductSize{}, &models.ProductColor{}, &models.Category{}, &models.Order{}, &models.OrderDetail{}, &models.Group{})
+	// Products saved before the publishing workflow get the status column's
+	// default, published; see the backfill below
+	hadStatus := !db.Migrator().HasTable(&models.Product{}) || db.Migrator().HasColumn(&models.Product{}, "status")
+
+	db.AutoMigrate(&models.User{}, &models.Role{}, &models.Permission{}, &models.Wallet{}, &models.Brand{}, &models.Product{}, &models.ProductImage{}, &models.ProductPrice{}, &models.ProductSize{}, &models.ProductColor{}, &models.Category{}, &models.Order{}, &models.OrderDetail{}, &models.Group{}, &models.Invoice{}, &models.ReturnRequest{}, &models.ReturnItem{}, &models.ReturnPhoto{}, &models.ReturnStatusHistory{}, &models.CreditNote{}, &models.Shipment{}, &models.ShipmentItem{}, &models.SpecAttribute{}, &models.ProductSpec{}, &models.ProductOption{}, &models.ProductOptionValue{}, &models.ProductVariant{}, &models.VariantPrice{}, &models.ImportJob{}, &models.Review{}, &models.ReviewPhoto{}, &models.ReviewVote{}, &models.ProductQuestion{}, &models.ProductAnswer{}, &models.Notification{}, &models.ProductRelation{}, &models.Wishlist{}, &models.WishlistItem{}, &models.StockAlert{}, &models.ProductRevision{})
 
 	log.Println("Migration is Successfull.")
 
+	// Products switched off before the publishing workflow existed come out
+	// of the storefront as archived instead of published, once
+	if !hadStatus {
+		if err := db.Exec("UPDATE products SET status = ? WHERE is_active = false", models.ProductArchived).Error; err != nil {
+			log.Printf("failed to archive inactive products: %v", err)
+		}
+	}
+
+	// Trigram indexes for typo-tolerant search suggestions
+	for _, stmt := range []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		search.NormalizeFunctionSQL,
+		"CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING gin (search_normalize(name) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_products_model_number_trgm ON products USING gin (search_normalize(model_number) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_products_sku_trgm ON products USING gin (search_normalize(sku) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_brands_name_trgm ON brands USING gin (search_normalize(name) gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING gin (search_normalize(name) gin_trgm_ops)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			log.Printf("failed to set up search suggestions: %v", err)
+			break
+		}
+	}
+
+	// Slug categories saved before slugs existed, then keep them unique per parent
+	if err := repository.NewCategoryRepository(db).BackfillSlugs(); err != nil {
+		log.Printf("failed to generate category slugs: %v", err)
+	} else if err := db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_parent_slug ON categories (COALESCE(parent_id, 0), slug) WHERE deleted_at IS NULL").Error; err != nil {
+		log.Printf("failed to index category slugs: %v", err)
+	}
+
+	// Index products saved before full-text search existed
+	if err := repository.NewProductRepository(db).RefreshSearchWhere("search_vector IS NULL"); err != nil {
+		log.Printf("failed to build product search index: %v", err)
+	}
+
 	// Seed admin user if no users exist
 	var userCount int64
 	if err := db.Model(&models.User{}).Count(&userCount).Error; err != nil {
@@ -64,5 +106,27 @@ func Connect(dsn string) (*gorm.DB, error) {
 		}
 	}
 
+	// Only roles with the publish permission publish products; admins get it
+	// when it is first created so they keep publishing
+	var publish models.Permission
+	if result := db.Where("name = ?", models.PermissionPublishProducts).Limit(1).Find(&publish); result.Error != nil {
+		log.Printf("failed to look up the publish permission: %v", result.Error)
+	} else if result.RowsAffected == 0 {
+		publish = models.Permission{Name: models.PermissionPublishProducts, Description: "Publish, reject, archive and schedule products"}
+		if err := db.Create(&publish).Error; err != nil {
+			log.Printf("failed to create the publish permission: %v", err)
+		} else {
+			var adminRoles []models.Role
+			if err := db.Where("name IN ?", []string{"admin", "administrator"}).Find(&adminRoles).Error; err != nil {
+				log.Printf("failed to find admin roles: %v", err)
+			}
+			for i := range adminRoles {
+				if err := db.Model(&adminRoles[i]).Association("Permissions").Append(&publish); err != nil {
+					log.Printf("failed to grant the publish permission to role %s: %v", adminRoles[i].Name, err)
+				}
+			}
+		}
+	}
+
 	return db, nil
 }
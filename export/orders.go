@@ -0,0 +1,200 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// flushEvery controls how many rows are buffered before the output is
+// flushed to a client that supports it.
+const flushEvery = 500
+
+// OrderColumn describes one selectable column of an order export.
+type OrderColumn struct {
+	Key    string
+	Header string
+	Value  func(row *repository.OrderExportRow) interface{}
+}
+
+// OrderColumns lists every column an order export can contain, in the order
+// they are written by default.
+var OrderColumns = []OrderColumn{
+	{"order_id", "Order ID", func(row *repository.OrderExportRow) interface{} { return row.OrderID }},
+	{"date", "Date", func(row *repository.OrderExportRow) interface{} { return row.CreatedAt.Format("2006-01-02 15:04:05") }},
+	{"customer", "Customer", func(row *repository.OrderExportRow) interface{} { return row.CustomerName }},
+	{"email", "Email", func(row *repository.OrderExportRow) interface{} { return row.CustomerEmail }},
+	{"group", "Group", func(row *repository.OrderExportRow) interface{} { return row.Groups }},
+	{"sku", "SKU", func(row *repository.OrderExportRow) interface{} { return row.SKU }},
+	{"product", "Product", func(row *repository.OrderExportRow) interface{} { return row.ProductName }},
+	{"brand", "Brand", func(row *repository.OrderExportRow) interface{} { return row.Brand }},
+	{"qty", "Quantity", func(row *repository.OrderExportRow) interface{} { return row.Quantity }},
+	{"unit_price", "Unit Price", func(row *repository.OrderExportRow) interface{} { return row.UnitPrice }},
+	{"tax", "Tax", func(row *repository.OrderExportRow) interface{} { return row.Tax }},
+	{"total", "Line Total", func(row *repository.OrderExportRow) interface{} { return row.Subtotal + row.Tax }},
+	{"order_total", "Order Total", func(row *repository.OrderExportRow) interface{} { return row.OrderTotal }},
+	{"payment_method", "Payment Method", func(row *repository.OrderExportRow) interface{} { return row.PaymentMethod }},
+	{"status", "Status", func(row *repository.OrderExportRow) interface{} { return row.Status }},
+}
+
+// ParseOrderColumns resolves a comma separated list of column keys. An empty
+// spec selects every column.
+func ParseOrderColumns(spec string) ([]OrderColumn, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return OrderColumns, nil
+	}
+
+	var columns []OrderColumn
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			continue
+		}
+		found := false
+		for _, c := range OrderColumns {
+			if c.Key == key {
+				columns = append(columns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", key)
+		}
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no columns selected")
+	}
+	return columns, nil
+}
+
+// ContentType returns the MIME type for an export format.
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// WriteOrders streams the order lines matching the filter to w in the given
+// format. If w has a Flush method (like http.Flusher) it is flushed
+// periodically so large exports reach the client progressively.
+func WriteOrders(w io.Writer, format string, repo *repository.OrderRepository, filter repository.OrderFilter, columns []OrderColumn) error {
+	switch format {
+	case FormatCSV:
+		return writeOrdersCSV(w, repo, filter, columns)
+	case FormatXLSX:
+		return writeOrdersXLSX(w, repo, filter, columns)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func writeOrdersCSV(w io.Writer, repo *repository.OrderRepository, filter repository.OrderFilter, columns []OrderColumn) error {
+	// UTF-8 BOM so spreadsheet software detects the Persian text correctly
+	if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Header
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	count := 0
+	record := make([]string, len(columns))
+	err := repo.ExportRows(filter, func(row *repository.OrderExportRow) error {
+		for i, c := range columns {
+			record[i] = formatCSVValue(c.Value(row))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		count++
+		if count%flushEvery == 0 {
+			cw.Flush()
+			flush(w)
+		}
+		return cw.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	cw.Flush()
+	flush(w)
+	return cw.Error()
+}
+
+func writeOrdersXLSX(w io.Writer, repo *repository.OrderRepository, filter repository.OrderFilter, columns []OrderColumn) error {
+	xw, err := utils.NewXLSXWriter(w, "Orders")
+	if err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, c := range columns {
+		header[i] = c.Header
+	}
+	if err := xw.WriteRow(header); err != nil {
+		return err
+	}
+
+	count := 0
+	cells := make([]interface{}, len(columns))
+	err = repo.ExportRows(filter, func(row *repository.OrderExportRow) error {
+		for i, c := range columns {
+			cells[i] = c.Value(row)
+		}
+		if err := xw.WriteRow(cells); err != nil {
+			return err
+		}
+		count++
+		if count%flushEvery == 0 {
+			if err := xw.Flush(); err != nil {
+				return err
+			}
+			flush(w)
+		}
+		return nil
+	})
+	if err != nil {
+		xw.Close()
+		return err
+	}
+
+	return xw.Close()
+}
+
+func formatCSVValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func flush(w io.Writer) {
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
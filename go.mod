@@ -4,6 +4,7 @@ go 1.24.5
 
 require (
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/crypto v0.31.0
 	gorm.io/gorm v1.31.0
 )
 
@@ -12,7 +13,6 @@ require (
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/pgx/v5 v5.6.0 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
-	golang.org/x/crypto v0.31.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
 )
 
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type BackorderHandler struct {
+	backorderRepo *repository.BackorderRepository
+}
+
+func NewBackorderHandler(db *gorm.DB) *BackorderHandler {
+	return &BackorderHandler{backorderRepo: repository.NewBackorderRepository(db)}
+}
+
+// GetAll returns the fulfilment queue: order lines waiting for stock, oldest
+// first. Optional query parameter: product_id.
+func (h *BackorderHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	var productID uint
+	if v := r.URL.Query().Get("product_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			utils.ErrorResponse(w, "Invalid product_id", http.StatusBadRequest)
+			return
+		}
+		productID = uint(id)
+	}
+
+	lines, err := h.backorderRepo.List(productID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch back-orders", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, lines, http.StatusOK)
+}
+
+// Allocate assigns a product's current stock to its waiting back-orders.
+// Useful after stock was corrected outside the receive-stock endpoint.
+func (h *BackorderHandler) Allocate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	allocations, err := h.backorderRepo.Allocate(uint(id))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to allocate back-orders", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Back-orders allocated", allocations, http.StatusOK)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -12,12 +13,14 @@ import (
 )
 
 type BrandHandler struct {
-	brandRepo *repository.BrandRepository
+	brandRepo   *repository.BrandRepository
+	productRepo *repository.ProductRepository
 }
 
 func NewBrandHandler(db *gorm.DB) *BrandHandler {
 	return &BrandHandler{
-		brandRepo: repository.NewBrandRepository(db),
+		brandRepo:   repository.NewBrandRepository(db),
+		productRepo: repository.NewProductRepository(db),
 	}
 }
 
@@ -86,6 +89,11 @@ func (h *BrandHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The brand name is part of its products' search index
+	if err := h.productRepo.RefreshSearchWhere("brand_id = ?", brand.ID); err != nil {
+		log.Printf("failed to reindex products of brand %d: %v", brand.ID, err)
+	}
+
 	utils.SuccessResponse(w, "Brand updated successfully", brand, http.StatusOK)
 }
 
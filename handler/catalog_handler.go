@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aminasadiam/Kasra/catalog"
+	"github.com/aminasadiam/Kasra/export"
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+// maxImportSize bounds the size of an uploaded product file.
+const maxImportSize = 32 << 20
+
+// CatalogHandler imports and exports products in bulk.
+type CatalogHandler struct {
+	importer    *catalog.Importer
+	jobRepo     *repository.ImportJobRepository
+	catalogRepo *repository.CatalogRepository
+}
+
+func NewCatalogHandler(db *gorm.DB) *CatalogHandler {
+	return &CatalogHandler{
+		importer:    catalog.NewImporter(db),
+		jobRepo:     repository.NewImportJobRepository(db),
+		catalogRepo: repository.NewCatalogRepository(db),
+	}
+}
+
+// FailInterrupted marks the imports a previous run left unfinished as
+// failed. Call it once at startup.
+func (h *CatalogHandler) FailInterrupted() error {
+	return h.jobRepo.FailInterrupted()
+}
+
+// Import starts a background import of the uploaded CSV or XLSX file
+// (multipart field "file") and returns the job to poll. With dry_run=true
+// rows are only validated.
+func (h *CatalogHandler) Import(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize+1<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		utils.ErrorResponse(w, "Invalid multipart form or file too large", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		utils.ErrorResponse(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(header.Filename)), ".")
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		utils.ErrorResponse(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxImportSize {
+		utils.ErrorResponse(w, "file is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	rows, err := catalog.ReadProducts(data, format)
+	if err != nil {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := models.ImportJob{
+		UserID:   claims.UserID,
+		Filename: filepath.Base(header.Filename),
+		Format:   format,
+		DryRun:   r.FormValue("dry_run") == "true",
+	}
+	if err := h.importer.Start(&job, rows); err != nil {
+		utils.ErrorResponse(w, "Failed to start import", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Import started", job, http.StatusAccepted)
+}
+
+// GetImport returns an import job with its progress and row errors.
+func (h *CatalogHandler) GetImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid import job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.jobRepo.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Import job not found", http.StatusNotFound)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to fetch import job", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, job, http.StatusOK)
+}
+
+// ListImports returns the latest import jobs.
+func (h *CatalogHandler) ListImports(w http.ResponseWriter, r *http.Request) {
+	jobs, err := h.jobRepo.List(20)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch import jobs", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, jobs, http.StatusOK)
+}
+
+// Export streams every product as CSV or XLSX in the import format.
+func (h *CatalogHandler) Export(w http.ResponseWriter, r *http.Request) {
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		utils.ErrorResponse(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	filename := "products_" + time.Now().Format("20060102_150405") + "." + format
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so a failure can only be logged
+	if err := catalog.WriteProducts(w, format, h.catalogRepo); err != nil {
+		log.Printf("product export failed: %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 
@@ -13,11 +15,15 @@ import (
 
 type CategoryHandler struct {
 	categoryRepo *repository.CategoryRepository
+	productRepo  *repository.ProductRepository
+	specRepo     *repository.SpecRepository
 }
 
 func NewCategoryHandler(db *gorm.DB) *CategoryHandler {
 	return &CategoryHandler{
 		categoryRepo: repository.NewCategoryRepository(db),
+		productRepo:  repository.NewProductRepository(db),
+		specRepo:     repository.NewSpecRepository(db),
 	}
 }
 
@@ -29,7 +35,7 @@ func (h *CategoryHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.categoryRepo.Create(&category); err != nil {
-		utils.ErrorResponse(w, "Failed to create category", http.StatusInternalServerError)
+		writeCategoryError(w, err, "Failed to create category")
 		return
 	}
 
@@ -57,7 +63,17 @@ func (h *CategoryHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 
 func (h *CategoryHandler) GetBySlug(w http.ResponseWriter, r *http.Request) {
 	slug := r.PathValue("slug")
-	category, err := h.categoryRepo.GetBySlug(slug)
+	var parentID *uint
+	if v := r.URL.Query().Get("parent_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			utils.ErrorResponse(w, "Invalid parent ID", http.StatusBadRequest)
+			return
+		}
+		parent := uint(id)
+		parentID = &parent
+	}
+	category, err := h.categoryRepo.GetBySlug(slug, parentID)
 	if err != nil {
 		utils.ErrorResponse(w, "Category not found", http.StatusNotFound)
 		return
@@ -81,10 +97,19 @@ func (h *CategoryHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	category.ID = uint(id)
 	if err := h.categoryRepo.Update(&category); err != nil {
-		utils.ErrorResponse(w, "Failed to update category", http.StatusInternalServerError)
+		writeCategoryError(w, err, "Failed to update category")
 		return
 	}
 
+	// The category name is part of its products' search index
+	if err := h.productRepo.RefreshSearchWhere("category_id = ?", category.ID); err != nil {
+		log.Printf("failed to reindex products of category %d: %v", category.ID, err)
+	}
+	// The parent may have changed, and with it the inherited spec schema
+	if err := h.specRepo.PruneCategory(category.ID); err != nil {
+		log.Printf("failed to prune specs under category %d: %v", category.ID, err)
+	}
+
 	utils.SuccessResponse(w, "Category updated successfully", category, http.StatusOK)
 }
 
@@ -102,3 +127,84 @@ func (h *CategoryHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	utils.SuccessResponse(w, "Category deleted successfully", nil, http.StatusOK)
 }
+
+// Tree returns all categories nested to any depth.
+func (h *CategoryHandler) Tree(w http.ResponseWriter, r *http.Request) {
+	tree, err := h.categoryRepo.Tree(nil)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch categories", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, tree, http.StatusOK)
+}
+
+// Subtree returns a category with its descendants nested to any depth.
+func (h *CategoryHandler) Subtree(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	root := uint(id)
+	tree, err := h.categoryRepo.Tree(&root)
+	if err != nil {
+		writeCategoryError(w, err, "Failed to fetch categories")
+		return
+	}
+	utils.JSONResponse(w, tree[0], http.StatusOK)
+}
+
+// Breadcrumbs returns the categories from the root down to the category.
+func (h *CategoryHandler) Breadcrumbs(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+	path, err := h.categoryRepo.Breadcrumbs(uint(id))
+	if err != nil {
+		writeCategoryError(w, err, "Failed to fetch breadcrumbs")
+		return
+	}
+	utils.JSONResponse(w, path, http.StatusOK)
+}
+
+// Move places a category and its subtree under another parent, or at the
+// root when parent_id is null.
+func (h *CategoryHandler) Move(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryRepo.Move(uint(id), req.ParentID)
+	if err != nil {
+		writeCategoryError(w, err, "Failed to move category")
+		return
+	}
+	if err := h.specRepo.PruneCategory(category.ID); err != nil {
+		log.Printf("failed to prune specs under category %d: %v", category.ID, err)
+	}
+	utils.SuccessResponse(w, "Category moved successfully", category, http.StatusOK)
+}
+
+// writeCategoryError maps category repository errors to responses.
+func writeCategoryError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.ErrorResponse(w, "Category not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrUnknownParent), errors.Is(err, repository.ErrCategoryCycle):
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	default:
+		utils.ErrorResponse(w, fallback, http.StatusInternalServerError)
+	}
+}
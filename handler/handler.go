@@ -3,7 +3,10 @@ package handler
 import (
 	"net/http"
 
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
 	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
 )
 
 func Index(w http.ResponseWriter, r *http.Request) {
@@ -12,3 +15,70 @@ func Index(w http.ResponseWriter, r *http.Request) {
 		"version": "1.0.0",
 	}, http.StatusOK)
 }
+
+// isAdmin reports whether the user has the admin role.
+func isAdmin(db *gorm.DB, userID uint) bool {
+	var user models.User
+	if err := db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return false
+	}
+	for _, role := range user.Roles {
+		if role.Name == "admin" || role.Name == "administrator" {
+			return true
+		}
+	}
+	return false
+}
+
+// productVisibility scopes a filter to the products the user may see:
+// everything for admins, published products for anonymous visitors and only
+// their groups' published products for other users. Only signed-in users
+// get prices. It also reports whether the user is an admin.
+func productVisibility(db *gorm.DB, r *http.Request) (repository.ProductFilter, bool) {
+	f := repository.ProductFilter{Status: models.ProductPublished, ActiveOnly: true}
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		return f, false
+	}
+	f.Priced = true
+	if isAdmin(db, claims.UserID) {
+		f.Status, f.ActiveOnly = "", false
+		return f, true
+	}
+
+	var user models.User
+	f.Restricted = true
+	if err := db.Preload("Groups").First(&user, claims.UserID).Error; err != nil {
+		return f, false
+	}
+	for _, g := range user.Groups {
+		f.GroupIDs = append(f.GroupIDs, g.ID)
+	}
+	return f, false
+}
+
+// canSee reports whether the user may open a product's page, by the same
+// rules productVisibility lists products: admins see every product, others
+// only active published ones, and signed-in users only those in their groups.
+func canSee(db *gorm.DB, r *http.Request, product *models.Product) bool {
+	f, admin := productVisibility(db, r)
+	if admin {
+		return true
+	}
+	if !product.IsPublished() || !product.IsActive {
+		return false
+	}
+	if !f.Restricted {
+		return true
+	}
+	if len(f.GroupIDs) == 0 {
+		return false
+	}
+	var count int64
+	if err := db.Table("group_products").
+		Where("product_id = ? AND group_id IN ?", product.ID, f.GroupIDs).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
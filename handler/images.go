@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/aminasadiam/Kasra/imaging"
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/storage"
+	"github.com/aminasadiam/Kasra/utils"
+)
+
+// maxImageSize bounds the size of an uploaded image file.
+const maxImageSize = 20 << 20
+
+// decodeImage checks an uploaded image by its magic bytes and size and
+// decodes it. On failure the error response is already written and ok is
+// false.
+func decodeImage(w http.ResponseWriter, data []byte) (img image.Image, ok bool) {
+	img, err := imaging.Decode(data, imaging.MaxPixels)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			utils.ErrorResponse(w, imaging.ErrUnsupportedFormat.Error(), http.StatusBadRequest)
+		case errors.Is(err, imaging.ErrTooManyPixels):
+			utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		default:
+			utils.ErrorResponse(w, imaging.ErrInvalidImage.Error(), http.StatusBadRequest)
+		}
+		return nil, false
+	}
+	return img, true
+}
+
+// saveImageRenditions validates an uploaded image and stores its resized
+// versions as <dir><name>_<size>.jpg|.png (plus .webp when smaller). On
+// failure the error response is already written and ok is false.
+func saveImageRenditions(w http.ResponseWriter, r *http.Request, store storage.Storage, file io.Reader, dir, name string, sizes []imaging.Size) (renditions []models.ImageRendition, ok bool) {
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to read image", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(data) > maxImageSize {
+		utils.ErrorResponse(w, "image is too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+
+	img, ok := decodeImage(w, data)
+	if !ok {
+		return nil, false
+	}
+
+	rendered, err := imaging.Render(img, sizes)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to process image", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	var written []string
+	put := func(key string, data []byte) bool {
+		if err := store.Put(r.Context(), key, data, mime.TypeByExtension(path.Ext(key))); err != nil {
+			log.Printf("failed to store image %s: %v", key, err)
+			for _, k := range written {
+				store.Delete(r.Context(), k)
+			}
+			utils.ErrorResponse(w, "Failed to save file", http.StatusInternalServerError)
+			return false
+		}
+		written = append(written, key)
+		return true
+	}
+
+	for _, img := range rendered {
+		rendition := models.ImageRendition{Name: img.Name, Width: img.Width, Height: img.Height}
+		key := dir + name + "_" + img.Name + img.Ext
+		if !put(key, img.Data) {
+			return nil, false
+		}
+		rendition.URL = store.URL(key)
+		if img.WebP != nil {
+			key = dir + name + "_" + img.Name + ".webp"
+			if !put(key, img.WebP) {
+				return nil, false
+			}
+			rendition.WebPURL = store.URL(key)
+		}
+		renditions = append(renditions, rendition)
+	}
+	return renditions, true
+}
+
+// removeImageFiles deletes the stored files behind url and any renditions.
+// Failures are only logged, since the record goes away regardless.
+func removeImageFiles(ctx context.Context, store storage.Storage, url string, renditions []models.ImageRendition) {
+	urls := []string{url}
+	for _, r := range renditions {
+		urls = append(urls, r.URL, r.WebPURL)
+	}
+	seen := map[string]bool{}
+	for _, u := range urls {
+		key, ok := storage.Key(store, u)
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("failed to delete image file %s: %v", key, err)
+		}
+	}
+}
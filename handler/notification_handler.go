@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type NotificationHandler struct {
+	notificationRepo *repository.NotificationRepository
+}
+
+func NewNotificationHandler(db *gorm.DB) *NotificationHandler {
+	return &NotificationHandler{notificationRepo: repository.NewNotificationRepository(db)}
+}
+
+// List returns a page of the user's notifications, newest first, and how
+// many are unread. Query: unread=true, page, page_size.
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	pagination := utils.ParsePagination(r)
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	notifications, total, err := h.notificationRepo.List(claims.UserID, unreadOnly, pagination)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch notifications", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	unread, err := h.notificationRepo.CountUnread(claims.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to count notifications", http.StatusInternalServerError)
+		return
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+		"pagination":    pagination,
+	}, http.StatusOK)
+}
+
+// MarkRead marks one notification as read.
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.notificationRepo.MarkRead(uint(id), claims.UserID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to update notification", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Notification marked as read", nil, http.StatusOK)
+}
+
+// MarkAllRead marks all of the user's notifications as read.
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.notificationRepo.MarkAllRead(claims.UserID); err != nil {
+		utils.ErrorResponse(w, "Failed to update notifications", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Notifications marked as read", nil, http.StatusOK)
+}
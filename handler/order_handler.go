@@ -1,10 +1,19 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aminasadiam/Kasra/config"
+	"github.com/aminasadiam/Kasra/export"
+	"github.com/aminasadiam/Kasra/invoice"
 	"github.com/aminasadiam/Kasra/models"
 	"github.com/aminasadiam/Kasra/repository"
 	"github.com/aminasadiam/Kasra/utils"
@@ -12,18 +21,24 @@ import (
 )
 
 type OrderHandler struct {
-	orderRepo   *repository.OrderRepository
-	productRepo *repository.ProductRepository
-	walletRepo  *repository.WalletRepository
-	db          *gorm.DB
+	orderRepo     *repository.OrderRepository
+	invoiceRepo   *repository.InvoiceRepository
+	backorderRepo *repository.BackorderRepository
+	productRepo   *repository.ProductRepository
+	variantRepo   *repository.VariantRepository
+	db            *gorm.DB
+	cfg           *config.Configuration
 }
 
-func NewOrderHandler(db *gorm.DB) *OrderHandler {
+func NewOrderHandler(db *gorm.DB, cfg *config.Configuration) *OrderHandler {
 	return &OrderHandler{
-		orderRepo:   repository.NewOrderRepository(db),
-		productRepo: repository.NewProductRepository(db),
-		walletRepo:  repository.NewWalletRepository(db),
-		db:          db,
+		orderRepo:     repository.NewOrderRepository(db),
+		invoiceRepo:   repository.NewInvoiceRepository(db),
+		backorderRepo: repository.NewBackorderRepository(db),
+		productRepo:   repository.NewProductRepository(db),
+		variantRepo:   repository.NewVariantRepository(db),
+		db:            db,
+		cfg:           cfg,
 	}
 }
 
@@ -77,6 +92,179 @@ func (h *OrderHandler) getUserGroupIDs(r *http.Request) []uint {
 	return groupIDs
 }
 
+// orderError is a failed order validation together with the HTTP status it
+// should be reported with.
+type orderError struct {
+	status  int
+	message string
+}
+
+func (e *orderError) Error() string {
+	return e.message
+}
+
+// writeOrderError reports err, using the status of an orderError when
+// available.
+func writeOrderError(w http.ResponseWriter, err error, fallback string) {
+	var oe *orderError
+	if errors.As(err, &oe) {
+		utils.ErrorResponse(w, oe.message, oe.status)
+		return
+	}
+	utils.ErrorResponse(w, fallback, http.StatusInternalServerError)
+}
+
+// checkVariant verifies that the size, color and variant chosen on an order
+// line still belong to the product, and returns the variant. Products with
+// variants must be ordered as one of their active variants.
+func (h *OrderHandler) checkVariant(d *models.OrderDetail, product *models.Product) (*models.ProductVariant, error) {
+	if d.SizeID != nil {
+		if err := h.db.Where("id = ? AND product_id = ?", *d.SizeID, product.ID).First(&models.ProductSize{}).Error; err != nil {
+			return nil, &orderError{http.StatusBadRequest, "Selected size is not available"}
+		}
+	}
+	if d.ColorID != nil {
+		if err := h.db.Where("id = ? AND product_id = ?", *d.ColorID, product.ID).First(&models.ProductColor{}).Error; err != nil {
+			return nil, &orderError{http.StatusBadRequest, "Selected color is not available"}
+		}
+	}
+	if d.VariantID == nil {
+		hasVariants, err := h.variantRepo.HasVariants(product.ID)
+		if err != nil {
+			return nil, err
+		}
+		if hasVariants {
+			return nil, &orderError{http.StatusBadRequest, "Choose a variant of the product"}
+		}
+		return nil, nil
+	}
+	variant, err := h.variantRepo.GetVariant(*d.VariantID)
+	if err != nil || variant.ProductID != product.ID || !variant.IsActive {
+		return nil, &orderError{http.StatusBadRequest, "Selected variant is not available"}
+	}
+	return variant, nil
+}
+
+// priceOrder validates the order lines against the current catalog and fills
+// in unit prices, subtotals and the order total from the user's group
+// prices. No tax or shipping is charged, so both are zero.
+func (h *OrderHandler) priceOrder(order *models.Order, groupIDs []uint) error {
+	order.Total, order.Tax, order.ShippingCost = 0, 0, 0
+
+	for i := range order.Details {
+		d := &order.Details[i]
+		d.Tax = 0
+		if d.Quantity <= 0 {
+			return &orderError{http.StatusBadRequest, "Quantity must be greater than 0"}
+		}
+
+		var product models.Product
+		err := h.productRepo.GetByID(d.ProductID, &product)
+		if err != nil || !product.IsActive || !product.IsPublished() {
+			return &orderError{http.StatusNotFound, "Product not found"}
+		}
+
+		variant, err := h.checkVariant(d, &product)
+		if err != nil {
+			return err
+		}
+
+		price := h.getProductPrice(product.ID, groupIDs)
+		if variant != nil {
+			if price, err = h.variantRepo.Price(variant.ID, groupIDs); err != nil {
+				return err
+			}
+		}
+		if price == 0 {
+			return &orderError{http.StatusBadRequest, "No price found for product"}
+		}
+
+		d.UnitPrice = price
+		d.Subtotal = price * float64(d.Quantity)
+		order.Total += d.Subtotal
+
+		if err := h.checkStock(d, &product, variant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStock verifies that a line can be fulfilled from the product's (or
+// the chosen variant's) stock. Lines exceeding the available stock are
+// rejected unless the product allows back-orders or pre-orders, in which
+// case the shortfall is flagged as back-ordered.
+func (h *OrderHandler) checkStock(d *models.OrderDetail, product *models.Product, variant *models.ProductVariant) error {
+	d.BackorderedQuantity = 0
+	d.PreOrder = false
+	d.ExpectedAt = nil
+
+	available := product.Stock
+	if variant != nil {
+		available = variant.Stock
+	}
+	if available < 0 {
+		available = 0
+	}
+	if available >= d.Quantity {
+		return nil
+	}
+
+	if !product.AllowsBackorder() {
+		return &orderError{http.StatusBadRequest, "Insufficient stock"}
+	}
+
+	short := d.Quantity - available
+	if product.BackorderLimit > 0 {
+		waiting, err := h.backorderRepo.WaitingQuantity(product.ID)
+		if err != nil {
+			return err
+		}
+		if waiting+short > product.BackorderLimit {
+			return &orderError{http.StatusBadRequest, "Insufficient stock"}
+		}
+	}
+
+	d.BackorderedQuantity = short
+	d.PreOrder = product.StockPolicy == models.StockPolicyPreorder
+	d.ExpectedAt = product.AvailableAt
+	return nil
+}
+
+// placeOrder pays for the order and takes its stock (see
+// OrderRepository.Place), reporting failures as orderErrors.
+func (h *OrderHandler) placeOrder(order *models.Order) error {
+	err := h.orderRepo.Place(order)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repository.ErrNoWallet):
+		return &orderError{http.StatusNotFound, "Wallet not found"}
+	case errors.Is(err, repository.ErrInsufficientBalance):
+		return &orderError{http.StatusBadRequest, "Insufficient balance"}
+	case errors.Is(err, repository.ErrInsufficientStock):
+		return &orderError{http.StatusConflict, "Insufficient stock"}
+	default:
+		log.Printf("failed to place order for user %d: %v", order.UserID, err)
+		return &orderError{http.StatusInternalServerError, "Failed to save order"}
+	}
+}
+
+// orderRequest is what a customer sends to place an order: the lines they
+// choose and where to deliver. Prices, totals and statuses are always set
+// by the server.
+type orderRequest struct {
+	Address       string `json:"address"`
+	PaymentMethod string `json:"payment_method"`
+	Details       []struct {
+		ProductID uint  `json:"product_id"`
+		VariantID *uint `json:"variant_id"`
+		SizeID    *uint `json:"size_id"`
+		ColorID   *uint `json:"color_id"`
+		Quantity  int   `json:"quantity"`
+	} `json:"details"`
+}
+
 func (h *OrderHandler) Create(w http.ResponseWriter, r *http.Request) {
 	claims, ok := utils.GetUserFromContext(r.Context())
 	if !ok {
@@ -84,77 +272,207 @@ func (h *OrderHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var order models.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+	var req orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	order.UserID = claims.UserID
-	order.Status = "pending"
-	order.Total = 0
+	order := models.Order{
+		UserID:        claims.UserID,
+		Status:        "pending",
+		Address:       req.Address,
+		PaymentMethod: req.PaymentMethod,
+	}
+	for _, d := range req.Details {
+		order.Details = append(order.Details, models.OrderDetail{
+			ProductID: d.ProductID,
+			VariantID: d.VariantID,
+			SizeID:    d.SizeID,
+			ColorID:   d.ColorID,
+			Quantity:  d.Quantity,
+		})
+	}
+
+	if err := h.priceOrder(&order, h.getUserGroupIDs(r)); err != nil {
+		writeOrderError(w, err, "Failed to create order")
+		return
+	}
+
+	if err := h.placeOrder(&order); err != nil {
+		writeOrderError(w, err, "Failed to create order")
+		return
+	}
+
+	utils.SuccessResponse(w, "Order created successfully", order, http.StatusCreated)
+}
+
+// reorderChange describes how a line of the original order differs from
+// what can be ordered today.
+type reorderChange struct {
+	ProductID uint   `json:"product_id"`
+	Name      string `json:"name,omitempty"`
+	// Change is one of: product_unavailable, inactive, variant_unavailable,
+	// out_of_stock, quantity_reduced, backordered, no_price, price_changed.
+	Change            string  `json:"change"`
+	OldPrice          float64 `json:"old_price,omitempty"`
+	NewPrice          float64 `json:"new_price,omitempty"`
+	RequestedQuantity int     `json:"requested_quantity,omitempty"`
+	AvailableQuantity int     `json:"available_quantity,omitempty"`
+}
+
+// Reorder rebuilds one of the user's past orders as a new draft order using
+// current group prices and stock. Lines that can no longer be ordered are
+// left out and every difference from the original is reported. The draft
+// is paid with Checkout.
+func (h *OrderHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	// Only the customer reorders and pays: drafts are priced with the
+	// caller's groups and paid from the owner's wallet
+	original, ok := h.ownedOrder(w, r, false)
+	if !ok {
+		return
+	}
 
 	groupIDs := h.getUserGroupIDs(r)
+	draft := models.Order{
+		UserID:        original.UserID,
+		Status:        "draft",
+		Address:       original.Address,
+		PaymentMethod: original.PaymentMethod,
+	}
+	changes := []reorderChange{}
+
+	for _, d := range original.Details {
+		change := reorderChange{ProductID: d.ProductID, RequestedQuantity: d.Quantity}
 
-	// Calculate total from order details
-	for i := range order.Details {
 		var product models.Product
-		err := h.productRepo.GetByID(order.Details[i].ProductID, &product)
-		if err != nil {
-			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
-			return
+		if err := h.productRepo.GetByID(d.ProductID, &product); err != nil {
+			change.Change = "product_unavailable"
+			changes = append(changes, change)
+			continue
+		}
+		change.Name = product.Name
+
+		line := models.OrderDetail{
+			ProductID: d.ProductID,
+			SizeID:    d.SizeID,
+			ColorID:   d.ColorID,
+			VariantID: d.VariantID,
+			Quantity:  d.Quantity,
+		}
+
+		variant, variantErr := h.checkVariant(&line, &product)
+		stock := product.Stock
+		if variant != nil {
+			stock = variant.Stock
+		}
+
+		switch {
+		case !product.IsActive || !product.IsPublished():
+			change.Change = "inactive"
+		case variantErr != nil:
+			change.Change = "variant_unavailable"
+		case stock <= 0 && !product.AllowsBackorder():
+			change.Change = "out_of_stock"
+		}
+		if change.Change != "" {
+			changes = append(changes, change)
+			continue
 		}
 
 		price := h.getProductPrice(product.ID, groupIDs)
+		if variant != nil {
+			price, _ = h.variantRepo.Price(variant.ID, groupIDs)
+		}
 		if price == 0 {
-			utils.ErrorResponse(w, "No price found for product", http.StatusBadRequest)
-			return
+			change.Change = "no_price"
+			changes = append(changes, change)
+			continue
 		}
 
-		order.Details[i].UnitPrice = price
-		order.Details[i].Subtotal = price * float64(order.Details[i].Quantity)
-		order.Total += order.Details[i].Subtotal
-
-		// Check stock
-		if product.Stock < order.Details[i].Quantity {
-			utils.ErrorResponse(w, "Insufficient stock", http.StatusBadRequest)
-			return
+		if stock < d.Quantity && !product.AllowsBackorder() {
+			line.Quantity = stock
+			changes = append(changes, reorderChange{
+				ProductID:         d.ProductID,
+				Name:              product.Name,
+				Change:            "quantity_reduced",
+				RequestedQuantity: d.Quantity,
+				AvailableQuantity: stock,
+			})
+		}
+		if stock < d.Quantity && product.AllowsBackorder() {
+			available := stock
+			if available < 0 {
+				available = 0
+			}
+			changes = append(changes, reorderChange{
+				ProductID:         d.ProductID,
+				Name:              product.Name,
+				Change:            "backordered",
+				RequestedQuantity: d.Quantity,
+				AvailableQuantity: available,
+			})
 		}
+		if price != d.UnitPrice {
+			changes = append(changes, reorderChange{
+				ProductID: d.ProductID,
+				Name:      product.Name,
+				Change:    "price_changed",
+				OldPrice:  d.UnitPrice,
+				NewPrice:  price,
+			})
+		}
+
+		draft.Details = append(draft.Details, line)
 	}
 
-	// Check wallet balance
-	wallet, err := h.walletRepo.GetByUserID(claims.UserID)
-	if err != nil {
-		utils.ErrorResponse(w, "Wallet not found", http.StatusNotFound)
+	if len(draft.Details) == 0 {
+		utils.SuccessResponse(w, "None of the products in this order can be ordered again", map[string]interface{}{
+			"order":   nil,
+			"changes": changes,
+		}, http.StatusOK)
 		return
 	}
 
-	if wallet.Balance < order.Total {
-		utils.ErrorResponse(w, "Insufficient balance", http.StatusBadRequest)
+	if err := h.priceOrder(&draft, groupIDs); err != nil {
+		writeOrderError(w, err, "Failed to rebuild order")
 		return
 	}
 
-	// Process payment: deduct from wallet
-	if err := h.walletRepo.AddBalance(claims.UserID, -order.Total); err != nil {
-		utils.ErrorResponse(w, "Failed to process payment", http.StatusInternalServerError)
+	if err := h.orderRepo.Create(&draft); err != nil {
+		utils.ErrorResponse(w, "Failed to create draft order", http.StatusInternalServerError)
 		return
 	}
 
-	// Update stock
-	for i := range order.Details {
-		var product models.Product
-		h.productRepo.GetByID(order.Details[i].ProductID, &product)
-		product.Stock -= order.Details[i].Quantity
-		h.productRepo.Update(&product)
+	utils.SuccessResponse(w, "Draft order created", map[string]interface{}{
+		"order":   draft,
+		"changes": changes,
+	}, http.StatusCreated)
+}
+
+// Checkout pays for one of the user's draft orders at current prices.
+func (h *OrderHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownedOrder(w, r, false)
+	if !ok {
+		return
 	}
 
-	order.Status = "paid"
-	if err := h.orderRepo.Create(&order); err != nil {
-		utils.ErrorResponse(w, "Failed to create order", http.StatusInternalServerError)
+	if order.Status != "draft" {
+		utils.ErrorResponse(w, "Only draft orders can be checked out", http.StatusBadRequest)
 		return
 	}
 
-	utils.SuccessResponse(w, "Order created successfully", order, http.StatusCreated)
+	if err := h.priceOrder(order, h.getUserGroupIDs(r)); err != nil {
+		writeOrderError(w, err, "Failed to check out order")
+		return
+	}
+
+	if err := h.placeOrder(order); err != nil {
+		writeOrderError(w, err, "Failed to check out order")
+		return
+	}
+
+	utils.SuccessResponse(w, "Order placed successfully", order, http.StatusOK)
 }
 
 func (h *OrderHandler) GetAllForUser(w http.ResponseWriter, r *http.Request) {
@@ -172,7 +490,195 @@ func (h *OrderHandler) GetAllForUser(w http.ResponseWriter, r *http.Request) {
 	utils.JSONResponse(w, orders, http.StatusOK)
 }
 
+// GetAll lists every order for admins with filtering, sorting and pagination.
+// Supported query parameters: status, user_id, group_id, product_id, from, to
+// (YYYY-MM-DD or RFC3339), min_total, max_total, search (customer username or
+// email), sort (created_at, total, status, id), order (asc, desc), page and
+// page_size. The summary covers the whole filtered set, not just the page.
+func (h *OrderHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pagination := utils.ParsePagination(r)
+	filter.Page = pagination.Page
+	filter.PageSize = pagination.PageSize
+
+	orders, total, err := h.orderRepo.List(filter)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch orders", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	summary, err := h.orderRepo.Summarize(filter)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to summarize orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	utils.JSONResponse(w, map[string]interface{}{
+		"orders":     orders,
+		"pagination": pagination,
+		"summary":    summary,
+	}, http.StatusOK)
+}
+
+// Export streams the orders matching the admin listing filters as CSV or XLSX.
+// Query parameters: format (csv, xlsx), columns (comma separated keys, see
+// export.OrderColumns) plus every filter accepted by GetAll.
+func (h *OrderHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = export.FormatCSV
+	}
+	if format != export.FormatCSV && format != export.FormatXLSX {
+		utils.ErrorResponse(w, "format must be csv or xlsx", http.StatusBadRequest)
+		return
+	}
+
+	columns, err := export.ParseOrderColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename := "orders_" + time.Now().Format("20060102_150405") + "." + format
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so a failure can only be logged
+	if err := export.WriteOrders(w, format, h.orderRepo, filter, columns); err != nil {
+		log.Printf("order export failed: %v", err)
+	}
+}
+
+// parseOrderFilter reads the admin order listing filters from the query string.
+func parseOrderFilter(r *http.Request) (repository.OrderFilter, error) {
+	q := r.URL.Query()
+	filter := repository.OrderFilter{
+		Status: strings.TrimSpace(q.Get("status")),
+		Search: strings.TrimSpace(q.Get("search")),
+		Sort:   q.Get("sort"),
+		Desc:   !strings.EqualFold(q.Get("order"), "asc"),
+	}
+
+	ids := map[string]*uint{
+		"user_id":    &filter.UserID,
+		"group_id":   &filter.GroupID,
+		"product_id": &filter.ProductID,
+	}
+	for name, target := range ids {
+		if v := q.Get(name); v != "" {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return filter, errors.New("Invalid " + name)
+			}
+			*target = uint(id)
+		}
+	}
+
+	if v := q.Get("from"); v != "" {
+		from, _, err := parseDateParam(v)
+		if err != nil {
+			return filter, errors.New("Invalid from date")
+		}
+		filter.From = &from
+	}
+	if v := q.Get("to"); v != "" {
+		to, dateOnly, err := parseDateParam(v)
+		if err != nil {
+			return filter, errors.New("Invalid to date")
+		}
+		// A bare date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+
+	totals := map[string]**float64{
+		"min_total": &filter.MinTotal,
+		"max_total": &filter.MaxTotal,
+	}
+	for name, target := range totals {
+		if v := q.Get(name); v != "" {
+			amount, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return filter, errors.New("Invalid " + name)
+			}
+			*target = &amount
+		}
+	}
+
+	return filter, nil
+}
+
+// parseDateParam accepts either a YYYY-MM-DD date or an RFC3339 timestamp and
+// reports whether the value was a bare date.
+func parseDateParam(v string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
+
+// GetByID returns an order with its lines and shipment tracking. Customers
+// can only see their own orders.
 func (h *OrderHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownedOrder(w, r, true)
+	if !ok {
+		return
+	}
+
+	utils.JSONResponse(w, order, http.StatusOK)
+}
+
+// Invoice renders the order's sales invoice as PDF. Customers can only
+// download invoices of their own orders; admins can download any. The
+// invoice number is assigned on the first download.
+func (h *OrderHandler) Invoice(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.ownedOrder(w, r, true)
+	if !ok {
+		return
+	}
+
+	if order.Status == "draft" {
+		utils.ErrorResponse(w, "Draft orders have no invoice", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := h.invoiceRepo.IssueForOrder(order.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to issue invoice", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.WriteInvoice(&buf, order, inv, h.seller()); err != nil {
+		utils.ErrorResponse(w, "Failed to generate invoice", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="invoice-%d.pdf"`, inv.Number))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// PackingSlip renders the warehouse packing slip of an order as PDF.
+func (h *OrderHandler) PackingSlip(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
 	if err != nil {
 		utils.ErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
@@ -185,7 +691,57 @@ func (h *OrderHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.JSONResponse(w, order, http.StatusOK)
+	var buf bytes.Buffer
+	if err := invoice.WritePackingSlip(&buf, order, h.seller()); err != nil {
+		utils.ErrorResponse(w, "Failed to generate packing slip", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="packing-slip-%d.pdf"`, order.ID))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// ownedOrder loads the order in the {id} path value and checks that the
+// authenticated user owns it or, with admins set, is an admin. On failure
+// it writes the error response and returns false.
+func (h *OrderHandler) ownedOrder(w http.ResponseWriter, r *http.Request, admins bool) (*models.Order, bool) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	order, err := h.orderRepo.GetByID(uint(id))
+	if err != nil {
+		utils.ErrorResponse(w, "Order not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if order.UserID != claims.UserID && !(admins && isAdmin(h.db, claims.UserID)) {
+		// Don't reveal that someone else's order exists
+		utils.ErrorResponse(w, "Order not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return order, true
+}
+
+func (h *OrderHandler) seller() invoice.Seller {
+	return invoice.Seller{
+		Name:         h.cfg.SellerName,
+		Address:      h.cfg.SellerAddress,
+		Phone:        h.cfg.SellerPhone,
+		EconomicCode: h.cfg.SellerEconomicCode,
+		Currency:     h.cfg.InvoiceCurrency,
+	}
 }
 
 func (h *OrderHandler) Update(w http.ResponseWriter, r *http.Request) {
@@ -2,33 +2,79 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/aminasadiam/Kasra/imaging"
 	"github.com/aminasadiam/Kasra/models"
 	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/storage"
 	"github.com/aminasadiam/Kasra/utils"
 	"gorm.io/gorm"
 )
 
 type ProductHandler struct {
-	productRepo *repository.ProductRepository
-	db          *gorm.DB
+	productRepo   *repository.ProductRepository
+	backorderRepo *repository.BackorderRepository
+	specRepo      *repository.SpecRepository
+	variantRepo   *repository.VariantRepository
+	relationRepo  *repository.RelationRepository
+	alertRepo     *repository.StockAlertRepository
+	revisionRepo  *repository.RevisionRepository
+	store         storage.Storage
+	db            *gorm.DB
 }
 
-func NewProductHandler(db *gorm.DB) *ProductHandler {
+func NewProductHandler(db *gorm.DB, store storage.Storage) *ProductHandler {
 	return &ProductHandler{
-		productRepo: repository.NewProductRepository(db),
-		db:          db,
+		productRepo:   repository.NewProductRepository(db),
+		backorderRepo: repository.NewBackorderRepository(db),
+		specRepo:      repository.NewSpecRepository(db),
+		variantRepo:   repository.NewVariantRepository(db),
+		relationRepo:  repository.NewRelationRepository(db),
+		alertRepo:     repository.NewStockAlertRepository(db),
+		revisionRepo:  repository.NewRevisionRepository(db),
+		store:         store,
+		db:            db,
 	}
 }
 
+// snapshot takes a product's state before a change, to record the change
+// as a revision.
+func (h *ProductHandler) snapshot(w http.ResponseWriter, productID uint) (*models.ProductSnapshot, bool) {
+	before, err := h.revisionRepo.Snapshot(productID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+			return nil, false
+		}
+		utils.ErrorResponse(w, "Failed to fetch product", http.StatusInternalServerError)
+		return nil, false
+	}
+	return before, true
+}
+
+// validStockPolicy normalizes an empty policy to "deny" and reports whether
+// the value is known.
+func validStockPolicy(policy *string) bool {
+	switch *policy {
+	case "":
+		*policy = models.StockPolicyDeny
+		return true
+	case models.StockPolicyDeny, models.StockPolicyBackorder, models.StockPolicyPreorder:
+		return true
+	}
+	return false
+}
+
 // تابع کمکی برای گرفتن قیمت مناسب بر اساس گروه‌های کاربر
 func (h *ProductHandler) getProductPrice(productID uint, userGroupIDs []uint) float64 {
 	var price float64
@@ -111,11 +157,24 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	product := req.Product
 
+	if !validStockPolicy(&product.StockPolicy) {
+		utils.ErrorResponse(w, "stock_policy must be deny, backorder or preorder", http.StatusBadRequest)
+		return
+	}
+	// New products go through review before the storefront shows them
+	product.Status = models.ProductDraft
+	product.PublishAt = nil
+	product.UnpublishAt = nil
+
 	if err := h.productRepo.Create(&product); err != nil {
 		utils.ErrorResponse(w, "Failed to create product", http.StatusInternalServerError)
 		return
 	}
 
+	if err := h.productRepo.RefreshSearch(product.ID); err != nil {
+		log.Printf("failed to index product %d for search: %v", product.ID, err)
+	}
+
 	// اضافه کردن قیمت‌ها
 	for _, p := range req.Prices {
 		pp := models.ProductPrice{
@@ -160,97 +219,216 @@ func (h *ProductHandler) Create(w http.ResponseWriter, r *http.Request) {
 		h.db.Create(&productColor)
 	}
 
+	revise(h.revisionRepo, r, product.ID, models.RevisionCreate, nil)
 	utils.SuccessResponse(w, "Product created successfully", product, http.StatusCreated)
 }
 
+// GetAll lists the products visible to the user as slim items with facet
+// counts. Query parameters: categoryId, brandId (repeatable or
+// comma-separated), min_price, max_price, in_stock, material, power,
+// capacity, color, size (all repeatable or comma-separated) and search.
+// Paging: page and page_size, or cursor (the next_cursor of a previous
+// page). Sorting: sort=newest|name|price|popularity|rating|relevance, order=asc|desc.
 func (h *ProductHandler) GetAll(w http.ResponseWriter, r *http.Request) {
-	// خواندن پارامترهای فیلتری از query string
-	filters := make(map[string]interface{})
+	filter, err := h.parseProductFilter(r)
+	if err != nil {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	// دسته‌بندی
-	if categoryID := r.URL.Query().Get("categoryId"); categoryID != "" {
-		if id, err := strconv.ParseUint(categoryID, 10, 32); err == nil {
-			filters["categoryId"] = uint(id)
-		}
+	pagination := utils.ParsePagination(r)
+	opts := repository.ProductListOptions{
+		Sort:     r.URL.Query().Get("sort"),
+		Page:     pagination.Page,
+		PageSize: pagination.PageSize,
+		Cursor:   r.URL.Query().Get("cursor"),
+	}
+	switch r.URL.Query().Get("order") {
+	case "":
+	case "asc", "desc":
+		desc := r.URL.Query().Get("order") == "desc"
+		opts.Desc = &desc
+	default:
+		utils.ErrorResponse(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+	if claims, ok := utils.GetUserFromContext(r.Context()); ok {
+		opts.WithStock = isAdmin(h.db, claims.UserID)
 	}
 
-	// برند
-	if brandID := r.URL.Query().Get("brandId"); brandID != "" {
-		if id, err := strconv.ParseUint(brandID, 10, 32); err == nil {
-			filters["brandId"] = uint(id)
+	products, next, err := h.productRepo.List(filter, opts)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		utils.ErrorResponse(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, repository.ErrInvalidSort) {
+		utils.ErrorResponse(w, "sort must be newest, name, price, popularity, rating or relevance (with search)", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch products", http.StatusInternalServerError)
+		return
+	}
+
+	facets, err := h.productRepo.Facets(filter)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to count product facets", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(facets.Total)
+
+	w.Header().Set("X-Total-Count", strconv.FormatInt(facets.Total, 10))
+	utils.JSONResponse(w, map[string]interface{}{
+		"products":    products,
+		"facets":      facets,
+		"pagination":  pagination,
+		"next_cursor": next,
+	}, http.StatusOK)
+}
+
+// Suggest returns search-as-you-type completions for q across product
+// names, model numbers, SKUs, brands and categories, tolerating typos.
+// Only products the user may see are suggested. limit defaults to 10
+// (max 20).
+func (h *ProductHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if utf8.RuneCountInString(q) < 2 {
+		utils.JSONResponse(w, []repository.Suggestion{}, http.StatusOK)
+		return
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			utils.ErrorResponse(w, "Invalid limit", http.StatusBadRequest)
+			return
 		}
+		limit = min(n, 20)
 	}
 
-	// جستجو
-	if search := r.URL.Query().Get("search"); search != "" {
-		filters["search"] = search
+	filter, err := h.parseProductFilter(r)
+	if err != nil {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	var products []models.Product
-	if err := h.productRepo.GetAll(&products, filters); err != nil {
-		utils.ErrorResponse(w, "Failed to fetch products", http.StatusInternalServerError)
+	suggestions, err := h.productRepo.Suggest(filter, q, limit)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch suggestions", http.StatusInternalServerError)
 		return
 	}
+	utils.JSONResponse(w, suggestions, http.StatusOK)
+}
 
-	// Check if user is authenticated and get their roles/groups
-	claims, isAuthenticated := utils.GetUserFromContext(r.Context())
+// parseProductFilter reads the listing filters and scopes them to the
+// products the user may see.
+func (h *ProductHandler) parseProductFilter(r *http.Request) (repository.ProductFilter, error) {
+	q := r.URL.Query()
+	f, admin := productVisibility(h.db, r)
 
-	var isAdmin bool
-	var groupIDs []uint
+	// Admins list every status unless they ask for one
+	if v := q.Get("status"); v != "" && admin {
+		if !models.ValidProductStatus(v) {
+			return f, fmt.Errorf("invalid status")
+		}
+		f.Status = v
+	}
 
-	if isAuthenticated {
-		// Check if user is admin
-		var user models.User
-		if err := h.db.Preload("Roles").First(&user, claims.UserID).Error; err == nil {
-			for _, role := range user.Roles {
-				if role.Name == "admin" || role.Name == "administrator" {
-					isAdmin = true
-					break
-				}
-			}
+	// دسته‌بندی
+	if v := q.Get("categoryId"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return f, fmt.Errorf("invalid categoryId")
+		}
+		categoryID := uint(id)
+		f.CategoryID = &categoryID
+	}
+
+	// برندها
+	for _, v := range queryList(q, "brandId") {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return f, fmt.Errorf("invalid brandId")
 		}
+		f.BrandIDs = append(f.BrandIDs, uint(id))
+	}
 
-		// Get user's group IDs
-		if !isAdmin {
-			groupIDs = h.getUserGroupIDs(r)
+	// بازه قیمت
+	for key, dst := range map[string]**float64{"min_price": &f.MinPrice, "max_price": &f.MaxPrice} {
+		if v := q.Get(key); v != "" {
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", key)
+			}
+			*dst = &price
 		}
 	}
 
-	// Filter products based on authentication status
-	var filteredProducts []models.Product
+	f.InStock = q.Get("in_stock") == "true" || q.Get("in_stock") == "1"
+	f.Materials = queryList(q, "material")
+	f.Powers = queryList(q, "power")
+	f.Capacities = queryList(q, "capacity")
+	f.Colors = queryList(q, "color")
+	f.Sizes = queryList(q, "size")
+	f.Search = strings.TrimSpace(q.Get("search"))
 
-	if !isAuthenticated {
-		// Unauthenticated users see all products but with price = 0
-		filteredProducts = products
-		for i := range filteredProducts {
-			filteredProducts[i].Price = 0
+	// مشخصات فنی: spec.<key>=v1,v2 و spec.<key>.min / spec.<key>.max
+	var params []string
+	for param := range q {
+		if strings.HasPrefix(param, "spec.") {
+			params = append(params, param)
 		}
-	} else if isAdmin {
-		// Admins see all products
-		filteredProducts = products
-		for i := range filteredProducts {
-			filteredProducts[i].Price = 0
+	}
+	sort.Strings(params)
+	specs := map[string]*repository.SpecFilter{}
+	var order []string
+	for _, param := range params {
+		key, bound := strings.TrimPrefix(param, "spec."), ""
+		if k, ok := strings.CutSuffix(key, ".min"); ok {
+			key, bound = k, "min"
+		} else if k, ok := strings.CutSuffix(key, ".max"); ok {
+			key, bound = k, "max"
 		}
-	} else {
-		// Authenticated non-admin users see only products in their groups
-		for _, product := range products {
-			// Only show products that are in at least one of user's groups
-			for _, productGroup := range product.Groups {
-				for _, userGroupID := range groupIDs {
-					if productGroup.ID == userGroupID {
-						filteredProducts = append(filteredProducts, product)
-						break
-					}
-				}
-			}
+		if specs[key] == nil {
+			specs[key] = &repository.SpecFilter{Key: key}
+			order = append(order, key)
+		}
+		if bound == "" {
+			specs[key].Values = queryList(q, param)
+			continue
+		}
+		n, err := strconv.ParseFloat(q.Get(param), 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s", param)
 		}
-		// Set prices to 0 for all (removing price display from response)
-		for i := range filteredProducts {
-			filteredProducts[i].Price = 0
+		if bound == "min" {
+			specs[key].Min = &n
+		} else {
+			specs[key].Max = &n
 		}
 	}
+	for _, key := range order {
+		if spec := specs[key]; len(spec.Values) > 0 || spec.Min != nil || spec.Max != nil {
+			f.Specs = append(f.Specs, *spec)
+		}
+	}
+
+	return f, nil
+}
 
-	utils.JSONResponse(w, filteredProducts, http.StatusOK)
+// queryList returns the non-empty values of a repeatable query parameter,
+// also splitting comma-separated values.
+func queryList(q url.Values, key string) []string {
+	var values []string
+	for _, raw := range q[key] {
+		for _, v := range strings.Split(raw, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
 }
 
 func (h *ProductHandler) GetByID(w http.ResponseWriter, r *http.Request) {
@@ -261,13 +439,17 @@ func (h *ProductHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var product models.Product
-	if err := h.productRepo.GetByID(uint(id), &product); err != nil {
+	if err := h.productRepo.GetByID(uint(id), &product); err != nil || !canSee(h.db, r, &product) {
 		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
 		return
 	}
 
 	// Preload روابط لازم
 	h.db.Preload("Images").Preload("Sizes").Preload("Colors").Preload("Prices").Find(&product)
+	if err := h.specRepo.LoadSpecs(&product); err != nil {
+		utils.ErrorResponse(w, "Failed to fetch product specs", http.StatusInternalServerError)
+		return
+	}
 
 	// Check if user is authenticated
 	_, isAuthenticated := utils.GetUserFromContext(r.Context())
@@ -279,9 +461,160 @@ func (h *ProductHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		product.Price = 0 // Hide price for unauthenticated users
 	}
 
+	matrix, err := h.variantMatrix(r, product.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch product variants", http.StatusInternalServerError)
+		return
+	}
+	product.Options = matrix.Options
+	product.Variants = matrix.Variants
+
+	filter, admin := productVisibility(h.db, r)
+	related, err := h.relationRepo.Related([]uint{product.ID}, filter, admin, nil)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch related products", http.StatusInternalServerError)
+		return
+	}
+	if len(related) > 0 {
+		product.Relations = map[string][]models.RelatedProduct{}
+		for _, rp := range related {
+			product.Relations[rp.Type] = append(product.Relations[rp.Type], rp)
+		}
+	}
+
 	utils.JSONResponse(w, product, http.StatusOK)
 }
 
+// Relations returns the products related to a product that the user may
+// see, in position order. Query: type (repeatable or comma-separated).
+func (h *ProductHandler) Relations(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	var product models.Product
+	if err := h.db.Select("id", "status", "is_active").First(&product, id).Error; err != nil || !canSee(h.db, r, &product) {
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	types := queryList(r.URL.Query(), "type")
+	for _, t := range types {
+		if !models.ValidRelationType(t) {
+			utils.ErrorResponse(w, repository.ErrInvalidRelationType.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter, admin := productVisibility(h.db, r)
+	related, err := h.relationRepo.Related([]uint{uint(id)}, filter, admin, types)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch related products", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, related, http.StatusOK)
+}
+
+// Compatible finds the products with a model number and the spare parts and
+// accessories for them, both limited to what the user may see. Query:
+// model (required), type=spare_part|accessory (repeatable or
+// comma-separated, default both).
+func (h *ProductHandler) Compatible(w http.ResponseWriter, r *http.Request) {
+	model := strings.TrimSpace(r.URL.Query().Get("model"))
+	if model == "" {
+		utils.ErrorResponse(w, "model is required", http.StatusBadRequest)
+		return
+	}
+	types := queryList(r.URL.Query(), "type")
+	for _, t := range types {
+		if t != models.RelationSparePart && t != models.RelationAccessory {
+			utils.ErrorResponse(w, "type must be spare_part or accessory", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(types) == 0 {
+		types = []string{models.RelationSparePart, models.RelationAccessory}
+	}
+
+	filter, admin := productVisibility(h.db, r)
+	matches, parts, err := h.relationRepo.Compatible(model, filter, admin, types)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch compatible products", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, map[string]interface{}{
+		"model":    model,
+		"products": matches,
+		"parts":    parts,
+	}, http.StatusOK)
+}
+
+// Compare lines up two to four products attribute by attribute and marks
+// the attributes whose values differ. Query: ids (repeatable or
+// comma-separated). Prices are included for signed-in users and stock for
+// admins; products the user may not see are not found.
+func (h *ProductHandler) Compare(w http.ResponseWriter, r *http.Request) {
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, v := range queryList(r.URL.Query(), "ids") {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+			return
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	if len(ids) < 2 || len(ids) > 4 {
+		utils.ErrorResponse(w, "Compare two to four products", http.StatusBadRequest)
+		return
+	}
+
+	filter, admin := productVisibility(h.db, r)
+	comparison, err := h.productRepo.Compare(ids, filter, admin)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to compare products", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, comparison, http.StatusOK)
+}
+
+// Variants returns the variant matrix of a product: its options and every
+// variant with its option values, stock, images and the user's price.
+func (h *ProductHandler) Variants(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	var product models.Product
+	if err := h.db.Select("id", "status", "is_active").First(&product, id).Error; err != nil || !canSee(h.db, r, &product) {
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	matrix, err := h.variantMatrix(r, uint(id))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch product variants", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, matrix, http.StatusOK)
+}
+
+// variantMatrix loads a product's variants priced for the user: anonymous
+// users get no prices, admins also get the per-group overrides.
+func (h *ProductHandler) variantMatrix(r *http.Request, productID uint) (*repository.VariantMatrix, error) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	admin := ok && isAdmin(h.db, claims.UserID)
+	return h.variantRepo.Matrix(productID, h.getUserGroupIDs(r), ok, admin)
+}
+
 func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
 	if err != nil {
@@ -324,11 +657,30 @@ func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !validStockPolicy(&req.StockPolicy) {
+		utils.ErrorResponse(w, "stock_policy must be deny, backorder or preorder", http.StatusBadRequest)
+		return
+	}
+	before, ok := h.snapshot(w, product.ID)
+	if !ok {
+		return
+	}
+	previousStock := product.Stock
+	previousCategory := product.CategoryID
+
 	// به‌روزرسانی فیلدهای اصلی
+	hasVariants, err := h.variantRepo.HasVariants(product.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to update product", http.StatusInternalServerError)
+		return
+	}
+
 	product.Name = req.Name
 	product.Description = req.Description
 	product.SKU = req.SKU
-	product.Stock = req.Stock
+	if !hasVariants { // otherwise the sum of the variants' stock
+		product.Stock = req.Stock
+	}
 	product.ModelNumber = req.ModelNumber
 	product.Warranty = req.Warranty
 	product.Weight = req.Weight
@@ -340,12 +692,37 @@ func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 	product.IsActive = req.IsActive
 	product.CategoryID = req.CategoryID
 	product.BrandID = req.BrandID
+	product.StockPolicy = req.StockPolicy
+	product.AvailableAt = req.AvailableAt
+	product.BackorderLimit = req.BackorderLimit
 
 	if err := h.productRepo.Update(&product); err != nil {
 		utils.ErrorResponse(w, "Failed to update product", http.StatusInternalServerError)
 		return
 	}
 
+	if err := h.productRepo.RefreshSearch(product.ID); err != nil {
+		log.Printf("failed to index product %d for search: %v", product.ID, err)
+	}
+
+	// Specs of the old category's schema no longer apply
+	if (previousCategory == nil) != (product.CategoryID == nil) ||
+		(previousCategory != nil && *previousCategory != *product.CategoryID) {
+		if err := h.specRepo.Prune(product.ID); err != nil {
+			log.Printf("failed to prune specs of product %d: %v", product.ID, err)
+		}
+	}
+
+	// New stock goes to waiting back-orders first, then to stock alerts
+	if product.Stock > previousStock {
+		if _, err := h.backorderRepo.Allocate(product.ID); err != nil {
+			log.Printf("back-order allocation for product %d failed: %v", product.ID, err)
+		}
+		if _, err := h.alertRepo.Restocked(product.ID); err != nil {
+			log.Printf("stock alerts for product %d failed: %v", product.ID, err)
+		}
+	}
+
 	// مدیریت روابط (برای سادگی، حذف قبلی و اضافه جدید - یا منطق بهتر)
 	// برای مثال، برای prices:
 	h.db.Where("product_id = ?", product.ID).Delete(&models.ProductPrice{})
@@ -360,9 +737,87 @@ func (h *ProductHandler) Update(w http.ResponseWriter, r *http.Request) {
 
 	// مشابه برای images, sizes, colors اگر لازم
 
+	revise(h.revisionRepo, r, product.ID, models.RevisionUpdate, before)
 	utils.SuccessResponse(w, "Product updated successfully", product, http.StatusOK)
 }
 
+// ReceiveStock adds incoming units to a product's stock and allocates them to
+// waiting back-orders in FIFO order. Users waiting for what is left in stock
+// are notified. Expects JSON { "quantity": <n> }, with
+// "variant_id" for products with variants.
+func (h *ProductHandler) ReceiveStock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Quantity  int   `json:"quantity"`
+		VariantID *uint `json:"variant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Quantity <= 0 {
+		utils.ErrorResponse(w, "Quantity must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	if body.VariantID != nil {
+		variant, err := h.variantRepo.GetVariant(*body.VariantID)
+		if err != nil || variant.ProductID != uint(id) {
+			utils.ErrorResponse(w, "Variant not found", http.StatusNotFound)
+			return
+		}
+		if _, err := h.variantRepo.AddStock(variant.ID, body.Quantity); err != nil {
+			utils.ErrorResponse(w, "Failed to update stock", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		hasVariants, err := h.variantRepo.HasVariants(uint(id))
+		if err != nil {
+			utils.ErrorResponse(w, "Failed to update stock", http.StatusInternalServerError)
+			return
+		}
+		if hasVariants {
+			utils.ErrorResponse(w, "variant_id is required for products with variants", http.StatusBadRequest)
+			return
+		}
+		result := h.db.Model(&models.Product{}).Where("id = ?", id).
+			Update("stock", gorm.Expr("stock + ?", body.Quantity))
+		if result.Error != nil {
+			utils.ErrorResponse(w, "Failed to update stock", http.StatusInternalServerError)
+			return
+		}
+		if result.RowsAffected == 0 {
+			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	allocations, err := h.backorderRepo.Allocate(uint(id))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to allocate back-orders", http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.alertRepo.Restocked(uint(id)); err != nil {
+		log.Printf("stock alerts for product %d failed: %v", id, err)
+	}
+
+	var product models.Product
+	if err := h.db.First(&product, id).Error; err != nil {
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	utils.SuccessResponse(w, "Stock received", map[string]interface{}{
+		"stock":       product.Stock,
+		"allocations": allocations,
+	}, http.StatusOK)
+}
+
 // endpoint جدید: اضافه کردن قیمت به محصول
 func (h *ProductHandler) AddPrice(w http.ResponseWriter, r *http.Request) {
 	productIDStr := r.PathValue("id")
@@ -383,11 +838,16 @@ func (h *ProductHandler) AddPrice(w http.ResponseWriter, r *http.Request) {
 		utils.ErrorResponse(w, "Price must be greater than 0", http.StatusBadRequest)
 		return
 	}
+	before, ok := h.snapshot(w, pp.ProductID)
+	if !ok {
+		return
+	}
 
 	if err := h.db.Create(&pp).Error; err != nil {
 		utils.ErrorResponse(w, "Failed to add price", http.StatusInternalServerError)
 		return
 	}
+	revise(h.revisionRepo, r, pp.ProductID, models.RevisionPrices, before)
 
 	utils.JSONResponse(w, pp, http.StatusCreated)
 }
@@ -404,51 +864,59 @@ func (h *ProductHandler) UploadImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, header, err := r.FormFile("image")
+	file, _, err := r.FormFile("image")
 	if err != nil {
 		utils.ErrorResponse(w, "image file is required", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
-	uploadDir := "./uploads/products"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		utils.ErrorResponse(w, "Failed to create upload dir", http.StatusInternalServerError)
-		return
+	// Optional: the image shows one variant of the product
+	var variantID *uint
+	if v := r.FormValue("variant_id"); v != "" {
+		vid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			utils.ErrorResponse(w, "Invalid variant ID", http.StatusBadRequest)
+			return
+		}
+		variant, err := h.variantRepo.GetVariant(uint(vid))
+		if err != nil || variant.ProductID != uint(productID) {
+			utils.ErrorResponse(w, "Variant not found", http.StatusNotFound)
+			return
+		}
+		variantID = &variant.ID
 	}
 
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("product_%d_%d%s", productID, time.Now().UnixNano(), ext)
-	outPath := filepath.Join(uploadDir, filename)
-
-	outFile, err := os.Create(outPath)
-	if err != nil {
-		utils.ErrorResponse(w, "Failed to create file", http.StatusInternalServerError)
+	before, ok := h.snapshot(w, uint(productID))
+	if !ok {
 		return
 	}
-	defer outFile.Close()
 
-	if _, err := io.Copy(outFile, file); err != nil {
-		utils.ErrorResponse(w, "Failed to save file", http.StatusInternalServerError)
+	// Validated, resized and re-encoded, which also strips EXIF data
+	name := fmt.Sprintf("product_%d_%d", productID, time.Now().UnixNano())
+	renditions, ok := saveImageRenditions(w, r, h.store, file, "products/", name, imaging.ProductSizes)
+	if !ok {
 		return
 	}
 
-	imageURL := "https://mehrsepehr.com/api/assets/products/" + filename
 	isPrimary := r.FormValue("is_primary") == "true"
 	order, _ := strconv.Atoi(r.FormValue("order"))
 
 	productImage := models.ProductImage{
 		ProductID: uint(productID),
-		URL:       imageURL,
 		Alt:       r.FormValue("alt"),
 		IsPrimary: isPrimary,
 		Order:     order,
+		VariantID: variantID,
 	}
+	productImage.SetRenditions(renditions)
 
 	if err := h.db.Create(&productImage).Error; err != nil {
+		removeImageFiles(r.Context(), h.store, productImage.URL, renditions)
 		utils.ErrorResponse(w, "Failed to save image record", http.StatusInternalServerError)
 		return
 	}
+	revise(h.revisionRepo, r, productImage.ProductID, models.RevisionImages, before)
 
 	utils.SuccessResponse(w, "Image uploaded successfully", productImage, http.StatusCreated)
 }
@@ -468,27 +936,18 @@ func (h *ProductHandler) DeleteImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract filename from URL
-	url := productImage.URL
-	parts := strings.Split(url, "/")
-	if len(parts) == 0 {
-		utils.ErrorResponse(w, "Invalid image URL", http.StatusBadRequest)
+	before, ok := h.snapshot(w, productImage.ProductID)
+	if !ok {
 		return
 	}
-	filename := parts[len(parts)-1]
-
-	// Delete the file from disk
-	filePath := filepath.Join("./uploads/products", filename)
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
-		// Log the error but continue with DB deletion
-		fmt.Printf("Warning: Failed to delete image file %s: %v\n", filePath, err)
-	}
 
-	// Delete from database
+	// The files are left to the upload collector, which keeps them for its
+	// grace period so the deletion can be reverted
 	if err := h.db.Delete(&productImage).Error; err != nil {
 		utils.ErrorResponse(w, "Failed to delete image record", http.StatusInternalServerError)
 		return
 	}
+	revise(h.revisionRepo, r, productImage.ProductID, models.RevisionImages, before)
 
 	utils.SuccessResponse(w, "Image deleted successfully", nil, http.StatusOK)
 }
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type PublishingHandler struct {
+	publishingRepo *repository.PublishingRepository
+}
+
+func NewPublishingHandler(db *gorm.DB) *PublishingHandler {
+	return &PublishingHandler{publishingRepo: repository.NewPublishingRepository(db)}
+}
+
+// Submit sends a draft for review.
+func (h *PublishingHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ProductDraft, models.ProductInReview, "Product submitted for review")
+}
+
+// Publish shows a product in review in the storefront.
+func (h *PublishingHandler) Publish(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ProductInReview, models.ProductPublished, "Product published")
+}
+
+// Reject sends a product in review back to draft.
+func (h *PublishingHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ProductInReview, models.ProductDraft, "Product sent back to draft")
+}
+
+// Archive takes a product out of the workflow, and out of the storefront
+// if it was published.
+func (h *PublishingHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "", models.ProductArchived, "Product archived")
+}
+
+// Unarchive brings an archived product back as a draft.
+func (h *PublishingHandler) Unarchive(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, models.ProductArchived, models.ProductDraft, "Product restored as draft")
+}
+
+// Schedule sets when a product is published and unpublished. Expects JSON
+// { "publish_at": "2026-01-01T08:00:00Z", "unpublish_at": null }; null or
+// a missing time clears it.
+func (h *PublishingHandler) Schedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		PublishAt   *time.Time `json:"publish_at"`
+		UnpublishAt *time.Time `json:"unpublish_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.publishingRepo.Schedule(uint(id), req.PublishAt, req.UnpublishAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrInvalidSchedule):
+			utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrPublishNotInReview), errors.Is(err, repository.ErrUnpublishStatus):
+			utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+		default:
+			utils.ErrorResponse(w, "Failed to schedule product", http.StatusInternalServerError)
+		}
+		return
+	}
+	utils.SuccessResponse(w, "Product schedule updated", publishingState(product), http.StatusOK)
+}
+
+// transition moves the product in the path to status; when from is set the
+// product must be in that status.
+func (h *PublishingHandler) transition(w http.ResponseWriter, r *http.Request, from, status, message string) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.publishingRepo.Transition(uint(id), from, status)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrInvalidProductStatus):
+			utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+		default:
+			utils.ErrorResponse(w, "Failed to update product status", http.StatusInternalServerError)
+		}
+		return
+	}
+	utils.SuccessResponse(w, message, publishingState(product), http.StatusOK)
+}
+
+// publishingState is the part of a product the publishing endpoints change.
+func publishingState(product *models.Product) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           product.ID,
+		"status":       product.Status,
+		"publish_at":   product.PublishAt,
+		"unpublish_at": product.UnpublishAt,
+	}
+}
@@ -0,0 +1,437 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+// maxQAText is the longest question or answer accepted, in characters.
+const maxQAText = 2000
+
+type QuestionHandler struct {
+	questionRepo     *repository.QuestionRepository
+	productRepo      *repository.ProductRepository
+	notificationRepo *repository.NotificationRepository
+	db               *gorm.DB
+}
+
+func NewQuestionHandler(db *gorm.DB) *QuestionHandler {
+	return &QuestionHandler{
+		questionRepo:     repository.NewQuestionRepository(db),
+		productRepo:      repository.NewProductRepository(db),
+		notificationRepo: repository.NewNotificationRepository(db),
+		db:               db,
+	}
+}
+
+// List returns a page of a product's approved questions with their approved
+// answers. Query: q (search within the questions and answers), page,
+// page_size.
+func (h *QuestionHandler) List(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.db.Select("id").First(&models.Product{}, productID).Error; err != nil {
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	pagination := utils.ParsePagination(r)
+	questions, total, err := h.questionRepo.List(uint(productID), r.URL.Query().Get("q"), pagination)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch questions", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"questions":  questions,
+		"pagination": pagination,
+	}, http.StatusOK)
+}
+
+// Mine returns the user's own questions in any status.
+func (h *QuestionHandler) Mine(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	questions, err := h.questionRepo.ListByUser(claims.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch questions", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, questions, http.StatusOK)
+}
+
+// decodeQAText reads {"body": "..."} and checks its length.
+func decodeQAText(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		utils.ErrorResponse(w, "body is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len([]rune(body)) > maxQAText {
+		utils.ErrorResponse(w, fmt.Sprintf("body must be at most %d characters", maxQAText), http.StatusBadRequest)
+		return "", false
+	}
+	return body, true
+}
+
+// Create asks a question about a product. It is shown once an admin
+// approves it. Body: {"body": "..."}
+func (h *QuestionHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.db.Select("id").First(&models.Product{}, productID).Error; err != nil {
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	body, ok := decodeQAText(w, r)
+	if !ok {
+		return
+	}
+
+	question := models.ProductQuestion{ProductID: uint(productID), UserID: claims.UserID, Body: body}
+	if err := h.questionRepo.Create(&question); err != nil {
+		utils.ErrorResponse(w, "Failed to create question", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Question submitted for moderation", question, http.StatusCreated)
+}
+
+// Delete removes a question and its answers. Askers may delete their own
+// questions, admins any.
+func (h *QuestionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	question, ok := h.question(w, r)
+	if !ok {
+		return
+	}
+	if question.UserID != claims.UserID && !isAdmin(h.db, claims.UserID) {
+		utils.ErrorResponse(w, "Question not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.questionRepo.Delete(question); err != nil {
+		utils.ErrorResponse(w, "Failed to delete question", http.StatusInternalServerError)
+		return
+	}
+	h.reindex(question.ProductID)
+	utils.SuccessResponse(w, "Question deleted successfully", nil, http.StatusOK)
+}
+
+// Answer answers an approved question. Admins' answers are published right
+// away; customers who bought the product are moderated first.
+// Body: {"body": "..."}
+func (h *QuestionHandler) Answer(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	question, ok := h.question(w, r)
+	if !ok {
+		return
+	}
+
+	body, ok := decodeQAText(w, r)
+	if !ok {
+		return
+	}
+
+	answer := models.ProductAnswer{
+		UserID:  claims.UserID,
+		IsStaff: isAdmin(h.db, claims.UserID),
+		Body:    body,
+	}
+	if err := h.questionRepo.CreateAnswer(question, &answer); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotVerifiedBuyer):
+			utils.ErrorResponse(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, repository.ErrQuestionClosed):
+			utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+		default:
+			utils.ErrorResponse(w, "Failed to create answer", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if answer.Status == models.QAStatusApproved {
+		h.answered(question, &answer)
+		utils.SuccessResponse(w, "Answer published", answer, http.StatusCreated)
+		return
+	}
+	utils.SuccessResponse(w, "Answer submitted for moderation", answer, http.StatusCreated)
+}
+
+// DeleteAnswer removes an answer. Authors may delete their own answers,
+// admins any.
+func (h *QuestionHandler) DeleteAnswer(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	answer, ok := h.answer(w, r)
+	if !ok {
+		return
+	}
+	if answer.UserID != claims.UserID && !isAdmin(h.db, claims.UserID) {
+		utils.ErrorResponse(w, "Answer not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.questionRepo.DeleteAnswer(answer); err != nil {
+		utils.ErrorResponse(w, "Failed to delete answer", http.StatusInternalServerError)
+		return
+	}
+	if answer.Question != nil {
+		h.reindex(answer.Question.ProductID)
+	}
+	utils.SuccessResponse(w, "Answer deleted successfully", nil, http.StatusOK)
+}
+
+// GetAll lists questions for moderation, oldest first. Query: status,
+// page, page_size.
+func (h *QuestionHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	status, ok := qaStatusFilter(w, r)
+	if !ok {
+		return
+	}
+	pagination := utils.ParsePagination(r)
+	questions, total, err := h.questionRepo.ListForModeration(status, pagination)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch questions", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"questions":  questions,
+		"pagination": pagination,
+	}, http.StatusOK)
+}
+
+// GetAllAnswers lists answers for moderation, oldest first. Query: status,
+// page, page_size.
+func (h *QuestionHandler) GetAllAnswers(w http.ResponseWriter, r *http.Request) {
+	status, ok := qaStatusFilter(w, r)
+	if !ok {
+		return
+	}
+	pagination := utils.ParsePagination(r)
+	answers, total, err := h.questionRepo.ListAnswersForModeration(status, pagination)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch answers", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"answers":    answers,
+		"pagination": pagination,
+	}, http.StatusOK)
+}
+
+func qaStatusFilter(w http.ResponseWriter, r *http.Request) (string, bool) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.QAStatusPending, models.QAStatusApproved, models.QAStatusRejected:
+		return status, true
+	}
+	utils.ErrorResponse(w, "Invalid status", http.StatusBadRequest)
+	return "", false
+}
+
+// Approve publishes a question.
+func (h *QuestionHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, models.QAStatusApproved, "Question approved")
+}
+
+// Reject hides a question. Body (optional): {"note": "..."}, shown to the
+// asker.
+func (h *QuestionHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, models.QAStatusRejected, "Question rejected")
+}
+
+func (h *QuestionHandler) moderate(w http.ResponseWriter, r *http.Request, status, message string) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	question, ok := h.question(w, r)
+	if !ok {
+		return
+	}
+	note, ok := decodeModerationNote(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.questionRepo.Moderate(question, status, note, claims.UserID); err != nil {
+		utils.ErrorResponse(w, "Failed to moderate question", http.StatusInternalServerError)
+		return
+	}
+	h.reindex(question.ProductID)
+	utils.SuccessResponse(w, message, question, http.StatusOK)
+}
+
+// ApproveAnswer publishes an answer and notifies the asker.
+func (h *QuestionHandler) ApproveAnswer(w http.ResponseWriter, r *http.Request) {
+	h.moderateAnswer(w, r, models.QAStatusApproved, "Answer approved")
+}
+
+// RejectAnswer hides an answer. Body (optional): {"note": "..."}, shown to
+// its author.
+func (h *QuestionHandler) RejectAnswer(w http.ResponseWriter, r *http.Request) {
+	h.moderateAnswer(w, r, models.QAStatusRejected, "Answer rejected")
+}
+
+func (h *QuestionHandler) moderateAnswer(w http.ResponseWriter, r *http.Request, status, message string) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	answer, ok := h.answer(w, r)
+	if !ok {
+		return
+	}
+	if answer.Question == nil {
+		utils.ErrorResponse(w, "Question not found", http.StatusNotFound)
+		return
+	}
+	note, ok := decodeModerationNote(w, r)
+	if !ok {
+		return
+	}
+
+	wasApproved := answer.Status == models.QAStatusApproved
+	if err := h.questionRepo.ModerateAnswer(answer, status, note, claims.UserID); err != nil {
+		utils.ErrorResponse(w, "Failed to moderate answer", http.StatusInternalServerError)
+		return
+	}
+	if status == models.QAStatusApproved && !wasApproved {
+		h.answered(answer.Question, answer)
+	} else {
+		h.reindex(answer.Question.ProductID)
+	}
+	utils.SuccessResponse(w, message, answer, http.StatusOK)
+}
+
+func decodeModerationNote(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return "", false
+		}
+	}
+	return strings.TrimSpace(req.Note), true
+}
+
+// answered indexes a newly published answer and tells the asker about it.
+func (h *QuestionHandler) answered(question *models.ProductQuestion, answer *models.ProductAnswer) {
+	h.reindex(question.ProductID)
+	if answer.UserID == question.UserID {
+		return
+	}
+
+	body := []rune(answer.Body)
+	if len(body) > 200 {
+		body = append(body[:200], '…')
+	}
+	notification := models.Notification{
+		UserID: question.UserID,
+		Type:   models.NotificationQuestionAnswered,
+		Title:  "Your question was answered",
+		Body:   string(body),
+		Link:   fmt.Sprintf("/products/%d#question-%d", question.ProductID, question.ID),
+	}
+	if err := h.notificationRepo.Create(&notification); err != nil {
+		log.Printf("failed to notify user %d of answer %d: %v", question.UserID, answer.ID, err)
+	}
+}
+
+// reindex refreshes the product's search index after its Q&A changed.
+func (h *QuestionHandler) reindex(productID uint) {
+	if err := h.productRepo.RefreshSearch(productID); err != nil {
+		log.Printf("failed to index product %d for search: %v", productID, err)
+	}
+}
+
+// question loads the question in the path.
+func (h *QuestionHandler) question(w http.ResponseWriter, r *http.Request) (*models.ProductQuestion, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid question ID", http.StatusBadRequest)
+		return nil, false
+	}
+	question, err := h.questionRepo.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Question not found", http.StatusNotFound)
+			return nil, false
+		}
+		utils.ErrorResponse(w, "Failed to fetch question", http.StatusInternalServerError)
+		return nil, false
+	}
+	return question, true
+}
+
+// answer loads the answer in the path with its question.
+func (h *QuestionHandler) answer(w http.ResponseWriter, r *http.Request) (*models.ProductAnswer, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid answer ID", http.StatusBadRequest)
+		return nil, false
+	}
+	answer, err := h.questionRepo.GetAnswer(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Answer not found", http.StatusNotFound)
+			return nil, false
+		}
+		utils.ErrorResponse(w, "Failed to fetch answer", http.StatusInternalServerError)
+		return nil, false
+	}
+	return answer, true
+}
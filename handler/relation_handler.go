@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type RelationHandler struct {
+	relationRepo *repository.RelationRepository
+}
+
+func NewRelationHandler(db *gorm.DB) *RelationHandler {
+	return &RelationHandler{relationRepo: repository.NewRelationRepository(db)}
+}
+
+// Create relates another product to the product in the path.
+// Body: {"related_id": 12, "type": "spare_part", "note": "...", "position": 0}
+// With "reciprocal": true a "related" relation is also added the other way.
+func (h *RelationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		RelatedID  uint   `json:"related_id"`
+		Type       string `json:"type"`
+		Note       string `json:"note"`
+		Position   int    `json:"position"`
+		Reciprocal bool   `json:"reciprocal"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Reciprocal && req.Type != models.RelationRelated {
+		utils.ErrorResponse(w, "Only related relations can be reciprocal", http.StatusBadRequest)
+		return
+	}
+
+	relation := models.ProductRelation{
+		ProductID: uint(productID),
+		RelatedID: req.RelatedID,
+		Type:      req.Type,
+		Note:      strings.TrimSpace(req.Note),
+		Position:  req.Position,
+	}
+	if err := h.relationRepo.Create(&relation); err != nil {
+		writeRelationError(w, err)
+		return
+	}
+	if req.Reciprocal {
+		reverse := models.ProductRelation{
+			ProductID: relation.RelatedID,
+			RelatedID: relation.ProductID,
+			Type:      relation.Type,
+			Note:      relation.Note,
+			Position:  relation.Position,
+		}
+		if err := h.relationRepo.Create(&reverse); err != nil && !errors.Is(err, repository.ErrRelationExists) {
+			writeRelationError(w, err)
+			return
+		}
+	}
+	utils.SuccessResponse(w, "Relation created successfully", relation, http.StatusCreated)
+}
+
+// Update changes a relation's note and position.
+// Body: {"note": "...", "position": 1}
+func (h *RelationHandler) Update(w http.ResponseWriter, r *http.Request) {
+	relation, ok := h.relation(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Note     *string `json:"note"`
+		Position *int    `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Note != nil {
+		relation.Note = strings.TrimSpace(*req.Note)
+	}
+	if req.Position != nil {
+		relation.Position = *req.Position
+	}
+
+	if err := h.relationRepo.Update(relation); err != nil {
+		utils.ErrorResponse(w, "Failed to update relation", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Relation updated successfully", relation, http.StatusOK)
+}
+
+func (h *RelationHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	relation, ok := h.relation(w, r)
+	if !ok {
+		return
+	}
+	if err := h.relationRepo.Delete(relation.ID); err != nil {
+		utils.ErrorResponse(w, "Failed to delete relation", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Relation deleted successfully", nil, http.StatusOK)
+}
+
+func (h *RelationHandler) relation(w http.ResponseWriter, r *http.Request) (*models.ProductRelation, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid relation ID", http.StatusBadRequest)
+		return nil, false
+	}
+	relation, err := h.relationRepo.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Relation not found", http.StatusNotFound)
+			return nil, false
+		}
+		utils.ErrorResponse(w, "Failed to fetch relation", http.StatusInternalServerError)
+		return nil, false
+	}
+	return relation, true
+}
+
+func writeRelationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInvalidRelationType), errors.Is(err, repository.ErrSelfRelation):
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrRelationExists):
+		utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+	default:
+		utils.ErrorResponse(w, "Failed to create relation", http.StatusInternalServerError)
+	}
+}
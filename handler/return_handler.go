@@ -0,0 +1,424 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aminasadiam/Kasra/config"
+	"github.com/aminasadiam/Kasra/imaging"
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/storage"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type ReturnHandler struct {
+	returnRepo    *repository.ReturnRepository
+	orderRepo     *repository.OrderRepository
+	backorderRepo *repository.BackorderRepository
+	alertRepo     *repository.StockAlertRepository
+	store         storage.Storage
+	cfg           *config.Configuration
+	db            *gorm.DB
+}
+
+func NewReturnHandler(db *gorm.DB, store storage.Storage, cfg *config.Configuration) *ReturnHandler {
+	return &ReturnHandler{
+		returnRepo:    repository.NewReturnRepository(db),
+		orderRepo:     repository.NewOrderRepository(db),
+		backorderRepo: repository.NewBackorderRepository(db),
+		alertRepo:     repository.NewStockAlertRepository(db),
+		store:         store,
+		cfg:           cfg,
+		db:            db,
+	}
+}
+
+// ReturnPhotosDir is where return photos are stored. With signed URLs
+// enabled they are private and only reachable through signed URLs.
+const ReturnPhotosDir = "returns/"
+
+// signPhotos swaps the stored photo URLs for signed ones when return photos
+// are private. Call it only on copies about to be written to the response.
+func (h *ReturnHandler) signPhotos(rmas ...*models.ReturnRequest) {
+	if !h.cfg.SignedURLs {
+		return
+	}
+	for _, rma := range rmas {
+		for i := range rma.Photos {
+			h.signPhoto(&rma.Photos[i])
+		}
+	}
+}
+
+func (h *ReturnHandler) signPhoto(photo *models.ReturnPhoto) {
+	if !h.cfg.SignedURLs {
+		return
+	}
+	key, ok := storage.Key(h.store, photo.URL)
+	if !ok {
+		return
+	}
+	signed, err := h.store.SignedURL(key, h.cfg.SignedURLTTL)
+	if err != nil {
+		log.Printf("failed to sign return photo %d: %v", photo.ID, err)
+		return
+	}
+	photo.URL = signed
+}
+
+// Create opens a return request for lines of one of the user's orders.
+// Body: {"reason": "...", "note": "...", "items": [{"order_detail_id": 1, "quantity": 1}]}
+func (h *ReturnHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	orderID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+		Note   string `json:"note"`
+		Items  []struct {
+			OrderDetailID uint `json:"order_detail_id"`
+			Quantity      int  `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		utils.ErrorResponse(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		utils.ErrorResponse(w, "At least one item is required", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderRepo.GetByID(uint(orderID))
+	if err != nil || order.UserID != claims.UserID {
+		utils.ErrorResponse(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if order.Status == "draft" || order.Status == "cancelled" {
+		utils.ErrorResponse(w, "Only placed orders can be returned", http.StatusConflict)
+		return
+	}
+
+	rma := models.ReturnRequest{
+		OrderID: order.ID,
+		UserID:  claims.UserID,
+		Reason:  strings.TrimSpace(req.Reason),
+		Note:    req.Note,
+	}
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			utils.ErrorResponse(w, "Quantity must be greater than zero", http.StatusBadRequest)
+			return
+		}
+		rma.Items = append(rma.Items, models.ReturnItem{OrderDetailID: item.OrderDetailID, Quantity: item.Quantity})
+	}
+
+	if err := h.returnRepo.Create(&rma); err != nil {
+		if errors.Is(err, repository.ErrUnknownOrderLine) || errors.Is(err, repository.ErrReturnQuantity) {
+			utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to create return request", http.StatusInternalServerError)
+		return
+	}
+
+	created, err := h.returnRepo.GetByID(rma.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch return request", http.StatusInternalServerError)
+		return
+	}
+	h.signPhotos(created)
+	utils.SuccessResponse(w, "Return request created", created, http.StatusCreated)
+}
+
+// GetAllForUser lists the authenticated user's return requests.
+func (h *ReturnHandler) GetAllForUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	rmas, err := h.returnRepo.GetByUserID(claims.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch return requests", http.StatusInternalServerError)
+		return
+	}
+	for i := range rmas {
+		h.signPhotos(&rmas[i])
+	}
+	utils.JSONResponse(w, rmas, http.StatusOK)
+}
+
+// GetAll lists all return requests for admins. Optional query parameter: status.
+func (h *ReturnHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	rmas, err := h.returnRepo.GetAll(r.URL.Query().Get("status"))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch return requests", http.StatusInternalServerError)
+		return
+	}
+	for i := range rmas {
+		h.signPhotos(&rmas[i])
+	}
+	utils.JSONResponse(w, rmas, http.StatusOK)
+}
+
+func (h *ReturnHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	rma, ok := h.ownedReturn(w, r)
+	if !ok {
+		return
+	}
+	h.signPhotos(rma)
+	utils.JSONResponse(w, rma, http.StatusOK)
+}
+
+// Cancel withdraws a return request that has not been received yet.
+func (h *ReturnHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	rma, ok := h.ownedReturn(w, r)
+	if !ok {
+		return
+	}
+	claims, _ := utils.GetUserFromContext(r.Context())
+
+	if err := h.returnRepo.Transition(rma, models.ReturnStatusCancelled, "", "", claims.UserID); err != nil {
+		writeReturnError(w, err, "Failed to cancel return request")
+		return
+	}
+	h.signPhotos(rma)
+	utils.SuccessResponse(w, "Return request cancelled", rma, http.StatusOK)
+}
+
+// UploadPhoto attaches a photo of the goods to a return request.
+func (h *ReturnHandler) UploadPhoto(w http.ResponseWriter, r *http.Request) {
+	rma, ok := h.ownedReturn(w, r)
+	if !ok {
+		return
+	}
+	if rma.Status != models.ReturnStatusRequested && rma.Status != models.ReturnStatusApproved {
+		utils.ErrorResponse(w, "Photos can no longer be added to this return", http.StatusConflict)
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		utils.ErrorResponse(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		utils.ErrorResponse(w, "photo file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageSize+1))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to read photo", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxImageSize {
+		utils.ErrorResponse(w, "photo is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	// The photo is stored as uploaded, named after its actual format
+	if _, ok := decodeImage(w, data); !ok {
+		return
+	}
+	ext := "." + imaging.Sniff(data)
+	if ext == ".jpeg" {
+		ext = ".jpg"
+	}
+
+	key := fmt.Sprintf("%sreturn_%d_%d%s", ReturnPhotosDir, rma.ID, time.Now().UnixNano(), ext)
+	if err := h.store.Put(r.Context(), key, data, mime.TypeByExtension(ext)); err != nil {
+		log.Printf("failed to store return photo %s: %v", key, err)
+		utils.ErrorResponse(w, "Failed to save file", http.StatusInternalServerError)
+		return
+	}
+
+	photo := models.ReturnPhoto{
+		ReturnRequestID: rma.ID,
+		URL:             h.store.URL(key),
+	}
+	if err := h.returnRepo.AddPhoto(&photo); err != nil {
+		h.store.Delete(r.Context(), key)
+		utils.ErrorResponse(w, "Failed to save photo record", http.StatusInternalServerError)
+		return
+	}
+	h.signPhoto(&photo)
+	utils.SuccessResponse(w, "Photo uploaded successfully", photo, http.StatusCreated)
+}
+
+// Approve accepts a return request. Body (optional): {"note": "..."}
+func (h *ReturnHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, models.ReturnStatusApproved, "Return request approved")
+}
+
+// Reject declines a return request. Body (optional): {"note": "..."}
+func (h *ReturnHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, models.ReturnStatusRejected, "Return request rejected")
+}
+
+func (h *ReturnHandler) decide(w http.ResponseWriter, r *http.Request, to, message string) {
+	claims, _ := utils.GetUserFromContext(r.Context())
+	rma, ok := h.adminReturn(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.returnRepo.Transition(rma, to, req.Note, req.Note, claims.UserID); err != nil {
+		writeReturnError(w, err, "Failed to update return request")
+		return
+	}
+	h.signPhotos(rma)
+	utils.SuccessResponse(w, message, rma, http.StatusOK)
+}
+
+// Receive records the returned goods and settles the request.
+// Body: {"items": [{"return_item_id": 1, "received_quantity": 1, "disposition": "restock"}],
+// "resolution": "refund" | "credit_note", "note": "..."}
+// Items left out of the body are treated as not received.
+func (h *ReturnHandler) Receive(w http.ResponseWriter, r *http.Request) {
+	claims, _ := utils.GetUserFromContext(r.Context())
+	rma, ok := h.adminReturn(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Items []struct {
+			ReturnItemID     uint   `json:"return_item_id"`
+			ReceivedQuantity int    `json:"received_quantity"`
+			Disposition      string `json:"disposition"`
+		} `json:"items"`
+		Resolution string `json:"resolution"`
+		Note       string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Resolution != "refund" && req.Resolution != "credit_note" {
+		utils.ErrorResponse(w, "Resolution must be refund or credit_note", http.StatusBadRequest)
+		return
+	}
+
+	items := make([]repository.ReceivedItem, 0, len(req.Items))
+	for _, item := range req.Items {
+		if item.Disposition != models.ReturnDispositionRestock && item.Disposition != models.ReturnDispositionWriteOff {
+			utils.ErrorResponse(w, "Disposition must be restock or write_off", http.StatusBadRequest)
+			return
+		}
+		items = append(items, repository.ReceivedItem{
+			ReturnItemID: item.ReturnItemID,
+			Quantity:     item.ReceivedQuantity,
+			Disposition:  item.Disposition,
+		})
+	}
+
+	restocked, err := h.returnRepo.Receive(rma, items, req.Resolution, req.Note, claims.UserID)
+	if err != nil {
+		writeReturnError(w, err, "Failed to receive return")
+		return
+	}
+
+	// Restocked goods may fill waiting back-orders, then stock alerts
+	for _, productID := range restocked {
+		if _, err := h.backorderRepo.Allocate(productID); err != nil {
+			log.Printf("back-order allocation for product %d failed: %v", productID, err)
+		}
+		if _, err := h.alertRepo.Restocked(productID); err != nil {
+			log.Printf("stock alerts for product %d failed: %v", productID, err)
+		}
+	}
+
+	updated, err := h.returnRepo.GetByID(rma.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch return request", http.StatusInternalServerError)
+		return
+	}
+	h.signPhotos(updated)
+	utils.SuccessResponse(w, "Return received", updated, http.StatusOK)
+}
+
+// ownedReturn loads the return request in the path for its owner or an admin.
+func (h *ReturnHandler) ownedReturn(w http.ResponseWriter, r *http.Request) (*models.ReturnRequest, bool) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	rma, ok := h.adminReturn(w, r)
+	if !ok {
+		return nil, false
+	}
+	if rma.UserID != claims.UserID && !isAdmin(h.db, claims.UserID) {
+		utils.ErrorResponse(w, "Return request not found", http.StatusNotFound)
+		return nil, false
+	}
+	return rma, true
+}
+
+// adminReturn loads the return request in the path without an owner check.
+func (h *ReturnHandler) adminReturn(w http.ResponseWriter, r *http.Request) (*models.ReturnRequest, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid return request ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	rma, err := h.returnRepo.GetByID(uint(id))
+	if err != nil {
+		utils.ErrorResponse(w, "Return request not found", http.StatusNotFound)
+		return nil, false
+	}
+	return rma, true
+}
+
+func writeReturnError(w http.ResponseWriter, err error, fallback string) {
+	if errors.Is(err, repository.ErrInvalidTransition) {
+		utils.ErrorResponse(w, "Return request cannot move to that status", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, repository.ErrUnknownReturnItem) ||
+		errors.Is(err, repository.ErrReceivedQuantity) ||
+		errors.Is(err, repository.ErrNoWalletForRefund) {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	utils.ErrorResponse(w, fallback, http.StatusInternalServerError)
+}
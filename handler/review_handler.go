@@ -0,0 +1,451 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aminasadiam/Kasra/imaging"
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/storage"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+// maxReviewPhotos is how many photos one review may have.
+const maxReviewPhotos = 5
+
+type ReviewHandler struct {
+	reviewRepo *repository.ReviewRepository
+	store      storage.Storage
+	db         *gorm.DB
+}
+
+func NewReviewHandler(db *gorm.DB, store storage.Storage) *ReviewHandler {
+	return &ReviewHandler{
+		reviewRepo: repository.NewReviewRepository(db),
+		store:      store,
+		db:         db,
+	}
+}
+
+// List returns a page of a product's approved reviews with the rating
+// summary. Query: sort (helpful, newest, rating_high, rating_low), rating,
+// page, page_size. Signed-in users also get their own votes.
+func (h *ReviewHandler) List(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.db.Select("id").First(&models.Product{}, productID).Error; err != nil {
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var rating int
+	if v := r.URL.Query().Get("rating"); v != "" {
+		rating, err = strconv.Atoi(v)
+		if err != nil || rating < 1 || rating > 5 {
+			utils.ErrorResponse(w, repository.ErrInvalidRating.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pagination := utils.ParsePagination(r)
+	reviews, total, err := h.reviewRepo.List(uint(productID), rating, r.URL.Query().Get("sort"), pagination)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidSort) {
+			utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	summary, err := h.reviewRepo.Summary(uint(productID))
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to summarize reviews", http.StatusInternalServerError)
+		return
+	}
+
+	if claims, ok := utils.GetUserFromContext(r.Context()); ok {
+		ids := make([]uint, len(reviews))
+		for i, review := range reviews {
+			ids[i] = review.ID
+		}
+		votes, err := h.reviewRepo.UserVotes(claims.UserID, ids)
+		if err != nil {
+			utils.ErrorResponse(w, "Failed to fetch votes", http.StatusInternalServerError)
+			return
+		}
+		for i := range reviews {
+			if helpful, ok := votes[reviews[i].ID]; ok {
+				reviews[i].MyVote = &helpful
+			}
+		}
+	}
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"reviews":    reviews,
+		"summary":    summary,
+		"pagination": pagination,
+	}, http.StatusOK)
+}
+
+// Mine returns the user's own reviews in any status.
+func (h *ReviewHandler) Mine(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	reviews, err := h.reviewRepo.ListByUser(claims.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, reviews, http.StatusOK)
+}
+
+type reviewRequest struct {
+	Rating int    `json:"rating"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+func (req *reviewRequest) decode(w http.ResponseWriter, r *http.Request) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	req.Title = strings.TrimSpace(req.Title)
+	req.Body = strings.TrimSpace(req.Body)
+	if len([]rune(req.Title)) > 200 {
+		utils.ErrorResponse(w, "Title must be at most 200 characters", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// Create submits a review of a product the user bought. It is shown once
+// an admin approves it.
+// Body: {"rating": 5, "title": "...", "body": "..."}
+func (h *ReviewHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	if err := h.db.Select("id").First(&models.Product{}, productID).Error; err != nil {
+		utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var req reviewRequest
+	if !req.decode(w, r) {
+		return
+	}
+
+	review := models.Review{
+		ProductID: uint(productID),
+		UserID:    claims.UserID,
+		Rating:    req.Rating,
+		Title:     req.Title,
+		Body:      req.Body,
+	}
+	if err := h.reviewRepo.Create(&review); err != nil {
+		writeReviewError(w, err, "Failed to create review")
+		return
+	}
+	utils.SuccessResponse(w, "Review submitted for moderation", review, http.StatusCreated)
+}
+
+// Update lets the author change their review, which sends it back to
+// moderation. Body: {"rating": 4, "title": "...", "body": "..."}
+func (h *ReviewHandler) Update(w http.ResponseWriter, r *http.Request) {
+	review, ok := h.authoredReview(w, r)
+	if !ok {
+		return
+	}
+
+	var req reviewRequest
+	if !req.decode(w, r) {
+		return
+	}
+	review.Rating, review.Title, review.Body = req.Rating, req.Title, req.Body
+
+	if err := h.reviewRepo.Update(review); err != nil {
+		writeReviewError(w, err, "Failed to update review")
+		return
+	}
+	utils.SuccessResponse(w, "Review submitted for moderation", review, http.StatusOK)
+}
+
+// Delete removes a review and its photos. Authors may delete their own
+// reviews, admins any.
+func (h *ReviewHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	review, ok := h.review(w, r)
+	if !ok {
+		return
+	}
+	if review.UserID != claims.UserID && !isAdmin(h.db, claims.UserID) {
+		utils.ErrorResponse(w, "Review not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.reviewRepo.Delete(review); err != nil {
+		utils.ErrorResponse(w, "Failed to delete review", http.StatusInternalServerError)
+		return
+	}
+	for _, photo := range review.Photos {
+		removeImageFiles(r.Context(), h.store, photo.URL, photo.Renditions)
+	}
+	utils.SuccessResponse(w, "Review deleted successfully", nil, http.StatusOK)
+}
+
+// UploadPhoto attaches a photo to the author's review and sends it back to
+// moderation.
+func (h *ReviewHandler) UploadPhoto(w http.ResponseWriter, r *http.Request) {
+	review, ok := h.authoredReview(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := h.reviewRepo.CountPhotos(review.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to count photos", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxReviewPhotos {
+		utils.ErrorResponse(w, fmt.Sprintf("A review can have at most %d photos", maxReviewPhotos), http.StatusConflict)
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		utils.ErrorResponse(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		utils.ErrorResponse(w, "photo file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Validated, resized and re-encoded, which also strips EXIF data
+	// such as the location the photo was taken at
+	name := fmt.Sprintf("review_%d_%d", review.ID, time.Now().UnixNano())
+	renditions, ok := saveImageRenditions(w, r, h.store, file, "reviews/", name, imaging.ReviewSizes)
+	if !ok {
+		return
+	}
+
+	photo := models.ReviewPhoto{
+		ReviewID:   review.ID,
+		URL:        renditions[len(renditions)-1].URL,
+		Renditions: renditions,
+	}
+	if err := h.reviewRepo.AddPhoto(&photo); err != nil {
+		removeImageFiles(r.Context(), h.store, photo.URL, renditions)
+		utils.ErrorResponse(w, "Failed to save photo record", http.StatusInternalServerError)
+		return
+	}
+
+	// A new photo needs moderating like new text
+	if review.Status != models.ReviewStatusPending {
+		if err := h.reviewRepo.Update(review); err != nil {
+			log.Printf("failed to send review %d back to moderation: %v", review.ID, err)
+		}
+	}
+	utils.SuccessResponse(w, "Photo uploaded successfully", photo, http.StatusCreated)
+}
+
+// Vote records whether the user found a review helpful; voting again
+// changes the vote. Body: {"helpful": true}
+func (h *ReviewHandler) Vote(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	review, ok := h.approvedReview(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Helpful *bool `json:"helpful"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Helpful == nil {
+		utils.ErrorResponse(w, "helpful is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.reviewRepo.Vote(review, claims.UserID, *req.Helpful); err != nil {
+		writeReviewError(w, err, "Failed to record vote")
+		return
+	}
+	review.MyVote = req.Helpful
+	utils.SuccessResponse(w, "Vote recorded", review, http.StatusOK)
+}
+
+// Unvote withdraws the user's vote on a review.
+func (h *ReviewHandler) Unvote(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	review, ok := h.approvedReview(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.reviewRepo.Unvote(review, claims.UserID); err != nil {
+		utils.ErrorResponse(w, "Failed to withdraw vote", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Vote withdrawn", review, http.StatusOK)
+}
+
+// GetAll lists reviews for moderation, oldest first. Query: status,
+// page, page_size.
+func (h *ReviewHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.ReviewStatusPending, models.ReviewStatusApproved, models.ReviewStatusRejected:
+	default:
+		utils.ErrorResponse(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	pagination := utils.ParsePagination(r)
+	reviews, total, err := h.reviewRepo.ListForModeration(status, pagination)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch reviews", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"reviews":    reviews,
+		"pagination": pagination,
+	}, http.StatusOK)
+}
+
+// Approve publishes a review and counts it in the product's rating.
+func (h *ReviewHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, models.ReviewStatusApproved, "Review approved")
+}
+
+// Reject hides a review. Body (optional): {"note": "..."}, shown to the
+// author.
+func (h *ReviewHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.moderate(w, r, models.ReviewStatusRejected, "Review rejected")
+}
+
+func (h *ReviewHandler) moderate(w http.ResponseWriter, r *http.Request, status, message string) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	review, ok := h.review(w, r)
+	if !ok {
+		return
+	}
+
+	note, ok := decodeModerationNote(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.reviewRepo.Moderate(review, status, note, claims.UserID); err != nil {
+		utils.ErrorResponse(w, "Failed to moderate review", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, message, review, http.StatusOK)
+}
+
+// review loads the review in the path.
+func (h *ReviewHandler) review(w http.ResponseWriter, r *http.Request) (*models.Review, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid review ID", http.StatusBadRequest)
+		return nil, false
+	}
+	review, err := h.reviewRepo.GetByID(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Review not found", http.StatusNotFound)
+			return nil, false
+		}
+		utils.ErrorResponse(w, "Failed to fetch review", http.StatusInternalServerError)
+		return nil, false
+	}
+	return review, true
+}
+
+// authoredReview loads the review in the path if the user wrote it.
+func (h *ReviewHandler) authoredReview(w http.ResponseWriter, r *http.Request) (*models.Review, bool) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	review, ok := h.review(w, r)
+	if !ok {
+		return nil, false
+	}
+	if review.UserID != claims.UserID {
+		utils.ErrorResponse(w, "Review not found", http.StatusNotFound)
+		return nil, false
+	}
+	return review, true
+}
+
+// approvedReview loads the review in the path if it is published.
+func (h *ReviewHandler) approvedReview(w http.ResponseWriter, r *http.Request) (*models.Review, bool) {
+	review, ok := h.review(w, r)
+	if !ok {
+		return nil, false
+	}
+	if review.Status != models.ReviewStatusApproved {
+		utils.ErrorResponse(w, "Review not found", http.StatusNotFound)
+		return nil, false
+	}
+	return review, true
+}
+
+func writeReviewError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, repository.ErrInvalidRating):
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrNotPurchased), errors.Is(err, repository.ErrOwnReview):
+		utils.ErrorResponse(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, repository.ErrAlreadyReviewed):
+		utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+	default:
+		utils.ErrorResponse(w, fallback, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aminasadiam/Kasra/config"
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type RevisionHandler struct {
+	revisionRepo *repository.RevisionRepository
+	productRepo  *repository.ProductRepository
+	specRepo     *repository.SpecRepository
+	cfg          *config.Configuration
+}
+
+func NewRevisionHandler(db *gorm.DB, cfg *config.Configuration) *RevisionHandler {
+	return &RevisionHandler{
+		revisionRepo: repository.NewRevisionRepository(db),
+		productRepo:  repository.NewProductRepository(db),
+		specRepo:     repository.NewSpecRepository(db),
+		cfg:          cfg,
+	}
+}
+
+// revise records the change made to a product since before (nil for new
+// products) as a revision by the user. The change is already saved, so
+// failures are only logged.
+func revise(repo *repository.RevisionRepository, r *http.Request, productID uint, action string, before *models.ProductSnapshot) {
+	var userID *uint
+	if claims, ok := utils.GetUserFromContext(r.Context()); ok {
+		userID = &claims.UserID
+	}
+	if _, err := repo.Record(productID, userID, action, before); err != nil {
+		log.Printf("failed to record revision of product %d: %v", productID, err)
+	}
+}
+
+// List returns a page of a product's revisions, newest first, with their
+// changes but not their snapshots.
+func (h *RevisionHandler) List(w http.ResponseWriter, r *http.Request) {
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	pagination := utils.ParsePagination(r)
+	revisions, total, err := h.revisionRepo.List(uint(productID), pagination)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch revisions", http.StatusInternalServerError)
+		return
+	}
+	pagination.SetTotal(total)
+
+	utils.JSONResponse(w, map[string]interface{}{
+		"revisions":  revisions,
+		"pagination": pagination,
+	}, http.StatusOK)
+}
+
+// Get returns a revision with the full snapshot of the product.
+func (h *RevisionHandler) Get(w http.ResponseWriter, r *http.Request) {
+	productID, revisionID, ok := revisionPath(w, r)
+	if !ok {
+		return
+	}
+	revision, err := h.revisionRepo.GetByID(productID, revisionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Revision not found", http.StatusNotFound)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to fetch revision", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, revision, http.StatusOK)
+}
+
+// Revert restores a product to a revision, recorded as a new revision.
+// Responds with that revision and the field paths that could not be
+// restored (see RevisionRepository.Revert).
+func (h *RevisionHandler) Revert(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	productID, revisionID, ok := revisionPath(w, r)
+	if !ok {
+		return
+	}
+
+	// Deleted images can come back while the upload collector keeps their files
+	var imagesSince time.Time
+	if h.cfg.UploadGCDelete {
+		imagesSince = time.Now().Add(-h.cfg.UploadGCGrace)
+	}
+	revision, skipped, err := h.revisionRepo.Revert(productID, revisionID, &claims.UserID, imagesSince)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(w, "Revision not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrRevertSKUTaken):
+			utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+		default:
+			utils.ErrorResponse(w, "Failed to revert product", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := h.productRepo.RefreshSearch(productID); err != nil {
+		log.Printf("failed to index product %d for search: %v", productID, err)
+	}
+	// Specs of the old category's schema no longer apply
+	for _, change := range revision.Changes {
+		if change.Field == "category_id" {
+			if err := h.specRepo.Prune(productID); err != nil {
+				log.Printf("failed to prune specs of product %d: %v", productID, err)
+			}
+		}
+	}
+
+	utils.SuccessResponse(w, "Product reverted", map[string]interface{}{
+		"revision": revision,
+		"skipped":  skipped,
+	}, http.StatusOK)
+}
+
+// revisionPath reads the product and revision IDs in the path.
+func revisionPath(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	revisionID, err := strconv.ParseUint(r.PathValue("revisionId"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid revision ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return uint(productID), uint(revisionID), true
+}
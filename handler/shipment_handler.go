@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type ShipmentHandler struct {
+	shipmentRepo *repository.ShipmentRepository
+	orderRepo    *repository.OrderRepository
+	db           *gorm.DB
+}
+
+func NewShipmentHandler(db *gorm.DB) *ShipmentHandler {
+	return &ShipmentHandler{
+		shipmentRepo: repository.NewShipmentRepository(db),
+		orderRepo:    repository.NewOrderRepository(db),
+		db:           db,
+	}
+}
+
+// GetByOrder lists the shipments of an order with their tracking details.
+// Customers can only see their own orders.
+func (h *ShipmentHandler) GetByOrder(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderRepo.GetByID(uint(id))
+	if err != nil || (order.UserID != claims.UserID && !isAdmin(h.db, claims.UserID)) {
+		utils.ErrorResponse(w, "Order not found", http.StatusNotFound)
+		return
+	}
+
+	shipments, err := h.shipmentRepo.GetByOrderID(order.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch shipments", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, shipments, http.StatusOK)
+}
+
+// Create ships some or all of an order's lines.
+// Body: {"carrier": "...", "tracking_number": "...", "tracking_url": "...", "note": "...",
+// "shipped_at": "2024-01-02T15:04:05Z", "items": [{"order_detail_id": 1, "quantity": 1}]}
+// Without items every unit still waiting to ship is included.
+func (h *ShipmentHandler) Create(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Carrier        string     `json:"carrier"`
+		TrackingNumber string     `json:"tracking_number"`
+		TrackingURL    string     `json:"tracking_url"`
+		Note           string     `json:"note"`
+		ShippedAt      *time.Time `json:"shipped_at"`
+		Items          []struct {
+			OrderDetailID uint `json:"order_detail_id"`
+			Quantity      int  `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Carrier) == "" {
+		utils.ErrorResponse(w, "Carrier is required", http.StatusBadRequest)
+		return
+	}
+
+	order, err := h.orderRepo.GetByID(uint(id))
+	if err != nil {
+		utils.ErrorResponse(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if order.Status == "draft" || order.Status == "cancelled" {
+		utils.ErrorResponse(w, "Draft and cancelled orders cannot be shipped", http.StatusConflict)
+		return
+	}
+
+	shipment := models.Shipment{
+		OrderID:        order.ID,
+		Carrier:        strings.TrimSpace(req.Carrier),
+		TrackingNumber: strings.TrimSpace(req.TrackingNumber),
+		TrackingURL:    req.TrackingURL,
+		Note:           req.Note,
+		ShippedAt:      req.ShippedAt,
+	}
+	for _, item := range req.Items {
+		shipment.Items = append(shipment.Items, models.ShipmentItem{OrderDetailID: item.OrderDetailID, Quantity: item.Quantity})
+	}
+
+	if err := h.shipmentRepo.Create(&shipment); err != nil {
+		writeShipmentError(w, err, "Failed to create shipment")
+		return
+	}
+
+	created, err := h.shipmentRepo.GetByID(shipment.ID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch shipment", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Shipment created", created, http.StatusCreated)
+}
+
+// Update changes the carrier and tracking details of a shipment.
+func (h *ShipmentHandler) Update(w http.ResponseWriter, r *http.Request) {
+	shipment, ok := h.shipment(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Carrier        *string `json:"carrier"`
+		TrackingNumber *string `json:"tracking_number"`
+		TrackingURL    *string `json:"tracking_url"`
+		Note           *string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Carrier != nil {
+		if strings.TrimSpace(*req.Carrier) == "" {
+			utils.ErrorResponse(w, "Carrier is required", http.StatusBadRequest)
+			return
+		}
+		shipment.Carrier = strings.TrimSpace(*req.Carrier)
+	}
+	if req.TrackingNumber != nil {
+		shipment.TrackingNumber = strings.TrimSpace(*req.TrackingNumber)
+	}
+	if req.TrackingURL != nil {
+		shipment.TrackingURL = *req.TrackingURL
+	}
+	if req.Note != nil {
+		shipment.Note = *req.Note
+	}
+
+	if err := h.shipmentRepo.Update(shipment); err != nil {
+		utils.ErrorResponse(w, "Failed to update shipment", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Shipment updated", shipment, http.StatusOK)
+}
+
+// Deliver marks a shipment as delivered. Body (optional): {"delivered_at": "..."}
+func (h *ShipmentHandler) Deliver(w http.ResponseWriter, r *http.Request) {
+	shipment, ok := h.shipment(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		DeliveredAt *time.Time `json:"delivered_at"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	at := time.Now()
+	if req.DeliveredAt != nil {
+		at = *req.DeliveredAt
+	}
+
+	if err := h.shipmentRepo.MarkDelivered(shipment, at); err != nil {
+		utils.ErrorResponse(w, "Failed to update shipment", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Shipment delivered", shipment, http.StatusOK)
+}
+
+func (h *ShipmentHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	shipment, ok := h.shipment(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.shipmentRepo.Delete(shipment); err != nil {
+		utils.ErrorResponse(w, "Failed to delete shipment", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Shipment deleted", nil, http.StatusOK)
+}
+
+func (h *ShipmentHandler) shipment(w http.ResponseWriter, r *http.Request) (*models.Shipment, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid shipment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	shipment, err := h.shipmentRepo.GetByID(uint(id))
+	if err != nil {
+		utils.ErrorResponse(w, "Shipment not found", http.StatusNotFound)
+		return nil, false
+	}
+	return shipment, true
+}
+
+func writeShipmentError(w http.ResponseWriter, err error, fallback string) {
+	if errors.Is(err, repository.ErrUnknownOrderLine) ||
+		errors.Is(err, repository.ErrOverShipment) ||
+		errors.Is(err, repository.ErrNothingToShip) {
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	utils.ErrorResponse(w, fallback, http.StatusInternalServerError)
+}
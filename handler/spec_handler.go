@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type SpecHandler struct {
+	specRepo *repository.SpecRepository
+}
+
+func NewSpecHandler(db *gorm.DB) *SpecHandler {
+	return &SpecHandler{
+		specRepo: repository.NewSpecRepository(db),
+	}
+}
+
+// Schema returns the spec attributes of a category, inherited ones first.
+func (h *SpecHandler) Schema(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	attributes, err := h.specRepo.Schema(uint(id))
+	if err != nil {
+		writeSpecError(w, err, "Failed to fetch spec schema")
+		return
+	}
+	utils.JSONResponse(w, attributes, http.StatusOK)
+}
+
+// CreateAttribute adds an attribute to a category's spec schema.
+func (h *SpecHandler) CreateAttribute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	var attribute models.SpecAttribute
+	if err := json.NewDecoder(r.Body).Decode(&attribute); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.specRepo.CreateAttribute(uint(id), &attribute); err != nil {
+		writeSpecError(w, err, "Failed to create spec attribute")
+		return
+	}
+	utils.SuccessResponse(w, "Spec attribute created successfully", attribute, http.StatusCreated)
+}
+
+// UpdateAttribute changes a spec attribute; its key and category are fixed.
+func (h *SpecHandler) UpdateAttribute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid spec attribute ID", http.StatusBadRequest)
+		return
+	}
+
+	var changes models.SpecAttribute
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	attribute, err := h.specRepo.UpdateAttribute(uint(id), changes)
+	if err != nil {
+		writeSpecError(w, err, "Failed to update spec attribute")
+		return
+	}
+	utils.SuccessResponse(w, "Spec attribute updated successfully", attribute, http.StatusOK)
+}
+
+// DeleteAttribute removes a spec attribute with all product values for it.
+func (h *SpecHandler) DeleteAttribute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid spec attribute ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.specRepo.DeleteAttribute(uint(id)); err != nil {
+		writeSpecError(w, err, "Failed to delete spec attribute")
+		return
+	}
+	utils.SuccessResponse(w, "Spec attribute deleted successfully", nil, http.StatusOK)
+}
+
+// SetProductSpecs replaces a product's spec values. Expects a JSON object
+// of spec key to value, validated against the category's schema.
+func (h *SpecHandler) SetProductSpecs(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var values map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	specs, err := h.specRepo.SetProductSpecs(uint(id), values)
+	if err != nil {
+		writeSpecError(w, err, "Failed to save product specs")
+		return
+	}
+	utils.SuccessResponse(w, "Product specs updated successfully", specs, http.StatusOK)
+}
+
+// MigrateLegacy copies the legacy spec fields of the products under a
+// category into spec values.
+func (h *SpecHandler) MigrateLegacy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.specRepo.MigrateLegacy(uint(id))
+	if err != nil {
+		writeSpecError(w, err, "Failed to migrate legacy specs")
+		return
+	}
+	utils.SuccessResponse(w, "Legacy specs migrated", report, http.StatusOK)
+}
+
+// writeSpecError maps spec repository errors to responses.
+func writeSpecError(w http.ResponseWriter, err error, fallback string) {
+	var specErrs repository.SpecErrors
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.ErrorResponse(w, "Not found", http.StatusNotFound)
+	case errors.As(err, &specErrs),
+		errors.Is(err, repository.ErrInvalidSpecAttribute),
+		errors.Is(err, repository.ErrNoCategory):
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrSpecKeyTaken), errors.Is(err, repository.ErrSpecInUse):
+		utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+	default:
+		utils.ErrorResponse(w, fallback, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+type StockAlertHandler struct {
+	alertRepo *repository.StockAlertRepository
+	db        *gorm.DB
+}
+
+func NewStockAlertHandler(db *gorm.DB) *StockAlertHandler {
+	return &StockAlertHandler{
+		alertRepo: repository.NewStockAlertRepository(db),
+		db:        db,
+	}
+}
+
+// Subscribe asks for a notification when the out-of-stock product in the
+// path is back in stock. Optional body: {"variant_id": 40}
+func (h *StockAlertHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	productID, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		VariantID *uint `json:"variant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	alert := models.StockAlert{UserID: claims.UserID, ProductID: uint(productID), VariantID: req.VariantID}
+	filter, _ := productVisibility(h.db, r)
+	if err := h.alertRepo.Subscribe(&alert, filter); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrInStock):
+			utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, repository.ErrVariantMismatch):
+			utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		default:
+			utils.ErrorResponse(w, "Failed to create stock alert", http.StatusInternalServerError)
+		}
+		return
+	}
+	utils.SuccessResponse(w, "You will be notified when the product is back in stock", alert, http.StatusOK)
+}
+
+// List returns the user's stock alerts, both waiting and sent.
+func (h *StockAlertHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	alerts, err := h.alertRepo.ListByUser(claims.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch stock alerts", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, alerts, http.StatusOK)
+}
+
+// Delete cancels one of the user's stock alerts.
+func (h *StockAlertHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid stock alert ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.alertRepo.Delete(uint(id), claims.UserID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Stock alert not found", http.StatusNotFound)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to delete stock alert", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Stock alert deleted successfully", nil, http.StatusOK)
+}
@@ -4,23 +4,23 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"time"
 
 	"strings"
 
+	"github.com/aminasadiam/Kasra/imaging"
 	"github.com/aminasadiam/Kasra/models"
 	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/storage"
 	"github.com/aminasadiam/Kasra/utils"
 	"gorm.io/gorm"
 )
 
 type UserHandler struct {
 	userRepo *repository.UserRepository
+	store    storage.Storage
 }
 
 // UploadAvatar allows a user to upload their own avatar image.
@@ -39,56 +39,7 @@ func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse form
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		utils.ErrorResponse(w, "Invalid multipart form", http.StatusBadRequest)
-		return
-	}
-
-	file, header, err := r.FormFile("avatar")
-	if err != nil {
-		utils.ErrorResponse(w, "avatar file is required", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	// Create uploads dir if not exists
-	uploadDir := "./uploads/avatars"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		utils.ErrorResponse(w, "Failed to create upload dir", http.StatusInternalServerError)
-		return
-	}
-
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("avatar_%d_%d%s", id, time.Now().Unix(), ext)
-	outPath := filepath.Join(uploadDir, filename)
-
-	outFile, err := os.Create(outPath)
-	if err != nil {
-		utils.ErrorResponse(w, "Failed to create file", http.StatusInternalServerError)
-		return
-	}
-	defer outFile.Close()
-
-	if _, err := io.Copy(outFile, file); err != nil {
-		utils.ErrorResponse(w, "Failed to save file", http.StatusInternalServerError)
-		return
-	}
-
-	// Update user record with avatar path
-	existing, err := h.userRepo.GetByID(uint(id))
-	if err != nil {
-		utils.ErrorResponse(w, "User not found", http.StatusNotFound)
-		return
-	}
-	// Use HTTPS through nginx proxy
-	existing.Avatar = "https://mehrsepehr.com/api/assets/avatar/" + filename
-	if err := h.userRepo.Update(existing); err != nil {
-		utils.ErrorResponse(w, "Failed to update user avatar", http.StatusInternalServerError)
-		return
-	}
-
-	utils.SuccessResponse(w, "Avatar uploaded", map[string]string{"avatar": existing.Avatar}, http.StatusOK)
+	h.saveAvatar(w, r, uint(id))
 }
 
 // AdminUploadAvatar allows an admin to upload avatar for any user.
@@ -99,58 +50,54 @@ func (h *UserHandler) AdminUploadAvatar(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	h.saveAvatar(w, r, uint(id))
+}
+
+// saveAvatar stores the uploaded "avatar" image, resized and stripped of
+// metadata, as the user's avatar.
+func (h *UserHandler) saveAvatar(w http.ResponseWriter, r *http.Request, id uint) {
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		utils.ErrorResponse(w, "Invalid multipart form", http.StatusBadRequest)
 		return
 	}
 
-	file, header, err := r.FormFile("avatar")
+	file, _, err := r.FormFile("avatar")
 	if err != nil {
 		utils.ErrorResponse(w, "avatar file is required", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
-	uploadDir := "./uploads/avatars"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		utils.ErrorResponse(w, "Failed to create upload dir", http.StatusInternalServerError)
-		return
-	}
-
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("avatar_%d_%d%s", id, time.Now().Unix(), ext)
-	outPath := filepath.Join(uploadDir, filename)
-
-	outFile, err := os.Create(outPath)
+	existing, err := h.userRepo.GetByID(id)
 	if err != nil {
-		utils.ErrorResponse(w, "Failed to create file", http.StatusInternalServerError)
+		utils.ErrorResponse(w, "User not found", http.StatusNotFound)
 		return
 	}
-	defer outFile.Close()
 
-	if _, err := io.Copy(outFile, file); err != nil {
-		utils.ErrorResponse(w, "Failed to save file", http.StatusInternalServerError)
+	name := fmt.Sprintf("avatar_%d_%d", id, time.Now().Unix())
+	renditions, ok := saveImageRenditions(w, r, h.store, file, "avatars/", name, imaging.AvatarSizes)
+	if !ok {
 		return
 	}
 
-	existing, err := h.userRepo.GetByID(uint(id))
-	if err != nil {
-		utils.ErrorResponse(w, "User not found", http.StatusNotFound)
-		return
-	}
-	// Use HTTPS through nginx proxy
-	existing.Avatar = "https://mehrsepehr.com/api/assets/avatar/" + filename
+	existing.Avatar = renditions[len(renditions)-1].URL
 	if err := h.userRepo.Update(existing); err != nil {
+		removeImageFiles(r.Context(), h.store, existing.Avatar, renditions)
 		utils.ErrorResponse(w, "Failed to update user avatar", http.StatusInternalServerError)
 		return
 	}
 
-	utils.SuccessResponse(w, "Avatar uploaded", map[string]string{"avatar": existing.Avatar}, http.StatusOK)
+	utils.SuccessResponse(w, "Avatar uploaded", map[string]any{
+		"avatar":     existing.Avatar,
+		"renditions": renditions,
+		"srcset":     models.Srcset(renditions, false),
+	}, http.StatusOK)
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
+func NewUserHandler(db *gorm.DB, store storage.Storage) *UserHandler {
 	return &UserHandler{
 		userRepo: repository.NewUserRepository(db),
+		store:    store,
 	}
 }
 
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+// VariantHandler manages product options and the variants generated from
+// them. The storefront reads variants through ProductHandler.
+type VariantHandler struct {
+	variantRepo   *repository.VariantRepository
+	backorderRepo *repository.BackorderRepository
+	alertRepo     *repository.StockAlertRepository
+	revisionRepo  *repository.RevisionRepository
+}
+
+func NewVariantHandler(db *gorm.DB) *VariantHandler {
+	return &VariantHandler{
+		variantRepo:   repository.NewVariantRepository(db),
+		backorderRepo: repository.NewBackorderRepository(db),
+		alertRepo:     repository.NewStockAlertRepository(db),
+		revisionRepo:  repository.NewRevisionRepository(db),
+	}
+}
+
+// CreateOption adds an option with its values to a product. Expects JSON
+// { "name": "Color", "values": [{ "value": "Red", "hex_code": "#f00" }] }.
+func (h *VariantHandler) CreateOption(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var option models.ProductOption
+	if err := json.NewDecoder(r.Body).Decode(&option); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.variantRepo.CreateOption(uint(id), &option); err != nil {
+		writeVariantError(w, err, "Failed to create option")
+		return
+	}
+	utils.SuccessResponse(w, "Option created successfully", option, http.StatusCreated)
+}
+
+// DeleteOption removes an option of a product that has no variants.
+func (h *VariantHandler) DeleteOption(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid option ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.variantRepo.DeleteOption(uint(id)); err != nil {
+		writeVariantError(w, err, "Failed to delete option")
+		return
+	}
+	utils.SuccessResponse(w, "Option deleted successfully", nil, http.StatusOK)
+}
+
+// AddOptionValue adds a value to an option.
+func (h *VariantHandler) AddOptionValue(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid option ID", http.StatusBadRequest)
+		return
+	}
+
+	var value models.ProductOptionValue
+	if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.variantRepo.AddOptionValue(uint(id), &value); err != nil {
+		writeVariantError(w, err, "Failed to add option value")
+		return
+	}
+	utils.SuccessResponse(w, "Option value added successfully", value, http.StatusCreated)
+}
+
+// DeleteOptionValue removes an option value no variant uses.
+func (h *VariantHandler) DeleteOptionValue(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid option value ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.variantRepo.DeleteOptionValue(uint(id)); err != nil {
+		writeVariantError(w, err, "Failed to delete option value")
+		return
+	}
+	utils.SuccessResponse(w, "Option value deleted successfully", nil, http.StatusOK)
+}
+
+// Generate creates the missing variants for every combination of a
+// product's option values. Accepts optional JSON defaults
+// { "stock": <n>, "is_active": <bool> }.
+func (h *VariantHandler) Generate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var defaults repository.GenerateDefaults
+	if err := json.NewDecoder(r.Body).Decode(&defaults); err != nil && !errors.Is(err, io.EOF) {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	before, err := h.revisionRepo.Snapshot(uint(id))
+	if err != nil {
+		writeVariantError(w, err, "Failed to generate variants")
+		return
+	}
+	created, err := h.variantRepo.Generate(uint(id), defaults)
+	if err != nil {
+		writeVariantError(w, err, "Failed to generate variants")
+		return
+	}
+	revise(h.revisionRepo, r, uint(id), models.RevisionVariants, before)
+	if defaults.Stock > 0 {
+		h.allocate(uint(id))
+	}
+	utils.SuccessResponse(w, strconv.Itoa(len(created))+" variants generated", created, http.StatusCreated)
+}
+
+// UpdateVariant changes a variant's SKU, barcode, stock, active flag or
+// price overrides.
+func (h *VariantHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid variant ID", http.StatusBadRequest)
+		return
+	}
+
+	var changes repository.VariantChanges
+	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	_, before, ok := h.snapshot(w, uint(id), "Failed to update variant")
+	if !ok {
+		return
+	}
+	variant, err := h.variantRepo.UpdateVariant(uint(id), changes)
+	if err != nil {
+		writeVariantError(w, err, "Failed to update variant")
+		return
+	}
+	revise(h.revisionRepo, r, variant.ProductID, models.RevisionVariants, before)
+	if changes.Stock != nil {
+		h.allocate(variant.ProductID)
+	}
+	utils.SuccessResponse(w, "Variant updated successfully", variant, http.StatusOK)
+}
+
+// DeleteVariant removes a variant.
+func (h *VariantHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid variant ID", http.StatusBadRequest)
+		return
+	}
+
+	productID, before, ok := h.snapshot(w, uint(id), "Failed to delete variant")
+	if !ok {
+		return
+	}
+	if err := h.variantRepo.DeleteVariant(uint(id)); err != nil {
+		writeVariantError(w, err, "Failed to delete variant")
+		return
+	}
+	revise(h.revisionRepo, r, productID, models.RevisionVariants, before)
+	utils.SuccessResponse(w, "Variant deleted successfully", nil, http.StatusOK)
+}
+
+// snapshot takes the state of a variant's product before a change, to
+// record the change as a revision, and returns the product's ID.
+func (h *VariantHandler) snapshot(w http.ResponseWriter, variantID uint, fallback string) (uint, *models.ProductSnapshot, bool) {
+	variant, err := h.variantRepo.GetVariant(variantID)
+	if err != nil {
+		writeVariantError(w, err, fallback)
+		return 0, nil, false
+	}
+	before, err := h.revisionRepo.Snapshot(variant.ProductID)
+	if err != nil {
+		writeVariantError(w, err, fallback)
+		return 0, nil, false
+	}
+	return variant.ProductID, before, true
+}
+
+// allocate hands new variant stock to waiting back-orders, then notifies
+// users waiting for what is left.
+func (h *VariantHandler) allocate(productID uint) {
+	if _, err := h.backorderRepo.Allocate(productID); err != nil {
+		log.Printf("back-order allocation for product %d failed: %v", productID, err)
+	}
+	if _, err := h.alertRepo.Restocked(productID); err != nil {
+		log.Printf("stock alerts for product %d failed: %v", productID, err)
+	}
+}
+
+// writeVariantError maps variant repository errors to responses.
+func writeVariantError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		utils.ErrorResponse(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, repository.ErrInvalidOption),
+		errors.Is(err, repository.ErrNoOptions),
+		errors.Is(err, repository.ErrVariantStock),
+		errors.Is(err, repository.ErrTooManyVariants):
+		utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrOptionInUse), errors.Is(err, repository.ErrDuplicateSKU):
+		utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+	default:
+		utils.ErrorResponse(w, fallback, http.StatusInternalServerError)
+	}
+}
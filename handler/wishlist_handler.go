@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+)
+
+// maxWishlistName matches the size of Wishlist.Name.
+const maxWishlistName = 100
+
+type WishlistHandler struct {
+	wishlistRepo *repository.WishlistRepository
+	db           *gorm.DB
+}
+
+func NewWishlistHandler(db *gorm.DB) *WishlistHandler {
+	return &WishlistHandler{
+		wishlistRepo: repository.NewWishlistRepository(db),
+		db:           db,
+	}
+}
+
+// List returns the user's wishlists with their item counts.
+func (h *WishlistHandler) List(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	wishlists, err := h.wishlistRepo.ListByUser(claims.UserID)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch wishlists", http.StatusInternalServerError)
+		return
+	}
+	utils.JSONResponse(w, wishlists, http.StatusOK)
+}
+
+// Create adds a wishlist. Body: {"name": "Kitchen renovation"}
+func (h *WishlistHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	name, ok := decodeWishlistName(w, r)
+	if !ok {
+		return
+	}
+
+	wishlist := models.Wishlist{UserID: claims.UserID, Name: name}
+	if err := h.wishlistRepo.Create(&wishlist); err != nil {
+		utils.ErrorResponse(w, "Failed to create wishlist", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Wishlist created successfully", wishlist, http.StatusCreated)
+}
+
+// Get returns one of the user's wishlists and its items.
+func (h *WishlistHandler) Get(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := h.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	h.writeWishlist(w, r, wishlist, map[string]interface{}{"wishlist": wishlist})
+}
+
+// Shared returns a wishlist shared by link, with its owner's username.
+// Only items the viewer may see are listed, priced for the viewer.
+func (h *WishlistHandler) Shared(w http.ResponseWriter, r *http.Request) {
+	wishlist, err := h.wishlistRepo.GetByToken(r.PathValue("token"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Wishlist not found", http.StatusNotFound)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to fetch wishlist", http.StatusInternalServerError)
+		return
+	}
+
+	var owner models.User
+	if err := h.db.Select("id", "username").First(&owner, wishlist.UserID).Error; err != nil {
+		utils.ErrorResponse(w, "Failed to fetch wishlist", http.StatusInternalServerError)
+		return
+	}
+	h.writeWishlist(w, r, wishlist, map[string]interface{}{
+		"name":  wishlist.Name,
+		"owner": owner.Username,
+	})
+}
+
+// writeWishlist responds with body plus the wishlist's items visible to the
+// user.
+func (h *WishlistHandler) writeWishlist(w http.ResponseWriter, r *http.Request, wishlist *models.Wishlist, body map[string]interface{}) {
+	filter, admin := productVisibility(h.db, r)
+	items, err := h.wishlistRepo.Items(wishlist.ID, filter, admin)
+	if err != nil {
+		utils.ErrorResponse(w, "Failed to fetch wishlist items", http.StatusInternalServerError)
+		return
+	}
+	body["items"] = items
+	utils.JSONResponse(w, body, http.StatusOK)
+}
+
+// Update renames a wishlist. Body: {"name": "..."}
+func (h *WishlistHandler) Update(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := h.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	name, ok := decodeWishlistName(w, r)
+	if !ok {
+		return
+	}
+
+	wishlist.Name = name
+	if err := h.wishlistRepo.Rename(wishlist); err != nil {
+		utils.ErrorResponse(w, "Failed to update wishlist", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Wishlist updated successfully", wishlist, http.StatusOK)
+}
+
+func (h *WishlistHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := h.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	if err := h.wishlistRepo.Delete(wishlist.ID); err != nil {
+		utils.ErrorResponse(w, "Failed to delete wishlist", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Wishlist deleted successfully", nil, http.StatusOK)
+}
+
+// AddItem saves a product in a wishlist.
+// Body: {"product_id": 12, "variant_id": 40}
+func (h *WishlistHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := h.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ProductID uint  `json:"product_id"`
+		VariantID *uint `json:"variant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	item := models.WishlistItem{WishlistID: wishlist.ID, ProductID: req.ProductID, VariantID: req.VariantID}
+	filter, _ := productVisibility(h.db, r)
+	if err := h.wishlistRepo.AddItem(&item, filter); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrWishlistItemExists):
+			utils.ErrorResponse(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, repository.ErrVariantMismatch):
+			utils.ErrorResponse(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			utils.ErrorResponse(w, "Product not found", http.StatusNotFound)
+		default:
+			utils.ErrorResponse(w, "Failed to add product to wishlist", http.StatusInternalServerError)
+		}
+		return
+	}
+	utils.SuccessResponse(w, "Product added to wishlist", item, http.StatusCreated)
+}
+
+func (h *WishlistHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := h.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	itemID, err := strconv.ParseUint(r.PathValue("itemId"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid item ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.wishlistRepo.RemoveItem(wishlist.ID, uint(itemID)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			utils.ErrorResponse(w, "Item not found", http.StatusNotFound)
+			return
+		}
+		utils.ErrorResponse(w, "Failed to remove product from wishlist", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Product removed from wishlist", nil, http.StatusOK)
+}
+
+// Share creates a new share link token for a wishlist, replacing any
+// earlier one.
+func (h *WishlistHandler) Share(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := h.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	if err := h.wishlistRepo.Share(wishlist); err != nil {
+		utils.ErrorResponse(w, "Failed to share wishlist", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Wishlist shared", wishlist, http.StatusOK)
+}
+
+// Unshare stops sharing a wishlist.
+func (h *WishlistHandler) Unshare(w http.ResponseWriter, r *http.Request) {
+	wishlist, ok := h.ownWishlist(w, r)
+	if !ok {
+		return
+	}
+	if err := h.wishlistRepo.Unshare(wishlist); err != nil {
+		utils.ErrorResponse(w, "Failed to stop sharing wishlist", http.StatusInternalServerError)
+		return
+	}
+	utils.SuccessResponse(w, "Wishlist no longer shared", wishlist, http.StatusOK)
+}
+
+// ownWishlist loads the wishlist in the path if it belongs to the user.
+func (h *WishlistHandler) ownWishlist(w http.ResponseWriter, r *http.Request) (*models.Wishlist, bool) {
+	claims, ok := utils.GetUserFromContext(r.Context())
+	if !ok {
+		utils.ErrorResponse(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(w, "Invalid wishlist ID", http.StatusBadRequest)
+		return nil, false
+	}
+	wishlist, err := h.wishlistRepo.GetByID(uint(id))
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		utils.ErrorResponse(w, "Failed to fetch wishlist", http.StatusInternalServerError)
+		return nil, false
+	}
+	if err != nil || wishlist.UserID != claims.UserID {
+		utils.ErrorResponse(w, "Wishlist not found", http.StatusNotFound)
+		return nil, false
+	}
+	return wishlist, true
+}
+
+// decodeWishlistName reads {"name": "..."}, which must not be blank.
+func decodeWishlistName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, "Invalid request body", http.StatusBadRequest)
+		return "", false
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxWishlistName {
+		utils.ErrorResponse(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,173 @@
+// Package imaging validates uploaded images and renders the resized JPEG,
+// PNG and WebP versions served to clients. Images are decoded and encoded
+// again, which drops EXIF and any other embedded metadata.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+)
+
+// MaxPixels bounds the decoded size of an upload (40 megapixels), so that
+// small files cannot expand into huge bitmaps.
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format; upload a JPEG, PNG or GIF image")
+	ErrInvalidImage      = errors.New("the image file is corrupt")
+	ErrTooManyPixels     = errors.New("the image has too many pixels")
+)
+
+// Size is a named rendition bounded by its longest edge.
+type Size struct {
+	Name    string
+	MaxEdge int
+}
+
+// ProductSizes are rendered for product images.
+var ProductSizes = []Size{
+	{"thumbnail", 150},
+	{"medium", 600},
+	{"large", 1600},
+}
+
+// ReviewSizes are rendered for review photos.
+var ReviewSizes = []Size{
+	{"thumbnail", 150},
+	{"large", 1200},
+}
+
+// AvatarSizes are rendered for avatars.
+var AvatarSizes = []Size{
+	{"thumbnail", 64},
+	{"medium", 256},
+}
+
+// Rendition is one encoded size of an image. Data is a JPEG, or a PNG when
+// the image has transparency. WebP holds the same pixels as a lossless WebP,
+// for clients that prefer WebP; for photos it is usually larger than the
+// JPEG.
+type Rendition struct {
+	Name   string
+	Width  int
+	Height int
+	Ext    string // ".jpg" or ".png"
+	Data   []byte
+	WebP   []byte
+}
+
+// Sniff identifies an image format by its magic bytes. It returns "" for
+// anything else.
+func Sniff(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	}
+	return ""
+}
+
+// Decode checks the magic bytes and pixel count of data before decoding it,
+// and turns JPEG photos upright according to their EXIF orientation.
+// Animated GIFs decode to their first frame.
+func Decode(data []byte, maxPixels int) (image.Image, error) {
+	format := Sniff(data)
+	if format == "" {
+		return nil, ErrUnsupportedFormat
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if config.Width < 1 || config.Height < 1 {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is more than %d megapixels", ErrTooManyPixels,
+			config.Width, config.Height, maxPixels/1_000_000)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if format == "jpeg" {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, nil
+}
+
+// Render encodes img at each size, never enlarging it. Sizes the image is
+// too small for collapse into the largest one it fills, so the renditions
+// have distinct widths.
+func Render(img image.Image, sizes []Size) ([]Rendition, error) {
+	src := toNRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	opaque := src.Opaque()
+
+	var renditions []Rendition
+	for _, size := range sizes {
+		rw, rh := fit(w, h, size.MaxEdge)
+		scaled := src
+		if rw != w || rh != h {
+			scaled = Resize(src, rw, rh)
+		}
+
+		r := Rendition{Name: size.Name, Width: rw, Height: rh}
+		var buf bytes.Buffer
+		if opaque {
+			r.Ext = ".jpg"
+			err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: 85})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			r.Ext = ".png"
+			if err := png.Encode(&buf, scaled); err != nil {
+				return nil, err
+			}
+		}
+		r.Data = buf.Bytes()
+
+		var webp bytes.Buffer
+		if err := EncodeWebP(&webp, scaled); err != nil {
+			return nil, err
+		}
+		r.WebP = webp.Bytes()
+		renditions = append(renditions, r)
+
+		if rw == w && rh == h {
+			break // larger sizes would be the same pixels
+		}
+	}
+	return renditions, nil
+}
+
+// fit scales w x h down so that its longest edge is at most maxEdge.
+func fit(w, h, maxEdge int) (int, int) {
+	if w <= maxEdge && h <= maxEdge {
+		return w, h
+	}
+	if w >= h {
+		return maxEdge, max(1, (h*maxEdge+w/2)/w)
+	}
+	return max(1, (w*maxEdge+h/2)/h), maxEdge
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Bounds().Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
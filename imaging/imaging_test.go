@@ -0,0 +1,53 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	photo := func(x, y int) color.NRGBA { return color.NRGBA{uint8(x * 7), uint8(y * 5), uint8(x ^ y), 0xff} }
+	cutout := func(x, y int) color.NRGBA { return color.NRGBA{0x20, 0x40, 0x60, uint8(x)} }
+	tests := []struct {
+		name          string
+		width, height int
+		pixel         func(x, y int) color.NRGBA
+		ext           string
+		sizes         [][2]int
+	}{
+		{"photo", 400, 200, photo, ".jpg", [][2]int{{150, 75}, {400, 200}}},
+		{"small photo", 100, 120, photo, ".jpg", [][2]int{{100, 120}}},
+		{"transparent", 300, 300, cutout, ".png", [][2]int{{150, 150}, {300, 300}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					img.SetNRGBA(x, y, tt.pixel(x, y))
+				}
+			}
+			renditions, err := Render(img, ProductSizes)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if len(renditions) != len(tt.sizes) {
+				t.Fatalf("got %d renditions, want %d", len(renditions), len(tt.sizes))
+			}
+			for i, r := range renditions {
+				if r.Width != tt.sizes[i][0] || r.Height != tt.sizes[i][1] {
+					t.Errorf("%s is %dx%d, want %dx%d", r.Name, r.Width, r.Height, tt.sizes[i][0], tt.sizes[i][1])
+				}
+				if r.Ext != tt.ext || Sniff(r.Data) == "" {
+					t.Errorf("%s is %s with format %q", r.Name, r.Ext, Sniff(r.Data))
+				}
+				// Every rendition has a WebP version, even when it is larger
+				if !bytes.HasPrefix(r.WebP, []byte("RIFF")) || !bytes.Equal(r.WebP[8:12], []byte("WEBP")) {
+					t.Errorf("%s has no WebP version", r.Name)
+				}
+			}
+		})
+	}
+}
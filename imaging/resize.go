@@ -0,0 +1,106 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+// contribution lists the source pixels, from start, that blend into one
+// destination pixel and their weights.
+type contribution struct {
+	start   int
+	weights []float32
+}
+
+// contributions computes a triangle filter widened by the scale factor,
+// which averages every source pixel into the result when shrinking.
+func contributions(srcLen, dstLen int) []contribution {
+	scale := float64(srcLen) / float64(dstLen)
+	radius := math.Max(scale, 1)
+	out := make([]contribution, dstLen)
+	for i := range out {
+		center := (float64(i) + 0.5) * scale
+		start := max(int(math.Floor(center-radius)), 0)
+		end := min(int(math.Ceil(center+radius)), srcLen)
+
+		weights := make([]float32, 0, end-start)
+		var sum float32
+		for j := start; j < end; j++ {
+			w := float32(1 - math.Abs(float64(j)+0.5-center)/radius)
+			if w < 0 {
+				w = 0
+			}
+			weights = append(weights, w)
+			sum += w
+		}
+		if sum == 0 {
+			// nearest pixel
+			start = min(int(center), srcLen-1)
+			weights, sum = []float32{1}, 1
+		}
+		for k := range weights {
+			weights[k] /= sum
+		}
+		out[i] = contribution{start: start, weights: weights}
+	}
+	return out
+}
+
+// Resize scales src to w x h. Colors are blended with premultiplied alpha so
+// transparent pixels don't bleed into their neighbours.
+func Resize(src *image.NRGBA, w, h int) *image.NRGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+
+	// Horizontal pass into premultiplied floats
+	tmp := make([]float32, w*sh*4)
+	cols := contributions(sw, w)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[src.PixOffset(bounds.Min.X, bounds.Min.Y+y):]
+		for x, c := range cols {
+			var r, g, b, a float32
+			for k, weight := range c.weights {
+				p := row[(c.start+k)*4:]
+				alpha := float32(p[3]) * weight
+				r += float32(p[0]) * alpha
+				g += float32(p[1]) * alpha
+				b += float32(p[2]) * alpha
+				a += alpha
+			}
+			i := (y*w + x) * 4
+			tmp[i], tmp[i+1], tmp[i+2], tmp[i+3] = r, g, b, a
+		}
+	}
+
+	// Vertical pass, back to straight alpha
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rows := contributions(sh, h)
+	for y, c := range rows {
+		for x := 0; x < w; x++ {
+			var r, g, b, a float32
+			for k, weight := range c.weights {
+				i := ((c.start+k)*w + x) * 4
+				r += tmp[i] * weight
+				g += tmp[i+1] * weight
+				b += tmp[i+2] * weight
+				a += tmp[i+3] * weight
+			}
+			p := dst.Pix[y*dst.Stride+x*4:]
+			if a > 0 {
+				p[0], p[1], p[2] = clamp8(r/a), clamp8(g/a), clamp8(b/a)
+			}
+			p[3] = clamp8(a)
+		}
+	}
+	return dst
+}
+
+func clamp8(v float32) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,545 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// EncodeWebP writes img as a lossless WebP (VP8L) image. It applies the
+// subtract-green and predictor transforms and codes runs of repeated pixels
+// as backward references, which suits product photos on plain backgrounds.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return errors.New("webp: image dimensions out of range")
+	}
+
+	argb := make([]uint32, width*height)
+	opaque := true
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			argb[y*width+x] = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+			opaque = opaque && c.A == 0xff
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8) // VP8L signature
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // version
+
+	// Transforms, undone by the decoder in reverse order
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	subtractGreen(argb)
+
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorBits-2, 3)
+	modes := choosePredictors(argb, width, height)
+	blocksWide := subSampleSize(width, predictorBits)
+	modeImage := make([]uint32, len(modes))
+	for i, m := range modes {
+		modeImage[i] = 0xff000000 | uint32(m)<<8
+	}
+	bw.write(0, 1) // no color cache
+	writeImageData(bw, modeImage, blocksWide, false)
+	residuals := predict(argb, width, height, modes)
+
+	bw.write(0, 1) // no more transforms
+	bw.write(0, 1) // no color cache
+	bw.write(0, 1) // a single prefix code group
+	writeImageData(bw, residuals, width, true)
+
+	data := bw.bytes()
+	chunk := len(data)
+	pad := chunk & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+chunk+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunk))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if pad == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+const (
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	// predictorBits sets the 16x16 blocks that each choose a predictor
+	predictorBits = 4
+
+	numLiterals     = 256
+	numLengthCodes  = 24
+	numDistanceCode = 40
+	maxCopyLength   = 4096
+	minCopyLength   = 3
+	maxCodeLength   = 15
+)
+
+// Predictor modes, of those the format defines, that need no top-right
+// neighbour.
+const (
+	predictLeft    = 1
+	predictTop     = 2
+	predictAverage = 7
+	predictSelect  = 11
+	predictClamp   = 12
+)
+
+var predictorModes = []int{predictLeft, predictTop, predictAverage, predictSelect, predictClamp}
+
+func subSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+func subtractGreen(argb []uint32) {
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+func predictor(mode int, left, top, topLeft uint32) uint32 {
+	switch mode {
+	case predictLeft:
+		return left
+	case predictTop:
+		return top
+	case predictAverage:
+		return average2(left, top)
+	case predictSelect:
+		return selectPredictor(left, top, topLeft)
+	case predictClamp:
+		return clampAddSubtractFull(left, top, topLeft)
+	}
+	return 0xff000000
+}
+
+func channel(p uint32, shift uint) int {
+	return int(p>>shift) & 0xff
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func selectPredictor(left, top, topLeft uint32) uint32 {
+	// Distances of the gradient estimate L + T - TL to L and to T
+	toLeft, toTop := 0, 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		toLeft += abs(channel(top, shift) - channel(topLeft, shift))
+		toTop += abs(channel(left, shift) - channel(topLeft, shift))
+	}
+	if toLeft < toTop {
+		return left
+	}
+	return top
+}
+
+func clampAddSubtractFull(left, top, topLeft uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := channel(left, shift) + channel(top, shift) - channel(topLeft, shift)
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		p |= uint32(v) << shift
+	}
+	return p
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// sub subtracts per channel, modulo 256.
+func sub(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// neighbours returns the left, top and top-left pixels of (x, y) for a
+// pixel off the top row and the left column.
+func neighbours(argb []uint32, width, x, y int) (uint32, uint32, uint32) {
+	i := y*width + x
+	return argb[i-1], argb[i-width], argb[i-width-1]
+}
+
+// choosePredictors picks for every block the mode with the smallest
+// residuals.
+func choosePredictors(argb []uint32, width, height int) []int {
+	blocksWide := subSampleSize(width, predictorBits)
+	blocksHigh := subSampleSize(height, predictorBits)
+	modes := make([]int, blocksWide*blocksHigh)
+	for by := 0; by < blocksHigh; by++ {
+		for bx := 0; bx < blocksWide; bx++ {
+			best, bestCost := predictLeft, -1
+			for _, mode := range predictorModes {
+				cost := 0
+				for y := max(by<<predictorBits, 1); y < min((by+1)<<predictorBits, height); y++ {
+					for x := max(bx<<predictorBits, 1); x < min((bx+1)<<predictorBits, width); x++ {
+						l, t, tl := neighbours(argb, width, x, y)
+						r := sub(argb[y*width+x], predictor(mode, l, t, tl))
+						for shift := uint(0); shift < 32; shift += 8 {
+							c := channel(r, shift)
+							cost += min(c, 256-c)
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[by*blocksWide+bx] = best
+		}
+	}
+	return modes
+}
+
+// predict returns the residuals of argb under the block modes, with the
+// fixed predictors of the first row and column.
+func predict(argb []uint32, width, height int, modes []int) []uint32 {
+	blocksWide := subSampleSize(width, predictorBits)
+	out := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			var pred uint32
+			switch {
+			case x == 0 && y == 0:
+				pred = 0xff000000
+			case y == 0:
+				pred = argb[i-1]
+			case x == 0:
+				pred = argb[i-width]
+			default:
+				l, t, tl := neighbours(argb, width, x, y)
+				pred = predictor(modes[(y>>predictorBits)*blocksWide+x>>predictorBits], l, t, tl)
+			}
+			out[i] = sub(argb[i], pred)
+		}
+	}
+	return out
+}
+
+// symbol is a pixel literal or a backward reference.
+type symbol struct {
+	pixel    uint32
+	length   int // 0 for a literal
+	distCode int
+}
+
+// writeImageData writes the prefix codes and the coded pixels of an image.
+// Backward references copy runs of the pixel to the left or above.
+func writeImageData(bw *bitWriter, argb []uint32, width int, backRefs bool) {
+	var symbols []symbol
+	for i := 0; i < len(argb); {
+		if backRefs {
+			best, bestCode := 0, 0
+			for _, ref := range []struct{ dist, code int }{{1, 2}, {width, 1}} {
+				if i < ref.dist {
+					continue
+				}
+				n := 0
+				for i+n < len(argb) && n < maxCopyLength && argb[i+n] == argb[i+n-ref.dist] {
+					n++
+				}
+				if n > best {
+					best, bestCode = n, ref.code
+				}
+			}
+			if best >= minCopyLength {
+				symbols = append(symbols, symbol{length: best, distCode: bestCode})
+				i += best
+				continue
+			}
+		}
+		symbols = append(symbols, symbol{pixel: argb[i]})
+		i++
+	}
+
+	green := make([]int, numLiterals+numLengthCodes)
+	red := make([]int, numLiterals)
+	blue := make([]int, numLiterals)
+	alpha := make([]int, numLiterals)
+	dist := make([]int, numDistanceCode)
+	for _, s := range symbols {
+		if s.length > 0 {
+			code, _, _ := prefixEncode(s.length)
+			green[numLiterals+code]++
+			code, _, _ = prefixEncode(s.distCode)
+			dist[code]++
+			continue
+		}
+		green[(s.pixel>>8)&0xff]++
+		red[(s.pixel>>16)&0xff]++
+		blue[s.pixel&0xff]++
+		alpha[s.pixel>>24]++
+	}
+
+	codes := make([]prefixCode, 5)
+	for i, counts := range [][]int{green, red, blue, alpha, dist} {
+		codes[i] = writePrefixCode(bw, counts)
+	}
+	for _, s := range symbols {
+		if s.length > 0 {
+			code, extraBits, extra := prefixEncode(s.length)
+			codes[0].write(bw, numLiterals+code)
+			bw.write(uint32(extra), extraBits)
+			code, extraBits, extra = prefixEncode(s.distCode)
+			codes[4].write(bw, code)
+			bw.write(uint32(extra), extraBits)
+			continue
+		}
+		codes[0].write(bw, int((s.pixel>>8)&0xff))
+		codes[1].write(bw, int((s.pixel>>16)&0xff))
+		codes[2].write(bw, int(s.pixel&0xff))
+		codes[3].write(bw, int(s.pixel>>24))
+	}
+}
+
+// prefixEncode splits a length or distance code (from 1) into its prefix
+// symbol and extra bits.
+func prefixEncode(value int) (code, extraBits, extra int) {
+	n := value - 1
+	if n < 4 {
+		return n, 0, 0
+	}
+	high := 0
+	for v := n; v > 1; v >>= 1 {
+		high++
+	}
+	second := (n >> (high - 1)) & 1
+	extraBits = high - 1
+	return 2*high + second, extraBits, n & (1<<extraBits - 1)
+}
+
+// prefixCode holds canonical prefix codes, bit-reversed for writing.
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (c prefixCode) write(bw *bitWriter, s int) {
+	bw.write(c.codes[s], c.lengths[s])
+}
+
+// codeLengthOrder is the order in which code length code lengths are sent.
+var codeLengthOrder = []int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writePrefixCode writes the prefix code for the symbol counts and returns
+// it. One or two used symbols below 256 use the short "simple" form; a
+// single symbol then takes no bits at all.
+func writePrefixCode(bw *bitWriter, counts []int) prefixCode {
+	var used []int
+	for s, n := range counts {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) <= 2 && used[len(used)-1] < numLiterals {
+		bw.write(1, 1) // simple code
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+		}
+		lengths := make([]int, len(counts))
+		if len(used) == 2 {
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return canonicalCode(lengths)
+	}
+
+	lengths := huffmanLengths(counts, maxCodeLength)
+	lengthCounts := make([]int, len(codeLengthOrder))
+	for _, l := range lengths {
+		lengthCounts[l]++
+	}
+	lengthCode := canonicalCode(huffmanLengths(lengthCounts, 7))
+
+	n := len(codeLengthOrder)
+	for n > 4 && lengthCode.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(0, 1) // normal code
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		bw.write(uint32(lengthCode.lengths[s]), 3)
+	}
+	bw.write(0, 1) // lengths for every symbol follow
+	for _, l := range lengths {
+		lengthCode.write(bw, l)
+	}
+	return canonicalCode(lengths)
+}
+
+// huffmanLengths returns code lengths of at most limit bits for the
+// counts. At least two symbols get a code so that it is complete.
+func huffmanLengths(counts []int, limit int) []int {
+	weights := make([]int, len(counts))
+	copy(weights, counts)
+	nonZero := 0
+	for _, w := range weights {
+		if w > 0 {
+			nonZero++
+		}
+	}
+	for s := 0; nonZero < 2 && s < len(weights); s++ {
+		if weights[s] == 0 {
+			weights[s] = 1
+			nonZero++
+		}
+	}
+
+	for {
+		lengths := huffmanTree(weights)
+		longest := 0
+		for _, l := range lengths {
+			longest = max(longest, l)
+		}
+		if longest <= limit {
+			return lengths
+		}
+		// Flatten the distribution until the tree fits
+		for s, w := range weights {
+			if w > 0 {
+				weights[s] = (w + 1) / 2
+			}
+		}
+	}
+}
+
+func huffmanTree(weights []int) []int {
+	type node struct {
+		weight      int
+		symbol      int // -1 for internal nodes
+		left, right int
+	}
+	var nodes []node
+	var queue []int
+	for s, w := range weights {
+		if w > 0 {
+			nodes = append(nodes, node{weight: w, symbol: s})
+			queue = append(queue, len(nodes)-1)
+		}
+	}
+	for len(queue) > 1 {
+		sort.SliceStable(queue, func(i, j int) bool { return nodes[queue[i]].weight < nodes[queue[j]].weight })
+		a, b := queue[0], queue[1]
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+		queue = append(queue[2:], len(nodes)-1)
+	}
+
+	lengths := make([]int, len(weights))
+	var walk func(n, depth int)
+	walk = func(n, depth int) {
+		if nodes[n].symbol >= 0 {
+			lengths[nodes[n].symbol] = depth
+			return
+		}
+		walk(nodes[n].left, depth+1)
+		walk(nodes[n].right, depth+1)
+	}
+	walk(queue[0], 0)
+	return lengths
+}
+
+// canonicalCode assigns canonical codes to the lengths, shortest first and
+// by symbol within a length.
+func canonicalCode(lengths []int) prefixCode {
+	codes := make([]uint32, len(lengths))
+	var count [maxCodeLength + 1]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [maxCodeLength + 2]uint32
+	code := uint32(0)
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + uint32(count[l-1])) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		codes[s] = reverseBits(next[l], l)
+		next[l]++
+	}
+	return prefixCode{lengths: lengths, codes: codes}
+}
+
+func reverseBits(v uint32, n int) uint32 {
+	var r uint32
+	for i := 0; i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+// bitWriter packs values least significant bit first.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	w.acc |= uint64(v&(1<<n-1)) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
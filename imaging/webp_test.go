@@ -0,0 +1,203 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// bitReader reads values least significant bit first, like the decoder.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v |= uint32(r.data[r.pos/8]>>(r.pos%8)&1) << i
+		r.pos++
+	}
+	return v
+}
+
+func TestEncodeWebPHeader(t *testing.T) {
+	opaque := func(x, y int) color.NRGBA { return color.NRGBA{uint8(x), uint8(y), 0x80, 0xff} }
+	tests := []struct {
+		name          string
+		width, height int
+		pixel         func(x, y int) color.NRGBA
+		alpha         bool
+	}{
+		{"single pixel", 1, 1, opaque, false},
+		{"odd size", 17, 33, opaque, false},
+		{"wide", 301, 2, opaque, false},
+		{"solid", 64, 64, func(x, y int) color.NRGBA { return color.NRGBA{0xff, 0xff, 0xff, 0xff} }, false},
+		{"transparent", 20, 10, func(x, y int) color.NRGBA { return color.NRGBA{0x10, 0x20, 0x30, uint8(x * 12)} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(5, 5, 5+tt.width, 5+tt.height))
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					img.SetNRGBA(5+x, 5+y, tt.pixel(x, y))
+				}
+			}
+			var buf bytes.Buffer
+			if err := EncodeWebP(&buf, img); err != nil {
+				t.Fatalf("EncodeWebP: %v", err)
+			}
+			data := buf.Bytes()
+
+			if len(data) < 25 || string(data[0:4]) != "RIFF" || string(data[8:16]) != "WEBPVP8L" {
+				t.Fatalf("not a lossless WebP container: % x", data[:min(len(data), 20)])
+			}
+			if size := binary.LittleEndian.Uint32(data[4:]); int(size) != len(data)-8 {
+				t.Errorf("RIFF size = %d, want %d", size, len(data)-8)
+			}
+			chunk := int(binary.LittleEndian.Uint32(data[16:]))
+			if want := len(data) - 20 - chunk%2; chunk != want {
+				t.Errorf("VP8L chunk size = %d, want %d", chunk, want)
+			}
+			if len(data)%2 != 0 {
+				t.Errorf("file size %d is not padded to even", len(data))
+			}
+
+			r := &bitReader{data: data[20:]}
+			if sig := r.read(8); sig != 0x2f {
+				t.Errorf("signature = %#x, want 0x2f", sig)
+			}
+			if w := int(r.read(14)) + 1; w != tt.width {
+				t.Errorf("width = %d, want %d", w, tt.width)
+			}
+			if h := int(r.read(14)) + 1; h != tt.height {
+				t.Errorf("height = %d, want %d", h, tt.height)
+			}
+			if alpha := r.read(1) == 1; alpha != tt.alpha {
+				t.Errorf("alpha hint = %v, want %v", alpha, tt.alpha)
+			}
+			if version := r.read(3); version != 0 {
+				t.Errorf("version = %d, want 0", version)
+			}
+			if present, kind := r.read(1), r.read(2); present != 1 || kind != transformSubtractGreen {
+				t.Errorf("first transform = %d/%d, want subtract green", present, kind)
+			}
+			if present, kind, bits := r.read(1), r.read(2), r.read(3); present != 1 || kind != transformPredictor || bits != predictorBits-2 {
+				t.Errorf("second transform = %d/%d/%d, want predictor with %d-bit blocks", present, kind, bits, predictorBits)
+			}
+		})
+	}
+}
+
+func TestEncodeWebPDimensions(t *testing.T) {
+	tests := []struct {
+		width, height int
+		ok            bool
+	}{
+		{0, 10, false},
+		{10, 0, false},
+		{1 << 14, 1, true},
+		{1<<14 + 1, 1, false},
+		{1, 1<<14 + 1, false},
+	}
+	for _, tt := range tests {
+		err := EncodeWebP(&bytes.Buffer{}, image.NewGray(image.Rect(0, 0, tt.width, tt.height)))
+		if (err == nil) != tt.ok {
+			t.Errorf("EncodeWebP(%dx%d) error = %v, want ok %v", tt.width, tt.height, err, tt.ok)
+		}
+	}
+}
+
+func TestPrefixEncode(t *testing.T) {
+	// The decoder's inverse of prefixEncode
+	decode := func(code, extra int) int {
+		if code < 4 {
+			return code + 1
+		}
+		extraBits := (code - 2) >> 1
+		offset := (2 + code&1) << extraBits
+		return offset + extra + 1
+	}
+	for value := 1; value <= maxCopyLength; value++ {
+		code, extraBits, extra := prefixEncode(value)
+		if code >= numLengthCodes {
+			t.Fatalf("prefixEncode(%d) code %d is past the length alphabet", value, code)
+		}
+		if extra >= 1<<extraBits {
+			t.Fatalf("prefixEncode(%d) extra %d does not fit %d bits", value, extra, extraBits)
+		}
+		if got := decode(code, extra); got != value {
+			t.Fatalf("prefixEncode(%d) decodes to %d", value, got)
+		}
+	}
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	skewed := make([]int, 300)
+	for i := range skewed {
+		skewed[i] = 1 << (i % 28)
+	}
+	tests := []struct {
+		name   string
+		counts []int
+		limit  int
+	}{
+		{"one symbol", []int{0, 0, 5}, maxCodeLength},
+		{"two symbols", []int{3, 9}, maxCodeLength},
+		{"uniform", []int{4, 4, 4, 4, 4, 4, 4, 4}, maxCodeLength},
+		{"fibonacci", []int{1, 1, 2, 3, 5, 8, 13, 21, 34, 55, 89, 144, 233, 377, 610, 987, 1597, 2584, 4181}, 7},
+		{"skewed", skewed, maxCodeLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lengths := huffmanLengths(tt.counts, tt.limit)
+
+			// A complete code has a Kraft sum of exactly one
+			kraft, coded := 0, 0
+			for s, l := range lengths {
+				if l > tt.limit {
+					t.Errorf("symbol %d has length %d, over the limit %d", s, l, tt.limit)
+				}
+				if tt.counts[s] > 0 && l == 0 {
+					t.Errorf("used symbol %d has no code", s)
+				}
+				if l > 0 {
+					kraft += 1 << (maxCodeLength - l)
+					coded++
+				}
+			}
+			if coded < 2 || kraft != 1<<maxCodeLength {
+				t.Errorf("code over %d symbols is not complete: Kraft sum %d/%d", coded, kraft, 1<<maxCodeLength)
+			}
+
+			// Codes are stored bit-reversed, so a code is a prefix of another
+			// when it matches the other's low bits
+			code := canonicalCode(lengths)
+			for a, la := range lengths {
+				for b, lb := range lengths {
+					if a == b || la == 0 || lb == 0 || la > lb {
+						continue
+					}
+					if code.codes[b]&(1<<la-1) == code.codes[a] {
+						t.Fatalf("code of symbol %d is a prefix of symbol %d's", a, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBitWriter(t *testing.T) {
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(0b101, 3)
+	bw.write(0xffff, 2) // only the low bits are written
+	bw.write(0x1234, 14)
+	got := bw.bytes()
+	want := []byte{0x2f, 0x9d, 0x46, 0x02}
+	if !bytes.Equal(got, want) {
+		t.Errorf("bytes = % x, want % x", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package invoice
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// persianDigits replaces ASCII digits with their Persian counterparts.
+func persianDigits(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			r = '۰' + (r - '0')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// formatNumber writes an integer with Persian digits and thousands
+// separators.
+func formatNumber(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteRune('٬')
+		}
+		b.WriteRune(r)
+	}
+
+	out := persianDigits(b.String())
+	if neg {
+		out = "-" + out
+	}
+	return out
+}
+
+// formatAmount formats a money value. Whole amounts are printed without
+// decimals, others with two.
+func formatAmount(v float64) string {
+	rounded := math.Round(v*100) / 100
+	whole := math.Trunc(rounded)
+	if rounded == whole {
+		return formatNumber(int64(whole))
+	}
+	cents := int64(math.Round(math.Abs(rounded-whole) * 100))
+	return formatNumber(int64(whole)) + "٫" + persianDigits(strconv.FormatInt(100+cents, 10)[1:])
+}
+
+// jalali converts a Gregorian date to the Solar Hijri (Jalali) calendar used
+// on Iranian invoices.
+func jalali(t time.Time) (year, month, day int) {
+	gy, gm, gd := t.Year(), int(t.Month()), t.Day()
+	daysBefore := [12]int{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334}
+
+	gy2 := gy
+	if gm > 2 {
+		gy2 = gy + 1
+	}
+	days := 355666 + 365*gy + (gy2+3)/4 - (gy2+99)/100 + (gy2+399)/400 + gd + daysBefore[gm-1]
+
+	year = -1595 + 33*(days/12053)
+	days %= 12053
+	year += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		year += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+	if days < 186 {
+		month = 1 + days/31
+		day = 1 + days%31
+	} else {
+		month = 7 + (days-186)/30
+		day = 1 + (days-186)%30
+	}
+	return year, month, day
+}
+
+// formatDate prints a date as YYYY/MM/DD in the Jalali calendar.
+func formatDate(t time.Time) string {
+	y, m, d := jalali(t)
+	pad := func(n int) string {
+		if n < 10 {
+			return "0" + strconv.Itoa(n)
+		}
+		return strconv.Itoa(n)
+	}
+	return persianDigits(strconv.Itoa(y) + "/" + pad(m) + "/" + pad(d))
+}
@@ -0,0 +1,396 @@
+// Package invoice renders printable order documents (invoices and packing
+// slips) as PDF with a right-to-left Persian layout.
+package invoice
+
+import (
+	_ "embed"
+	"io"
+	"strconv"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/pdf"
+)
+
+//go:embed fonts/Vazirmatn-Regular.ttf
+var regularFont []byte
+
+//go:embed fonts/Vazirmatn-Bold.ttf
+var boldFont []byte
+
+// Seller holds the issuing company's details.
+type Seller struct {
+	Name         string
+	Address      string
+	Phone        string
+	EconomicCode string
+	Currency     string
+}
+
+const (
+	margin    = 36.0
+	rowHeight = 20.0
+	// bottom is the lowest y a table row may reach before a page break
+	bottom = pdf.A4Height - 60
+)
+
+// column describes a table column. Columns are listed right to left.
+type column struct {
+	title string
+	width float64
+	// numeric columns are drawn left-to-right and aligned to the left edge
+	numeric bool
+}
+
+// layout wraps a document with the fonts and cursor shared by both document
+// types.
+type layout struct {
+	doc     *pdf.Document
+	regular *pdf.Font
+	bold    *pdf.Font
+	page    *pdf.Page
+	y       float64
+}
+
+func newLayout(title string) (*layout, error) {
+	doc := pdf.New()
+	doc.SetTitle(title)
+
+	regular, err := doc.AddFont("Vazirmatn-Regular", regularFont)
+	if err != nil {
+		return nil, err
+	}
+	bold, err := doc.AddFont("Vazirmatn-Bold", boldFont)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &layout{doc: doc, regular: regular, bold: bold}
+	l.newPage()
+	return l, nil
+}
+
+func (l *layout) right() float64 { return l.doc.Width() - margin }
+func (l *layout) width() float64 { return l.doc.Width() - 2*margin }
+
+func (l *layout) newPage() {
+	l.page = l.doc.AddPage()
+	l.page.SetLineWidth(0.6)
+	l.y = margin
+}
+
+// header draws the document title and the key/value lines shown at the top
+// left of the first page.
+func (l *layout) header(title string, meta [][2]string) {
+	l.page.SetFont(l.bold, 16)
+	l.page.TextRight(l.right(), l.y+18, title)
+
+	l.page.SetFont(l.regular, 10)
+	y := l.y + 4
+	for _, kv := range meta {
+		y += 15
+		l.page.TextRight(margin+170, y, kv[0]+": "+kv[1])
+	}
+	l.y = y + 14
+}
+
+// box draws a titled box with one line per entry. Empty entries are
+// skipped.
+func (l *layout) box(title string, lines []string) {
+	var visible []string
+	for _, line := range lines {
+		if line != "" {
+			visible = append(visible, line)
+		}
+	}
+
+	height := rowHeight + float64(len(visible))*15 + 8
+	l.page.SetGray(0.92)
+	l.page.Rect(margin, l.y, l.width(), rowHeight, true)
+	l.page.SetGray(0)
+	l.page.Rect(margin, l.y, l.width(), height, false)
+
+	l.page.SetFont(l.bold, 10)
+	l.page.TextRight(l.right()-8, l.y+14, title)
+
+	l.page.SetFont(l.regular, 10)
+	y := l.y + rowHeight
+	for _, line := range visible {
+		y += 15
+		l.page.TextRight(l.right()-8, y, line)
+	}
+	l.y += height + 12
+}
+
+// tableHeader draws the header row of a table.
+func (l *layout) tableHeader(columns []column) {
+	l.page.SetGray(0.92)
+	l.page.Rect(margin, l.y, l.width(), rowHeight, true)
+	l.page.SetGray(0)
+	l.page.SetFont(l.bold, 9)
+	l.row(columns, titles(columns), true)
+}
+
+// row draws one table row and moves the cursor below it.
+func (l *layout) row(columns []column, cells []string, header bool) {
+	x := l.right()
+	for i, c := range columns {
+		x -= c.width
+		l.page.Rect(x, l.y, c.width, rowHeight, false)
+
+		text := fit(l.page, cells[i], c.width-8)
+		switch {
+		case header:
+			l.page.TextCenter(x+c.width/2, l.y+14, text)
+		case c.numeric:
+			l.page.Text(x+4, l.y+14, text)
+		default:
+			l.page.TextRight(x+c.width-4, l.y+14, text)
+		}
+	}
+	l.y += rowHeight
+}
+
+// table draws the header and rows, starting new pages (with a repeated
+// header) as needed.
+func (l *layout) table(columns []column, rows [][]string) {
+	l.tableHeader(columns)
+	l.page.SetFont(l.regular, 9)
+	for _, cells := range rows {
+		if l.y+rowHeight > bottom {
+			l.newPage()
+			l.tableHeader(columns)
+			l.page.SetFont(l.regular, 9)
+		}
+		l.row(columns, cells, false)
+	}
+	l.y += 12
+}
+
+// ensure starts a new page if less than height points remain.
+func (l *layout) ensure(height float64) {
+	if l.y+height > bottom {
+		l.newPage()
+	}
+}
+
+// finish numbers the pages and writes the document.
+func (l *layout) finish(w io.Writer) error {
+	pages := l.doc.Pages()
+	for i, p := range pages {
+		p.SetFont(l.regular, 8)
+		p.TextCenter(l.doc.Width()/2, l.doc.Height()-24,
+			"صفحه "+persianDigits(strconv.Itoa(i+1))+" از "+persianDigits(strconv.Itoa(len(pages))))
+	}
+	_, err := l.doc.WriteTo(w)
+	return err
+}
+
+func titles(columns []column) []string {
+	out := make([]string, len(columns))
+	for i, c := range columns {
+		out[i] = c.title
+	}
+	return out
+}
+
+// fit shortens s with an ellipsis until it fits into width.
+func fit(p *pdf.Page, s string, width float64) string {
+	if p.TextWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if candidate := string(runes) + "…"; p.TextWidth(candidate) <= width {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func customerName(order *models.Order) string {
+	if order.User == nil {
+		return ""
+	}
+	return order.User.Username
+}
+
+func productField(d models.OrderDetail, field func(*models.Product) string) string {
+	if d.Product == nil {
+		return ""
+	}
+	return field(d.Product)
+}
+
+func label(name, value string) string {
+	if value == "" {
+		return ""
+	}
+	return name + ": " + value
+}
+
+// WriteInvoice renders the sales invoice of an order. The order must be
+// loaded with its User and Details.Product relations.
+func WriteInvoice(w io.Writer, order *models.Order, inv *models.Invoice, seller Seller) error {
+	l, err := newLayout("Invoice " + strconv.FormatUint(uint64(inv.Number), 10))
+	if err != nil {
+		return err
+	}
+
+	l.header("صورتحساب فروش کالا", [][2]string{
+		{"شماره فاکتور", persianDigits(strconv.FormatUint(uint64(inv.Number), 10))},
+		{"تاریخ صدور", formatDate(inv.IssuedAt)},
+		{"شماره سفارش", persianDigits(strconv.FormatUint(uint64(order.ID), 10))},
+		{"تاریخ سفارش", formatDate(order.CreatedAt)},
+	})
+
+	l.box("مشخصات فروشنده", []string{
+		label("نام", seller.Name),
+		label("کد اقتصادی", seller.EconomicCode),
+		label("نشانی", seller.Address),
+		label("تلفن", seller.Phone),
+	})
+
+	var email, phone string
+	if order.User != nil {
+		email, phone = order.User.Email, order.User.Phone
+	}
+	l.box("مشخصات خریدار", []string{
+		label("نام", customerName(order)),
+		label("ایمیل", email),
+		label("تلفن", phone),
+		label("نشانی", order.Address),
+	})
+
+	columns := []column{
+		{title: "ردیف", width: 30},
+		{title: "کد کالا", width: 70},
+		{title: "شرح کالا", width: 150},
+		{title: "تعداد", width: 40, numeric: true},
+		{title: "مبلغ واحد", width: 80, numeric: true},
+		{title: "مالیات", width: 65, numeric: true},
+		{title: "مبلغ کل", width: l.width() - 435, numeric: true},
+	}
+
+	var subtotal float64
+	rows := make([][]string, len(order.Details))
+	for i, d := range order.Details {
+		subtotal += d.Subtotal
+		rows[i] = []string{
+			persianDigits(strconv.Itoa(i + 1)),
+			productField(d, func(p *models.Product) string { return p.SKU }),
+			productField(d, func(p *models.Product) string { return p.Name }),
+			formatNumber(int64(d.Quantity)),
+			formatAmount(d.UnitPrice),
+			formatAmount(d.Tax),
+			formatAmount(d.Subtotal + d.Tax),
+		}
+	}
+	l.table(columns, rows)
+
+	// Totals; the payable amount is the total charged to the wallet
+	totals := [][2]string{
+		{"جمع کالاها", formatAmount(subtotal)},
+		{"مالیات بر ارزش افزوده", formatAmount(order.Tax)},
+		{"هزینه ارسال", formatAmount(order.ShippingCost)},
+		{"مبلغ قابل پرداخت", formatAmount(order.Total)},
+	}
+	l.ensure(float64(len(totals))*rowHeight + 90)
+
+	boxWidth := 240.0
+	for i, t := range totals {
+		font := l.regular
+		if i == len(totals)-1 {
+			font = l.bold
+			l.page.SetGray(0.92)
+			l.page.Rect(margin, l.y, boxWidth, rowHeight, true)
+			l.page.SetGray(0)
+		}
+		l.page.Rect(margin, l.y, boxWidth, rowHeight, false)
+		l.page.SetFont(font, 10)
+		l.page.TextRight(margin+boxWidth-6, l.y+14, t[0])
+		l.page.Text(margin+6, l.y+14, t[1])
+		l.y += rowHeight
+	}
+
+	l.page.SetFont(l.regular, 9)
+	l.y += 14
+	l.page.TextRight(l.right(), l.y, "مبالغ به "+seller.Currency+" است.")
+	if order.PaymentMethod != "" {
+		l.y += 14
+		l.page.TextRight(l.right(), l.y, "روش پرداخت: "+order.PaymentMethod)
+	}
+
+	// Signatures
+	l.y += 40
+	l.page.SetFont(l.bold, 10)
+	l.page.TextRight(l.right(), l.y, "مهر و امضای فروشنده")
+	l.page.TextRight(margin+150, l.y, "مهر و امضای خریدار")
+
+	return l.finish(w)
+}
+
+// WritePackingSlip renders the warehouse packing slip of an order. It lists
+// products and quantities without prices. The order must be loaded with its
+// User and Details.Product relations.
+func WritePackingSlip(w io.Writer, order *models.Order, seller Seller) error {
+	l, err := newLayout("Packing slip " + strconv.FormatUint(uint64(order.ID), 10))
+	if err != nil {
+		return err
+	}
+
+	l.header("برگه بسته‌بندی", [][2]string{
+		{"شماره سفارش", persianDigits(strconv.FormatUint(uint64(order.ID), 10))},
+		{"تاریخ سفارش", formatDate(order.CreatedAt)},
+	})
+
+	l.box("فرستنده", []string{
+		label("نام", seller.Name),
+		label("نشانی", seller.Address),
+		label("تلفن", seller.Phone),
+	})
+
+	var phone string
+	if order.User != nil {
+		phone = order.User.Phone
+	}
+	l.box("گیرنده", []string{
+		label("نام", customerName(order)),
+		label("تلفن", phone),
+		label("نشانی", order.Address),
+	})
+
+	columns := []column{
+		{title: "ردیف", width: 30},
+		{title: "کد کالا", width: 90},
+		{title: "شرح کالا", width: 200},
+		{title: "مدل", width: 90},
+		{title: "تعداد", width: 50, numeric: true},
+		{title: "کنترل", width: l.width() - 460},
+	}
+
+	var items int
+	rows := make([][]string, len(order.Details))
+	for i, d := range order.Details {
+		items += d.Quantity
+		rows[i] = []string{
+			persianDigits(strconv.Itoa(i + 1)),
+			productField(d, func(p *models.Product) string { return p.SKU }),
+			productField(d, func(p *models.Product) string { return p.Name }),
+			productField(d, func(p *models.Product) string { return p.ModelNumber }),
+			formatNumber(int64(d.Quantity)),
+			"",
+		}
+	}
+	l.table(columns, rows)
+
+	l.ensure(80)
+	l.page.SetFont(l.bold, 10)
+	l.page.TextRight(l.right(), l.y+6, "تعداد کل اقلام: "+formatNumber(int64(items)))
+
+	l.y += 50
+	l.page.TextRight(l.right(), l.y, "امضای بسته‌بند")
+	l.page.TextRight(margin+150, l.y, "امضای تحویل‌گیرنده")
+
+	return l.finish(w)
+}
@@ -35,3 +35,20 @@ func AuthMiddleware(cfg *config.Configuration) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// OptionalAuthMiddleware stores the user's claims when a valid bearer token
+// is sent, and lets anonymous requests through unchanged. Public routes use it
+// to tailor their response to the signed-in user.
+func OptionalAuthMiddleware(cfg *config.Configuration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.Split(r.Header.Get("Authorization"), " ")
+			if len(parts) == 2 && parts[0] == "Bearer" {
+				if claims, err := utils.ValidateToken(parts[1], cfg.JWTSecret); err == nil {
+					r = r.WithContext(utils.SetUserContext(r.Context(), claims))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
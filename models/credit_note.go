@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// CreditNote is store credit issued to a customer for returned goods instead
+// of a wallet refund.
+type CreditNote struct {
+	gorm.Model
+	UserID          uint    `gorm:"index;not null" json:"user_id"`
+	User            *User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user,omitempty"`
+	ReturnRequestID uint    `gorm:"uniqueIndex;not null" json:"return_request_id"`
+	Amount          float64 `gorm:"type:numeric;not null" json:"amount"`
+	Note            string  `json:"note,omitempty"`
+}
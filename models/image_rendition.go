@@ -0,0 +1,32 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ImageRendition is one resized version of an uploaded image. WebPURL is
+// empty on images saved while WebP versions were only kept when smaller.
+type ImageRendition struct {
+	Name    string `json:"name"` // thumbnail, medium or large
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	URL     string `json:"url"`
+	WebPURL string `json:"webp_url,omitempty"`
+}
+
+// Srcset formats renditions, smallest first, as an HTML srcset of their
+// JPEG/PNG or, with webp set, their WebP URLs.
+func Srcset(renditions []ImageRendition, webp bool) string {
+	var parts []string
+	for _, r := range renditions {
+		url := r.URL
+		if webp {
+			url = r.WebPURL
+		}
+		if url != "" {
+			parts = append(parts, url+" "+strconv.Itoa(r.Width)+"w")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
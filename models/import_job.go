@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Import job statuses
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportJob tracks a bulk product import running in the background. A dry
+// run validates every row without saving anything.
+type ImportJob struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null" json:"user_id"`
+	Filename string `json:"filename"`
+	Format   string `gorm:"not null" json:"format"`
+	DryRun   bool   `gorm:"not null;default:false" json:"dry_run"`
+	Status   string `gorm:"not null;default:'pending';index" json:"status"`
+
+	Total     int `gorm:"not null;default:0" json:"total"`
+	Processed int `gorm:"not null;default:0" json:"processed"`
+	Created   int `gorm:"not null;default:0" json:"created"`
+	Updated   int `gorm:"not null;default:0" json:"updated"`
+	Failed    int `gorm:"not null;default:0" json:"failed"`
+
+	// Errors of the failed rows, capped at MaxImportErrors
+	Errors []ImportRowError `gorm:"serializer:json" json:"errors"`
+	// Error is set when the whole job failed
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// MaxImportErrors bounds the row errors kept on an ImportJob.
+const MaxImportErrors = 1000
+
+// ImportRowError is a validation or save error of one row of an import file.
+// Row is the line number in the file, the header being line 1.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	SKU     string `json:"sku,omitempty"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invoice records the sequential invoice number issued for an order.
+// Numbers are assigned once, on first issue, and never reused.
+type Invoice struct {
+	gorm.Model
+	OrderID  uint      `gorm:"uniqueIndex;not null" json:"order_id"`
+	Order    *Order    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"order,omitempty"`
+	Number   uint      `gorm:"uniqueIndex;not null" json:"number"`
+	IssuedAt time.Time `gorm:"not null" json:"issued_at"`
+}
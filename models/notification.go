@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification types
+const (
+	NotificationQuestionAnswered = "question_answered"
+	NotificationBackInStock      = "back_in_stock"
+)
+
+// Notification is a message shown to a user in the app, such as an answer
+// to their question.
+type Notification struct {
+	gorm.Model
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	User   *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Type   string `gorm:"size:50;not null" json:"type"`
+	Title  string `gorm:"not null" json:"title"`
+	Body   string `gorm:"type:text" json:"body,omitempty"`
+	// Storefront path the notification links to, e.g. /products/12
+	Link   string     `json:"link,omitempty"`
+	ReadAt *time.Time `gorm:"index" json:"read_at,omitempty"`
+}
@@ -9,9 +9,12 @@ type Order struct {
 	User   *User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user,omitempty"`
 
 	Total         float64 `gorm:"type:numeric;not null;default:0" json:"total"`
+	Tax           float64 `gorm:"type:numeric;not null;default:0" json:"tax"`
+	ShippingCost  float64 `gorm:"type:numeric;not null;default:0" json:"shipping_cost"`
 	Status        string  `gorm:"not null;default:'pending'" json:"status"`
 	Address       string  `json:"address,omitempty"`
 	PaymentMethod string  `json:"payment_method,omitempty"`
 
-	Details []OrderDetail `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"details,omitempty"`
+	Details   []OrderDetail `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"details,omitempty"`
+	Shipments []Shipment    `gorm:"foreignKey:OrderID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"shipments,omitempty"`
 }
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // OrderDetail is a line item in an order linking product and quantity.
 type OrderDetail struct {
@@ -11,7 +15,25 @@ type OrderDetail struct {
 	ProductID uint     `json:"product_id"`
 	Product   *Product `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"product,omitempty"`
 
+	// Optional size/color chosen for the line
+	SizeID  *uint         `json:"size_id,omitempty"`
+	Size    *ProductSize  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"size,omitempty"`
+	ColorID *uint         `json:"color_id,omitempty"`
+	Color   *ProductColor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"color,omitempty"`
+
+	// Variant chosen for the line; required when the product has variants
+	VariantID *uint           `json:"variant_id,omitempty"`
+	Variant   *ProductVariant `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"variant,omitempty"`
+
 	Quantity  int     `gorm:"not null;default:1" json:"quantity"`
 	UnitPrice float64 `gorm:"type:numeric;not null" json:"unit_price"`
 	Subtotal  float64 `gorm:"type:numeric;not null" json:"subtotal"`
+	Tax       float64 `gorm:"type:numeric;not null;default:0" json:"tax"`
+
+	// Units of Quantity still waiting for stock. Lines are allocated in FIFO
+	// order as stock arrives.
+	BackorderedQuantity int        `gorm:"not null;default:0;index" json:"backordered_quantity"`
+	PreOrder            bool       `gorm:"not null;default:false" json:"pre_order"`
+	ExpectedAt          *time.Time `json:"expected_at,omitempty"`
+	AllocatedAt         *time.Time `json:"allocated_at,omitempty"`
 }
@@ -1,6 +1,57 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Stock policies decide what happens when an order asks for more than the
+// available stock.
+const (
+	StockPolicyDeny      = "deny"      // reject the order
+	StockPolicyBackorder = "backorder" // accept and ship when restocked
+	StockPolicyPreorder  = "preorder"  // accept before the product is released
+)
+
+// Publishing statuses. Products are written as drafts, submitted for review
+// and published by a user with PermissionPublishProducts; only published
+// products are shown in the storefront.
+const (
+	ProductDraft     = "draft"
+	ProductInReview  = "in_review"
+	ProductPublished = "published"
+	ProductArchived  = "archived"
+)
+
+// PermissionPublishProducts lets a role publish, reject, archive and
+// schedule products.
+const PermissionPublishProducts = "products.publish"
+
+// productTransitions lists the statuses each status may move to.
+var productTransitions = map[string][]string{
+	ProductDraft:     {ProductInReview, ProductArchived},
+	ProductInReview:  {ProductDraft, ProductPublished, ProductArchived},
+	ProductPublished: {ProductArchived},
+	ProductArchived:  {ProductDraft},
+}
+
+// ValidProductStatus reports whether s is a publishing status.
+func ValidProductStatus(s string) bool {
+	_, ok := productTransitions[s]
+	return ok
+}
+
+// CanTransition reports whether a product may move from one publishing
+// status to another.
+func CanTransition(from, to string) bool {
+	for _, s := range productTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
 
 // Product represents a sellable item (kitchen appliance).
 type Product struct {
@@ -10,7 +61,9 @@ type Product struct {
 	SKU         string `gorm:"uniqueIndex;not null" json:"sku"`
 	Stock       int    `gorm:"not null;default:0" json:"stock"`
 
-	// Additional fields for kitchen appliances
+	// Additional fields for kitchen appliances. Dimensions, Power, Material,
+	// Capacity and Features predate category spec schemas (see Specs) and are
+	// kept for existing clients until migrated.
 	ModelNumber string  `json:"model_number,omitempty"`
 	Warranty    string  `json:"warranty,omitempty"`
 	Weight      float64 `json:"weight,omitempty"`
@@ -21,6 +74,18 @@ type Product struct {
 	Features    string  `json:"features,omitempty"`
 	IsActive    bool    `gorm:"default:true" json:"is_active"`
 
+	// Publishing workflow. Products saved before it existed are published.
+	// PublishAt publishes a product in review and UnpublishAt archives a
+	// published one when the time comes (see the publishing package).
+	Status      string     `gorm:"size:20;not null;default:'published';index" json:"status"`
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	UnpublishAt *time.Time `json:"unpublish_at,omitempty"`
+
+	// Back-order / pre-order settings
+	StockPolicy    string     `gorm:"not null;default:'deny'" json:"stock_policy"`
+	AvailableAt    *time.Time `json:"available_at,omitempty"`                    // expected restock or release date
+	BackorderLimit int        `gorm:"not null;default:0" json:"backorder_limit"` // max units waiting, 0 = unlimited
+
 	// Category relation
 	CategoryID *uint     `json:"category_id,omitempty"`
 	Category   *Category `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"category,omitempty"`
@@ -29,6 +94,10 @@ type Product struct {
 	BrandID *uint  `json:"brand_id,omitempty"`
 	Brand   *Brand `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"brand,omitempty"`
 
+	// Approved reviews, kept up to date by ReviewRepository
+	RatingAverage float64 `gorm:"type:numeric(3,2);not null;default:0" json:"rating_average"`
+	RatingCount   int     `gorm:"not null;default:0" json:"rating_count"`
+
 	// Product images
 	Images []ProductImage `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"images,omitempty"`
 
@@ -38,6 +107,13 @@ type Product struct {
 	// Product colors
 	Colors []ProductColor `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"colors,omitempty"`
 
+	// Options (size, color, voltage...) and their combinations
+	Options  []ProductOption  `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"options,omitempty"`
+	Variants []ProductVariant `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"variants,omitempty"`
+
+	// Values of the category's specification schema
+	Specs []ProductSpec `gorm:"foreignKey:ProductID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"specs,omitempty"`
+
 	// Prices (dynamic per group)
 	Prices []ProductPrice `gorm:"foreignKey:ProductID" json:"prices,omitempty"`
 
@@ -47,6 +123,25 @@ type Product struct {
 	// Groups for restricted visibility
 	Groups []Group `gorm:"many2many:group_products;" json:"groups,omitempty"`
 
+	// Full-text search index, maintained by ProductRepository.RefreshSearch.
+	// Never read or written through the model.
+	SearchVector string `gorm:"type:tsvector;index:idx_products_search_vector,type:gin;->:false;<-:false" json:"-"`
+	SearchText   string `gorm:"->:false;<-:false" json:"-"` // normalized name, description and Q&A, for snippets
+
 	// فیلد موقت برای نمایش قیمت پویا در JSON (نه در دیتابیس)
 	Price float64 `gorm:"-" json:"price,omitempty"`
+
+	// Related products the user may see, by relation type; set on the
+	// product page only
+	Relations map[string][]RelatedProduct `gorm:"-" json:"relations,omitempty"`
+}
+
+// IsPublished reports whether the product is shown in the storefront.
+func (p *Product) IsPublished() bool {
+	return p.Status == ProductPublished
+}
+
+// AllowsBackorder reports whether orders may exceed the available stock.
+func (p *Product) AllowsBackorder() bool {
+	return p.StockPolicy == StockPolicyBackorder || p.StockPolicy == StockPolicyPreorder
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductAnswer answers a product question. Answers by admins are approved
+// when posted; those by customers who bought the product are moderated.
+type ProductAnswer struct {
+	gorm.Model
+	QuestionID uint             `gorm:"not null;index" json:"question_id"`
+	Question   *ProductQuestion `json:"question,omitempty"`
+	UserID     uint             `gorm:"not null;index" json:"user_id"`
+	User       *User            `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Username of the author, set when answers are read
+	AuthorName string `gorm:"-" json:"author_name,omitempty"`
+	// Whether the author answered as staff or as a verified buyer
+	IsStaff         bool `gorm:"not null;default:false" json:"is_staff"`
+	IsVerifiedBuyer bool `gorm:"not null;default:false" json:"is_verified_buyer"`
+
+	Body string `gorm:"type:text;not null" json:"body"`
+
+	Status         string     `gorm:"not null;default:'pending';index" json:"status"`
+	ModerationNote string     `json:"moderation_note,omitempty"`
+	ModeratedByID  *uint      `json:"moderated_by_id,omitempty"`
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+}
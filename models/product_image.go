@@ -11,5 +11,27 @@ type ProductImage struct {
 	Alt       string  `json:"alt,omitempty"`       // Alt text for accessibility
 	IsPrimary bool    `gorm:"default:false" json:"is_primary"` // Primary image for the product
 	Order     int     `gorm:"default:0" json:"order"`           // Display order
+	VariantID *uint   `gorm:"index" json:"variant_id,omitempty"` // set for images of one variant
+
+	// Resized versions of uploaded images; URL is the largest of them
+	Width      int              `json:"width,omitempty"`
+	Height     int              `json:"height,omitempty"`
+	Renditions []ImageRendition `gorm:"serializer:json" json:"renditions,omitempty"`
+	Srcset     string           `json:"srcset,omitempty"`      // for <img srcset>
+	WebPSrcset string           `json:"webp_srcset,omitempty"` // for <source type="image/webp">
+}
+
+// SetRenditions stores the resized versions of the image and points URL,
+// the size and the srcsets at them.
+func (i *ProductImage) SetRenditions(renditions []ImageRendition) {
+	i.Renditions = renditions
+	if len(renditions) == 0 {
+		return
+	}
+	largest := renditions[len(renditions)-1]
+	i.URL = largest.URL
+	i.Width, i.Height = largest.Width, largest.Height
+	i.Srcset = Srcset(renditions, false)
+	i.WebPSrcset = Srcset(renditions, true)
 }
 
@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProductOption is an axis along which a product varies, such as size,
+// color or voltage. Every variant of the product picks one of its values.
+type ProductOption struct {
+	gorm.Model
+	ProductID uint                 `gorm:"not null;uniqueIndex:idx_product_options_product_name" json:"product_id"`
+	Product   *Product             `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Name      string               `gorm:"not null;uniqueIndex:idx_product_options_product_name" json:"name"`
+	Position  int                  `gorm:"not null;default:0" json:"position"`
+	Values    []ProductOptionValue `gorm:"foreignKey:OptionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"values"`
+}
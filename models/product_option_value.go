@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProductOptionValue is one value of a ProductOption, e.g. "Red" or "220V".
+type ProductOptionValue struct {
+	gorm.Model
+	OptionID uint   `gorm:"not null;uniqueIndex:idx_product_option_values_option_value" json:"option_id"`
+	Value    string `gorm:"not null;uniqueIndex:idx_product_option_values_option_value" json:"value"`
+	HexCode  string `json:"hex_code,omitempty"` // swatch for color values
+	Position int    `gorm:"not null;default:0" json:"position"`
+}
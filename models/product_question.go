@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Moderation statuses of product questions and answers. Only approved ones
+// are shown and indexed for product search.
+const (
+	QAStatusPending  = "pending"
+	QAStatusApproved = "approved"
+	QAStatusRejected = "rejected"
+)
+
+// ProductQuestion is a question a customer asked about a product, answered
+// by admins or customers who bought it.
+type ProductQuestion struct {
+	gorm.Model
+	ProductID uint     `gorm:"not null;index" json:"product_id"`
+	Product   *Product `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"product,omitempty"`
+	UserID    uint     `gorm:"not null;index" json:"user_id"`
+	User      *User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Username of the asker, set when questions are read
+	AuthorName string `gorm:"-" json:"author_name,omitempty"`
+
+	Body string `gorm:"type:text;not null" json:"body"`
+
+	Status         string     `gorm:"not null;default:'pending';index" json:"status"`
+	ModerationNote string     `json:"moderation_note,omitempty"` // why it was rejected, shown to the asker
+	ModeratedByID  *uint      `json:"moderated_by_id,omitempty"`
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+
+	Answers []ProductAnswer `gorm:"foreignKey:QuestionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"answers,omitempty"`
+}
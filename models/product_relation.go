@@ -0,0 +1,61 @@
+package models
+
+import "gorm.io/gorm"
+
+// Product relation types. A relation reads "Related is a <type> of
+// Product": an accessory or spare part for it, a replacement for it, or a
+// pricier upsell.
+const (
+	RelationRelated        = "related"
+	RelationAccessory      = "accessory"
+	RelationSparePart      = "spare_part"
+	RelationReplacementFor = "replacement_for"
+	RelationUpsell         = "upsell"
+)
+
+// RelationTypes lists the relation types in display order.
+var RelationTypes = []string{
+	RelationRelated, RelationAccessory, RelationSparePart, RelationReplacementFor, RelationUpsell,
+}
+
+// ProductRelation links a product to another one, managed by admins.
+type ProductRelation struct {
+	gorm.Model
+	ProductID uint     `gorm:"not null;uniqueIndex:idx_product_relations_unique" json:"product_id"`
+	Product   *Product `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	RelatedID uint     `gorm:"not null;uniqueIndex:idx_product_relations_unique;index" json:"related_id"`
+	Related   *Product `gorm:"foreignKey:RelatedID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"related,omitempty"`
+	Type      string   `gorm:"size:30;not null;uniqueIndex:idx_product_relations_unique" json:"type"`
+	Note      string   `json:"note,omitempty"` // e.g. "fits the 2019 revision only"
+	Position  int      `gorm:"not null;default:0" json:"position"`
+}
+
+// RelatedProduct is a related product as listed on another product's page.
+type RelatedProduct struct {
+	RelationID    uint     `json:"relation_id"`
+	Type          string   `json:"type"`
+	Note          string   `json:"note,omitempty"`
+	Position      int      `json:"position"`
+	ID            uint     `json:"id"`
+	Name          string   `json:"name"`
+	SKU           string   `json:"sku"`
+	ModelNumber   string   `json:"model_number,omitempty"`
+	BrandName     string   `json:"brand_name,omitempty"`
+	Image         string   `json:"image,omitempty"` // primary image URL
+	Price         *float64 `json:"price,omitempty"` // the user's group price; nil for anonymous users
+	InStock       bool     `json:"in_stock"`
+	Stock         *int     `json:"stock,omitempty"`  // admins only
+	Status        string   `json:"status,omitempty"` // admins only
+	RatingAverage float64  `json:"rating_average"`
+	RatingCount   int      `json:"rating_count"`
+}
+
+// ValidRelationType reports whether t is a known relation type.
+func ValidRelationType(t string) bool {
+	for _, known := range RelationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
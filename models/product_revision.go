@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Revision actions: what kind of change a revision records.
+const (
+	RevisionBaseline = "baseline" // state before the first recorded change
+	RevisionCreate   = "create"
+	RevisionUpdate   = "update"
+	RevisionPrices   = "prices"
+	RevisionImages   = "images"
+	RevisionVariants = "variants"
+	RevisionImport   = "import"
+	RevisionRevert   = "revert"
+)
+
+// ProductRevision is the state of a product, its prices, images and
+// variants after a change, with who made it and how it differs from the
+// state before. Stock is not part of revisions; it changes with every order.
+type ProductRevision struct {
+	gorm.Model
+	ProductID uint             `gorm:"not null;index" json:"product_id"`
+	Product   *Product         `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	UserID    *uint            `gorm:"index" json:"user_id,omitempty"` // nil for changes made by the system
+	User      *User            `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+	Action    string           `gorm:"size:20;not null" json:"action"`
+	Snapshot  *ProductSnapshot `gorm:"type:jsonb;serializer:json;not null" json:"snapshot,omitempty"` // not set on lists
+	Changes   []FieldChange    `gorm:"type:jsonb;serializer:json" json:"changes"`
+	// For reverts, the revision that was restored
+	RevertedFrom *uint `json:"reverted_from,omitempty"`
+
+	Username string `gorm:"-" json:"username,omitempty"` // author, set on lists
+}
+
+// FieldChange is one changed value. Field is a path such as "name",
+// "prices.group:3", "images.12.alt" or "variants.40.sku"; Old is nil for
+// added values and New for removed ones.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// ProductSnapshot is the revisioned state of a product.
+type ProductSnapshot struct {
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	SKU            string            `json:"sku"`
+	ModelNumber    string            `json:"model_number"`
+	Warranty       string            `json:"warranty"`
+	Weight         float64           `json:"weight"`
+	Dimensions     string            `json:"dimensions"`
+	Power          string            `json:"power"`
+	Material       string            `json:"material"`
+	Capacity       string            `json:"capacity"`
+	Features       string            `json:"features"`
+	IsActive       bool              `json:"is_active"`
+	StockPolicy    string            `json:"stock_policy"`
+	AvailableAt    *time.Time        `json:"available_at"`
+	BackorderLimit int               `json:"backorder_limit"`
+	CategoryID     *uint             `json:"category_id"`
+	BrandID        *uint             `json:"brand_id"`
+	Prices         []SnapshotPrice   `json:"prices"`
+	Images         []SnapshotImage   `json:"images"`
+	Variants       []SnapshotVariant `json:"variants"`
+}
+
+// SnapshotPrice is a product or variant price; GroupID nil is the default.
+type SnapshotPrice struct {
+	GroupID *uint   `json:"group_id"`
+	Price   float64 `json:"price"`
+}
+
+type SnapshotImage struct {
+	ID        uint   `json:"id"`
+	URL       string `json:"url"`
+	Alt       string `json:"alt"`
+	IsPrimary bool   `json:"is_primary"`
+	Order     int    `json:"order"`
+	VariantID *uint  `json:"variant_id"`
+}
+
+type SnapshotVariant struct {
+	ID       uint            `json:"id"`
+	Label    string          `json:"label"` // option values, e.g. "Red / Large"
+	SKU      string          `json:"sku"`
+	Barcode  string          `json:"barcode"`
+	IsActive bool            `json:"is_active"`
+	Prices   []SnapshotPrice `json:"prices"`
+}
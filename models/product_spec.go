@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProductSpec is a product's value for one SpecAttribute. Value is the
+// canonical text form; Number is also set for number attributes so they can
+// be range-filtered.
+type ProductSpec struct {
+	gorm.Model
+	ProductID   uint           `gorm:"not null;uniqueIndex:idx_product_specs_product_attribute" json:"product_id"`
+	AttributeID uint           `gorm:"not null;uniqueIndex:idx_product_specs_product_attribute;index" json:"attribute_id"`
+	Attribute   *SpecAttribute `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"attribute,omitempty"`
+	Value       string         `gorm:"not null" json:"value"`
+	Number      *float64       `json:"number,omitempty"`
+}
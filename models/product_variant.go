@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+// ProductVariant is one combination of a product's option values with its
+// own SKU, barcode, stock, prices and images. When a product has variants,
+// its Stock is the sum of theirs.
+type ProductVariant struct {
+	gorm.Model
+	ProductID uint     `gorm:"not null;uniqueIndex:idx_product_variants_product_signature" json:"product_id"`
+	Product   *Product `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Signature is the sorted IDs of the variant's option values, e.g. "3-8"
+	Signature string `gorm:"not null;uniqueIndex:idx_product_variants_product_signature" json:"signature"`
+	SKU       string `gorm:"uniqueIndex;not null" json:"sku"`
+	Barcode   string `gorm:"index" json:"barcode,omitempty"`
+	Stock     int    `gorm:"not null;default:0" json:"stock"`
+	IsActive  bool   `gorm:"not null;default:true" json:"is_active"`
+
+	Values []ProductOptionValue `gorm:"many2many:product_variant_values;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"values"`
+	Prices []VariantPrice       `gorm:"foreignKey:VariantID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"prices,omitempty"`
+	Images []ProductImage       `gorm:"foreignKey:VariantID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"images,omitempty"`
+
+	// Price for the user's groups, falling back to the product's price
+	Price float64 `gorm:"-" json:"price,omitempty"`
+}
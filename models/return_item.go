@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+// Dispositions of returned goods.
+const (
+	ReturnDispositionRestock  = "restock"
+	ReturnDispositionWriteOff = "write_off"
+)
+
+// ReturnItem is an order line (and quantity) included in a return request.
+type ReturnItem struct {
+	gorm.Model
+	ReturnRequestID uint         `gorm:"index;not null" json:"return_request_id"`
+	OrderDetailID   uint         `gorm:"index;not null" json:"order_detail_id"`
+	OrderDetail     *OrderDetail `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"order_detail,omitempty"`
+	Quantity        int          `gorm:"not null" json:"quantity"`
+
+	// Filled in when the goods arrive
+	ReceivedQuantity int    `gorm:"not null;default:0" json:"received_quantity"`
+	Disposition      string `json:"disposition,omitempty"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "gorm.io/gorm"
+
+// ReturnPhoto is a picture of the returned goods uploaded by the customer.
+type ReturnPhoto struct {
+	gorm.Model
+	ReturnRequestID uint   `gorm:"index;not null" json:"return_request_id"`
+	URL             string `gorm:"not null" json:"url"`
+}
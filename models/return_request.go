@@ -0,0 +1,38 @@
+package models
+
+import "gorm.io/gorm"
+
+// Return (RMA) statuses.
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusCancelled = "cancelled"
+	ReturnStatusReceived  = "received"
+	ReturnStatusRefunded  = "refunded" // refunded to the wallet
+	ReturnStatusCredited  = "credited" // credit note issued
+)
+
+// ReturnRequest is a customer's request (RMA) to send back order lines.
+type ReturnRequest struct {
+	gorm.Model
+	OrderID uint   `gorm:"index;not null" json:"order_id"`
+	Order   *Order `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"order,omitempty"`
+	UserID  uint   `gorm:"index;not null" json:"user_id"`
+	User    *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"user,omitempty"`
+
+	Status    string `gorm:"not null;default:'requested';index" json:"status"`
+	Reason    string `gorm:"not null" json:"reason"`
+	Note      string `json:"note,omitempty"`       // customer's description
+	AdminNote string `json:"admin_note,omitempty"` // visible to the customer
+
+	// Set when the goods are received
+	Resolution   string  `json:"resolution,omitempty"` // refund or credit_note
+	RefundAmount float64 `gorm:"type:numeric;not null;default:0" json:"refund_amount"`
+
+	Items   []ReturnItem          `gorm:"foreignKey:ReturnRequestID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"items,omitempty"`
+	Photos  []ReturnPhoto         `gorm:"foreignKey:ReturnRequestID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"photos,omitempty"`
+	History []ReturnStatusHistory `gorm:"foreignKey:ReturnRequestID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"history,omitempty"`
+
+	CreditNote *CreditNote `gorm:"foreignKey:ReturnRequestID" json:"credit_note,omitempty"`
+}
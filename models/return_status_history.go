@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// ReturnStatusHistory records every status change of a return request.
+type ReturnStatusHistory struct {
+	gorm.Model
+	ReturnRequestID uint   `gorm:"index;not null" json:"return_request_id"`
+	FromStatus      string `json:"from_status,omitempty"`
+	ToStatus        string `gorm:"not null" json:"to_status"`
+	Note            string `json:"note,omitempty"`
+	ChangedByID     uint   `json:"changed_by_id"`
+	ChangedBy       *User  `gorm:"foreignKey:ChangedByID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"changed_by,omitempty"`
+}
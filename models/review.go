@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Review moderation statuses. Only approved reviews are shown and counted
+// in the product's rating.
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// Review is a customer's rating and opinion of a product they bought.
+// A user reviews a product once; editing sends the review back to
+// moderation.
+type Review struct {
+	gorm.Model
+	ProductID uint     `gorm:"not null;uniqueIndex:idx_reviews_product_user" json:"product_id"`
+	Product   *Product `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"product,omitempty"`
+	UserID    uint     `gorm:"not null;uniqueIndex:idx_reviews_product_user;index" json:"user_id"`
+	User      *User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	// Username of the author, set when reviews are read
+	AuthorName string `gorm:"-" json:"author_name,omitempty"`
+
+	Rating int    `gorm:"not null" json:"rating"` // 1 to 5
+	Title  string `gorm:"size:200" json:"title,omitempty"`
+	Body   string `gorm:"type:text" json:"body,omitempty"`
+
+	Status         string     `gorm:"not null;default:'pending';index" json:"status"`
+	ModerationNote string     `json:"moderation_note,omitempty"` // why it was rejected, shown to the author
+	ModeratedByID  *uint      `json:"moderated_by_id,omitempty"`
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+
+	// Votes of other users on whether the review helped them
+	HelpfulCount   int `gorm:"not null;default:0" json:"helpful_count"`
+	UnhelpfulCount int `gorm:"not null;default:0" json:"unhelpful_count"`
+
+	Photos []ReviewPhoto `gorm:"foreignKey:ReviewID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"photos,omitempty"`
+
+	// The caller's vote, set on listings for signed-in users
+	MyVote *bool `gorm:"-" json:"my_vote,omitempty"`
+}
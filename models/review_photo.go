@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// ReviewPhoto is a picture attached to a review. URL is the largest
+// rendition.
+type ReviewPhoto struct {
+	gorm.Model
+	ReviewID   uint             `gorm:"index;not null" json:"review_id"`
+	URL        string           `gorm:"not null" json:"url"`
+	Renditions []ImageRendition `gorm:"serializer:json" json:"renditions,omitempty"`
+}
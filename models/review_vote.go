@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+// ReviewVote is a user's verdict on whether a review was helpful.
+type ReviewVote struct {
+	gorm.Model
+	ReviewID uint `gorm:"not null;uniqueIndex:idx_review_votes_review_user" json:"review_id"`
+	UserID   uint `gorm:"not null;uniqueIndex:idx_review_votes_review_user" json:"user_id"`
+	Helpful  bool `gorm:"not null" json:"helpful"`
+}
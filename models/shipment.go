@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Shipment is one package sent for an order. An order may be shipped in
+// several packages, each carrying some or all units of its lines.
+type Shipment struct {
+	gorm.Model
+	OrderID uint   `gorm:"index;not null" json:"order_id"`
+	Order   *Order `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"order,omitempty"`
+
+	Carrier        string `gorm:"not null" json:"carrier"`
+	TrackingNumber string `gorm:"index" json:"tracking_number,omitempty"`
+	TrackingURL    string `json:"tracking_url,omitempty"`
+	Note           string `json:"note,omitempty"`
+
+	ShippedAt   *time.Time `json:"shipped_at,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+
+	Items []ShipmentItem `gorm:"foreignKey:ShipmentID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"items,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// ShipmentItem is the quantity of an order line packed in a shipment.
+type ShipmentItem struct {
+	gorm.Model
+	ShipmentID    uint         `gorm:"index;not null" json:"shipment_id"`
+	OrderDetailID uint         `gorm:"index;not null" json:"order_detail_id"`
+	OrderDetail   *OrderDetail `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"order_detail,omitempty"`
+	Quantity      int          `gorm:"not null" json:"quantity"`
+}
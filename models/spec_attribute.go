@@ -0,0 +1,28 @@
+package models
+
+import "gorm.io/gorm"
+
+// Types of specification attributes.
+const (
+	SpecTypeText    = "text"
+	SpecTypeNumber  = "number"
+	SpecTypeBoolean = "boolean"
+	SpecTypeEnum    = "enum"
+)
+
+// SpecAttribute is one attribute of a category's specification schema, such
+// as a fridge's capacity in liters. Subcategories inherit the attributes of
+// their ancestors; a key is unique along each branch of the tree.
+type SpecAttribute struct {
+	gorm.Model
+	CategoryID uint      `gorm:"not null;index" json:"category_id"`
+	Category   *Category `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Key        string    `gorm:"size:64;not null;index" json:"key"` // used in filters: spec.<key>=
+	Name       string    `gorm:"not null" json:"name"`
+	Type       string    `gorm:"size:16;not null;default:'text'" json:"type"`
+	Unit       string    `json:"unit,omitempty"`
+	Options    []string  `gorm:"serializer:json" json:"options,omitempty"` // allowed values of enum attributes
+	Required   bool      `gorm:"not null;default:false" json:"required"`
+	Filterable bool      `gorm:"not null;default:false" json:"filterable"`
+	Position   int       `gorm:"not null;default:0" json:"position"`
+}
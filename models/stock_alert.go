@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StockAlert asks for a notification when an out-of-stock product, or one
+// of its variants, can be bought again. It is sent once; NotifiedAt is then
+// set.
+type StockAlert struct {
+	gorm.Model
+	UserID     uint            `gorm:"not null;index" json:"user_id"`
+	User       *User           `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	ProductID  uint            `gorm:"not null;index" json:"product_id"`
+	Product    *Product        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"product,omitempty"`
+	VariantID  *uint           `gorm:"index" json:"variant_id,omitempty"`
+	Variant    *ProductVariant `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"variant,omitempty"`
+	NotifiedAt *time.Time      `gorm:"index" json:"notified_at,omitempty"`
+}
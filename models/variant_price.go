@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// VariantPrice overrides the product's price for one variant, for a group
+// or (GroupID nil) for everyone.
+type VariantPrice struct {
+	gorm.Model
+	VariantID uint            `gorm:"index;not null" json:"variant_id"`
+	Variant   *ProductVariant `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	GroupID   *uint           `gorm:"index" json:"group_id,omitempty"` // nil = default
+	Group     *Group          `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"group,omitempty"`
+	Price     float64         `gorm:"type:numeric;not null" json:"price"`
+}
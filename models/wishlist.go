@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+// Wishlist is a named list of products a user saved for later. Anyone with
+// its ShareToken can view the list.
+type Wishlist struct {
+	gorm.Model
+	UserID     uint    `gorm:"not null;index" json:"user_id"`
+	User       *User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Name       string  `gorm:"size:100;not null" json:"name"`
+	ShareToken *string `gorm:"size:64;uniqueIndex" json:"share_token,omitempty"` // nil while not shared
+
+	Items     []WishlistItem `gorm:"foreignKey:WishlistID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	ItemCount int            `gorm:"->;-:migration" json:"item_count"` // set on lists only
+}
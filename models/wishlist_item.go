@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// WishlistItem is a product, or one of its variants, saved in a wishlist.
+type WishlistItem struct {
+	gorm.Model
+	WishlistID uint            `gorm:"not null;index" json:"wishlist_id"`
+	ProductID  uint            `gorm:"not null;index" json:"product_id"`
+	Product    *Product        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	VariantID  *uint           `gorm:"index" json:"variant_id,omitempty"`
+	Variant    *ProductVariant `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+}
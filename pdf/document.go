@@ -0,0 +1,303 @@
+// Package pdf is a small PDF writer for server-side documents such as
+// invoices. It embeds TrueType fonts as Unicode (Identity-H) fonts and lays
+// out Persian text right to left, so no external binaries are needed.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// A4 page size in points.
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Document collects pages and fonts and serializes them as a PDF file.
+type Document struct {
+	width  float64
+	height float64
+	fonts  []*Font
+	pages  []*Page
+	title  string
+}
+
+// New returns an empty A4 portrait document.
+func New() *Document {
+	return &Document{width: A4Width, height: A4Height}
+}
+
+// SetTitle sets the document title shown by PDF viewers.
+func (d *Document) SetTitle(title string) {
+	d.title = title
+}
+
+// AddFont parses and registers a TrueType font for use on any page.
+func (d *Document) AddFont(name string, data []byte) (*Font, error) {
+	f, err := ParseFont(name, data)
+	if err != nil {
+		return nil, err
+	}
+	d.fonts = append(d.fonts, f)
+	return f, nil
+}
+
+// AddPage appends a blank page and returns it.
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the pages added so far.
+func (d *Document) Pages() []*Page { return d.pages }
+
+// Width returns the page width in points.
+func (d *Document) Width() float64 { return d.width }
+
+// Height returns the page height in points.
+func (d *Document) Height() float64 { return d.height }
+
+// Page is a single page. Coordinates passed to its methods have their origin
+// at the top-left corner with y growing downwards.
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+	font    *Font
+	size    float64
+}
+
+// SetFont selects the font and size used by subsequent text calls.
+func (p *Page) SetFont(f *Font, size float64) {
+	p.font = f
+	p.size = size
+}
+
+// SetGray sets the fill and stroke colour as a gray level (0 black, 1 white).
+func (p *Page) SetGray(level float64) {
+	fmt.Fprintf(&p.content, "%.3f g %.3f G\n", level, level)
+}
+
+// SetLineWidth sets the stroke width in points.
+func (p *Page) SetLineWidth(w float64) {
+	fmt.Fprintf(&p.content, "%.2f w\n", w)
+}
+
+// Text draws s with its left edge at x and its baseline at y.
+func (p *Page) Text(x, y float64, s string) {
+	p.drawRunes(x, y, Visual(s))
+}
+
+// TextRight draws s so that it ends at x.
+func (p *Page) TextRight(x, y float64, s string) {
+	runes := Visual(s)
+	p.drawRunes(x-p.font.runesWidth(runes, p.size), y, runes)
+}
+
+// TextCenter draws s centred on x.
+func (p *Page) TextCenter(x, y float64, s string) {
+	runes := Visual(s)
+	p.drawRunes(x-p.font.runesWidth(runes, p.size)/2, y, runes)
+}
+
+// TextWidth returns the width of s in the current font and size.
+func (p *Page) TextWidth(s string) float64 {
+	return p.font.Width(s, p.size)
+}
+
+func (p *Page) drawRunes(x, y float64, runes []rune) {
+	if p.font == nil || len(runes) == 0 {
+		return
+	}
+
+	var hex strings.Builder
+	for _, r := range runes {
+		gid := p.font.glyph(r)
+		if _, ok := p.font.used[gid]; !ok {
+			p.font.used[gid] = r
+		}
+		fmt.Fprintf(&hex, "%04X", gid)
+	}
+
+	fmt.Fprintf(&p.content, "BT /F%d %.2f Tf %.2f %.2f Td <%s> Tj ET\n",
+		p.fontIndex(), p.size, x, p.doc.height-y, hex.String())
+}
+
+func (p *Page) fontIndex() int {
+	for i, f := range p.doc.fonts {
+		if f == p.font {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Line strokes a straight line.
+func (p *Page) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f m %.2f %.2f l S\n", x1, p.doc.height-y1, x2, p.doc.height-y2)
+}
+
+// Rect strokes (or fills) a rectangle whose top-left corner is at x, y.
+func (p *Page) Rect(x, y, w, h float64, fill bool) {
+	op := "S"
+	if fill {
+		op = "f"
+	}
+	fmt.Fprintf(&p.content, "%.2f %.2f %.2f %.2f re %s\n", x, p.doc.height-y-h, w, h, op)
+}
+
+// writer tracks object offsets while the file is serialized.
+type writer struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+func (w *writer) reserve() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *writer) begin(ref int) {
+	w.offsets[ref-1] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", ref)
+}
+
+func (w *writer) object(ref int, body string) {
+	w.begin(ref)
+	w.buf.WriteString(body)
+	w.buf.WriteString("\nendobj\n")
+}
+
+func (w *writer) stream(ref int, dict string, data []byte) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(data)
+	zw.Close()
+
+	w.begin(ref)
+	fmt.Fprintf(&w.buf, "<< %s /Filter /FlateDecode /Length %d >>\nstream\n", dict, z.Len())
+	w.buf.Write(z.Bytes())
+	w.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// WriteTo serializes the document.
+func (d *Document) WriteTo(out io.Writer) (int64, error) {
+	w := &writer{}
+	w.buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	catalog := w.reserve()
+	pagesRef := w.reserve()
+	info := w.reserve()
+
+	fontRefs := make([]int, len(d.fonts))
+	for i, f := range d.fonts {
+		fontRefs[i] = d.writeFont(w, f)
+	}
+
+	var fontDict strings.Builder
+	for i, ref := range fontRefs {
+		fmt.Fprintf(&fontDict, "/F%d %d 0 R ", i+1, ref)
+	}
+
+	var kids []string
+	for _, p := range d.pages {
+		pageRef := w.reserve()
+		contentRef := w.reserve()
+		w.object(pageRef, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pagesRef, d.width, d.height, fontDict.String(), contentRef))
+		w.stream(contentRef, "", p.content.Bytes())
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageRef))
+	}
+
+	w.object(pagesRef, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	w.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesRef))
+	w.object(info, fmt.Sprintf("<< /Title %s /Producer (Kasra) >>", utf16String(d.title)))
+
+	xref := w.buf.Len()
+	fmt.Fprintf(&w.buf, "xref\n0 %d\n0000000000 65535 f \n", len(w.offsets)+1)
+	for _, off := range w.offsets {
+		fmt.Fprintf(&w.buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&w.buf, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(w.offsets)+1, catalog, info, xref)
+
+	n, err := out.Write(w.buf.Bytes())
+	return int64(n), err
+}
+
+// writeFont emits a Type0 font with an embedded TrueType program and
+// returns the reference of the top level font object.
+func (d *Document) writeFont(w *writer, f *Font) int {
+	fontRef := w.reserve()
+	cidRef := w.reserve()
+	descRef := w.reserve()
+	fileRef := w.reserve()
+	toUnicodeRef := w.reserve()
+
+	gids := make([]int, 0, len(f.used))
+	for gid := range f.used {
+		gids = append(gids, int(gid))
+	}
+	sort.Ints(gids)
+
+	var widths strings.Builder
+	for _, gid := range gids {
+		fmt.Fprintf(&widths, "%d [%d] ", gid, int(f.advance(uint16(gid))))
+	}
+
+	name := strings.ReplaceAll(f.name, " ", "")
+
+	w.object(fontRef, fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, cidRef, toUnicodeRef))
+	w.object(cidRef, fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /DW 0 /W [%s] /CIDToGIDMap /Identity >>",
+		name, descRef, widths.String()))
+	w.object(descRef, fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 4 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, f.scale(f.bbox[0]), f.scale(f.bbox[1]), f.scale(f.bbox[2]), f.scale(f.bbox[3]),
+		f.scale(f.ascent), f.scale(f.descent), f.scale(f.capHeight), fileRef))
+	w.stream(fileRef, fmt.Sprintf("/Length1 %d", len(f.data)), f.data)
+
+	var cmap strings.Builder
+	cmap.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	cmap.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	cmap.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	cmap.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for start := 0; start < len(gids); start += 100 {
+		end := start + 100
+		if end > len(gids) {
+			end = len(gids)
+		}
+		fmt.Fprintf(&cmap, "%d beginbfchar\n", end-start)
+		for _, gid := range gids[start:end] {
+			fmt.Fprintf(&cmap, "<%04X> <%s>\n", gid, utf16Hex(f.used[uint16(gid)]))
+		}
+		cmap.WriteString("endbfchar\n")
+	}
+	cmap.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend")
+	w.stream(toUnicodeRef, "", []byte(cmap.String()))
+
+	return fontRef
+}
+
+func utf16Hex(r rune) string {
+	if r < 0x10000 {
+		return fmt.Sprintf("%04X", r)
+	}
+	r -= 0x10000
+	return fmt.Sprintf("%04X%04X", 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+}
+
+// utf16String encodes s as a PDF text string (UTF-16BE with BOM).
+func utf16String(s string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, r := range s {
+		b.WriteString(utf16Hex(r))
+	}
+	b.WriteString(">")
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func loadFont(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("../invoice/fonts/Vazirmatn-Regular.ttf")
+	if err != nil {
+		t.Fatalf("reading test font: %v", err)
+	}
+	return data
+}
+
+func TestParseFont(t *testing.T) {
+	f, err := ParseFont("Vazirmatn", loadFont(t))
+	if err != nil {
+		t.Fatalf("ParseFont: %v", err)
+	}
+	for _, r := range []rune{'A', '1', 'ب', 'ی', '۱', 0xFE91, 0xFEFB, 0xFB90} {
+		if !f.HasGlyph(r) {
+			t.Errorf("font has no glyph for %U", r)
+		}
+	}
+	if f.HasGlyph(0x1F600) {
+		t.Errorf("font claims a glyph for an emoji")
+	}
+	if w := f.Width("سلام", 12); w <= 0 || w >= 12*4 {
+		t.Errorf("Width = %v, want a positive width under one em per glyph", w)
+	}
+	if wide, narrow := f.Width("WWW", 10), f.Width("iii", 10); wide <= narrow {
+		t.Errorf("Width(WWW) = %v is not wider than Width(iii) = %v", wide, narrow)
+	}
+}
+
+func TestParseFontErrors(t *testing.T) {
+	data := loadFont(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short", data[:8]},
+		{"truncated directory", data[:20]},
+		{"tables out of range", data[:len(data)/2]},
+		{"missing tables", append(append([]byte{}, data[:4]...), 0, 0, 0, 0, 0, 0, 0, 0)},
+	}
+	for _, tt := range tests {
+		if _, err := ParseFont("Broken", tt.data); err == nil {
+			t.Errorf("%s: ParseFont returned no error", tt.name)
+		}
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	doc := New()
+	doc.SetTitle("فاکتور 1001")
+	fontData := loadFont(t)
+	font, err := doc.AddFont("Vazirmatn Regular", fontData)
+	if err != nil {
+		t.Fatalf("AddFont: %v", err)
+	}
+	for _, text := range []string{"فاکتور فروش", "Total: 1,250"} {
+		p := doc.AddPage()
+		p.SetFont(font, 12)
+		p.SetLineWidth(0.5)
+		p.Line(40, 60, 555, 60)
+		p.Rect(40, 80, 100, 20, true)
+		p.TextRight(555, 50, text)
+	}
+
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	out := buf.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.7\n")) {
+		t.Fatalf("missing PDF header: %q", out[:min(len(out), 16)])
+	}
+	if !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Errorf("missing %%%%EOF marker")
+	}
+
+	// startxref points at the cross-reference table, whose entries point
+	// at their objects
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n0 ")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	table := strings.Split(string(out[xref:]), "\n")
+	size, _ := strconv.Atoi(strings.Fields(table[1])[1])
+	if !strings.Contains(string(out[xref:]), "/Size "+strconv.Itoa(size)+" ") {
+		t.Errorf("trailer /Size does not match the %d xref entries", size)
+	}
+	for ref := 1; ref < size; ref++ {
+		entry := table[2+ref]
+		if len(entry) != 19 || !strings.HasSuffix(entry, " 00000 n ") {
+			t.Fatalf("xref entry %d is malformed: %q", ref, entry)
+		}
+		off, _ := strconv.Atoi(entry[:10])
+		if want := strconv.Itoa(ref) + " 0 obj\n"; !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", ref, out[off:min(len(out), off+12)])
+		}
+	}
+
+	if n := bytes.Count(out, []byte("/Type /Page ")); n != 2 {
+		t.Errorf("found %d page objects, want 2", n)
+	}
+	if !bytes.Contains(out, []byte("/Type /Pages /Kids [")) || !bytes.Contains(out, []byte("/Count 2 >>")) {
+		t.Errorf("page tree is missing or does not count 2 pages")
+	}
+	if !bytes.Contains(out, []byte("/BaseFont /VazirmatnRegular /Encoding /Identity-H")) {
+		t.Errorf("Type0 font with Identity-H encoding is missing")
+	}
+	if !bytes.Contains(out, []byte("/Title <FEFF")) {
+		t.Errorf("title is not a UTF-16 text string")
+	}
+
+	streams := inflateStreams(t, out)
+	var embedded, toUnicode, content bool
+	for _, s := range streams {
+		switch {
+		case bytes.Equal(s, fontData):
+			embedded = true
+		case bytes.Contains(s, []byte("begincmap")):
+			toUnicode = true
+			// The ToUnicode map lets viewers copy the shaped text back
+			for _, r := range []rune{0xFE98, 0xFB90, 'T', '1'} {
+				entry := "<" + utf16Hex(r) + ">\n"
+				if !bytes.Contains(s, []byte(entry)) {
+					t.Errorf("ToUnicode has no entry for %U", r)
+				}
+			}
+		case bytes.Contains(s, []byte(" Tj ET")):
+			content = true
+			if !bytes.Contains(s, []byte(" re f\n")) || !bytes.Contains(s, []byte(" l S\n")) {
+				t.Errorf("content stream is missing the rectangle or line: %s", s)
+			}
+		}
+	}
+	if !embedded {
+		t.Errorf("font program is not embedded unchanged")
+	}
+	if !toUnicode {
+		t.Errorf("ToUnicode map is missing")
+	}
+	if !content {
+		t.Errorf("no page content draws text")
+	}
+}
+
+// inflateStreams returns the decompressed data of every stream in a PDF.
+func inflateStreams(t *testing.T, out []byte) [][]byte {
+	t.Helper()
+	var streams [][]byte
+	re := regexp.MustCompile(`/Length (\d+) >>\nstream\n`)
+	for _, loc := range re.FindAllSubmatchIndex(out, -1) {
+		n, _ := strconv.Atoi(string(out[loc[2]:loc[3]]))
+		raw := out[loc[1] : loc[1]+n]
+		if !bytes.HasPrefix(out[loc[1]+n:], []byte("\nendstream")) {
+			t.Fatalf("stream at %d does not end after its /Length", loc[1])
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("stream at %d is not deflated: %v", loc[1], err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("stream at %d: %v", loc[1], err)
+		}
+		streams = append(streams, data)
+	}
+	return streams
+}
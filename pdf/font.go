@@ -0,0 +1,233 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf8"
+)
+
+// Font is a parsed TrueType font that can be embedded into a document.
+// Only the tables needed for layout and embedding are read.
+type Font struct {
+	name string
+	data []byte
+
+	unitsPerEm uint16
+	ascent     int16
+	descent    int16
+	capHeight  int16
+	bbox       [4]int16
+	advances   []uint16
+	cmap       map[rune]uint16
+
+	// used records every glyph drawn with this font so the document can
+	// emit widths and the ToUnicode map only for those glyphs.
+	used map[uint16]rune
+	ref  int
+}
+
+// ParseFont reads a TrueType (glyf based) font file.
+func ParseFont(name string, data []byte) (*Font, error) {
+	if len(data) < 12 {
+		return nil, errors.New("pdf: font data too short")
+	}
+
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(data[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := 12 + 16*i
+		if rec+16 > len(data) {
+			return nil, errors.New("pdf: truncated table directory")
+		}
+		tag := string(data[rec : rec+4])
+		off := int(binary.BigEndian.Uint32(data[rec+8:]))
+		length := int(binary.BigEndian.Uint32(data[rec+12:]))
+		if off+length > len(data) {
+			return nil, errors.New("pdf: table " + tag + " out of range")
+		}
+		tables[tag] = data[off : off+length]
+	}
+
+	for _, tag := range []string{"head", "hhea", "hmtx", "maxp", "cmap", "glyf"} {
+		if _, ok := tables[tag]; !ok {
+			return nil, errors.New("pdf: font is missing the " + tag + " table")
+		}
+	}
+
+	f := &Font{name: name, data: data, used: make(map[uint16]rune)}
+
+	head := tables["head"]
+	if len(head) < 54 {
+		return nil, errors.New("pdf: invalid head table")
+	}
+	f.unitsPerEm = binary.BigEndian.Uint16(head[18:])
+	for i := 0; i < 4; i++ {
+		f.bbox[i] = int16(binary.BigEndian.Uint16(head[36+2*i:]))
+	}
+
+	hhea := tables["hhea"]
+	if len(hhea) < 36 {
+		return nil, errors.New("pdf: invalid hhea table")
+	}
+	f.ascent = int16(binary.BigEndian.Uint16(hhea[4:]))
+	f.descent = int16(binary.BigEndian.Uint16(hhea[6:]))
+	numHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+
+	f.capHeight = f.ascent
+	if os2, ok := tables["OS/2"]; ok && len(os2) >= 90 && binary.BigEndian.Uint16(os2) >= 2 {
+		f.capHeight = int16(binary.BigEndian.Uint16(os2[88:]))
+	}
+
+	numGlyphs := int(binary.BigEndian.Uint16(tables["maxp"][4:]))
+	hmtx := tables["hmtx"]
+	if len(hmtx) < 4*numHMetrics {
+		return nil, errors.New("pdf: invalid hmtx table")
+	}
+	f.advances = make([]uint16, numGlyphs)
+	var last uint16
+	for i := 0; i < numGlyphs; i++ {
+		if i < numHMetrics {
+			last = binary.BigEndian.Uint16(hmtx[4*i:])
+		}
+		f.advances[i] = last
+	}
+
+	cmap, err := parseCmap(tables["cmap"])
+	if err != nil {
+		return nil, err
+	}
+	f.cmap = cmap
+
+	return f, nil
+}
+
+// parseCmap reads the best Unicode subtable: format 12 (full repertoire)
+// when present, otherwise format 4 (BMP).
+func parseCmap(data []byte) (map[rune]uint16, error) {
+	if len(data) < 4 {
+		return nil, errors.New("pdf: invalid cmap table")
+	}
+
+	var format4, format12 []byte
+	n := int(binary.BigEndian.Uint16(data[2:]))
+	for i := 0; i < n; i++ {
+		rec := 4 + 8*i
+		if rec+8 > len(data) {
+			break
+		}
+		platform := binary.BigEndian.Uint16(data[rec:])
+		encoding := binary.BigEndian.Uint16(data[rec+2:])
+		off := int(binary.BigEndian.Uint32(data[rec+4:]))
+		if off+2 > len(data) {
+			continue
+		}
+		sub := data[off:]
+		switch binary.BigEndian.Uint16(sub) {
+		case 4:
+			if platform == 0 || (platform == 3 && encoding == 1) {
+				format4 = sub
+			}
+		case 12:
+			if platform == 0 || (platform == 3 && encoding == 10) {
+				format12 = sub
+			}
+		}
+	}
+
+	m := make(map[rune]uint16)
+	switch {
+	case format12 != nil:
+		if len(format12) < 16 {
+			return nil, errors.New("pdf: invalid cmap format 12")
+		}
+		groups := int(binary.BigEndian.Uint32(format12[12:]))
+		for i := 0; i < groups; i++ {
+			g := 16 + 12*i
+			if g+12 > len(format12) {
+				break
+			}
+			start := binary.BigEndian.Uint32(format12[g:])
+			end := binary.BigEndian.Uint32(format12[g+4:])
+			gid := binary.BigEndian.Uint32(format12[g+8:])
+			for c := start; c <= end && c <= utf8.MaxRune; c++ {
+				m[rune(c)] = uint16(gid + c - start)
+			}
+		}
+	case format4 != nil:
+		if len(format4) < 14 {
+			return nil, errors.New("pdf: invalid cmap format 4")
+		}
+		segX2 := int(binary.BigEndian.Uint16(format4[6:]))
+		ends := 14
+		starts := ends + segX2 + 2
+		deltas := starts + segX2
+		rangeOffsets := deltas + segX2
+		if rangeOffsets+segX2 > len(format4) {
+			return nil, errors.New("pdf: invalid cmap format 4")
+		}
+		for s := 0; s < segX2; s += 2 {
+			end := binary.BigEndian.Uint16(format4[ends+s:])
+			start := binary.BigEndian.Uint16(format4[starts+s:])
+			delta := binary.BigEndian.Uint16(format4[deltas+s:])
+			ro := int(binary.BigEndian.Uint16(format4[rangeOffsets+s:]))
+			for c := uint32(start); c <= uint32(end) && c != 0xFFFF; c++ {
+				var gid uint16
+				if ro == 0 {
+					gid = uint16(c) + delta
+				} else {
+					idx := rangeOffsets + s + ro + 2*int(c-uint32(start))
+					if idx+2 > len(format4) {
+						continue
+					}
+					gid = binary.BigEndian.Uint16(format4[idx:])
+					if gid != 0 {
+						gid += delta
+					}
+				}
+				if gid != 0 {
+					m[rune(c)] = gid
+				}
+			}
+		}
+	default:
+		return nil, errors.New("pdf: no unicode cmap subtable")
+	}
+	return m, nil
+}
+
+// HasGlyph reports whether the font maps r to a glyph.
+func (f *Font) HasGlyph(r rune) bool {
+	_, ok := f.cmap[r]
+	return ok
+}
+
+// glyph returns the glyph id for r, or 0 (.notdef) if the font lacks it.
+func (f *Font) glyph(r rune) uint16 {
+	return f.cmap[r]
+}
+
+// advance returns the advance width of a glyph in 1/1000 text space units.
+func (f *Font) advance(gid uint16) float64 {
+	if int(gid) >= len(f.advances) {
+		return 0
+	}
+	return float64(f.advances[gid]) * 1000 / float64(f.unitsPerEm)
+}
+
+func (f *Font) scale(v int16) int {
+	return int(float64(v) * 1000 / float64(f.unitsPerEm))
+}
+
+// Width returns the rendered width of s at the given size, after shaping
+// and reordering.
+func (f *Font) Width(s string, size float64) float64 {
+	return f.runesWidth(Visual(s), size)
+}
+
+func (f *Font) runesWidth(runes []rune, size float64) float64 {
+	var w float64
+	for _, r := range runes {
+		w += f.advance(f.glyph(r))
+	}
+	return w * size / 1000
+}
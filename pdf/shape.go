@@ -0,0 +1,284 @@
+package pdf
+
+import "unicode"
+
+// Persian/Arabic text is stored in logical order with base letters, but a
+// PDF content stream draws glyphs left to right exactly as given. Shape picks
+// the contextual presentation form of every letter and Visual reorders a
+// line for display, which is enough for invoice style documents without a
+// full OpenType shaping engine.
+
+// forms holds the isolated, final, initial and medial presentation forms of
+// a letter. Right-joining letters only have the first two.
+type forms [4]rune
+
+const (
+	isolated = iota
+	final
+	initial
+	medial
+)
+
+var letterForms = map[rune]forms{
+	0x0621: {0xFE80, 0, 0, 0},
+	0x0622: {0xFE81, 0xFE82, 0, 0},
+	0x0623: {0xFE83, 0xFE84, 0, 0},
+	0x0624: {0xFE85, 0xFE86, 0, 0},
+	0x0625: {0xFE87, 0xFE88, 0, 0},
+	0x0626: {0xFE89, 0xFE8A, 0xFE8B, 0xFE8C},
+	0x0627: {0xFE8D, 0xFE8E, 0, 0},
+	0x0628: {0xFE8F, 0xFE90, 0xFE91, 0xFE92},
+	0x0629: {0xFE93, 0xFE94, 0, 0},
+	0x062A: {0xFE95, 0xFE96, 0xFE97, 0xFE98},
+	0x062B: {0xFE99, 0xFE9A, 0xFE9B, 0xFE9C},
+	0x062C: {0xFE9D, 0xFE9E, 0xFE9F, 0xFEA0},
+	0x062D: {0xFEA1, 0xFEA2, 0xFEA3, 0xFEA4},
+	0x062E: {0xFEA5, 0xFEA6, 0xFEA7, 0xFEA8},
+	0x062F: {0xFEA9, 0xFEAA, 0, 0},
+	0x0630: {0xFEAB, 0xFEAC, 0, 0},
+	0x0631: {0xFEAD, 0xFEAE, 0, 0},
+	0x0632: {0xFEAF, 0xFEB0, 0, 0},
+	0x0633: {0xFEB1, 0xFEB2, 0xFEB3, 0xFEB4},
+	0x0634: {0xFEB5, 0xFEB6, 0xFEB7, 0xFEB8},
+	0x0635: {0xFEB9, 0xFEBA, 0xFEBB, 0xFEBC},
+	0x0636: {0xFEBD, 0xFEBE, 0xFEBF, 0xFEC0},
+	0x0637: {0xFEC1, 0xFEC2, 0xFEC3, 0xFEC4},
+	0x0638: {0xFEC5, 0xFEC6, 0xFEC7, 0xFEC8},
+	0x0639: {0xFEC9, 0xFECA, 0xFECB, 0xFECC},
+	0x063A: {0xFECD, 0xFECE, 0xFECF, 0xFED0},
+	0x0641: {0xFED1, 0xFED2, 0xFED3, 0xFED4},
+	0x0642: {0xFED5, 0xFED6, 0xFED7, 0xFED8},
+	0x0643: {0xFED9, 0xFEDA, 0xFEDB, 0xFEDC},
+	0x0644: {0xFEDD, 0xFEDE, 0xFEDF, 0xFEE0},
+	0x0645: {0xFEE1, 0xFEE2, 0xFEE3, 0xFEE4},
+	0x0646: {0xFEE5, 0xFEE6, 0xFEE7, 0xFEE8},
+	0x0647: {0xFEE9, 0xFEEA, 0xFEEB, 0xFEEC},
+	0x0648: {0xFEED, 0xFEEE, 0, 0},
+	0x0649: {0xFEEF, 0xFEF0, 0, 0},
+	0x064A: {0xFEF1, 0xFEF2, 0xFEF3, 0xFEF4},
+	0x067E: {0xFB56, 0xFB57, 0xFB58, 0xFB59},
+	0x0686: {0xFB7A, 0xFB7B, 0xFB7C, 0xFB7D},
+	0x0698: {0xFB8A, 0xFB8B, 0, 0},
+	0x06A9: {0xFB8E, 0xFB8F, 0xFB90, 0xFB91},
+	0x06AF: {0xFB92, 0xFB93, 0xFB94, 0xFB95},
+	0x06CC: {0xFBFC, 0xFBFD, 0xFBFE, 0xFBFF},
+}
+
+// lamAlef maps the alef that follows a lam to the isolated form of the
+// combined ligature; the final form is the next code point.
+var lamAlef = map[rune]rune{
+	0x0622: 0xFEF5,
+	0x0623: 0xFEF7,
+	0x0625: 0xFEF9,
+	0x0627: 0xFEFB,
+}
+
+const (
+	lam     = 0x0644
+	tatweel = 0x0640
+	zwnj    = 0x200C
+)
+
+// transparent marks (harakat) do not affect joining.
+func transparent(r rune) bool {
+	return (r >= 0x064B && r <= 0x065F) || r == 0x0670
+}
+
+func joinsBoth(r rune) bool {
+	if r == tatweel {
+		return true
+	}
+	f, ok := letterForms[r]
+	return ok && f[initial] != 0
+}
+
+func joinsRight(r rune) bool {
+	if r == tatweel {
+		return true
+	}
+	f, ok := letterForms[r]
+	return ok && f[final] != 0
+}
+
+// Shape replaces Arabic script letters with their contextual presentation
+// forms and drops zero width non-joiners. The result is still in logical
+// order.
+func Shape(runes []rune) []rune {
+	out := make([]rune, 0, len(runes))
+
+	// neighbour finds the closest non-transparent rune in direction step.
+	neighbour := func(i, step int) rune {
+		for j := i + step; j >= 0 && j < len(runes); j += step {
+			if !transparent(runes[j]) {
+				return runes[j]
+			}
+		}
+		return 0
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == zwnj {
+			continue
+		}
+
+		f, ok := letterForms[r]
+		if !ok {
+			out = append(out, r)
+			continue
+		}
+
+		joinPrev := joinsBoth(neighbour(i, -1))
+
+		// lam followed by alef becomes a single ligature glyph
+		if r == lam && i+1 < len(runes) {
+			if lig, ok := lamAlef[runes[i+1]]; ok {
+				if joinPrev {
+					lig++
+				}
+				out = append(out, lig)
+				i++
+				continue
+			}
+		}
+
+		joinNext := f[initial] != 0 && joinsRight(neighbour(i, 1))
+
+		form := f[isolated]
+		switch {
+		case joinPrev && joinNext:
+			form = f[medial]
+		case joinPrev && f[final] != 0:
+			form = f[final]
+		case joinNext:
+			form = f[initial]
+		}
+		out = append(out, form)
+	}
+	return out
+}
+
+type direction int
+
+const (
+	neutral direction = iota
+	ltr
+	rtl
+	number
+)
+
+func classify(r rune) direction {
+	switch {
+	case r >= '0' && r <= '9', r >= 0x06F0 && r <= 0x06F9, r >= 0x0660 && r <= 0x0669:
+		return number
+	case (r >= 0x0590 && r <= 0x08FF) || (r >= 0xFB1D && r <= 0xFDFF) || (r >= 0xFE70 && r <= 0xFEFF):
+		return rtl
+	case unicode.IsLetter(r):
+		return ltr
+	default:
+		return neutral
+	}
+}
+
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(',
+	'[': ']', ']': '[',
+	'{': '}', '}': '{',
+	'<': '>', '>': '<',
+	'«': '»', '»': '«',
+}
+
+// numberSeparator reports whether r may sit inside a number, such as the
+// separators in 1,250.00 or 1404/07/27.
+func numberSeparator(r rune) bool {
+	switch r {
+	case '.', ',', '/', ':', '-', 0x066B, 0x066C:
+		return true
+	}
+	return false
+}
+
+// Visual shapes s and reorders it for left-to-right drawing. Text that
+// contains Persian/Arabic letters is laid out with a right-to-left base
+// direction; embedded Latin words and numbers keep their own order.
+func Visual(s string) []rune {
+	runes := Shape([]rune(s))
+
+	hasRTL := false
+	for _, r := range runes {
+		if classify(r) == rtl {
+			hasRTL = true
+			break
+		}
+	}
+	if !hasRTL {
+		return runes
+	}
+
+	dirs := make([]direction, len(runes))
+	for i, r := range runes {
+		dirs[i] = classify(r)
+	}
+
+	// Separators between digits belong to the number
+	for i := 1; i+1 < len(runes); i++ {
+		if dirs[i] == neutral && numberSeparator(runes[i]) && dirs[i-1] == number && dirs[i+1] == number {
+			dirs[i] = number
+		}
+	}
+
+	// Numbers behave as left-to-right runs
+	for i := range dirs {
+		if dirs[i] == number {
+			dirs[i] = ltr
+		}
+	}
+
+	// Neutrals take the direction of the surrounding strong text when both
+	// sides agree, otherwise the base (right-to-left) direction.
+	for i := 0; i < len(dirs); {
+		if dirs[i] != neutral {
+			i++
+			continue
+		}
+		j := i
+		for j < len(dirs) && dirs[j] == neutral {
+			j++
+		}
+		d := rtl
+		if i > 0 && j < len(dirs) && dirs[i-1] == ltr && dirs[j] == ltr {
+			d = ltr
+		}
+		for k := i; k < j; k++ {
+			dirs[k] = d
+		}
+		i = j
+	}
+
+	// Reverse the whole line, then restore the order inside each
+	// left-to-right run.
+	out := make([]rune, len(runes))
+	outDirs := make([]direction, len(runes))
+	for i := range runes {
+		out[len(runes)-1-i] = runes[i]
+		outDirs[len(runes)-1-i] = dirs[i]
+	}
+	for i := 0; i < len(out); {
+		if outDirs[i] != ltr {
+			if m, ok := mirrored[out[i]]; ok {
+				out[i] = m
+			}
+			i++
+			continue
+		}
+		j := i
+		for j < len(out) && outDirs[j] == ltr {
+			j++
+		}
+		for a, b := i, j-1; a < b; a, b = a+1, b-1 {
+			out[a], out[b] = out[b], out[a]
+		}
+		i = j
+	}
+	return out
+}
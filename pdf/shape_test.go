@@ -0,0 +1,63 @@
+package pdf
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func runesHex(runes []rune) string {
+	return fmt.Sprintf("%U", runes)
+}
+
+func TestShape(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []rune
+	}{
+		{"isolated", "ب", []rune{0xFE8F}},
+		{"initial and final", "بب", []rune{0xFE91, 0xFE90}},
+		{"medial", "ببب", []rune{0xFE91, 0xFE92, 0xFE90}},
+		{"right-joining letter ends the join", "بدب", []rune{0xFE91, 0xFEAA, 0xFE8F}},
+		{"persian letters", "پچژکگی", []rune{0xFB58, 0xFB7D, 0xFB8B, 0xFB90, 0xFB95, 0xFBFD}},
+		{"arabic yeh and kaf", "يك", []rune{0xFEF3, 0xFEDA}},
+		{"lam alef", "لا", []rune{0xFEFB}},
+		{"lam alef after a joining letter", "بلا", []rune{0xFE91, 0xFEFC}},
+		{"lam alef madda", "سلآ", []rune{0xFEB3, 0xFEF6}},
+		{"zwnj breaks the join and is dropped", "می\u200cخواهم", []rune{0xFEE3, 0xFBFD, 0xFEA7, 0xFEEE, 0xFE8D, 0xFEEB, 0xFEE2}},
+		{"harakat do not break joins", "بَب", []rune{0xFE91, 0x064E, 0xFE90}},
+		{"tatweel joins", "بـ", []rune{0xFE91, 0x0640}},
+		{"latin is untouched", "SKU-12", []rune("SKU-12")},
+		{"space breaks joins", "ب ب", []rune{0xFE8F, ' ', 0xFE8F}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Shape([]rune(tt.in)); !slices.Equal(got, tt.want) {
+				t.Errorf("Shape(%q) = %s, want %s", tt.in, runesHex(got), runesHex(tt.want))
+			}
+		})
+	}
+}
+
+func TestVisual(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []rune
+	}{
+		{"latin only", "Invoice #12 (paid)", []rune("Invoice #12 (paid)")},
+		{"persian word", "سلام", []rune{0xFEE1, 0xFEFC, 0xFEB3}},
+		{"number keeps its order", "مبلغ 1,250", append([]rune("1,250 "), 0xFECE, 0xFEE0, 0xFE92, 0xFEE3)},
+		{"persian digits and date", "تاریخ ۱۴۰۴/۰۷/۲۷", append([]rune("۱۴۰۴/۰۷/۲۷ "), 0xFEA6, 0xFBFE, 0xFEAD, 0xFE8E, 0xFE97)},
+		{"latin word keeps its order", "کد ABC", append([]rune("ABC "), 0xFEAA, 0xFB90)},
+		{"brackets are mirrored", "(کد)", []rune{'(', 0xFEAA, 0xFB90, ')'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Visual(tt.in); !slices.Equal(got, tt.want) {
+				t.Errorf("Visual(%q) = %s, want %s", tt.in, runesHex(got), runesHex(tt.want))
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package publishing carries out the publish and unpublish times scheduled
+// on products.
+package publishing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aminasadiam/Kasra/repository"
+	"gorm.io/gorm"
+)
+
+// Scheduler publishes products in review and archives published ones when
+// their scheduled time comes.
+type Scheduler struct {
+	publishing *repository.PublishingRepository
+}
+
+func NewScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{publishing: repository.NewPublishingRepository(db)}
+}
+
+// Schedule applies the due schedules every interval until ctx is done,
+// logging the runs that changed a product.
+func (s *Scheduler) Schedule(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		published, archived, err := s.publishing.ApplySchedules(time.Now())
+		if err != nil {
+			log.Printf("scheduled publishing failed: %v", err)
+			continue
+		}
+		if published > 0 || archived > 0 {
+			log.Printf("scheduled publishing: %d products published, %d archived", published, archived)
+		}
+	}
+}
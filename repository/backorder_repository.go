@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BackorderRepository manages the fulfilment queue of order lines waiting
+// for stock.
+type BackorderRepository struct {
+	db *gorm.DB
+}
+
+func NewBackorderRepository(db *gorm.DB) *BackorderRepository {
+	return &BackorderRepository{db: db}
+}
+
+// Allocation records stock assigned to a waiting order line.
+type Allocation struct {
+	OrderID       uint `json:"order_id"`
+	OrderDetailID uint `json:"order_detail_id"`
+	Quantity      int  `json:"quantity"`
+	Remaining     int  `json:"remaining"`
+}
+
+// waiting returns the queue ordered first-in first-out.
+func waiting(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.OrderDetail{}).
+		Joins("JOIN orders ON orders.id = order_details.order_id AND orders.deleted_at IS NULL").
+		Where("order_details.backordered_quantity > 0").
+		Where("orders.status NOT IN ?", []string{"draft", "cancelled"}).
+		Order("orders.created_at, order_details.id")
+}
+
+// List returns the waiting order lines, optionally for a single product.
+func (r *BackorderRepository) List(productID uint) ([]models.OrderDetail, error) {
+	query := waiting(r.db).Preload("Order").Preload("Order.User").Preload("Product")
+	if productID != 0 {
+		query = query.Where("order_details.product_id = ?", productID)
+	}
+	var details []models.OrderDetail
+	err := query.Find(&details).Error
+	return details, err
+}
+
+// WaitingQuantity returns how many units of a product are on back-order.
+func (r *BackorderRepository) WaitingQuantity(productID uint) (int, error) {
+	var total int
+	err := waiting(r.db).
+		Where("order_details.product_id = ?", productID).
+		Select("COALESCE(SUM(order_details.backordered_quantity), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// Allocate assigns the product's available stock to waiting order lines in
+// FIFO order and removes the allocated units from stock. Lines for a variant
+// take from that variant's stock. The product and variant rows are locked
+// for the duration so concurrent orders cannot take the same units.
+func (r *BackorderRepository) Allocate(productID uint) ([]Allocation, error) {
+	allocations := []Allocation{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error; err != nil {
+			return err
+		}
+		if product.Stock <= 0 {
+			return nil
+		}
+
+		var variants []models.ProductVariant
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("product_id = ?", productID).Find(&variants).Error; err != nil {
+			return err
+		}
+		variantStock := make(map[uint]int, len(variants))
+		for _, v := range variants {
+			variantStock[v.ID] = v.Stock
+		}
+
+		var lines []models.OrderDetail
+		if err := waiting(tx).Where("order_details.product_id = ?", productID).Find(&lines).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, line := range lines {
+			if product.Stock == 0 {
+				break
+			}
+			available := product.Stock
+			switch {
+			case line.VariantID != nil:
+				available = variantStock[*line.VariantID]
+			case len(variants) > 0:
+				// the product's stock belongs to its variants
+				continue
+			}
+			n := min(line.BackorderedQuantity, available)
+			if n <= 0 {
+				continue
+			}
+			product.Stock -= n
+			if line.VariantID != nil {
+				variantStock[*line.VariantID] -= n
+			}
+
+			updates := map[string]interface{}{"backordered_quantity": line.BackorderedQuantity - n}
+			if line.BackorderedQuantity == n {
+				updates["allocated_at"] = now
+			}
+			if err := tx.Model(&models.OrderDetail{}).Where("id = ?", line.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+
+			allocations = append(allocations, Allocation{
+				OrderID:       line.OrderID,
+				OrderDetailID: line.ID,
+				Quantity:      n,
+				Remaining:     line.BackorderedQuantity - n,
+			})
+		}
+
+		if len(variants) == 0 {
+			return tx.Model(&models.Product{}).Where("id = ?", productID).Update("stock", product.Stock).Error
+		}
+		for _, v := range variants {
+			if variantStock[v.ID] != v.Stock {
+				if err := tx.Model(&models.ProductVariant{}).Where("id = ?", v.ID).Update("stock", variantStock[v.ID]).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return syncProductStock(tx, productID)
+	})
+	return allocations, err
+}
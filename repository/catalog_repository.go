@@ -0,0 +1,523 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errDryRun rolls back the transaction of a dry-run import.
+var errDryRun = errors.New("dry run")
+
+// CategoryPathSeparator joins the category names of a path in import and
+// export files, e.g. "Kitchen > Blenders".
+const CategoryPathSeparator = " > "
+
+// RowErrors maps the columns of an import row to what is wrong with them.
+type RowErrors map[string]string
+
+func (e RowErrors) Error() string {
+	columns := make([]string, 0, len(e))
+	for column := range e {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	parts := make([]string, len(columns))
+	for i, column := range columns {
+		parts[i] = column + ": " + e[column]
+	}
+	return "invalid row: " + strings.Join(parts, "; ")
+}
+
+// GroupPriceRow is a price for the users of a group, by group name.
+type GroupPriceRow struct {
+	Group string
+	Price float64
+}
+
+type SizeRow struct {
+	Name  string
+	Stock int
+	Price float64
+}
+
+type ColorRow struct {
+	Name    string
+	HexCode string
+	Stock   int
+}
+
+// ProductRow is a product as one row of an import or export file, with its
+// category, brand and groups by name. A nil field is a column the file does
+// not have, which an import leaves unchanged.
+type ProductRow struct {
+	SKU         string
+	Name        *string
+	Description *string
+	Category    *string // path of names, "" for none
+	Brand       *string // "" for none
+	ModelNumber *string
+	Warranty    *string
+	Weight      *float64
+	Dimensions  *string
+	Power       *string
+	Material    *string
+	Capacity    *string
+	Features    *string
+	IsActive    *bool
+	Stock       *int // ignored for products with variants
+	StockPolicy *string
+	Price       *float64 // default price, for users without a group price
+	GroupPrices *[]GroupPriceRow
+	Sizes       *[]SizeRow
+	Colors      *[]ColorRow
+	Images      *[]string // URLs, the first one primary
+}
+
+// ImportResult describes what importing a row did.
+type ImportResult struct {
+	ProductID       uint
+	Created         bool
+	StockRaised     bool
+	CategoryChanged bool
+}
+
+// CatalogLookup resolves the names used in import files to IDs and back.
+// Load one per import or export.
+type CatalogLookup struct {
+	categoryPaths  map[uint]string
+	categoryByPath map[string]uint
+	categoryByName map[string][]uint
+	brandNames     map[uint]string
+	brandByName    map[string]uint
+	groupNames     map[uint]string
+	groupByName    map[string]uint
+}
+
+// CatalogRepository imports and exports products in bulk.
+type CatalogRepository struct {
+	db *gorm.DB
+}
+
+func NewCatalogRepository(db *gorm.DB) *CatalogRepository {
+	return &CatalogRepository{db: db}
+}
+
+// nameKey normalizes a name for case-insensitive lookups.
+func nameKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Lookup loads the categories, brands and groups.
+func (r *CatalogRepository) Lookup() (*CatalogLookup, error) {
+	var categories []models.Category
+	if err := r.db.Select("id", "name", "parent_id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	var brands []models.Brand
+	if err := r.db.Select("id", "name").Find(&brands).Error; err != nil {
+		return nil, err
+	}
+	var groups []models.Group
+	if err := r.db.Select("id", "name").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	l := &CatalogLookup{
+		categoryPaths:  make(map[uint]string, len(categories)),
+		categoryByPath: make(map[string]uint, len(categories)),
+		categoryByName: make(map[string][]uint, len(categories)),
+		brandNames:     make(map[uint]string, len(brands)),
+		brandByName:    make(map[string]uint, len(brands)),
+		groupNames:     make(map[uint]string, len(groups)),
+		groupByName:    make(map[string]uint, len(groups)),
+	}
+
+	byID := make(map[uint]models.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	for _, c := range categories {
+		names := []string{c.Name}
+		for parent, depth := c.ParentID, 0; parent != nil && depth < maxCategoryDepth; depth++ {
+			p, ok := byID[*parent]
+			if !ok {
+				break
+			}
+			names = append([]string{p.Name}, names...)
+			parent = p.ParentID
+		}
+		path := strings.Join(names, CategoryPathSeparator)
+		l.categoryPaths[c.ID] = path
+		l.categoryByPath[nameKey(path)] = c.ID
+		l.categoryByName[nameKey(c.Name)] = append(l.categoryByName[nameKey(c.Name)], c.ID)
+	}
+	for _, b := range brands {
+		l.brandNames[b.ID] = b.Name
+		l.brandByName[nameKey(b.Name)] = b.ID
+	}
+	for _, g := range groups {
+		l.groupNames[g.ID] = g.Name
+		l.groupByName[nameKey(g.Name)] = g.ID
+	}
+	return l, nil
+}
+
+// category resolves a category path, or a name that only one category has.
+func (l *CatalogLookup) category(path string) (uint, string) {
+	segments := strings.Split(path, strings.TrimSpace(CategoryPathSeparator))
+	for i := range segments {
+		segments[i] = strings.TrimSpace(segments[i])
+	}
+	if id, ok := l.categoryByPath[nameKey(strings.Join(segments, CategoryPathSeparator))]; ok {
+		return id, ""
+	}
+	if len(segments) == 1 {
+		switch ids := l.categoryByName[nameKey(segments[0])]; len(ids) {
+		case 1:
+			return ids[0], ""
+		case 0:
+		default:
+			return 0, "more than one category is named " + segments[0] + "; use its full path"
+		}
+	}
+	return 0, "unknown category"
+}
+
+// Upsert creates the product with the row's SKU or updates the columns the
+// row has. Names that don't resolve and invalid values are reported
+// together as RowErrors. The change is recorded as a product revision by
+// userID. A dry run validates and saves in a transaction that is rolled
+// back.
+func (r *CatalogRepository) Upsert(row *ProductRow, lookup *CatalogLookup, userID uint, dryRun bool) (*ImportResult, error) {
+	errs := RowErrors{}
+	if row.SKU == "" {
+		errs["sku"] = "is required"
+	}
+	if row.Name != nil && *row.Name == "" {
+		errs["name"] = "cannot be empty"
+	}
+	var categoryID, brandID *uint
+	if row.Category != nil && *row.Category != "" {
+		id, problem := lookup.category(*row.Category)
+		if problem != "" {
+			errs["category"] = problem
+		}
+		categoryID = &id
+	}
+	if row.Brand != nil && *row.Brand != "" {
+		id, ok := lookup.brandByName[nameKey(*row.Brand)]
+		if !ok {
+			errs["brand"] = "unknown brand"
+		}
+		brandID = &id
+	}
+	if row.Weight != nil && *row.Weight < 0 {
+		errs["weight"] = "cannot be negative"
+	}
+	if row.Stock != nil && *row.Stock < 0 {
+		errs["stock"] = "cannot be negative"
+	}
+	if row.StockPolicy != nil {
+		switch *row.StockPolicy {
+		case "", models.StockPolicyDeny, models.StockPolicyBackorder, models.StockPolicyPreorder:
+		default:
+			errs["stock_policy"] = "must be deny, backorder or preorder"
+		}
+	}
+	if row.Price != nil && *row.Price <= 0 {
+		errs["price"] = "must be positive"
+	}
+	var groupIDs []uint
+	if row.GroupPrices != nil {
+		for _, p := range *row.GroupPrices {
+			id, ok := lookup.groupByName[nameKey(p.Group)]
+			switch {
+			case !ok:
+				errs["group_prices"] = "unknown group " + p.Group
+			case p.Price <= 0:
+				errs["group_prices"] = "price for " + p.Group + " must be positive"
+			}
+			groupIDs = append(groupIDs, id)
+		}
+	}
+	if row.Sizes != nil {
+		for _, s := range *row.Sizes {
+			if s.Stock < 0 || s.Price < 0 {
+				errs["sizes"] = "stock and price of " + s.Name + " cannot be negative"
+			}
+		}
+	}
+	if row.Colors != nil {
+		for _, c := range *row.Colors {
+			if c.Stock < 0 {
+				errs["colors"] = "stock of " + c.Name + " cannot be negative"
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	result := &ImportResult{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Deleted products keep their SKU, so importing it restores them
+		var product models.Product
+		err := tx.Unscoped().Where("sku = ?", row.SKU).First(&product).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if row.Name == nil {
+				return RowErrors{"name": "is required for new products"}
+			}
+			product = models.Product{SKU: row.SKU, IsActive: true, StockPolicy: models.StockPolicyDeny, Status: models.ProductDraft}
+			result.Created = true
+		case err != nil:
+			return err
+		case product.DeletedAt.Valid:
+			product.DeletedAt = gorm.DeletedAt{}
+			result.Created = true
+		}
+		previousStock := product.Stock
+		previousCategory := product.CategoryID
+		var before *models.ProductSnapshot
+		if !result.Created {
+			if before, err = snapshot(tx, product.ID); err != nil {
+				return err
+			}
+		}
+
+		setString(&product.Name, row.Name)
+		setString(&product.Description, row.Description)
+		setString(&product.ModelNumber, row.ModelNumber)
+		setString(&product.Warranty, row.Warranty)
+		setString(&product.Dimensions, row.Dimensions)
+		setString(&product.Power, row.Power)
+		setString(&product.Material, row.Material)
+		setString(&product.Capacity, row.Capacity)
+		setString(&product.Features, row.Features)
+		if row.Weight != nil {
+			product.Weight = *row.Weight
+		}
+		if row.IsActive != nil {
+			product.IsActive = *row.IsActive
+		}
+		if row.StockPolicy != nil {
+			product.StockPolicy = *row.StockPolicy
+			if product.StockPolicy == "" {
+				product.StockPolicy = models.StockPolicyDeny
+			}
+		}
+		if row.Category != nil {
+			product.CategoryID = categoryID
+		}
+		if row.Brand != nil {
+			product.BrandID = brandID
+		}
+		if row.Stock != nil {
+			var variants int64
+			if product.ID != 0 {
+				if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", product.ID).Count(&variants).Error; err != nil {
+					return err
+				}
+			}
+			if variants == 0 { // otherwise the sum of the variants' stock
+				product.Stock = *row.Stock
+			}
+		}
+
+		if err := tx.Unscoped().Omit(clause.Associations).Save(&product).Error; err != nil {
+			return err
+		}
+		result.ProductID = product.ID
+		result.StockRaised = product.Stock > previousStock
+		result.CategoryChanged = !result.Created &&
+			((previousCategory == nil) != (product.CategoryID == nil) ||
+				(previousCategory != nil && *previousCategory != *product.CategoryID))
+
+		if row.Price != nil {
+			if err := tx.Where("product_id = ? AND group_id IS NULL", product.ID).Delete(&models.ProductPrice{}).Error; err != nil {
+				return err
+			}
+			price := models.ProductPrice{ProductID: product.ID, Price: *row.Price}
+			if err := tx.Omit(clause.Associations).Create(&price).Error; err != nil {
+				return err
+			}
+		}
+		if row.GroupPrices != nil {
+			if err := tx.Where("product_id = ? AND group_id IS NOT NULL", product.ID).Delete(&models.ProductPrice{}).Error; err != nil {
+				return err
+			}
+			for i, p := range *row.GroupPrices {
+				price := models.ProductPrice{ProductID: product.ID, GroupID: &groupIDs[i], Price: p.Price}
+				if err := tx.Omit(clause.Associations).Create(&price).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if row.Sizes != nil {
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductSize{}).Error; err != nil {
+				return err
+			}
+			for _, s := range *row.Sizes {
+				size := models.ProductSize{ProductID: product.ID, Name: s.Name, Stock: s.Stock, Price: s.Price}
+				if err := tx.Omit(clause.Associations).Create(&size).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if row.Colors != nil {
+			if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductColor{}).Error; err != nil {
+				return err
+			}
+			for _, c := range *row.Colors {
+				color := models.ProductColor{ProductID: product.ID, Name: c.Name, HexCode: c.HexCode, Stock: c.Stock}
+				if err := tx.Omit(clause.Associations).Create(&color).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if row.Images != nil {
+			if err := syncImages(tx, product.ID, *row.Images); err != nil {
+				return err
+			}
+		}
+		if _, err := record(tx, product.ID, &userID, models.RevisionImport, before, nil); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func setString(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+// syncImages makes urls, in order, the product's own images (those not of
+// a variant), keeping the rows and alt texts of the URLs it already has.
+func syncImages(tx *gorm.DB, productID uint, urls []string) error {
+	var existing []models.ProductImage
+	if err := tx.Where("product_id = ? AND variant_id IS NULL", productID).Find(&existing).Error; err != nil {
+		return err
+	}
+	byURL := make(map[string]*models.ProductImage, len(existing))
+	for i := range existing {
+		byURL[existing[i].URL] = &existing[i]
+	}
+
+	kept := make(map[uint]bool, len(urls))
+	for i, url := range urls {
+		image, ok := byURL[url]
+		if !ok {
+			image = &models.ProductImage{ProductID: productID, URL: url}
+		}
+		image.Order = i
+		image.IsPrimary = i == 0
+		if err := tx.Omit(clause.Associations).Save(image).Error; err != nil {
+			return err
+		}
+		kept[image.ID] = true
+	}
+
+	var removed []uint
+	for _, image := range existing {
+		if !kept[image.ID] {
+			removed = append(removed, image.ID)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return tx.Delete(&models.ProductImage{}, removed).Error
+}
+
+// ExportRows calls fn with every product as a row with all columns set, in
+// ID order, loading products in batches.
+func (r *CatalogRepository) ExportRows(lookup *CatalogLookup, fn func(*ProductRow) error) error {
+	var batch []models.Product
+	return r.db.
+		Preload("Prices", func(db *gorm.DB) *gorm.DB { return db.Order("group_id NULLS FIRST, id") }).
+		Preload("Sizes", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Colors", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Images", func(db *gorm.DB) *gorm.DB {
+			return db.Where("variant_id IS NULL").Order(`is_primary DESC, "order", id`)
+		}).
+		FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := fn(lookup.productRow(&batch[i])); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// productRow converts a product with its prices, sizes, colors and images
+// loaded.
+func (l *CatalogLookup) productRow(p *models.Product) *ProductRow {
+	category, brand := "", ""
+	if p.CategoryID != nil {
+		category = l.categoryPaths[*p.CategoryID]
+	}
+	if p.BrandID != nil {
+		brand = l.brandNames[*p.BrandID]
+	}
+	row := &ProductRow{
+		SKU:         p.SKU,
+		Name:        &p.Name,
+		Description: &p.Description,
+		Category:    &category,
+		Brand:       &brand,
+		ModelNumber: &p.ModelNumber,
+		Warranty:    &p.Warranty,
+		Weight:      &p.Weight,
+		Dimensions:  &p.Dimensions,
+		Power:       &p.Power,
+		Material:    &p.Material,
+		Capacity:    &p.Capacity,
+		Features:    &p.Features,
+		IsActive:    &p.IsActive,
+		Stock:       &p.Stock,
+		StockPolicy: &p.StockPolicy,
+		GroupPrices: &[]GroupPriceRow{},
+		Sizes:       &[]SizeRow{},
+		Colors:      &[]ColorRow{},
+		Images:      &[]string{},
+	}
+	for _, price := range p.Prices {
+		switch {
+		case price.GroupID == nil:
+			if row.Price == nil {
+				row.Price = &price.Price
+			}
+		case l.groupNames[*price.GroupID] != "":
+			*row.GroupPrices = append(*row.GroupPrices, GroupPriceRow{Group: l.groupNames[*price.GroupID], Price: price.Price})
+		}
+	}
+	for _, s := range p.Sizes {
+		*row.Sizes = append(*row.Sizes, SizeRow{Name: s.Name, Stock: s.Stock, Price: s.Price})
+	}
+	for _, c := range p.Colors {
+		*row.Colors = append(*row.Colors, ColorRow{Name: c.Name, HexCode: c.HexCode, Stock: c.Stock})
+	}
+	for _, image := range p.Images {
+		*row.Images = append(*row.Images, image.URL)
+	}
+	return row
+}
@@ -1,10 +1,40 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/utils"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrUnknownParent = errors.New("parent category not found")
+	ErrCategoryCycle = errors.New("a category cannot be placed under itself or one of its descendants")
+)
+
+// categorySubtreeSQL selects the id of a category (the single placeholder)
+// and of all its descendants. UNION keeps it finite on cyclic data.
+const categorySubtreeSQL = `WITH RECURSIVE subtree AS (
+	SELECT id FROM categories WHERE id = ? AND deleted_at IS NULL
+	UNION
+	SELECT categories.id FROM categories JOIN subtree ON categories.parent_id = subtree.id WHERE categories.deleted_at IS NULL
+) SELECT id FROM subtree`
+
+// categoryPathSQL selects the id of a category (the first placeholder) and
+// of its ancestors with their distance from it, walking at most the second
+// placeholder levels up.
+const categoryPathSQL = `WITH RECURSIVE crumbs AS (
+	SELECT id, parent_id, 0 AS depth FROM categories WHERE id = ? AND deleted_at IS NULL
+	UNION ALL
+	SELECT categories.id, categories.parent_id, crumbs.depth + 1 FROM categories JOIN crumbs ON categories.id = crumbs.parent_id
+	WHERE categories.deleted_at IS NULL AND crumbs.depth < ?
+) SELECT id, depth FROM crumbs`
+
+// maxCategoryDepth bounds the ancestor walk of categoryPathSQL.
+const maxCategoryDepth = 100
+
 type CategoryRepository struct {
 	db *gorm.DB
 }
@@ -13,8 +43,24 @@ func NewCategoryRepository(db *gorm.DB) *CategoryRepository {
 	return &CategoryRepository{db: db}
 }
 
+// Create stores the category with a slug derived from its Slug, or its
+// Name when no slug is given, made unique among its siblings.
 func (r *CategoryRepository) Create(model *models.Category) error {
-	return r.db.Create(model).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkParent(tx, 0, model.ParentID); err != nil {
+			return err
+		}
+		base := model.Slug
+		if base == "" {
+			base = model.Name
+		}
+		slug, err := uniqueSlug(tx, base, model.ParentID, 0)
+		if err != nil {
+			return err
+		}
+		model.Slug = slug
+		return tx.Create(model).Error
+	})
 }
 
 func (r *CategoryRepository) GetByID(id uint) (*models.Category, error) {
@@ -29,17 +75,74 @@ func (r *CategoryRepository) GetAll() ([]models.Category, error) {
 	return categories, err
 }
 
+// Update saves the category. The slug stays stable unless a new one is
+// given or the category moves to a parent where it is already taken.
 func (r *CategoryRepository) Update(model *models.Category) error {
-	return r.db.Save(model).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var current models.Category
+		if err := tx.First(&current, model.ID).Error; err != nil {
+			return err
+		}
+		if err := checkParent(tx, model.ID, model.ParentID); err != nil {
+			return err
+		}
+		base := current.Slug
+		if model.Slug != "" {
+			base = model.Slug
+		}
+		if base == "" {
+			base = model.Name
+		}
+		slug, err := uniqueSlug(tx, base, model.ParentID, model.ID)
+		if err != nil {
+			return err
+		}
+		model.Slug = slug
+		model.CreatedAt = current.CreatedAt
+		return tx.Omit("Children", "Products", "Parent").Save(model).Error
+	})
 }
 
 func (r *CategoryRepository) Delete(id uint) error {
 	return r.db.Delete(&models.Category{}, id).Error
 }
 
-func (r *CategoryRepository) GetBySlug(slug string) (*models.Category, error) {
+// Move places the category and its whole subtree under parentID, or at the
+// root when parentID is nil. Moving a category under itself or one of its
+// descendants returns ErrCategoryCycle.
+func (r *CategoryRepository) Move(id uint, parentID *uint) (*models.Category, error) {
 	var category models.Category
-	err := r.db.Where("slug = ?", slug).Preload("Products").First(&category).Error
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&category, id).Error; err != nil {
+			return err
+		}
+		if err := checkParent(tx, id, parentID); err != nil {
+			return err
+		}
+		slug, err := uniqueSlug(tx, category.Slug, parentID, id)
+		if err != nil {
+			return err
+		}
+		category.ParentID = parentID
+		category.Slug = slug
+		return tx.Model(&category).Updates(map[string]interface{}{"parent_id": parentID, "slug": slug}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// GetBySlug finds a category by its slug among the children of parentID.
+// With a nil parentID any category matches, the one closest to the root
+// first, since slugs are only unique among siblings.
+func (r *CategoryRepository) GetBySlug(slug string, parentID *uint) (*models.Category, error) {
+	var category models.Category
+	db := r.db.Where("slug = ?", slug)
+	if parentID != nil {
+		db = siblings(db, parentID)
+	}
+	err := db.Order("parent_id IS NOT NULL, id").Preload("Products").First(&category).Error
 	return &category, err
 }
 
@@ -52,3 +155,153 @@ func (r *CategoryRepository) GetAllWithChildren(categories *[]models.Category) e
 		return db.Order("name")
 	}).Preload("Products").Order("name").Find(categories).Error
 }
+
+// Tree returns the categories nested to any depth, sorted by name: the whole
+// forest when rootID is nil, otherwise the subtree under rootID (which is
+// itself the only element). Products are not loaded.
+func (r *CategoryRepository) Tree(rootID *uint) ([]models.Category, error) {
+	var categories []models.Category
+	db := r.db.Order("name")
+	if rootID != nil {
+		db = db.Where("id IN ("+categorySubtreeSQL+")", *rootID)
+	}
+	if err := db.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	known := make(map[uint]bool, len(categories))
+	for _, c := range categories {
+		known[c.ID] = true
+	}
+	children := make(map[uint][]models.Category)
+	var roots []models.Category
+	for _, c := range categories {
+		switch {
+		case rootID != nil && c.ID == *rootID:
+			roots = append(roots, c)
+		case c.ParentID != nil && known[*c.ParentID]:
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		case rootID == nil:
+			// top-level, or under a deleted parent
+			roots = append(roots, c)
+		}
+	}
+	if rootID != nil && len(roots) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	var attach func(nodes []models.Category, depth int)
+	attach = func(nodes []models.Category, depth int) {
+		if depth > maxCategoryDepth {
+			return
+		}
+		for i := range nodes {
+			nodes[i].Children = children[nodes[i].ID]
+			attach(nodes[i].Children, depth+1)
+		}
+	}
+	attach(roots, 0)
+	if roots == nil {
+		roots = []models.Category{}
+	}
+	return roots, nil
+}
+
+// Breadcrumbs returns the path from the root down to the category,
+// the category itself last.
+func (r *CategoryRepository) Breadcrumbs(id uint) ([]models.Category, error) {
+	var path []models.Category
+	err := r.db.Raw("SELECT categories.* FROM categories JOIN ("+categoryPathSQL+") AS path ON path.id = categories.id ORDER BY path.depth DESC",
+		id, maxCategoryDepth).
+		Scan(&path).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return path, nil
+}
+
+// BackfillSlugs gives every category saved before slugs existed one.
+func (r *CategoryRepository) BackfillSlugs() error {
+	var categories []models.Category
+	if err := r.db.Where("slug IS NULL OR slug = ''").Order("id").Find(&categories).Error; err != nil {
+		return err
+	}
+	for _, c := range categories {
+		slug, err := uniqueSlug(r.db, c.Name, c.ParentID, c.ID)
+		if err != nil {
+			return err
+		}
+		if err := r.db.Model(&c).Update("slug", slug).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// siblings scopes db to the categories directly under parentID.
+func siblings(db *gorm.DB, parentID *uint) *gorm.DB {
+	if parentID == nil {
+		return db.Where("parent_id IS NULL")
+	}
+	return db.Where("parent_id = ?", *parentID)
+}
+
+// checkParent verifies that parentID exists and is not the category id
+// itself or one of its descendants (id 0 is a new category).
+func checkParent(tx *gorm.DB, id uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID == id {
+		return ErrCategoryCycle
+	}
+	var parent models.Category
+	if err := tx.Select("id").First(&parent, *parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownParent
+		}
+		return err
+	}
+	if id == 0 {
+		return nil
+	}
+	var inSubtree int64
+	err := tx.Raw("SELECT COUNT(*) FROM ("+categorySubtreeSQL+") AS subtree WHERE id = ?", id, *parentID).
+		Scan(&inSubtree).Error
+	if err != nil {
+		return err
+	}
+	if inSubtree > 0 {
+		return ErrCategoryCycle
+	}
+	return nil
+}
+
+// uniqueSlug slugifies base and appends -2, -3, ... until no sibling under
+// parentID other than the category selfID uses it.
+func uniqueSlug(tx *gorm.DB, base string, parentID *uint, selfID uint) (string, error) {
+	slug := utils.Slugify(base)
+	if slug == "" {
+		slug = "category"
+	}
+	var taken []string
+	err := siblings(tx.Model(&models.Category{}), parentID).
+		Where("id <> ?", selfID).
+		Where("slug = ? OR slug LIKE ?", slug, slug+"-%").
+		Pluck("slug", &taken).Error
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool, len(taken))
+	for _, s := range taken {
+		used[s] = true
+	}
+	candidate := slug
+	for n := 2; used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s-%d", slug, n)
+	}
+	return candidate, nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+)
+
+// ImportJobRepository stores the state and progress of bulk imports.
+type ImportJobRepository struct {
+	db *gorm.DB
+}
+
+func NewImportJobRepository(db *gorm.DB) *ImportJobRepository {
+	return &ImportJobRepository{db: db}
+}
+
+func (r *ImportJobRepository) Create(job *models.ImportJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *ImportJobRepository) GetByID(id uint) (*models.ImportJob, error) {
+	var job models.ImportJob
+	err := r.db.First(&job, id).Error
+	return &job, err
+}
+
+// List returns the latest jobs, newest first.
+func (r *ImportJobRepository) List(limit int) ([]models.ImportJob, error) {
+	var jobs []models.ImportJob
+	err := r.db.Order("id DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// Save writes the job's status, counters and errors.
+func (r *ImportJobRepository) Save(job *models.ImportJob) error {
+	return r.db.Model(job).Select("Status", "Total", "Processed", "Created", "Updated", "Failed",
+		"Errors", "Error", "StartedAt", "FinishedAt").Updates(job).Error
+}
+
+// FailInterrupted marks the jobs left pending or running by a previous run
+// of the server as failed, since nothing will resume them.
+func (r *ImportJobRepository) FailInterrupted() error {
+	return r.db.Model(&models.ImportJob{}).
+		Where("status IN ?", []string{models.ImportPending, models.ImportRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.ImportFailed,
+			"error":       "interrupted by a server restart",
+			"finished_at": time.Now(),
+		}).Error
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+)
+
+type InvoiceRepository struct {
+	db *gorm.DB
+}
+
+func NewInvoiceRepository(db *gorm.DB) *InvoiceRepository {
+	return &InvoiceRepository{db: db}
+}
+
+func (r *InvoiceRepository) GetByOrderID(orderID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := r.db.Where("order_id = ?", orderID).First(&invoice).Error
+	return &invoice, err
+}
+
+// IssueForOrder returns the invoice of an order, issuing one with the next
+// sequential number if the order has none yet. The table is locked while the
+// number is chosen so concurrent requests cannot produce gaps or duplicates.
+func (r *InvoiceRepository) IssueForOrder(orderID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE invoices IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		err := tx.Where("order_id = ?", orderID).First(&invoice).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var last uint
+		if err := tx.Unscoped().Model(&models.Invoice{}).Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+
+		invoice = models.Invoice{
+			OrderID:  orderID,
+			Number:   last + 1,
+			IssuedAt: time.Now(),
+		}
+		return tx.Create(&invoice).Error
+	})
+	return &invoice, err
+}
@@ -1,8 +1,21 @@
 package repository
 
 import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/aminasadiam/Kasra/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors returned by Place when an order cannot be paid or fulfilled.
+var (
+	ErrNoWallet            = errors.New("wallet not found")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInsufficientStock   = errors.New("insufficient stock")
 )
 
 type OrderRepository struct {
@@ -13,13 +26,47 @@ func NewOrderRepository(db *gorm.DB) *OrderRepository {
 	return &OrderRepository{db: db}
 }
 
+// OrderFilter holds the optional criteria used by the admin order listing.
+// Zero values mean "no filter".
+type OrderFilter struct {
+	Status    string
+	UserID    uint
+	GroupID   uint
+	ProductID uint
+	From      *time.Time
+	To        *time.Time
+	MinTotal  *float64
+	MaxTotal  *float64
+	Search    string
+
+	Sort     string // created_at, total, status, id
+	Desc     bool
+	Page     int
+	PageSize int
+}
+
+// OrderSummary aggregates the orders matched by an OrderFilter.
+type OrderSummary struct {
+	Count         int64              `json:"count"`
+	Revenue       float64            `json:"revenue"`
+	StatusCounts  map[string]int64   `json:"status_counts"`
+	StatusRevenue map[string]float64 `json:"status_revenue"`
+}
+
+var orderSortColumns = map[string]string{
+	"id":         "orders.id",
+	"created_at": "orders.created_at",
+	"total":      "orders.total",
+	"status":     "orders.status",
+}
+
 func (r *OrderRepository) Create(model *models.Order) error {
 	return r.db.Create(model).Error
 }
 
 func (r *OrderRepository) GetByID(id uint) (*models.Order, error) {
 	var order models.Order
-	err := r.db.Preload("User").Preload("Details").Preload("Details.Product").First(&order, id).Error
+	err := r.db.Preload("User").Preload("Details").Preload("Details.Product").Preload("Details.Variant.Values").Preload("Shipments").Preload("Shipments.Items").First(&order, id).Error
 	return &order, err
 }
 
@@ -29,9 +76,177 @@ func (r *OrderRepository) GetAll() ([]models.Order, error) {
 	return orders, err
 }
 
+// filtered builds the base query shared by List, Summarize and ExportRows.
+// Drafts built by Reorder are not orders until checked out, so they are
+// never matched.
+func (r *OrderRepository) filtered(f OrderFilter) *gorm.DB {
+	query := r.db.Model(&models.Order{}).Where("orders.status <> ?", "draft")
+
+	if f.Status != "" {
+		query = query.Where("orders.status = ?", f.Status)
+	}
+	if f.UserID != 0 {
+		query = query.Where("orders.user_id = ?", f.UserID)
+	}
+	if f.GroupID != 0 {
+		query = query.Where("orders.user_id IN (?)",
+			r.db.Table("user_groups").Select("user_id").Where("group_id = ?", f.GroupID))
+	}
+	if f.ProductID != 0 {
+		query = query.Where("orders.id IN (?)",
+			r.db.Model(&models.OrderDetail{}).Select("order_id").Where("product_id = ?", f.ProductID))
+	}
+	if f.From != nil {
+		query = query.Where("orders.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("orders.created_at < ?", *f.To)
+	}
+	if f.MinTotal != nil {
+		query = query.Where("orders.total >= ?", *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		query = query.Where("orders.total <= ?", *f.MaxTotal)
+	}
+	if search := strings.TrimSpace(f.Search); search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		query = query.Where("orders.user_id IN (?)",
+			r.db.Model(&models.User{}).Select("id").
+				Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", like, like))
+	}
+
+	return query
+}
+
+// List returns one page of orders matching the filter together with the
+// total number of matching orders.
+func (r *OrderRepository) List(f OrderFilter) ([]models.Order, int64, error) {
+	var total int64
+	if err := r.filtered(f).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := orderSortColumns[f.Sort]
+	if !ok {
+		column = "orders.created_at"
+	}
+	direction := " ASC"
+	if f.Desc {
+		direction = " DESC"
+	}
+
+	query := r.filtered(f).
+		Preload("User").
+		Preload("Details").
+		Preload("Details.Product").
+		Order(column + direction).
+		Order("orders.id DESC")
+
+	if f.PageSize > 0 {
+		page := f.Page
+		if page < 1 {
+			page = 1
+		}
+		query = query.Offset((page - 1) * f.PageSize).Limit(f.PageSize)
+	}
+
+	var orders []models.Order
+	err := query.Find(&orders).Error
+	return orders, total, err
+}
+
+// Summarize returns counts and revenue for every order matching the filter,
+// ignoring pagination. Cancelled orders are counted but left out of the
+// revenue total.
+func (r *OrderRepository) Summarize(f OrderFilter) (*OrderSummary, error) {
+	var rows []struct {
+		Status  string
+		Count   int64
+		Revenue float64
+	}
+	err := r.filtered(f).
+		Select("orders.status AS status, COUNT(*) AS count, COALESCE(SUM(orders.total), 0) AS revenue").
+		Group("orders.status").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &OrderSummary{
+		StatusCounts:  make(map[string]int64),
+		StatusRevenue: make(map[string]float64),
+	}
+	for _, row := range rows {
+		summary.Count += row.Count
+		if row.Status != "cancelled" {
+			summary.Revenue += row.Revenue
+		}
+		summary.StatusCounts[row.Status] = row.Count
+		summary.StatusRevenue[row.Status] = row.Revenue
+	}
+	return summary, nil
+}
+
+// OrderExportRow is a single order line flattened together with its order,
+// customer and product data.
+type OrderExportRow struct {
+	OrderID       uint
+	CreatedAt     time.Time
+	Status        string
+	PaymentMethod string
+	OrderTotal    float64
+	CustomerName  string
+	CustomerEmail string
+	Groups        string
+	SKU           string
+	ProductName   string
+	Brand         string
+	Quantity      int
+	UnitPrice     float64
+	Tax           float64
+	Subtotal      float64
+}
+
+// ExportRows walks every order line matching the filter, oldest order first,
+// and calls fn for each one. Rows are read from a cursor so the result set is
+// never held in memory. Pagination and sorting in the filter are ignored.
+func (r *OrderRepository) ExportRows(f OrderFilter, fn func(*OrderExportRow) error) error {
+	rows, err := r.filtered(f).
+		Select(`orders.id AS order_id, orders.created_at, orders.status,
+			COALESCE(orders.payment_method, '') AS payment_method, orders.total AS order_total,
+			COALESCE(users.username, '') AS customer_name, COALESCE(users.email, '') AS customer_email,
+			COALESCE((SELECT string_agg(groups.name, ', ' ORDER BY groups.name)
+				FROM groups JOIN user_groups ON user_groups.group_id = groups.id
+				WHERE user_groups.user_id = orders.user_id AND groups.deleted_at IS NULL), '') AS groups,
+			COALESCE(products.sku, '') AS sku, COALESCE(products.name, '') AS product_name,
+			COALESCE(brands.name, '') AS brand,
+			order_details.quantity, order_details.unit_price, order_details.tax, order_details.subtotal`).
+		Joins("JOIN order_details ON order_details.order_id = orders.id AND order_details.deleted_at IS NULL").
+		Joins("LEFT JOIN users ON users.id = orders.user_id").
+		Joins("LEFT JOIN products ON products.id = order_details.product_id").
+		Joins("LEFT JOIN brands ON brands.id = products.brand_id").
+		Order("orders.created_at, orders.id, order_details.id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row OrderExportRow
+		if err := r.db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func (r *OrderRepository) GetByUserID(userID uint) ([]models.Order, error) {
 	var orders []models.Order
-	err := r.db.Where("user_id = ?", userID).Preload("Details").Preload("Details.Product").Find(&orders).Error
+	err := r.db.Where("user_id = ?", userID).Preload("Details").Preload("Details.Product").Preload("Details.Variant.Values").Find(&orders).Error
 	return orders, err
 }
 
@@ -39,6 +254,106 @@ func (r *OrderRepository) Update(model *models.Order) error {
 	return r.db.Save(model).Error
 }
 
+// SaveWithDetails updates an order and its lines without touching the
+// preloaded user and products.
+func (r *OrderRepository) SaveWithDetails(model *models.Order) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return saveWithDetails(tx, model)
+	})
+}
+
+func saveWithDetails(tx *gorm.DB, model *models.Order) error {
+	if err := tx.Omit(clause.Associations).Save(model).Error; err != nil {
+		return err
+	}
+	for i := range model.Details {
+		model.Details[i].OrderID = model.ID
+		if err := tx.Omit(clause.Associations).Save(&model.Details[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Place charges the order total to the user's wallet, takes the ordered
+// quantities out of stock and saves the order as paid, all in one
+// transaction. Back-ordered units are left for the fulfilment queue. Stock
+// is only taken while enough is left, under the same row locks
+// BackorderRepository.Allocate holds, so concurrent orders and allocations
+// cannot take the same units. Orders without an ID are created with new
+// lines and no shipments, existing ones (drafts) are updated.
+func (r *OrderRepository) Place(order *models.Order) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var wallet models.Wallet
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", order.UserID).Limit(1).Find(&wallet)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNoWallet
+		}
+		if wallet.Balance < order.Total {
+			return ErrInsufficientBalance
+		}
+		if err := tx.Model(&wallet).Update("balance", gorm.Expr("balance - ?", order.Total)).Error; err != nil {
+			return err
+		}
+
+		// Lock products in ID order, like Allocate, to avoid deadlocks
+		lines := make([]*models.OrderDetail, len(order.Details))
+		for i := range order.Details {
+			lines[i] = &order.Details[i]
+		}
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].ProductID < lines[j].ProductID })
+		for _, d := range lines {
+			if err := takeStock(tx, d.ProductID, d.VariantID, d.Quantity-d.BackorderedQuantity); err != nil {
+				return err
+			}
+		}
+
+		order.Status = "paid"
+		if order.ID == 0 {
+			// New orders have no shipments yet and their lines are new too
+			order.Shipments = nil
+			for i := range order.Details {
+				d := &order.Details[i]
+				d.ID, d.OrderID, d.AllocatedAt = 0, 0, nil
+			}
+			return tx.Omit("Shipments").Create(order).Error
+		}
+		return saveWithDetails(tx, order)
+	})
+}
+
+// takeStock removes quantity units from a product's or variant's stock,
+// failing with ErrInsufficientStock when fewer are left.
+func takeStock(tx *gorm.DB, productID uint, variantID *uint, quantity int) error {
+	if quantity <= 0 {
+		return nil
+	}
+	var product models.Product
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&product, productID).Error; err != nil {
+		return err
+	}
+
+	query := tx.Model(&models.Product{}).Where("id = ?", productID)
+	if variantID != nil {
+		query = tx.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", *variantID, productID)
+	}
+	result := query.Where("stock >= ?", quantity).Update("stock", gorm.Expr("stock - ?", quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+	if variantID != nil {
+		return syncProductStock(tx, productID)
+	}
+	return nil
+}
+
 func (r *OrderRepository) Delete(id uint) error {
 	return r.db.Delete(&models.Order{}, id).Error
 }
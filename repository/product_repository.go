@@ -1,10 +1,18 @@
 package repository
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/search"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ProductRepository struct {
@@ -31,39 +39,790 @@ func (r *ProductRepository) GetByID(id uint, product *models.Product) error {
 		First(product, id).Error
 }
 
-// GetAll با Preload کامل و فیلترهای اختیاری
-func (r *ProductRepository) GetAll(products *[]models.Product, filters ...map[string]interface{}) error {
-	query := r.db.Preload("Category").
-		Preload("Brand").
-		Preload("Images").
-		Preload("Sizes").
-		Preload("Colors").
-		Preload("Groups").
-		Preload("Prices").
-		Order("created_at DESC")
+// ProductFilter holds the optional criteria of the storefront listing.
+// Zero values mean "no filter"; list fields match any of their values.
+type ProductFilter struct {
+	// Visibility: when Restricted, only products in GroupIDs are listed
+	Restricted bool
+	GroupIDs   []uint
+	// Publishing status; the storefront only lists published products
+	Status string
+	// ActiveOnly leaves out products switched off with is_active
+	ActiveOnly bool
+
+	// Price filters use the price the user's groups pay. Priced is false for
+	// anonymous users, who don't see prices and can't filter on them.
+	Priced   bool
+	MinPrice *float64
+	MaxPrice *float64
+
+	CategoryID *uint
+	BrandIDs   []uint
+	InStock    bool
+	Materials  []string
+	Powers     []string
+	Capacities []string
+	Colors     []string
+	Sizes      []string
+	Specs      []SpecFilter
+	Search     string
+}
+
+// SpecFilter matches products by a spec attribute: Values for text, enum
+// and boolean attributes, Min and Max for number attributes.
+type SpecFilter struct {
+	Key    string
+	Values []string
+	Min    *float64
+	Max    *float64
+}
+
+// FacetValue is one value of a facet and the number of products having it.
+type FacetValue struct {
+	ID    uint   `json:"id,omitempty"`
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// PriceRange is the lowest and highest price among the matched products.
+type PriceRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// ProductFacets counts the products matching a ProductFilter per filter
+// value. Each facet ignores its own filter, so selecting one brand still
+// shows the counts of the other brands.
+type ProductFacets struct {
+	Total      int64        `json:"total"`
+	Brands     []FacetValue `json:"brands"`
+	Materials  []FacetValue `json:"materials"`
+	Powers     []FacetValue `json:"powers"`
+	Capacities []FacetValue `json:"capacities"`
+	Colors     []FacetValue `json:"colors"`
+	Sizes      []FacetValue `json:"sizes"`
+	InStock    int64        `json:"in_stock"`
+	Price      *PriceRange  `json:"price,omitempty"`
+	Specs      []SpecFacet  `json:"specs,omitempty"` // filterable attributes, when filtering by category
+}
+
+// SpecFacet counts the values of a filterable spec attribute, or gives the
+// range of a number attribute.
+type SpecFacet struct {
+	Key    string       `json:"key"`
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Unit   string       `json:"unit,omitempty"`
+	Values []FacetValue `json:"values,omitempty"`
+	Range  *SpecRange   `json:"range,omitempty"`
+}
+
+// SpecRange is the lowest and highest value of a number attribute.
+type SpecRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Facet names, used to leave a facet's own filter out of its counts.
+const (
+	facetNone     = ""
+	facetBrand    = "brand"
+	facetMaterial = "material"
+	facetPower    = "power"
+	facetCapacity = "capacity"
+	facetColor    = "color"
+	facetSize     = "size"
+	facetInStock  = "in_stock"
+	facetPrice    = "price"
+	facetSpec     = "spec:" // followed by the attribute key
+)
+
+// priceExpr is the SQL price of a product for the given groups: a group
+// price wins over the default price, and any price is used as a last resort,
+// matching the handlers' getProductPrice.
+func priceExpr(groupIDs []uint) (string, []interface{}) {
+	groupCond := "pp.group_id IS NULL"
+	var args []interface{}
+	if len(groupIDs) > 0 {
+		groupCond = "(pp.group_id IN ? OR pp.group_id IS NULL)"
+		args = append(args, groupIDs)
+	}
+	return `COALESCE(
+		(SELECT NULLIF(pp.price, 0) FROM product_prices pp
+			WHERE pp.product_id = products.id AND pp.deleted_at IS NULL AND ` + groupCond + `
+			ORDER BY pp.group_id DESC NULLS LAST LIMIT 1),
+		(SELECT pp.price FROM product_prices pp
+			WHERE pp.product_id = products.id AND pp.deleted_at IS NULL LIMIT 1),
+		0)`, args
+}
+
+// filtered applies f to db, leaving out the filter of the skipped facet.
+// The full-text condition is not applied; see matching.
+func (f ProductFilter) filtered(db *gorm.DB, skip string) *gorm.DB {
+	if f.Status != "" {
+		db = db.Where("products.status = ?", f.Status)
+	}
+	if f.ActiveOnly {
+		db = db.Where("products.is_active = ?", true)
+	}
+	if f.Restricted {
+		if len(f.GroupIDs) == 0 {
+			return db.Where("1 = 0")
+		}
+		db = db.Where("products.id IN (SELECT product_id FROM group_products WHERE group_id IN ?)", f.GroupIDs)
+	}
+	if f.CategoryID != nil {
+		db = db.Where("products.category_id IN ("+categorySubtreeSQL+")", *f.CategoryID)
+	}
+	if len(f.BrandIDs) > 0 && skip != facetBrand {
+		db = db.Where("products.brand_id IN ?", f.BrandIDs)
+	}
+	if f.InStock && skip != facetInStock {
+		db = db.Where("products.stock > 0")
+	}
+	if len(f.Materials) > 0 && skip != facetMaterial {
+		db = db.Where("products.material IN ?", f.Materials)
+	}
+	if len(f.Powers) > 0 && skip != facetPower {
+		db = db.Where("products.power IN ?", f.Powers)
+	}
+	if len(f.Capacities) > 0 && skip != facetCapacity {
+		db = db.Where("products.capacity IN ?", f.Capacities)
+	}
+	if len(f.Colors) > 0 && skip != facetColor {
+		db = db.Where("products.id IN (SELECT product_id FROM product_colors WHERE name IN ? AND deleted_at IS NULL)", f.Colors)
+	}
+	if len(f.Sizes) > 0 && skip != facetSize {
+		db = db.Where("products.id IN (SELECT product_id FROM product_sizes WHERE name IN ? AND deleted_at IS NULL)", f.Sizes)
+	}
+	for _, spec := range f.Specs {
+		if skip == facetSpec+spec.Key {
+			continue
+		}
+		sub := `SELECT product_specs.product_id FROM product_specs
+			JOIN spec_attributes ON spec_attributes.id = product_specs.attribute_id AND spec_attributes.deleted_at IS NULL
+			WHERE product_specs.deleted_at IS NULL AND spec_attributes.key = ?`
+		args := []interface{}{spec.Key}
+		if len(spec.Values) > 0 {
+			sub += " AND product_specs.value IN ?"
+			args = append(args, spec.Values)
+		}
+		if spec.Min != nil {
+			sub += " AND product_specs.number >= ?"
+			args = append(args, *spec.Min)
+		}
+		if spec.Max != nil {
+			sub += " AND product_specs.number <= ?"
+			args = append(args, *spec.Max)
+		}
+		db = db.Where("products.id IN ("+sub+")", args...)
+	}
+	if f.Priced && skip != facetPrice {
+		expr, args := priceExpr(f.GroupIDs)
+		if f.MinPrice != nil {
+			db = db.Where(expr+" >= ?", append(args, *f.MinPrice)...)
+		}
+		if f.MaxPrice != nil {
+			db = db.Where(expr+" <= ?", append(args, *f.MaxPrice)...)
+		}
+	}
+	return db
+}
+
+// matching restricts db to products matching the full-text term.
+func matching(db *gorm.DB, term string) *gorm.DB {
+	if tsquery := search.Query(term); tsquery != "" {
+		db = db.Where("products.search_vector @@ to_tsquery('simple', ?)", tsquery)
+	}
+	return db
+}
+
+// ProductListItem is the slim projection of a product used by listings.
+// The full relation graph is only loaded for a single product.
+type ProductListItem struct {
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	SKU          string    `json:"sku"`
+	ModelNumber  string    `json:"model_number,omitempty"`
+	BrandID      *uint     `json:"brand_id,omitempty"`
+	BrandName    string    `json:"brand_name,omitempty"`
+	CategoryID   *uint     `json:"category_id,omitempty"`
+	CategoryName string    `json:"category_name,omitempty"`
+	Image        string    `json:"image,omitempty"` // primary image URL
+	Price        *float64  `json:"price,omitempty"` // the user's group price; nil for anonymous users
+	InStock      bool      `json:"in_stock"`
+	Stock        *int      `json:"stock,omitempty"`  // admins only
+	Status       string    `json:"status,omitempty"` // admins only
+	StockPolicy  string    `json:"stock_policy"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	RatingAverage float64 `json:"rating_average"`
+	RatingCount   int     `json:"rating_count"`
+
+	// Set on search results only
+	SearchRank float64 `json:"search_rank,omitempty"`
+	Snippet    string  `json:"snippet,omitempty"`
+
+	SortKey string `json:"-"` // sort value as text, for the next cursor
+}
+
+// Product sort options. Each has a natural direction used when the caller
+// doesn't choose one.
+const (
+	ProductSortNewest     = "newest"
+	ProductSortName       = "name"
+	ProductSortPrice      = "price"
+	ProductSortPopularity = "popularity"
+	ProductSortRating     = "rating"
+	ProductSortRelevance  = "relevance"
+)
+
+// ProductListOptions selects the page and order of a product listing. A
+// non-empty Cursor continues after the last item of a previous page and
+// takes precedence over Page.
+type ProductListOptions struct {
+	Sort      string
+	Desc      *bool // nil = the sort's natural direction
+	Page      int
+	PageSize  int
+	Cursor    string
+	WithStock bool
+}
+
+// Errors returned by List for bad paging or sorting input.
+var (
+	ErrInvalidCursor = errors.New("invalid cursor") // malformed or issued for another sort order
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// productCursor is the position after the last item of a page.
+type productCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d"`
+	Key  string `json:"k"`
+	ID   uint   `json:"i"`
+}
+
+func (c productCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeProductCursor(s string) (productCursor, error) {
+	var c productCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// popularityExpr is the number of units sold in placed orders.
+const popularityExpr = `(SELECT COALESCE(SUM(od.quantity), 0) FROM order_details od
+	JOIN orders o ON o.id = od.order_id AND o.deleted_at IS NULL
+	WHERE od.product_id = products.id AND od.deleted_at IS NULL AND o.status NOT IN ('draft', 'cancelled'))`
+
+// snippetExpr highlights the matches of the tsquery q in the product's name
+// and description.
+const snippetExpr = `ts_headline('simple', COALESCE(products.search_text, ''), q,
+	'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=" … "')`
+
+// listColumns selects the fields of ProductListItem, with the price for
+// the groups of f when it is priced and the stock when withStock is set.
+// The query needs listJoins.
+func listColumns(f ProductFilter, withStock bool) ([]string, []interface{}) {
+	columns := []string{
+		"products.id", "products.name", "products.sku", "products.model_number",
+		"products.brand_id", "brands.name AS brand_name",
+		"products.category_id", "categories.name AS category_name",
+		`(SELECT pi.url FROM product_images pi WHERE pi.product_id = products.id AND pi.deleted_at IS NULL
+			ORDER BY pi.is_primary DESC, pi."order", pi.id LIMIT 1) AS image`,
+		"products.stock > 0 AS in_stock", "products.stock_policy", "products.created_at",
+		"products.rating_average", "products.rating_count",
+	}
+	var args []interface{}
+	if f.Priced {
+		priceSQL, priceArgs := priceExpr(f.GroupIDs)
+		columns = append(columns, priceSQL+" AS price")
+		args = append(args, priceArgs...)
+	}
+	if withStock {
+		columns = append(columns, "products.stock", "products.status")
+	}
+	return columns, args
+}
+
+// listJoins joins the brand and category names selected by listColumns.
+func listJoins(db *gorm.DB) *gorm.DB {
+	return db.
+		Joins("LEFT JOIN brands ON brands.id = products.brand_id AND brands.deleted_at IS NULL").
+		Joins("LEFT JOIN categories ON categories.id = products.category_id AND categories.deleted_at IS NULL")
+}
+
+// List returns one page of the products matching f as slim list items,
+// and the cursor of the next page ("" on the last page).
+func (r *ProductRepository) List(f ProductFilter, opts ProductListOptions) ([]ProductListItem, string, error) {
+	tsquery := search.Query(f.Search)
+	if opts.Sort == "" {
+		opts.Sort = ProductSortNewest
+		if tsquery != "" {
+			opts.Sort = ProductSortRelevance
+		}
+	}
+
+	priceSQL, priceArgs := priceExpr(f.GroupIDs)
+	var sortSQL, sortType string
+	var sortArgs []interface{}
+	desc := false
+	switch opts.Sort {
+	case ProductSortNewest:
+		sortSQL, sortType, desc = "products.created_at", "timestamptz", true
+	case ProductSortName:
+		sortSQL, sortType = "products.name", "text"
+	case ProductSortPrice:
+		sortSQL, sortType, sortArgs = priceSQL, "numeric", priceArgs
+	case ProductSortPopularity:
+		sortSQL, sortType, desc = popularityExpr, "bigint", true
+	case ProductSortRating:
+		sortSQL, sortType, desc = "products.rating_average", "numeric", true
+	case ProductSortRelevance:
+		if tsquery == "" {
+			return nil, "", ErrInvalidSort // relevance needs a search term
+		}
+		sortSQL, sortType, desc = "ts_rank_cd(products.search_vector, q)::float8", "float8", true
+	default:
+		return nil, "", ErrInvalidSort
+	}
+	if opts.Desc != nil {
+		desc = *opts.Desc
+	}
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	columns, args := listColumns(f, opts.WithStock)
+	if tsquery != "" {
+		columns = append(columns, "ts_rank_cd(products.search_vector, q)::float8 AS search_rank", snippetExpr+" AS snippet")
+	}
+	columns = append(columns, "("+sortSQL+")::text AS sort_key")
+	args = append(args, sortArgs...)
+
+	query := listJoins(f.filtered(r.db.Model(&models.Product{}), facetNone))
+	if tsquery != "" {
+		query = query.Joins("CROSS JOIN to_tsquery('simple', ?) AS q", tsquery).
+			Where("products.search_vector @@ q")
+	}
+	query = query.Select(strings.Join(columns, ", "), args...)
+
+	if opts.Cursor != "" {
+		c, err := decodeProductCursor(opts.Cursor)
+		if err != nil || c.Sort != opts.Sort || c.Desc != desc {
+			return nil, "", ErrInvalidCursor
+		}
+		cond := fmt.Sprintf("((%s), products.id) %s (CAST(?::text AS %s), ?)", sortSQL, cmp, sortType)
+		query = query.Where(cond, append(sortArgs, c.Key, c.ID)...)
+	} else if opts.Page > 1 {
+		query = query.Offset((opts.Page - 1) * opts.PageSize)
+	}
+
+	var items []ProductListItem
+	err := query.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:  fmt.Sprintf("(%s) %s, products.id %s", sortSQL, dir, dir),
+		Vars: sortArgs,
+	}}).
+		Limit(opts.PageSize + 1).
+		Scan(&items).Error
+	if err != nil {
+		return nil, "", err
+	}
+	if items == nil {
+		items = []ProductListItem{}
+	}
+
+	var next string
+	if len(items) > opts.PageSize {
+		items = items[:opts.PageSize]
+		last := items[len(items)-1]
+		next = productCursor{Sort: opts.Sort, Desc: desc, Key: last.SortKey, ID: last.ID}.encode()
+	}
+	return items, next, nil
+}
+
+// Facets counts the products matching f per brand, attribute, color, size
+// and stock state, and reports their price range when f is priced.
+func (r *ProductRepository) Facets(f ProductFilter) (*ProductFacets, error) {
+	scope := func(skip string) *gorm.DB {
+		return matching(f.filtered(r.db.Model(&models.Product{}), skip), f.Search)
+	}
+	facets := &ProductFacets{}
+
+	if err := scope(facetNone).Count(&facets.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := scope(facetInStock).Where("products.stock > 0").Count(&facets.InStock).Error; err != nil {
+		return nil, err
+	}
 
-	// اعمال فیلترها اگر مورد نیاز باشد
-	if len(filters) > 0 && filters[0] != nil {
-		filterMap := filters[0]
+	err := scope(facetBrand).
+		Joins("JOIN brands ON brands.id = products.brand_id AND brands.deleted_at IS NULL").
+		Select("brands.id AS id, brands.name AS value, COUNT(*) AS count").
+		Group("brands.id, brands.name").
+		Order("count DESC, value").
+		Scan(&facets.Brands).Error
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []struct {
+		facet  string
+		column string
+		values *[]FacetValue
+	}{
+		{facetMaterial, "products.material", &facets.Materials},
+		{facetPower, "products.power", &facets.Powers},
+		{facetCapacity, "products.capacity", &facets.Capacities},
+	}
+	for _, c := range columns {
+		err := scope(c.facet).
+			Select(c.column + " AS value, COUNT(*) AS count").
+			Where(c.column + " <> ''").
+			Group(c.column).
+			Order("count DESC, value").
+			Scan(c.values).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	variants := []struct {
+		facet  string
+		table  string
+		values *[]FacetValue
+	}{
+		{facetColor, "product_colors", &facets.Colors},
+		{facetSize, "product_sizes", &facets.Sizes},
+	}
+	for _, v := range variants {
+		err := scope(v.facet).
+			Joins("JOIN " + v.table + " ON " + v.table + ".product_id = products.id AND " + v.table + ".deleted_at IS NULL").
+			Select(v.table + ".name AS value, COUNT(DISTINCT products.id) AS count").
+			Group(v.table + ".name").
+			Order("count DESC, value").
+			Scan(v.values).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Priced {
+		expr, args := priceExpr(f.GroupIDs)
+		var price PriceRange
+		err := scope(facetPrice).
+			Select("COALESCE(MIN("+expr+"), 0) AS min, COALESCE(MAX("+expr+"), 0) AS max", append(args, args...)...).
+			Scan(&price).Error
+		if err != nil {
+			return nil, err
+		}
+		facets.Price = &price
+	}
+
+	if f.CategoryID != nil {
+		specs, err := r.specFacets(f, scope)
+		if err != nil {
+			return nil, err
+		}
+		facets.Specs = specs
+	}
+
+	return facets, nil
+}
+
+// specFacets counts the values of the filterable attributes in the schema
+// of the filtered category, leaving out attributes no product has.
+func (r *ProductRepository) specFacets(f ProductFilter, scope func(skip string) *gorm.DB) ([]SpecFacet, error) {
+	schema, err := specSchema(r.db, *f.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+	var facets []SpecFacet
+	for _, attribute := range schema {
+		if !attribute.Filterable {
+			continue
+		}
+		facet := SpecFacet{Key: attribute.Key, Name: attribute.Name, Type: attribute.Type, Unit: attribute.Unit}
+		db := scope(facetSpec+attribute.Key).
+			Joins("JOIN product_specs ON product_specs.product_id = products.id AND product_specs.deleted_at IS NULL AND product_specs.attribute_id = ?", attribute.ID)
+		if attribute.Type == models.SpecTypeNumber {
+			var bounds struct {
+				Count    int64
+				Min, Max float64
+			}
+			err := db.Select("COUNT(*) AS count, COALESCE(MIN(product_specs.number), 0) AS min, COALESCE(MAX(product_specs.number), 0) AS max").
+				Scan(&bounds).Error
+			if err != nil {
+				return nil, err
+			}
+			if bounds.Count == 0 {
+				continue
+			}
+			facet.Range = &SpecRange{Min: bounds.Min, Max: bounds.Max}
+		} else {
+			err := db.Select("product_specs.value AS value, COUNT(DISTINCT products.id) AS count").
+				Group("product_specs.value").
+				Order("count DESC, value").
+				Scan(&facet.Values).Error
+			if err != nil {
+				return nil, err
+			}
+			if len(facet.Values) == 0 {
+				continue
+			}
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
+
+// Suggestion is one autocomplete entry.
+type Suggestion struct {
+	Type  string  `json:"type"` // product, brand or category
+	ID    uint    `json:"id"`
+	Text  string  `json:"text"`            // the matched value
+	Field string  `json:"field,omitempty"` // product field that matched: name, model_number or sku
+	Name  string  `json:"name,omitempty"`  // product name, when another field matched
+	Score float64 `json:"score"`
+}
+
+// suggestThreshold is the trigram word similarity a value needs to be
+// suggested. The pg_trgm default of 0.6 misses many one-letter typos.
+const suggestThreshold = 0.4
 
-		// فیلتر براساس دسته‌بندی
-		if categoryID, ok := filterMap["categoryId"]; ok && categoryID != nil {
-			query = query.Where("category_id = ?", categoryID)
+// likePrefix escapes s for use as a LIKE prefix pattern.
+func likePrefix(s string) string {
+	return likeEscaper.Replace(s) + "%"
+}
+
+// likeContains escapes s for use as a LIKE substring pattern.
+func likeContains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Suggest returns up to limit completions for q among the names, model
+// numbers and SKUs of the products visible under f, and the brands and
+// categories having such products. Values are compared normalized and by
+// trigram word similarity, so typos still match; prefix matches rank first.
+func (r *ProductRepository) Suggest(f ProductFilter, q string, limit int) ([]Suggestion, error) {
+	term := search.Normalize(q)
+	if term == "" {
+		return []Suggestion{}, nil
+	}
+	var suggestions []Suggestion
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %g", suggestThreshold)).Error; err != nil {
+			return err
+		}
+		var err error
+		suggestions, err = suggest(tx, f, term, limit)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	if suggestions == nil {
+		suggestions = []Suggestion{}
+	}
+	return suggestions, nil
+}
+
+// suggest runs the suggestion queries of Suggest inside tx.
+func suggest(tx *gorm.DB, f ProductFilter, term string, limit int) ([]Suggestion, error) {
+	prefix := likePrefix(term)
+
+	// score is the word similarity of column, plus one for a prefix match
+	score := func(column string) (string, []interface{}) {
+		return fmt.Sprintf("word_similarity(?, search_normalize(%s)) + CASE WHEN search_normalize(%s) LIKE ? THEN 1 ELSE 0 END", column, column),
+			[]interface{}{term, prefix}
+	}
+	matches := func(column string) (string, []interface{}) {
+		return fmt.Sprintf("(? <%% search_normalize(%s) OR search_normalize(%s) LIKE ?)", column, column),
+			[]interface{}{term, prefix}
+	}
+
+	var suggestions []Suggestion
+
+	// Products, by name, model number or SKU
+	fields := []string{"name", "model_number", "sku"}
+	var selects, conds []string
+	var selectArgs, condArgs []interface{}
+	for _, field := range fields {
+		expr, args := score("products." + field)
+		selects = append(selects, expr+" AS "+field+"_score")
+		selectArgs = append(selectArgs, args...)
+		expr, args = matches("products." + field)
+		conds = append(conds, expr)
+		condArgs = append(condArgs, args...)
+	}
+	var products []struct {
+		ID               uint
+		Name             string
+		ModelNumber      string
+		SKU              string `gorm:"column:sku"`
+		NameScore        float64
+		ModelNumberScore float64
+		SKUScore         float64 `gorm:"column:sku_score"`
+	}
+	scored := f.filtered(tx.Model(&models.Product{}), facetNone).
+		Select("products.id, products.name, products.model_number, products.sku, "+strings.Join(selects, ", "), selectArgs...).
+		Where(strings.Join(conds, " OR "), condArgs...)
+	err := tx.Table("(?) AS scored", scored).
+		Order("GREATEST(name_score, model_number_score, sku_score) DESC, name").
+		Limit(limit).
+		Scan(&products).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range products {
+		s := Suggestion{Type: "product", ID: p.ID, Text: p.Name, Field: "name", Score: p.NameScore}
+		if p.ModelNumberScore > s.Score {
+			s = Suggestion{Type: "product", ID: p.ID, Text: p.ModelNumber, Field: "model_number", Name: p.Name, Score: p.ModelNumberScore}
+		}
+		if p.SKUScore > s.Score {
+			s = Suggestion{Type: "product", ID: p.ID, Text: p.SKU, Field: "sku", Name: p.Name, Score: p.SKUScore}
 		}
+		suggestions = append(suggestions, s)
+	}
 
-		// فیلتر براساس برند
-		if brandID, ok := filterMap["brandId"]; ok && brandID != nil {
-			query = query.Where("brand_id = ?", brandID)
+	// Brands and categories, only when they have a visible product
+	for _, group := range []struct{ kind, table, column string }{
+		{"brand", "brands", "brand_id"},
+		{"category", "categories", "category_id"},
+	} {
+		visible := f.filtered(tx.Model(&models.Product{}), facetNone).
+			Select("1").
+			Where("products." + group.column + " = " + group.table + ".id")
+		scoreExpr, scoreArgs := score(group.table + ".name")
+		matchExpr, matchArgs := matches(group.table + ".name")
+
+		var rows []Suggestion
+		err := tx.Table(group.table).
+			Select(group.table+".id, "+group.table+".name AS text, "+scoreExpr+" AS score", scoreArgs...).
+			Where(matchExpr, matchArgs...).
+			Where(group.table+".deleted_at IS NULL").
+			Where("EXISTS (?)", visible).
+			Order("score DESC").
+			Limit(limit).
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			row.Type = group.kind
+			suggestions = append(suggestions, row)
 		}
+	}
+	return suggestions, nil
+}
 
-		// جستجو براساس نام یا SKU
-		if search, ok := filterMap["search"]; ok && search != nil {
-			searchTerm := "%" + strings.ToLower(search.(string)) + "%"
-			query = query.Where("LOWER(name) LIKE ? OR LOWER(sku) LIKE ?", searchTerm, searchTerm)
+// RefreshSearch rebuilds the full-text index of the given products. Name
+// weighs most, then SKU and model number, then brand and category, then the
+// description and the approved questions and answers.
+func (r *ProductRepository) RefreshSearch(ids ...uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var products []models.Product
+	if err := r.db.Unscoped().Preload("Brand").Preload("Category").Where("id IN ?", ids).Find(&products).Error; err != nil {
+		return err
+	}
+	for i := range products {
+		if err := r.refreshSearch(&products[i]); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func (r *ProductRepository) refreshSearch(p *models.Product) error {
+	var brand, category string
+	text := p.Name
+	if p.Description != "" {
+		text += " — " + p.Description
+	}
+	if p.Brand != nil {
+		brand = p.Brand.Name
+	}
+	if p.Category != nil {
+		category = p.Category.Name
+	}
+	qa, err := r.questionsText(p.ID)
+	if err != nil {
+		return err
+	}
+	if qa != "" {
+		text += " — " + qa
+	}
+
+	return r.db.Exec(`UPDATE products SET
+			search_vector = setweight(to_tsvector('simple', ?), 'A') ||
+				setweight(to_tsvector('simple', ?), 'B') ||
+				setweight(to_tsvector('simple', ?), 'C') ||
+				setweight(to_tsvector('simple', ?), 'D'),
+			search_text = ?
+		WHERE id = ?`,
+		search.Document(p.Name),
+		search.Document(p.SKU+" "+p.ModelNumber),
+		search.Document(brand+" "+category),
+		search.Document(p.Description+" "+qa),
+		search.Normalize(text),
+		p.ID,
+	).Error
+}
+
+// questionsText joins the approved questions about a product and their
+// approved answers.
+func (r *ProductRepository) questionsText(productID uint) (string, error) {
+	var texts []string
+	err := r.db.Model(&models.ProductQuestion{}).
+		Where("product_id = ? AND status = ?", productID, models.QAStatusApproved).
+		Order("id").Pluck("body", &texts).Error
+	if err != nil {
+		return "", err
+	}
+	var answers []string
+	err = r.db.Model(&models.ProductAnswer{}).
+		Joins("JOIN product_questions ON product_questions.id = product_answers.question_id AND product_questions.deleted_at IS NULL").
+		Where("product_questions.product_id = ? AND product_questions.status = ? AND product_answers.status = ?",
+			productID, models.QAStatusApproved, models.QAStatusApproved).
+		Order("product_answers.id").Pluck("product_answers.body", &answers).Error
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append(texts, answers...), " "), nil
+}
 
-	return query.Find(products).Error
+// RefreshSearchWhere rebuilds the full-text index of every product matching
+// the condition, e.g. after a brand or category was renamed.
+func (r *ProductRepository) RefreshSearchWhere(query interface{}, args ...interface{}) error {
+	var batch []models.Product
+	return r.db.Preload("Brand").Preload("Category").Where(query, args...).
+		FindInBatches(&batch, 200, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				if err := r.refreshSearch(&batch[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
 }
 
 func (r *ProductRepository) Update(model *models.Product) error {
@@ -74,54 +833,145 @@ func (r *ProductRepository) Delete(id uint) error {
 	return r.db.Delete(&models.Product{}, id).Error
 }
 
-func (r *ProductRepository) GetByCategory(categoryID uint) ([]models.Product, error) {
-	var products []models.Product
-	err := r.db.Where("category_id = ?", categoryID).
-		Preload("Category").
-		Preload("Brand").
-		Preload("Images").
-		Preload("Sizes").
-		Preload("Colors").
-		Preload("Groups").
-		Preload("Prices").
-		Order("created_at DESC").
-		Find(&products).Error
-	return products, err
+// ComparedProduct is a list item with the fields shown side by side on the
+// comparison page.
+type ComparedProduct struct {
+	ProductListItem
+	Warranty   string  `json:"warranty,omitempty"`
+	Dimensions string  `json:"dimensions,omitempty"`
+	Weight     float64 `json:"weight,omitempty"`
 }
 
-// Search با Preload کامل (شامل Prices)
-func (r *ProductRepository) Search(q string, categoryID *uint, brandID *uint) ([]models.Product, error) {
-	var products []models.Product
-	db := r.db.Model(&models.Product{}).
-		Joins("LEFT JOIN brands ON brands.id = products.brand_id")
+// ComparisonRow is one attribute across the compared products. Values are
+// aligned with Comparison.Products; a product without the attribute has nil.
+type ComparisonRow struct {
+	Key     string        `json:"key"`             // product field, or "spec.<key>" for specs
+	Label   string        `json:"label,omitempty"` // spec attribute name
+	Group   string        `json:"group"`           // "general" or "specs"
+	Unit    string        `json:"unit,omitempty"`
+	Values  []interface{} `json:"values"`
+	Differs bool          `json:"differs"` // the values are not all the same
+}
 
-	if q != "" {
-		like := "%" + strings.ToLower(q) + "%"
-		db = db.Where(
-			r.db.Where("LOWER(products.name) LIKE ?", like).
-				Or("LOWER(products.description) LIKE ?", like).
-				Or("LOWER(products.sku) LIKE ?", like).
-				Or("LOWER(brands.name) LIKE ?", like),
-		)
+// Comparison lines up products attribute by attribute.
+type Comparison struct {
+	Products []ComparedProduct `json:"products"`
+	Rows     []ComparisonRow   `json:"rows"`
+}
+
+// Comparison row groups
+const (
+	ComparisonGeneral = "general"
+	ComparisonSpecs   = "specs"
+)
+
+// Compare returns the products with the given IDs, in that order, and a row
+// per attribute: brand, model, warranty, dimensions, weight, price (when f
+// is priced), availability, stock (with withStock), rating and then the
+// union of their specs in schema order. Specs are matched by key, so
+// products of different categories still line up. It returns
+// gorm.ErrRecordNotFound if any product doesn't exist or isn't visible
+// under f.
+func (r *ProductRepository) Compare(ids []uint, f ProductFilter, withStock bool) (*Comparison, error) {
+	columns, args := listColumns(f, withStock)
+	columns = append(columns, "products.warranty", "products.dimensions", "products.weight")
+
+	found := []ComparedProduct{}
+	err := listJoins(f.filtered(r.db.Model(&models.Product{}), facetNone)).
+		Where("products.id IN ?", ids).
+		Select(strings.Join(columns, ", "), args...).
+		Scan(&found).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(found) != len(ids) {
+		return nil, gorm.ErrRecordNotFound
 	}
 
-	if categoryID != nil {
-		db = db.Where("products.category_id = ?", *categoryID)
+	index := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+	products := make([]ComparedProduct, len(ids))
+	for _, p := range found {
+		products[index[p.ID]] = p
 	}
 
-	if brandID != nil {
-		db = db.Where("products.brand_id = ?", *brandID)
+	row := func(key string, value func(p ComparedProduct) interface{}) ComparisonRow {
+		values := make([]interface{}, len(products))
+		for i, p := range products {
+			values[i] = value(p)
+		}
+		return ComparisonRow{Key: key, Group: ComparisonGeneral, Values: values}
+	}
+	text := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
 	}
 
-	err := db.Preload("Category").
-		Preload("Brand").
-		Preload("Images").
-		Preload("Sizes").
-		Preload("Colors").
-		Preload("Groups").
-		Preload("Prices").
-		Order("created_at DESC").
-		Find(&products).Error
+	rows := []ComparisonRow{
+		row("brand", func(p ComparedProduct) interface{} { return text(p.BrandName) }),
+		row("model_number", func(p ComparedProduct) interface{} { return text(p.ModelNumber) }),
+		row("warranty", func(p ComparedProduct) interface{} { return text(p.Warranty) }),
+		row("dimensions", func(p ComparedProduct) interface{} { return text(p.Dimensions) }),
+		row("weight", func(p ComparedProduct) interface{} {
+			if p.Weight == 0 {
+				return nil
+			}
+			return p.Weight
+		}),
+	}
+	if f.Priced {
+		rows = append(rows, row("price", func(p ComparedProduct) interface{} {
+			if p.Price == nil {
+				return nil
+			}
+			return *p.Price
+		}))
+	}
+	rows = append(rows, row("in_stock", func(p ComparedProduct) interface{} { return p.InStock }))
+	if withStock {
+		rows = append(rows, row("stock", func(p ComparedProduct) interface{} { return *p.Stock }))
+	}
+	rows = append(rows,
+		row("rating_average", func(p ComparedProduct) interface{} { return p.RatingAverage }),
+		row("rating_count", func(p ComparedProduct) interface{} { return p.RatingCount }),
+	)
 
-	return products, err
+	var specs []models.ProductSpec
+	err = r.db.Preload("Attribute").Where("product_id IN ?", ids).Order(specOrder).Find(&specs).Error
+	if err != nil {
+		return nil, err
+	}
+	specRows := map[string]int{}
+	for _, spec := range specs {
+		if spec.Attribute == nil {
+			continue
+		}
+		i, ok := specRows[spec.Attribute.Key]
+		if !ok {
+			i = len(rows)
+			specRows[spec.Attribute.Key] = i
+			rows = append(rows, ComparisonRow{
+				Key:    "spec." + spec.Attribute.Key,
+				Label:  spec.Attribute.Name,
+				Group:  ComparisonSpecs,
+				Unit:   spec.Attribute.Unit,
+				Values: make([]interface{}, len(products)),
+			})
+		}
+		rows[i].Values[index[spec.ProductID]] = spec.Value
+	}
+
+	for i := range rows {
+		for _, v := range rows[i].Values[1:] {
+			if v != rows[i].Values[0] {
+				rows[i].Differs = true
+				break
+			}
+		}
+	}
+	return &Comparison{Products: products, Rows: rows}, nil
 }
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidProductStatus = errors.New("invalid product status change")
+	ErrInvalidSchedule      = errors.New("unpublish_at must be after publish_at")
+	ErrPublishNotInReview   = errors.New("only products in review can be scheduled for publishing")
+	ErrUnpublishStatus      = errors.New("only products in review or published can be scheduled for unpublishing")
+)
+
+type PublishingRepository struct {
+	db *gorm.DB
+}
+
+func NewPublishingRepository(db *gorm.DB) *PublishingRepository {
+	return &PublishingRepository{db: db}
+}
+
+// Transition moves a product to another publishing status. When from is
+// set the product must be in that status, so that actions sharing a target
+// status, like rejecting and unarchiving, cannot stand in for each other.
+// Schedules that no longer apply are cleared: both when a product goes back
+// to draft or is archived, the publish time once it is published.
+func (r *PublishingRepository) Transition(productID uint, from, status string) (*models.Product, error) {
+	var product models.Product
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status", "publish_at", "unpublish_at").
+			First(&product, productID).Error; err != nil {
+			return err
+		}
+		if (from != "" && product.Status != from) || !models.CanTransition(product.Status, status) {
+			return fmt.Errorf("%w: the product is %s and cannot become %s", ErrInvalidProductStatus, product.Status, status)
+		}
+
+		product.Status = status
+		switch status {
+		case models.ProductDraft, models.ProductArchived:
+			product.PublishAt, product.UnpublishAt = nil, nil
+		case models.ProductPublished:
+			product.PublishAt = nil
+		}
+		return tx.Model(&product).Updates(map[string]interface{}{
+			"status":       product.Status,
+			"publish_at":   product.PublishAt,
+			"unpublish_at": product.UnpublishAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// Schedule sets when a product is published and unpublished; nil clears a
+// time. Only products in review can wait to be published, and only those
+// or published ones to be unpublished.
+func (r *PublishingRepository) Schedule(productID uint, publishAt, unpublishAt *time.Time) (*models.Product, error) {
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return nil, ErrInvalidSchedule
+	}
+
+	var product models.Product
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "status", "publish_at", "unpublish_at").
+			First(&product, productID).Error; err != nil {
+			return err
+		}
+		if publishAt != nil && product.Status != models.ProductInReview {
+			return ErrPublishNotInReview
+		}
+		if unpublishAt != nil && product.Status != models.ProductInReview && product.Status != models.ProductPublished {
+			return ErrUnpublishStatus
+		}
+
+		product.PublishAt, product.UnpublishAt = publishAt, unpublishAt
+		return tx.Model(&product).Updates(map[string]interface{}{
+			"publish_at":   publishAt,
+			"unpublish_at": unpublishAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+// ApplySchedules publishes the products in review whose publish time has
+// come and then archives the published products whose unpublish time has,
+// returning how many of each it changed.
+func (r *PublishingRepository) ApplySchedules(now time.Time) (published, archived int64, err error) {
+	err = r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Product{}).
+			Where("status = ? AND publish_at <= ?", models.ProductInReview, now).
+			Updates(map[string]interface{}{"status": models.ProductPublished, "publish_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		published = result.RowsAffected
+
+		result = tx.Model(&models.Product{}).
+			Where("status = ? AND unpublish_at <= ?", models.ProductPublished, now).
+			Updates(map[string]interface{}{"status": models.ProductArchived, "unpublish_at": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		archived = result.RowsAffected
+		return nil
+	})
+	return published, archived, err
+}
@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/search"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotVerifiedBuyer = errors.New("only admins and customers who bought the product can answer")
+	ErrQuestionClosed   = errors.New("question is not published")
+)
+
+type QuestionRepository struct {
+	db *gorm.DB
+}
+
+func NewQuestionRepository(db *gorm.DB) *QuestionRepository {
+	return &QuestionRepository{db: db}
+}
+
+// Create saves a new question for moderation.
+func (r *QuestionRepository) Create(question *models.ProductQuestion) error {
+	question.Status = models.QAStatusPending
+	return r.db.Omit(clause.Associations).Create(question).Error
+}
+
+// GetByID loads a question with all its answers.
+func (r *QuestionRepository) GetByID(id uint) (*models.ProductQuestion, error) {
+	questions := make([]models.ProductQuestion, 1)
+	err := r.db.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("is_staff DESC, created_at, id")
+	}).First(&questions[0], id).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := r.attachAuthors(questions); err != nil {
+		return nil, err
+	}
+	return &questions[0], nil
+}
+
+// List returns a page of a product's approved questions, newest first, with
+// their approved answers, and their total count. A non-empty term keeps the
+// questions whose text or approved answers contain it.
+func (r *QuestionRepository) List(productID uint, term string, page utils.Pagination) ([]models.ProductQuestion, int64, error) {
+	query := r.db.Model(&models.ProductQuestion{}).
+		Where("product_questions.product_id = ? AND product_questions.status = ?", productID, models.QAStatusApproved)
+	if term = search.Normalize(term); term != "" {
+		like := likeContains(term)
+		answers := r.db.Model(&models.ProductAnswer{}).Select("1").
+			Where("product_answers.question_id = product_questions.id AND product_answers.status = ?", models.QAStatusApproved).
+			Where("search_normalize(product_answers.body) LIKE ?", like)
+		query = query.Where("search_normalize(product_questions.body) LIKE ? OR EXISTS (?)", like, answers)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	questions := []models.ProductQuestion{}
+	err := query.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", models.QAStatusApproved).Order("is_staff DESC, created_at, id")
+	}).Order("product_questions.created_at DESC, product_questions.id DESC").
+		Offset(page.Offset()).Limit(page.PageSize).Find(&questions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return questions, total, r.attachAuthors(questions)
+}
+
+// ListByUser returns all of a user's questions, newest first, with their
+// approved answers.
+func (r *QuestionRepository) ListByUser(userID uint) ([]models.ProductQuestion, error) {
+	questions := []models.ProductQuestion{}
+	err := r.db.Preload("Answers", func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ?", models.QAStatusApproved).Order("is_staff DESC, created_at, id")
+	}).Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name", "sku") }).
+		Where("user_id = ?", userID).Order("created_at DESC").Find(&questions).Error
+	if err != nil {
+		return nil, err
+	}
+	return questions, r.attachAuthors(questions)
+}
+
+// ListForModeration returns a page of questions of any product, oldest
+// first, optionally with one status, and their total count.
+func (r *QuestionRepository) ListForModeration(status string, page utils.Pagination) ([]models.ProductQuestion, int64, error) {
+	query := r.db.Model(&models.ProductQuestion{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	questions := []models.ProductQuestion{}
+	err := query.Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name", "sku") }).
+		Order("created_at, id").Offset(page.Offset()).Limit(page.PageSize).Find(&questions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return questions, total, r.attachAuthors(questions)
+}
+
+// Moderate approves or rejects a question.
+func (r *QuestionRepository) Moderate(question *models.ProductQuestion, status, note string, adminID uint) error {
+	now := time.Now()
+	question.Status = status
+	question.ModerationNote = note
+	question.ModeratedByID = &adminID
+	question.ModeratedAt = &now
+	return r.db.Model(question).Select("Status", "ModerationNote", "ModeratedByID", "ModeratedAt").
+		Updates(question).Error
+}
+
+// Delete removes a question and its answers.
+func (r *QuestionRepository) Delete(question *models.ProductQuestion) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("question_id = ?", question.ID).Delete(&models.ProductAnswer{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.ProductQuestion{}, question.ID).Error
+	})
+}
+
+// CreateAnswer saves an answer to an approved question. Staff answers are
+// approved right away; anyone else must have bought the product and is
+// moderated.
+func (r *QuestionRepository) CreateAnswer(question *models.ProductQuestion, answer *models.ProductAnswer) error {
+	if question.Status != models.QAStatusApproved {
+		return ErrQuestionClosed
+	}
+	purchased, err := hasPurchased(r.db, answer.UserID, question.ProductID)
+	if err != nil {
+		return err
+	}
+	if !answer.IsStaff && !purchased {
+		return ErrNotVerifiedBuyer
+	}
+
+	answer.QuestionID = question.ID
+	answer.IsVerifiedBuyer = purchased
+	answer.Status = models.QAStatusPending
+	if answer.IsStaff {
+		now := time.Now()
+		answer.Status = models.QAStatusApproved
+		answer.ModeratedByID = &answer.UserID
+		answer.ModeratedAt = &now
+	}
+	return r.db.Omit(clause.Associations).Create(answer).Error
+}
+
+// GetAnswer loads an answer with its question.
+func (r *QuestionRepository) GetAnswer(id uint) (*models.ProductAnswer, error) {
+	var answer models.ProductAnswer
+	if err := r.db.Preload("Question").First(&answer, id).Error; err != nil {
+		return nil, err
+	}
+	names, err := usernames(r.db, []uint{answer.UserID})
+	if err != nil {
+		return nil, err
+	}
+	answer.AuthorName = names[answer.UserID]
+	return &answer, nil
+}
+
+// ListAnswersForModeration returns a page of answers, oldest first,
+// optionally with one status, with their questions, and their total count.
+func (r *QuestionRepository) ListAnswersForModeration(status string, page utils.Pagination) ([]models.ProductAnswer, int64, error) {
+	query := r.db.Model(&models.ProductAnswer{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	answers := []models.ProductAnswer{}
+	err := query.Preload("Question").Order("created_at, id").
+		Offset(page.Offset()).Limit(page.PageSize).Find(&answers).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]uint, len(answers))
+	for i, a := range answers {
+		ids[i] = a.UserID
+	}
+	names, err := usernames(r.db, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range answers {
+		answers[i].AuthorName = names[answers[i].UserID]
+	}
+	return answers, total, nil
+}
+
+// ModerateAnswer approves or rejects an answer.
+func (r *QuestionRepository) ModerateAnswer(answer *models.ProductAnswer, status, note string, adminID uint) error {
+	now := time.Now()
+	answer.Status = status
+	answer.ModerationNote = note
+	answer.ModeratedByID = &adminID
+	answer.ModeratedAt = &now
+	return r.db.Model(answer).Select("Status", "ModerationNote", "ModeratedByID", "ModeratedAt").
+		Updates(answer).Error
+}
+
+func (r *QuestionRepository) DeleteAnswer(answer *models.ProductAnswer) error {
+	return r.db.Delete(&models.ProductAnswer{}, answer.ID).Error
+}
+
+// attachAuthors sets the names of the askers and of the authors of the
+// loaded answers.
+func (r *QuestionRepository) attachAuthors(questions []models.ProductQuestion) error {
+	var ids []uint
+	for _, q := range questions {
+		ids = append(ids, q.UserID)
+		for _, a := range q.Answers {
+			ids = append(ids, a.UserID)
+		}
+	}
+	names, err := usernames(r.db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range questions {
+		q := &questions[i]
+		q.AuthorName = names[q.UserID]
+		for j := range q.Answers {
+			q.Answers[j].AuthorName = names[q.Answers[j].UserID]
+		}
+	}
+	return nil
+}
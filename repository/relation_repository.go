@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/search"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRelationType = errors.New("type must be related, accessory, spare_part, replacement_for or upsell")
+	ErrSelfRelation        = errors.New("a product cannot be related to itself")
+	ErrRelationExists      = errors.New("the products are already related this way")
+)
+
+type RelationRepository struct {
+	db *gorm.DB
+}
+
+func NewRelationRepository(db *gorm.DB) *RelationRepository {
+	return &RelationRepository{db: db}
+}
+
+// Create links two existing products.
+func (r *RelationRepository) Create(relation *models.ProductRelation) error {
+	if !models.ValidRelationType(relation.Type) {
+		return ErrInvalidRelationType
+	}
+	if relation.ProductID == relation.RelatedID {
+		return ErrSelfRelation
+	}
+
+	var count int64
+	if err := r.db.Model(&models.Product{}).Where("id IN ?", []uint{relation.ProductID, relation.RelatedID}).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count != 2 {
+		return gorm.ErrRecordNotFound
+	}
+
+	if err := r.db.Model(&models.ProductRelation{}).
+		Where("product_id = ? AND related_id = ? AND type = ?", relation.ProductID, relation.RelatedID, relation.Type).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRelationExists
+	}
+	return r.db.Omit("Product", "Related").Create(relation).Error
+}
+
+func (r *RelationRepository) GetByID(id uint) (*models.ProductRelation, error) {
+	var relation models.ProductRelation
+	if err := r.db.First(&relation, id).Error; err != nil {
+		return nil, err
+	}
+	return &relation, nil
+}
+
+// Update saves a relation's note and position.
+func (r *RelationRepository) Update(relation *models.ProductRelation) error {
+	return r.db.Model(relation).Select("Note", "Position").Updates(relation).Error
+}
+
+// Delete removes a relation for good, so the products can be related the
+// same way again.
+func (r *RelationRepository) Delete(id uint) error {
+	return r.db.Unscoped().Delete(&models.ProductRelation{}, id).Error
+}
+
+// Related returns the products related to any of productIDs that are
+// visible under f, optionally of some types only, in position order.
+func (r *RelationRepository) Related(productIDs []uint, f ProductFilter, withStock bool, types []string) ([]models.RelatedProduct, error) {
+	columns, args := listColumns(f, withStock)
+	columns = append(columns, "product_relations.id AS relation_id", "product_relations.type",
+		"product_relations.note", "product_relations.position")
+
+	query := listJoins(f.filtered(r.db.Model(&models.Product{}), facetNone)).
+		Joins("JOIN product_relations ON product_relations.related_id = products.id AND product_relations.deleted_at IS NULL").
+		Where("product_relations.product_id IN ?", productIDs)
+	if len(types) > 0 {
+		query = query.Where("product_relations.type IN ?", types)
+	}
+
+	related := []models.RelatedProduct{}
+	err := query.Select(strings.Join(columns, ", "), args...).
+		Order("product_relations.position, product_relations.id").
+		Scan(&related).Error
+	return related, err
+}
+
+// Compatible finds the products with the given model number and the parts
+// related to them as one of types, both limited to those visible under f.
+// Deleted products are matched too, so discontinued models still find
+// their parts. A part related to several matches is listed once.
+func (r *RelationRepository) Compatible(model string, f ProductFilter, withStock bool, types []string) ([]ProductListItem, []models.RelatedProduct, error) {
+	var ids []uint
+	err := r.db.Unscoped().Model(&models.Product{}).
+		Where("search_normalize(products.model_number) = ?", search.Normalize(model)).
+		Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ids) == 0 {
+		return []ProductListItem{}, []models.RelatedProduct{}, nil
+	}
+
+	columns, args := listColumns(f, withStock)
+	matches := []ProductListItem{}
+	err = listJoins(f.filtered(r.db.Model(&models.Product{}), facetNone)).
+		Where("products.id IN ?", ids).
+		Select(strings.Join(columns, ", "), args...).
+		Order("products.id").
+		Scan(&matches).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	related, err := r.Related(ids, f, withStock, types)
+	if err != nil {
+		return nil, nil, err
+	}
+	parts := []models.RelatedProduct{}
+	seen := map[uint]bool{}
+	for _, part := range related {
+		if seen[part.ID] {
+			continue
+		}
+		seen[part.ID] = true
+		parts = append(parts, part)
+	}
+	return matches, parts, nil
+}
@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidTransition is returned when a return request cannot move to the
+// requested status from its current one.
+var ErrInvalidTransition = errors.New("invalid return status transition")
+
+// ErrReturnQuantity is returned by Create for more units of a line than
+// were shipped and not returned yet.
+var ErrReturnQuantity = errors.New("return quantity exceeds the shipped units")
+
+// Errors returned by Receive for input that does not match the request.
+var (
+	ErrUnknownReturnItem = errors.New("unknown return item")
+	ErrReceivedQuantity  = errors.New("received quantity exceeds the returned quantity")
+	ErrNoWalletForRefund = errors.New("customer has no wallet to refund to")
+)
+
+// returnTransitions lists the statuses each status may move to.
+var returnTransitions = map[string][]string{
+	models.ReturnStatusRequested: {models.ReturnStatusApproved, models.ReturnStatusRejected, models.ReturnStatusCancelled},
+	models.ReturnStatusApproved:  {models.ReturnStatusReceived, models.ReturnStatusCancelled},
+	models.ReturnStatusReceived:  {models.ReturnStatusRefunded, models.ReturnStatusCredited},
+}
+
+type ReturnRepository struct {
+	db *gorm.DB
+}
+
+func NewReturnRepository(db *gorm.DB) *ReturnRepository {
+	return &ReturnRepository{db: db}
+}
+
+// Create saves a new return request with its items and the initial history
+// entry. Only shipped units can be returned, less those in earlier requests
+// that were not rejected or cancelled; the order row is locked so
+// concurrent requests cannot return the same units.
+func (r *ReturnRepository) Create(model *models.ReturnRequest) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Details").First(&order, model.OrderID).Error; err != nil {
+			return err
+		}
+		lines := make(map[uint]bool, len(order.Details))
+		for _, d := range order.Details {
+			lines[d.ID] = true
+		}
+		shipped, err := shippedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		requested := make(map[uint]int)
+		for _, item := range model.Items {
+			if !lines[item.OrderDetailID] {
+				return fmt.Errorf("%w: line %d", ErrUnknownOrderLine, item.OrderDetailID)
+			}
+			requested[item.OrderDetailID] += item.Quantity
+			returned, err := returnedQuantity(tx, item.OrderDetailID)
+			if err != nil {
+				return err
+			}
+			if left := shipped[item.OrderDetailID] - returned; requested[item.OrderDetailID] > left {
+				return fmt.Errorf("%w: only %d of order line %d can still be returned", ErrReturnQuantity, max(left, 0), item.OrderDetailID)
+			}
+		}
+
+		model.Status = models.ReturnStatusRequested
+		if err := tx.Omit("Items.OrderDetail").Create(model).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ReturnStatusHistory{
+			ReturnRequestID: model.ID,
+			ToStatus:        models.ReturnStatusRequested,
+			Note:            model.Reason,
+			ChangedByID:     model.UserID,
+		}).Error
+	})
+}
+
+func (r *ReturnRepository) preload() *gorm.DB {
+	return r.db.Preload("Order").
+		Preload("User").
+		Preload("Items").
+		Preload("Items.OrderDetail").
+		Preload("Items.OrderDetail.Product").
+		Preload("Photos").
+		Preload("History", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("History.ChangedBy").
+		Preload("CreditNote")
+}
+
+func (r *ReturnRepository) GetByID(id uint) (*models.ReturnRequest, error) {
+	var rma models.ReturnRequest
+	err := r.preload().First(&rma, id).Error
+	return &rma, err
+}
+
+func (r *ReturnRepository) GetByUserID(userID uint) ([]models.ReturnRequest, error) {
+	var rmas []models.ReturnRequest
+	err := r.preload().Where("user_id = ?", userID).Order("created_at DESC").Find(&rmas).Error
+	return rmas, err
+}
+
+// GetAll lists return requests, newest first, optionally filtered by status.
+func (r *ReturnRepository) GetAll(status string) ([]models.ReturnRequest, error) {
+	query := r.preload().Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var rmas []models.ReturnRequest
+	err := query.Find(&rmas).Error
+	return rmas, err
+}
+
+// returnedQuantity returns how many units of an order line are already part
+// of return requests that were not rejected or cancelled.
+func returnedQuantity(tx *gorm.DB, orderDetailID uint) (int, error) {
+	var total int
+	err := tx.Model(&models.ReturnItem{}).
+		Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id AND return_requests.deleted_at IS NULL").
+		Where("return_items.order_detail_id = ?", orderDetailID).
+		Where("return_requests.status NOT IN ?", []string{models.ReturnStatusRejected, models.ReturnStatusCancelled}).
+		Select("COALESCE(SUM(return_items.quantity), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+func canTransition(from, to string) bool {
+	for _, s := range returnTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transition changes the status inside tx and appends a history entry.
+func transition(tx *gorm.DB, rma *models.ReturnRequest, to, note string, actorID uint) error {
+	if !canTransition(rma.Status, to) {
+		return ErrInvalidTransition
+	}
+	from := rma.Status
+	rma.Status = to
+	if err := tx.Model(&models.ReturnRequest{}).Where("id = ?", rma.ID).Update("status", to).Error; err != nil {
+		return err
+	}
+	return tx.Create(&models.ReturnStatusHistory{
+		ReturnRequestID: rma.ID,
+		FromStatus:      from,
+		ToStatus:        to,
+		Note:            note,
+		ChangedByID:     actorID,
+	}).Error
+}
+
+// Transition moves a return request to a new status, recording who did it.
+// A non-empty adminNote replaces the note shown to the customer.
+func (r *ReturnRepository) Transition(rma *models.ReturnRequest, to, note, adminNote string, actorID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReturn(tx, rma); err != nil {
+			return err
+		}
+		if adminNote != "" {
+			rma.AdminNote = adminNote
+			if err := tx.Model(&models.ReturnRequest{}).Where("id = ?", rma.ID).Update("admin_note", adminNote).Error; err != nil {
+				return err
+			}
+		}
+		return transition(tx, rma, to, note, actorID)
+	})
+}
+
+// lockReturn reloads the status under a row lock so concurrent admin actions
+// cannot both apply.
+func lockReturn(tx *gorm.DB, rma *models.ReturnRequest) error {
+	var current models.ReturnRequest
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&current, rma.ID).Error; err != nil {
+		return err
+	}
+	rma.Status = current.Status
+	return nil
+}
+
+// ReceivedItem describes what arrived for one return item.
+type ReceivedItem struct {
+	ReturnItemID uint
+	Quantity     int
+	Disposition  string
+}
+
+// Receive records the goods that arrived, restocks the items marked for
+// restocking and settles the return: either a wallet refund or a credit
+// note. The request moves through "received" to "refunded" or "credited".
+// It returns the IDs of products whose stock grew.
+func (r *ReturnRepository) Receive(rma *models.ReturnRequest, items []ReceivedItem, resolution, note string, actorID uint) ([]uint, error) {
+	var restocked []uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockReturn(tx, rma); err != nil {
+			return err
+		}
+		if err := transition(tx, rma, models.ReturnStatusReceived, note, actorID); err != nil {
+			return err
+		}
+
+		byID := make(map[uint]*models.ReturnItem, len(rma.Items))
+		for i := range rma.Items {
+			byID[rma.Items[i].ID] = &rma.Items[i]
+		}
+
+		var amount float64
+		for _, received := range items {
+			item, ok := byID[received.ReturnItemID]
+			if !ok || item.OrderDetail == nil {
+				return ErrUnknownReturnItem
+			}
+			if received.Quantity < 0 || received.Quantity > item.Quantity {
+				return ErrReceivedQuantity
+			}
+
+			item.ReceivedQuantity = received.Quantity
+			item.Disposition = received.Disposition
+			if err := tx.Model(&models.ReturnItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+				"received_quantity": item.ReceivedQuantity,
+				"disposition":       item.Disposition,
+			}).Error; err != nil {
+				return err
+			}
+
+			if received.Quantity == 0 {
+				continue
+			}
+
+			// Refund the unit price plus its share of the line tax
+			d := item.OrderDetail
+			unit := d.UnitPrice
+			if d.Quantity > 0 {
+				unit += d.Tax / float64(d.Quantity)
+			}
+			amount += unit * float64(received.Quantity)
+
+			if received.Disposition == models.ReturnDispositionRestock {
+				if d.VariantID != nil {
+					if _, err := adjustVariantStock(tx, *d.VariantID, received.Quantity); err != nil {
+						return err
+					}
+				} else if err := tx.Model(&models.Product{}).Where("id = ?", d.ProductID).
+					Update("stock", gorm.Expr("stock + ?", received.Quantity)).Error; err != nil {
+					return err
+				}
+				restocked = append(restocked, d.ProductID)
+			}
+		}
+
+		rma.Resolution = resolution
+		rma.RefundAmount = amount
+		if err := tx.Model(&models.ReturnRequest{}).Where("id = ?", rma.ID).Updates(map[string]interface{}{
+			"resolution":    resolution,
+			"refund_amount": amount,
+		}).Error; err != nil {
+			return err
+		}
+
+		if resolution == "credit_note" {
+			credit := models.CreditNote{UserID: rma.UserID, ReturnRequestID: rma.ID, Amount: amount, Note: note}
+			if err := tx.Create(&credit).Error; err != nil {
+				return err
+			}
+			rma.CreditNote = &credit
+			return transition(tx, rma, models.ReturnStatusCredited, "", actorID)
+		}
+
+		if amount > 0 {
+			result := tx.Model(&models.Wallet{}).Where("user_id = ?", rma.UserID).
+				Update("balance", gorm.Expr("balance + ?", amount))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrNoWalletForRefund
+			}
+		}
+		return transition(tx, rma, models.ReturnStatusRefunded, "", actorID)
+	})
+	return restocked, err
+}
+
+func (r *ReturnRepository) AddPhoto(photo *models.ReturnPhoto) error {
+	return r.db.Create(photo).Error
+}
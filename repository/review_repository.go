@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotPurchased    = errors.New("only customers who bought the product can review it")
+	ErrAlreadyReviewed = errors.New("you have already reviewed this product")
+	ErrInvalidRating   = errors.New("rating must be between 1 and 5")
+	ErrOwnReview       = errors.New("you cannot vote on your own review")
+)
+
+// PaidOrderStatuses are the statuses of orders that have been paid for.
+var PaidOrderStatuses = []string{"paid", "partially_shipped", "shipped", "delivered"}
+
+// Review sort options; helpful is the default.
+const (
+	ReviewSortHelpful    = "helpful"
+	ReviewSortNewest     = "newest"
+	ReviewSortRatingHigh = "rating_high"
+	ReviewSortRatingLow  = "rating_low"
+)
+
+var reviewOrders = map[string]string{
+	ReviewSortHelpful:    "helpful_count - unhelpful_count DESC, helpful_count DESC, created_at DESC, id DESC",
+	ReviewSortNewest:     "created_at DESC, id DESC",
+	ReviewSortRatingHigh: "rating DESC, created_at DESC, id DESC",
+	ReviewSortRatingLow:  "rating ASC, created_at DESC, id DESC",
+}
+
+// ReviewSummary aggregates the approved reviews of a product.
+type ReviewSummary struct {
+	Average float64 `json:"average"`
+	Count   int64   `json:"count"`
+	// Number of reviews per rating, 1 to 5
+	Distribution map[int]int64 `json:"distribution"`
+}
+
+type ReviewRepository struct {
+	db *gorm.DB
+}
+
+func NewReviewRepository(db *gorm.DB) *ReviewRepository {
+	return &ReviewRepository{db: db}
+}
+
+// HasPurchased reports whether the user has a paid order line for the
+// product.
+func (r *ReviewRepository) HasPurchased(userID, productID uint) (bool, error) {
+	return hasPurchased(r.db, userID, productID)
+}
+
+func hasPurchased(db *gorm.DB, userID, productID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.OrderDetail{}).
+		Joins("JOIN orders ON orders.id = order_details.order_id AND orders.deleted_at IS NULL").
+		Where("orders.user_id = ? AND order_details.product_id = ? AND orders.status IN ?",
+			userID, productID, PaidOrderStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// Create saves a new review for moderation after checking the rating and
+// that the author bought the product and has not reviewed it yet.
+func (r *ReviewRepository) Create(review *models.Review) error {
+	if review.Rating < 1 || review.Rating > 5 {
+		return ErrInvalidRating
+	}
+	purchased, err := r.HasPurchased(review.UserID, review.ProductID)
+	if err != nil {
+		return err
+	}
+	if !purchased {
+		return ErrNotPurchased
+	}
+
+	var count int64
+	if err := r.db.Model(&models.Review{}).
+		Where("product_id = ? AND user_id = ?", review.ProductID, review.UserID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadyReviewed
+	}
+
+	review.Status = models.ReviewStatusPending
+	review.HelpfulCount, review.UnhelpfulCount = 0, 0
+	return r.db.Omit(clause.Associations).Create(review).Error
+}
+
+func (r *ReviewRepository) GetByID(id uint) (*models.Review, error) {
+	reviews := make([]models.Review, 1)
+	if err := r.db.Preload("Photos").First(&reviews[0], id).Error; err != nil {
+		return nil, err
+	}
+	if err := r.attachAuthors(reviews); err != nil {
+		return nil, err
+	}
+	return &reviews[0], nil
+}
+
+// List returns a page of a product's approved reviews, optionally only
+// those with one rating, and their total count.
+func (r *ReviewRepository) List(productID uint, rating int, sort string, page utils.Pagination) ([]models.Review, int64, error) {
+	if sort == "" {
+		sort = ReviewSortHelpful
+	}
+	order, ok := reviewOrders[sort]
+	if !ok {
+		return nil, 0, ErrInvalidSort
+	}
+
+	query := r.db.Model(&models.Review{}).
+		Where("product_id = ? AND status = ?", productID, models.ReviewStatusApproved)
+	if rating != 0 {
+		query = query.Where("rating = ?", rating)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	reviews := []models.Review{}
+	err := query.Preload("Photos").Order(order).
+		Offset(page.Offset()).Limit(page.PageSize).Find(&reviews).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return reviews, total, r.attachAuthors(reviews)
+}
+
+// ListForModeration returns a page of reviews of any product, oldest first,
+// optionally with one status, and their total count.
+func (r *ReviewRepository) ListForModeration(status string, page utils.Pagination) ([]models.Review, int64, error) {
+	query := r.db.Model(&models.Review{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	reviews := []models.Review{}
+	err := query.Preload("Photos").
+		Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name", "sku") }).
+		Order("created_at, id").Offset(page.Offset()).Limit(page.PageSize).Find(&reviews).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return reviews, total, r.attachAuthors(reviews)
+}
+
+// ListByUser returns all of a user's reviews, newest first.
+func (r *ReviewRepository) ListByUser(userID uint) ([]models.Review, error) {
+	reviews := []models.Review{}
+	err := r.db.Preload("Photos").
+		Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Select("id", "name", "sku") }).
+		Where("user_id = ?", userID).Order("created_at DESC").Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+	return reviews, r.attachAuthors(reviews)
+}
+
+// attachAuthors sets the author names without exposing other user fields.
+func (r *ReviewRepository) attachAuthors(reviews []models.Review) error {
+	ids := make([]uint, len(reviews))
+	for i, review := range reviews {
+		ids[i] = review.UserID
+	}
+	names, err := usernames(r.db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range reviews {
+		reviews[i].AuthorName = names[reviews[i].UserID]
+	}
+	return nil
+}
+
+// usernames maps user IDs to usernames, including deleted users.
+func usernames(db *gorm.DB, ids []uint) (map[uint]string, error) {
+	names := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+	var users []models.User
+	if err := db.Unscoped().Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names, nil
+}
+
+// Summary aggregates the approved reviews of a product.
+func (r *ReviewRepository) Summary(productID uint) (*ReviewSummary, error) {
+	var rows []struct {
+		Rating int
+		Count  int64
+	}
+	err := r.db.Model(&models.Review{}).Select("rating, COUNT(*) AS count").
+		Where("product_id = ? AND status = ?", productID, models.ReviewStatusApproved).
+		Group("rating").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ReviewSummary{Distribution: map[int]int64{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	var sum int64
+	for _, row := range rows {
+		summary.Distribution[row.Rating] = row.Count
+		summary.Count += row.Count
+		sum += int64(row.Rating) * row.Count
+	}
+	if summary.Count > 0 {
+		summary.Average = float64(sum) / float64(summary.Count)
+	}
+	return summary, nil
+}
+
+// Update changes the author's rating and text and sends the review back to
+// moderation.
+func (r *ReviewRepository) Update(review *models.Review) error {
+	if review.Rating < 1 || review.Rating > 5 {
+		return ErrInvalidRating
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		wasApproved := review.Status == models.ReviewStatusApproved
+		review.Status = models.ReviewStatusPending
+		review.ModerationNote = ""
+		err := tx.Model(review).Select("Rating", "Title", "Body", "Status", "ModerationNote").
+			Updates(review).Error
+		if err != nil {
+			return err
+		}
+		if wasApproved {
+			return refreshRating(tx, review.ProductID)
+		}
+		return nil
+	})
+}
+
+// Moderate approves or rejects a review and updates the product's rating.
+func (r *ReviewRepository) Moderate(review *models.Review, status, note string, adminID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		review.Status = status
+		review.ModerationNote = note
+		review.ModeratedByID = &adminID
+		review.ModeratedAt = &now
+		err := tx.Model(review).Select("Status", "ModerationNote", "ModeratedByID", "ModeratedAt").
+			Updates(review).Error
+		if err != nil {
+			return err
+		}
+		return refreshRating(tx, review.ProductID)
+	})
+}
+
+// Delete removes a review with its photos and votes, so its author may
+// review the product again, and updates the product's rating.
+func (r *ReviewRepository) Delete(review *models.Review) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("review_id = ?", review.ID).Delete(&models.ReviewPhoto{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("review_id = ?", review.ID).Delete(&models.ReviewVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&models.Review{}, review.ID).Error; err != nil {
+			return err
+		}
+		return refreshRating(tx, review.ProductID)
+	})
+}
+
+// refreshRating stores the average and count of a product's approved
+// reviews on the product.
+func refreshRating(tx *gorm.DB, productID uint) error {
+	return tx.Exec(`UPDATE products SET
+		rating_average = COALESCE((SELECT ROUND(AVG(rating), 2) FROM reviews
+			WHERE product_id = ? AND status = ? AND deleted_at IS NULL), 0),
+		rating_count = (SELECT COUNT(*) FROM reviews
+			WHERE product_id = ? AND status = ? AND deleted_at IS NULL)
+		WHERE id = ?`,
+		productID, models.ReviewStatusApproved, productID, models.ReviewStatusApproved, productID).Error
+}
+
+func (r *ReviewRepository) AddPhoto(photo *models.ReviewPhoto) error {
+	return r.db.Create(photo).Error
+}
+
+func (r *ReviewRepository) CountPhotos(reviewID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ReviewPhoto{}).Where("review_id = ?", reviewID).Count(&count).Error
+	return count, err
+}
+
+// Vote records or changes a user's vote on a review and recounts its votes.
+func (r *ReviewRepository) Vote(review *models.Review, userID uint, helpful bool) error {
+	if review.UserID == userID {
+		return ErrOwnReview
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		vote := models.ReviewVote{ReviewID: review.ID, UserID: userID, Helpful: helpful}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "review_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"helpful", "updated_at", "deleted_at"}),
+		}).Create(&vote).Error
+		if err != nil {
+			return err
+		}
+		return recountVotes(tx, review)
+	})
+}
+
+// Unvote withdraws a user's vote on a review.
+func (r *ReviewRepository) Unvote(review *models.Review, userID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("review_id = ? AND user_id = ?", review.ID, userID).
+			Delete(&models.ReviewVote{}).Error
+		if err != nil {
+			return err
+		}
+		return recountVotes(tx, review)
+	})
+}
+
+func recountVotes(tx *gorm.DB, review *models.Review) error {
+	err := tx.Exec(`UPDATE reviews SET
+		helpful_count = (SELECT COUNT(*) FROM review_votes WHERE review_id = ? AND helpful AND deleted_at IS NULL),
+		unhelpful_count = (SELECT COUNT(*) FROM review_votes WHERE review_id = ? AND NOT helpful AND deleted_at IS NULL)
+		WHERE id = ?`, review.ID, review.ID, review.ID).Error
+	if err != nil {
+		return err
+	}
+	return tx.Model(&models.Review{}).Select("helpful_count", "unhelpful_count").
+		First(review, review.ID).Error
+}
+
+// UserVotes returns the user's votes on the given reviews.
+func (r *ReviewRepository) UserVotes(userID uint, reviewIDs []uint) (map[uint]bool, error) {
+	votes := map[uint]bool{}
+	if len(reviewIDs) == 0 {
+		return votes, nil
+	}
+	var rows []models.ReviewVote
+	if err := r.db.Where("user_id = ? AND review_id IN ?", userID, reviewIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range rows {
+		votes[v.ReviewID] = v.Helpful
+	}
+	return votes, nil
+}
@@ -0,0 +1,488 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrRevertSKUTaken = errors.New("the revision's SKU is now used by another product")
+
+type RevisionRepository struct {
+	db *gorm.DB
+}
+
+func NewRevisionRepository(db *gorm.DB) *RevisionRepository {
+	return &RevisionRepository{db: db}
+}
+
+// Snapshot returns the current revisioned state of a product. Take it
+// before a change and pass it to Record afterwards.
+func (r *RevisionRepository) Snapshot(productID uint) (*models.ProductSnapshot, error) {
+	return snapshot(r.db, productID)
+}
+
+// Record saves the product's current state as a revision made by userID,
+// with its differences from before (nil for new products). A change that
+// altered nothing is not recorded and returns nil. Before a product's first
+// recorded change, before is saved as its baseline so it can be restored.
+func (r *RevisionRepository) Record(productID uint, userID *uint, action string, before *models.ProductSnapshot) (*models.ProductRevision, error) {
+	var revision *models.ProductRevision
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		revision, err = record(tx, productID, userID, action, before, nil)
+		return err
+	})
+	return revision, err
+}
+
+func record(tx *gorm.DB, productID uint, userID *uint, action string, before *models.ProductSnapshot, revertedFrom *uint) (*models.ProductRevision, error) {
+	after, err := snapshot(tx, productID)
+	if err != nil {
+		return nil, err
+	}
+	changes := diffSnapshots(before, after)
+	if before != nil && len(changes) == 0 && revertedFrom == nil {
+		return nil, nil
+	}
+
+	if before != nil {
+		var count int64
+		if err := tx.Model(&models.ProductRevision{}).Where("product_id = ?", productID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			baseline := models.ProductRevision{
+				ProductID: productID,
+				Action:    models.RevisionBaseline,
+				Snapshot:  before,
+				Changes:   []models.FieldChange{},
+			}
+			if err := tx.Omit(clause.Associations).Create(&baseline).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	revision := models.ProductRevision{
+		ProductID:    productID,
+		UserID:       userID,
+		Action:       action,
+		Snapshot:     after,
+		Changes:      changes,
+		RevertedFrom: revertedFrom,
+	}
+	if err := tx.Omit(clause.Associations).Create(&revision).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// List returns a page of a product's revisions without their snapshots,
+// newest first, and their total count.
+func (r *RevisionRepository) List(productID uint, page utils.Pagination) ([]models.ProductRevision, int64, error) {
+	query := r.db.Model(&models.ProductRevision{}).Where("product_id = ?", productID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	revisions := []models.ProductRevision{}
+	err := query.Omit("Snapshot").Order("id DESC").
+		Offset(page.Offset()).Limit(page.PageSize).Find(&revisions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := r.attachAuthors(revisions); err != nil {
+		return nil, 0, err
+	}
+	return revisions, total, nil
+}
+
+// GetByID returns one of a product's revisions with its snapshot.
+func (r *RevisionRepository) GetByID(productID, id uint) (*models.ProductRevision, error) {
+	var revision models.ProductRevision
+	if err := r.db.Where("product_id = ?", productID).First(&revision, id).Error; err != nil {
+		return nil, err
+	}
+	revisions := []models.ProductRevision{revision}
+	if err := r.attachAuthors(revisions); err != nil {
+		return nil, err
+	}
+	return &revisions[0], nil
+}
+
+func (r *RevisionRepository) attachAuthors(revisions []models.ProductRevision) error {
+	var ids []uint
+	for _, rev := range revisions {
+		if rev.UserID != nil {
+			ids = append(ids, *rev.UserID)
+		}
+	}
+	names, err := usernames(r.db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range revisions {
+		if revisions[i].UserID != nil {
+			revisions[i].Username = names[*revisions[i].UserID]
+		}
+	}
+	return nil
+}
+
+// Revert restores a product to one of its revisions and records that as a
+// new revision. Fields and prices are restored as they were. Images come
+// back if their rows still exist; deleted images are restored only if they
+// were deleted after imagesSince, while their files are still kept. Only
+// variants that still exist are restored, since deleting a variant removes
+// it for good. What could not be restored is returned as the field paths of
+// FieldChange.
+func (r *RevisionRepository) Revert(productID, revisionID uint, userID *uint, imagesSince time.Time) (*models.ProductRevision, []string, error) {
+	var revision *models.ProductRevision
+	skipped := []string{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var target models.ProductRevision
+		if err := tx.Where("product_id = ?", productID).First(&target, revisionID).Error; err != nil {
+			return err
+		}
+		before, err := snapshot(tx, productID)
+		if err != nil {
+			return err
+		}
+		s := target.Snapshot
+
+		var taken int64
+		if err := tx.Model(&models.Product{}).Where("sku = ? AND id <> ?", s.SKU, productID).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrRevertSKUTaken
+		}
+		err = tx.Model(&models.Product{}).Where("id = ?", productID).Updates(map[string]interface{}{
+			"name":            s.Name,
+			"description":     s.Description,
+			"sku":             s.SKU,
+			"model_number":    s.ModelNumber,
+			"warranty":        s.Warranty,
+			"weight":          s.Weight,
+			"dimensions":      s.Dimensions,
+			"power":           s.Power,
+			"material":        s.Material,
+			"capacity":        s.Capacity,
+			"features":        s.Features,
+			"is_active":       s.IsActive,
+			"stock_policy":    s.StockPolicy,
+			"available_at":    s.AvailableAt,
+			"backorder_limit": s.BackorderLimit,
+			"category_id":     s.CategoryID,
+			"brand_id":        s.BrandID,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Where("product_id = ?", productID).Delete(&models.ProductPrice{}).Error; err != nil {
+			return err
+		}
+		for _, p := range s.Prices {
+			price := models.ProductPrice{ProductID: productID, GroupID: p.GroupID, Price: p.Price}
+			if err := tx.Omit(clause.Associations).Create(&price).Error; err != nil {
+				return err
+			}
+		}
+
+		var variants []models.ProductVariant
+		if err := tx.Where("product_id = ?", productID).Find(&variants).Error; err != nil {
+			return err
+		}
+		existing := make(map[uint]bool, len(variants))
+		for _, v := range variants {
+			existing[v.ID] = true
+		}
+		restored := map[uint]bool{}
+		for _, v := range s.Variants {
+			key := fmt.Sprintf("variants.%d", v.ID)
+			if !existing[v.ID] {
+				skipped = append(skipped, key)
+				continue
+			}
+			restored[v.ID] = true
+			updates := map[string]interface{}{"barcode": v.Barcode, "is_active": v.IsActive}
+			if err := tx.Model(&models.ProductVariant{}).Where("sku = ? AND id <> ?", v.SKU, v.ID).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				skipped = append(skipped, key+".sku")
+			} else {
+				updates["sku"] = v.SKU
+			}
+			if err := tx.Model(&models.ProductVariant{}).Where("id = ?", v.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Where("variant_id = ?", v.ID).Delete(&models.VariantPrice{}).Error; err != nil {
+				return err
+			}
+			for _, p := range v.Prices {
+				price := models.VariantPrice{VariantID: v.ID, GroupID: p.GroupID, Price: p.Price}
+				if err := tx.Omit(clause.Associations).Create(&price).Error; err != nil {
+					return err
+				}
+			}
+		}
+		// Variants added since can only be deleted by hand
+		for _, v := range variants {
+			if !restored[v.ID] {
+				skipped = append(skipped, fmt.Sprintf("variants.%d", v.ID))
+			}
+		}
+
+		wanted := make(map[uint]bool, len(s.Images))
+		for _, img := range s.Images {
+			wanted[img.ID] = true
+		}
+		err = tx.Where("product_id = ?", productID).Where("id NOT IN ?", append(keys(wanted), 0)).
+			Delete(&models.ProductImage{}).Error
+		if err != nil {
+			return err
+		}
+		for _, img := range s.Images {
+			key := fmt.Sprintf("images.%d", img.ID)
+			var current models.ProductImage
+			result := tx.Unscoped().Select("id", "deleted_at").Where("product_id = ?", productID).Limit(1).Find(&current, img.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 || (current.DeletedAt.Valid && current.DeletedAt.Time.Before(imagesSince)) {
+				skipped = append(skipped, key)
+				continue
+			}
+			variantID := img.VariantID
+			if variantID != nil && !existing[*variantID] {
+				variantID = nil
+				skipped = append(skipped, key+".variant_id")
+			}
+			err := tx.Unscoped().Model(&models.ProductImage{}).Where("id = ?", img.ID).Updates(map[string]interface{}{
+				"alt":        img.Alt,
+				"is_primary": img.IsPrimary,
+				"order":      img.Order,
+				"variant_id": variantID,
+				"deleted_at": nil,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		revision, err = record(tx, productID, userID, models.RevisionRevert, before, &target.ID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return revision, skipped, nil
+}
+
+func keys(set map[uint]bool) []uint {
+	ids := make([]uint, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// snapshot reads the revisioned state of a product.
+func snapshot(db *gorm.DB, productID uint) (*models.ProductSnapshot, error) {
+	var product models.Product
+	if err := db.First(&product, productID).Error; err != nil {
+		return nil, err
+	}
+	s := models.ProductSnapshot{
+		Name:           product.Name,
+		Description:    product.Description,
+		SKU:            product.SKU,
+		ModelNumber:    product.ModelNumber,
+		Warranty:       product.Warranty,
+		Weight:         product.Weight,
+		Dimensions:     product.Dimensions,
+		Power:          product.Power,
+		Material:       product.Material,
+		Capacity:       product.Capacity,
+		Features:       product.Features,
+		IsActive:       product.IsActive,
+		StockPolicy:    product.StockPolicy,
+		AvailableAt:    product.AvailableAt,
+		BackorderLimit: product.BackorderLimit,
+		CategoryID:     product.CategoryID,
+		BrandID:        product.BrandID,
+		Prices:         []models.SnapshotPrice{},
+		Images:         []models.SnapshotImage{},
+		Variants:       []models.SnapshotVariant{},
+	}
+
+	var prices []models.ProductPrice
+	if err := db.Where("product_id = ?", productID).Order("id").Find(&prices).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range prices {
+		s.Prices = append(s.Prices, models.SnapshotPrice{GroupID: p.GroupID, Price: p.Price})
+	}
+
+	var images []models.ProductImage
+	if err := db.Where("product_id = ?", productID).Order(`"order", id`).Find(&images).Error; err != nil {
+		return nil, err
+	}
+	for _, img := range images {
+		s.Images = append(s.Images, models.SnapshotImage{
+			ID:        img.ID,
+			URL:       img.URL,
+			Alt:       img.Alt,
+			IsPrimary: img.IsPrimary,
+			Order:     img.Order,
+			VariantID: img.VariantID,
+		})
+	}
+
+	var variants []models.ProductVariant
+	err := db.Preload("Values", func(db *gorm.DB) *gorm.DB {
+		return db.Order("option_id, position, id")
+	}).Preload("Prices", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Where("product_id = ?", productID).Order("id").Find(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range variants {
+		labels := make([]string, len(v.Values))
+		for i, value := range v.Values {
+			labels[i] = value.Value
+		}
+		variant := models.SnapshotVariant{
+			ID:       v.ID,
+			Label:    strings.Join(labels, " / "),
+			SKU:      v.SKU,
+			Barcode:  v.Barcode,
+			IsActive: v.IsActive,
+			Prices:   []models.SnapshotPrice{},
+		}
+		for _, p := range v.Prices {
+			variant.Prices = append(variant.Prices, models.SnapshotPrice{GroupID: p.GroupID, Price: p.Price})
+		}
+		s.Variants = append(s.Variants, variant)
+	}
+	return &s, nil
+}
+
+// diffSnapshots lists the values that differ between two snapshots, in
+// snapshot order. A nil before counts as empty.
+func diffSnapshots(before, after *models.ProductSnapshot) []models.FieldChange {
+	oldKeys, oldValues := flattenSnapshot(before)
+	newKeys, newValues := flattenSnapshot(after)
+
+	changes := []models.FieldChange{}
+	seen := map[string]bool{}
+	for _, key := range append(oldKeys, newKeys...) {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if oldValues[key] != newValues[key] {
+			changes = append(changes, models.FieldChange{Field: key, Old: oldValues[key], New: newValues[key]})
+		}
+	}
+	return changes
+}
+
+// flattenSnapshot turns a snapshot into comparable values keyed by
+// FieldChange paths, and returns the paths in order.
+func flattenSnapshot(s *models.ProductSnapshot) ([]string, map[string]interface{}) {
+	var order []string
+	values := map[string]interface{}{}
+	if s == nil {
+		return order, values
+	}
+	set := func(key string, value interface{}) {
+		// repeated keys, such as two prices for one group, are numbered
+		for n := 2; ; n++ {
+			if _, taken := values[key]; !taken {
+				break
+			}
+			key = fmt.Sprintf("%s#%d", strings.SplitN(key, "#", 2)[0], n)
+		}
+		order = append(order, key)
+		values[key] = value
+	}
+
+	set("name", s.Name)
+	set("description", s.Description)
+	set("sku", s.SKU)
+	set("model_number", s.ModelNumber)
+	set("warranty", s.Warranty)
+	set("weight", s.Weight)
+	set("dimensions", s.Dimensions)
+	set("power", s.Power)
+	set("material", s.Material)
+	set("capacity", s.Capacity)
+	set("features", s.Features)
+	set("is_active", s.IsActive)
+	set("stock_policy", s.StockPolicy)
+	set("available_at", timeValue(s.AvailableAt))
+	set("backorder_limit", s.BackorderLimit)
+	set("category_id", idValue(s.CategoryID))
+	set("brand_id", idValue(s.BrandID))
+
+	prices := func(prefix string, list []models.SnapshotPrice) {
+		sorted := append([]models.SnapshotPrice(nil), list...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].GroupID == nil && sorted[j].GroupID != nil ||
+				sorted[i].GroupID != nil && sorted[j].GroupID != nil && *sorted[i].GroupID < *sorted[j].GroupID
+		})
+		for _, p := range sorted {
+			key := prefix + ".default"
+			if p.GroupID != nil {
+				key = fmt.Sprintf("%s.group:%d", prefix, *p.GroupID)
+			}
+			set(key, p.Price)
+		}
+	}
+	prices("prices", s.Prices)
+
+	for _, img := range s.Images {
+		prefix := fmt.Sprintf("images.%d.", img.ID)
+		set(prefix+"url", img.URL)
+		set(prefix+"alt", img.Alt)
+		set(prefix+"is_primary", img.IsPrimary)
+		set(prefix+"order", img.Order)
+		set(prefix+"variant_id", idValue(img.VariantID))
+	}
+	for _, v := range s.Variants {
+		prefix := fmt.Sprintf("variants.%d", v.ID)
+		set(prefix+".label", v.Label)
+		set(prefix+".sku", v.SKU)
+		set(prefix+".barcode", v.Barcode)
+		set(prefix+".is_active", v.IsActive)
+		prices(prefix+".prices", v.Prices)
+	}
+	return order, values
+}
+
+func idValue(id *uint) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
+}
+
+func timeValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors returned by ShipmentRepository.Create for items that cannot ship.
+var (
+	ErrUnknownOrderLine = errors.New("order line does not belong to this order")
+	ErrOverShipment     = errors.New("quantity exceeds the units left to ship")
+	ErrNothingToShip    = errors.New("nothing left to ship")
+)
+
+type ShipmentRepository struct {
+	db *gorm.DB
+}
+
+func NewShipmentRepository(db *gorm.DB) *ShipmentRepository {
+	return &ShipmentRepository{db: db}
+}
+
+func (r *ShipmentRepository) GetByID(id uint) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := r.db.Preload("Items").Preload("Items.OrderDetail").Preload("Items.OrderDetail.Product").First(&shipment, id).Error
+	return &shipment, err
+}
+
+func (r *ShipmentRepository) GetByOrderID(orderID uint) ([]models.Shipment, error) {
+	var shipments []models.Shipment
+	err := r.db.Preload("Items").Preload("Items.OrderDetail").Preload("Items.OrderDetail.Product").
+		Where("order_id = ?", orderID).Order("created_at").Find(&shipments).Error
+	return shipments, err
+}
+
+// shippedQuantities returns the units already shipped per order line.
+func shippedQuantities(tx *gorm.DB, orderID uint) (map[uint]int, error) {
+	var rows []struct {
+		OrderDetailID uint
+		Quantity      int
+	}
+	err := tx.Model(&models.ShipmentItem{}).
+		Joins("JOIN shipments ON shipments.id = shipment_items.shipment_id AND shipments.deleted_at IS NULL").
+		Where("shipments.order_id = ?", orderID).
+		Select("shipment_items.order_detail_id, SUM(shipment_items.quantity) AS quantity").
+		Group("shipment_items.order_detail_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	shipped := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		shipped[row.OrderDetailID] = row.Quantity
+	}
+	return shipped, nil
+}
+
+// Create saves a shipment for the order and updates the order status. When
+// the shipment has no items, every unit still waiting to ship is included.
+// Back-ordered units cannot ship until they are allocated.
+func (r *ShipmentRepository) Create(shipment *models.Shipment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Details").First(&order, shipment.OrderID).Error; err != nil {
+			return err
+		}
+
+		shipped, err := shippedQuantities(tx, order.ID)
+		if err != nil {
+			return err
+		}
+
+		remaining := make(map[uint]int, len(order.Details))
+		for _, d := range order.Details {
+			remaining[d.ID] = d.Quantity - d.BackorderedQuantity - shipped[d.ID]
+		}
+
+		if len(shipment.Items) == 0 {
+			for _, d := range order.Details {
+				if remaining[d.ID] > 0 {
+					shipment.Items = append(shipment.Items, models.ShipmentItem{OrderDetailID: d.ID, Quantity: remaining[d.ID]})
+				}
+			}
+			if len(shipment.Items) == 0 {
+				return ErrNothingToShip
+			}
+		}
+
+		for _, item := range shipment.Items {
+			left, ok := remaining[item.OrderDetailID]
+			if !ok {
+				return ErrUnknownOrderLine
+			}
+			if item.Quantity <= 0 || item.Quantity > left {
+				return ErrOverShipment
+			}
+			remaining[item.OrderDetailID] = left - item.Quantity
+		}
+
+		if shipment.ShippedAt == nil {
+			now := time.Now()
+			shipment.ShippedAt = &now
+		}
+		if err := tx.Omit("Items.OrderDetail").Create(shipment).Error; err != nil {
+			return err
+		}
+		return syncOrderStatus(tx, &order)
+	})
+}
+
+// Update changes the carrier and tracking details of a shipment.
+func (r *ShipmentRepository) Update(shipment *models.Shipment) error {
+	return r.db.Model(&models.Shipment{}).Where("id = ?", shipment.ID).Updates(map[string]interface{}{
+		"carrier":         shipment.Carrier,
+		"tracking_number": shipment.TrackingNumber,
+		"tracking_url":    shipment.TrackingURL,
+		"note":            shipment.Note,
+	}).Error
+}
+
+// MarkDelivered records the delivery time of a shipment and updates the
+// order status.
+func (r *ShipmentRepository) MarkDelivered(shipment *models.Shipment, at time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Details").First(&order, shipment.OrderID).Error; err != nil {
+			return err
+		}
+
+		shipment.DeliveredAt = &at
+		if err := tx.Model(&models.Shipment{}).Where("id = ?", shipment.ID).Update("delivered_at", at).Error; err != nil {
+			return err
+		}
+		return syncOrderStatus(tx, &order)
+	})
+}
+
+// Delete removes a shipment created by mistake and recomputes the order status.
+func (r *ShipmentRepository) Delete(shipment *models.Shipment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Details").First(&order, shipment.OrderID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("shipment_id = ?", shipment.ID).Delete(&models.ShipmentItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Shipment{}, shipment.ID).Error; err != nil {
+			return err
+		}
+		return syncOrderStatus(tx, &order)
+	})
+}
+
+// syncOrderStatus derives the order status from its shipments:
+// partially_shipped while units are left to ship, shipped once everything
+// left and delivered once every shipment arrived. Orders without shipments
+// fall back to "paid".
+func syncOrderStatus(tx *gorm.DB, order *models.Order) error {
+	shipped, err := shippedQuantities(tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	var undelivered, total int64
+	if err := tx.Model(&models.Shipment{}).Where("order_id = ?", order.ID).Count(&total).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Shipment{}).Where("order_id = ? AND delivered_at IS NULL", order.ID).Count(&undelivered).Error; err != nil {
+		return err
+	}
+
+	complete := true
+	for _, d := range order.Details {
+		if shipped[d.ID] < d.Quantity {
+			complete = false
+			break
+		}
+	}
+
+	status := order.Status
+	switch {
+	case total == 0:
+		if status == "partially_shipped" || status == "shipped" || status == "delivered" {
+			status = "paid"
+		}
+	case !complete:
+		status = "partially_shipped"
+	case undelivered > 0:
+		status = "shipped"
+	default:
+		status = "delivered"
+	}
+
+	if status == order.Status {
+		return nil
+	}
+	order.Status = status
+	return tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("status", status).Error
+}
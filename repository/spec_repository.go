@@ -0,0 +1,494 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/search"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors returned by SpecRepository for schema changes and values that don't
+// fit. ErrInvalidSpecAttribute is wrapped with the reason.
+var (
+	ErrInvalidSpecAttribute = errors.New("invalid spec attribute")
+	ErrSpecKeyTaken         = errors.New("spec key is already used by this category, an ancestor or a descendant")
+	ErrSpecInUse            = errors.New("products have values that this change would invalidate")
+	ErrNoCategory           = errors.New("product has no category, so it has no spec schema")
+)
+
+// SpecErrors maps spec keys to what is wrong with their values.
+type SpecErrors map[string]string
+
+func (e SpecErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key + ": " + e[key]
+	}
+	return "invalid specs: " + strings.Join(parts, "; ")
+}
+
+// specOrder sorts product_specs rows by their attribute's position.
+const specOrder = "(SELECT position FROM spec_attributes WHERE spec_attributes.id = product_specs.attribute_id), product_specs.attribute_id"
+
+// maxSpecKeyLength matches the size of SpecAttribute.Key.
+const maxSpecKeyLength = 64
+
+type SpecRepository struct {
+	db *gorm.DB
+}
+
+func NewSpecRepository(db *gorm.DB) *SpecRepository {
+	return &SpecRepository{db: db}
+}
+
+// Schema returns the attributes products of the category have: those of its
+// ancestors first, then its own, each in position order.
+func (r *SpecRepository) Schema(categoryID uint) ([]models.SpecAttribute, error) {
+	if err := r.db.Select("id").First(&models.Category{}, categoryID).Error; err != nil {
+		return nil, err
+	}
+	return specSchema(r.db, categoryID)
+}
+
+// specSchema loads the attributes of a category and its ancestors.
+func specSchema(db *gorm.DB, categoryID uint) ([]models.SpecAttribute, error) {
+	attributes := []models.SpecAttribute{}
+	err := db.Joins("JOIN ("+categoryPathSQL+") AS path ON path.id = spec_attributes.category_id", categoryID, maxCategoryDepth).
+		Order("path.depth DESC, spec_attributes.position, spec_attributes.id").
+		Find(&attributes).Error
+	return attributes, err
+}
+
+func (r *SpecRepository) GetAttribute(id uint) (*models.SpecAttribute, error) {
+	var attribute models.SpecAttribute
+	err := r.db.First(&attribute, id).Error
+	return &attribute, err
+}
+
+// CreateAttribute adds an attribute to the category's schema. The key
+// defaults to the slug of the name.
+func (r *SpecRepository) CreateAttribute(categoryID uint, attribute *models.SpecAttribute) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&models.Category{}, categoryID).Error; err != nil {
+			return err
+		}
+		attribute.ID = 0
+		attribute.CategoryID = categoryID
+		if err := normalizeSpecAttribute(attribute); err != nil {
+			return err
+		}
+		if err := checkSpecKey(tx, categoryID, attribute.Key, 0); err != nil {
+			return err
+		}
+		return tx.Create(attribute).Error
+	})
+}
+
+// UpdateAttribute changes the name, type, unit, options, flags and position
+// of an attribute. Its key and category stay. Changing the type of an
+// attribute in use, or dropping enum options products use, returns
+// ErrSpecInUse.
+func (r *SpecRepository) UpdateAttribute(id uint, changes models.SpecAttribute) (*models.SpecAttribute, error) {
+	var attribute models.SpecAttribute
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&attribute, id).Error; err != nil {
+			return err
+		}
+		changes.Key = attribute.Key
+		if err := normalizeSpecAttribute(&changes); err != nil {
+			return err
+		}
+
+		values := tx.Model(&models.ProductSpec{}).Where("attribute_id = ?", id)
+		var invalidated int64
+		switch {
+		case changes.Type != attribute.Type:
+			err := values.Count(&invalidated).Error
+			if err != nil {
+				return err
+			}
+		case changes.Type == models.SpecTypeEnum:
+			err := values.Where("value NOT IN ?", changes.Options).Count(&invalidated).Error
+			if err != nil {
+				return err
+			}
+		}
+		if invalidated > 0 {
+			return ErrSpecInUse
+		}
+
+		attribute.Name = changes.Name
+		attribute.Type = changes.Type
+		attribute.Unit = changes.Unit
+		attribute.Options = changes.Options
+		attribute.Required = changes.Required
+		attribute.Filterable = changes.Filterable
+		attribute.Position = changes.Position
+		return tx.Save(&attribute).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &attribute, nil
+}
+
+// DeleteAttribute removes an attribute and every product's value for it.
+func (r *SpecRepository) DeleteAttribute(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("attribute_id = ?", id).Delete(&models.ProductSpec{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Delete(&models.SpecAttribute{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// ProductSpecs returns a product's spec values with their attributes.
+func (r *SpecRepository) ProductSpecs(productID uint) ([]models.ProductSpec, error) {
+	specs := []models.ProductSpec{}
+	err := r.db.Preload("Attribute").Where("product_id = ?", productID).Order(specOrder).Find(&specs).Error
+	return specs, err
+}
+
+// LoadSpecs fills the Specs of the given products.
+func (r *SpecRepository) LoadSpecs(products ...*models.Product) error {
+	for _, p := range products {
+		specs, err := r.ProductSpecs(p.ID)
+		if err != nil {
+			return err
+		}
+		p.Specs = specs
+	}
+	return nil
+}
+
+// SetProductSpecs validates values (spec key to value) against the schema
+// of the product's category and replaces the product's specs with them.
+// Numbers may be sent as JSON numbers or strings, optionally followed by the
+// unit; enum values match their options case-insensitively. Invalid values
+// are reported together as SpecErrors.
+func (r *SpecRepository) SetProductSpecs(productID uint, values map[string]interface{}) ([]models.ProductSpec, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Select("id", "category_id").First(&product, productID).Error; err != nil {
+			return err
+		}
+		var schema []models.SpecAttribute
+		if product.CategoryID != nil {
+			var err error
+			if schema, err = specSchema(tx, *product.CategoryID); err != nil {
+				return err
+			}
+		} else if len(values) > 0 {
+			return ErrNoCategory
+		}
+
+		specs, errs := validateSpecs(schema, values)
+		if len(errs) > 0 {
+			return errs
+		}
+		for i := range specs {
+			specs[i].ProductID = productID
+		}
+
+		if err := tx.Unscoped().Where("product_id = ?", productID).Delete(&models.ProductSpec{}).Error; err != nil {
+			return err
+		}
+		if len(specs) == 0 {
+			return nil
+		}
+		return tx.Create(&specs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.ProductSpecs(productID)
+}
+
+// validateSpecs turns raw values into specs of the schema's attributes.
+func validateSpecs(schema []models.SpecAttribute, values map[string]interface{}) ([]models.ProductSpec, SpecErrors) {
+	errs := SpecErrors{}
+	known := make(map[string]bool, len(schema))
+	var specs []models.ProductSpec
+	for _, attribute := range schema {
+		known[attribute.Key] = true
+		value, number, err := specValue(attribute, values[attribute.Key])
+		switch {
+		case err != nil:
+			errs[attribute.Key] = err.Error()
+		case value == "" && attribute.Required:
+			errs[attribute.Key] = "is required"
+		case value != "":
+			specs = append(specs, models.ProductSpec{AttributeID: attribute.ID, Value: value, Number: number})
+		}
+	}
+	for key := range values {
+		if !known[key] {
+			errs[key] = "is not an attribute of the product's category"
+		}
+	}
+	return specs, errs
+}
+
+// specValue converts a raw JSON value to the canonical text of the
+// attribute's type, with the number of number attributes. An empty value
+// means the attribute is not set.
+func specValue(attribute models.SpecAttribute, raw interface{}) (string, *float64, error) {
+	if raw == nil {
+		return "", nil, nil
+	}
+	text := ""
+	switch v := raw.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		return "", nil, fmt.Errorf("must be a %s", attribute.Type)
+	}
+	if text == "" {
+		return "", nil, nil
+	}
+
+	switch attribute.Type {
+	case models.SpecTypeNumber:
+		digits := search.Normalize(text)
+		if attribute.Unit != "" {
+			digits = strings.TrimSpace(strings.TrimSuffix(digits, search.Normalize(attribute.Unit)))
+		}
+		n, err := strconv.ParseFloat(digits, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", nil, errors.New("must be a number")
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), &n, nil
+	case models.SpecTypeBoolean:
+		switch strings.ToLower(text) {
+		case "true", "1", "yes":
+			return "true", nil, nil
+		case "false", "0", "no":
+			return "false", nil, nil
+		}
+		return "", nil, errors.New("must be true or false")
+	case models.SpecTypeEnum:
+		for _, option := range attribute.Options {
+			if strings.EqualFold(option, text) {
+				return option, nil, nil
+			}
+		}
+		return "", nil, fmt.Errorf("must be one of: %s", strings.Join(attribute.Options, ", "))
+	}
+	return text, nil, nil
+}
+
+// Prune deletes the product's values for attributes outside the schema of
+// its current category, after the product or its category moved.
+func (r *SpecRepository) Prune(productID uint) error {
+	var product models.Product
+	if err := r.db.Select("id", "category_id").First(&product, productID).Error; err != nil {
+		return err
+	}
+	db := r.db.Unscoped().Where("product_id = ?", productID)
+	if product.CategoryID != nil {
+		db = db.Where("attribute_id NOT IN (SELECT spec_attributes.id FROM spec_attributes JOIN ("+categoryPathSQL+") AS path ON path.id = spec_attributes.category_id)",
+			*product.CategoryID, maxCategoryDepth)
+	}
+	return db.Delete(&models.ProductSpec{}).Error
+}
+
+// PruneCategory prunes the products of a category and its subcategories.
+func (r *SpecRepository) PruneCategory(categoryID uint) error {
+	var ids []uint
+	if err := r.db.Model(&models.Product{}).Where("category_id IN ("+categorySubtreeSQL+")", categoryID).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := r.Prune(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacySpecFields are the fixed spec columns of products that predate
+// category schemas.
+var legacySpecFields = []struct {
+	column, name string
+	filterable   bool
+}{
+	{"dimensions", "Dimensions", false},
+	{"power", "Power", true},
+	{"material", "Material", true},
+	{"capacity", "Capacity", true},
+	{"features", "Features", false},
+}
+
+// LegacySpecMigration reports what MigrateLegacy did.
+type LegacySpecMigration struct {
+	AttributesCreated []string `json:"attributes_created"`
+	ValuesCopied      int64    `json:"values_copied"`
+	Skipped           []string `json:"skipped"` // "<sku> <key>: reason"
+}
+
+// MigrateLegacy copies the legacy Dimensions, Power, Material, Capacity and
+// Features of the products in a category and its subcategories into specs.
+// Attributes with those keys are created on the category as text
+// attributes unless its schema already has them; existing spec values are
+// kept, and values that don't fit an existing attribute are skipped.
+// Running it again only copies what is still missing.
+func (r *SpecRepository) MigrateLegacy(categoryID uint) (*LegacySpecMigration, error) {
+	report := &LegacySpecMigration{AttributesCreated: []string{}, Skipped: []string{}}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&models.Category{}, categoryID).Error; err != nil {
+			return err
+		}
+		schema, err := specSchema(tx, categoryID)
+		if err != nil {
+			return err
+		}
+		byKey := make(map[string]models.SpecAttribute, len(schema))
+		for _, attribute := range schema {
+			byKey[attribute.Key] = attribute
+		}
+
+		for i, field := range legacySpecFields {
+			attribute, ok := byKey[field.column]
+			if !ok {
+				attribute = models.SpecAttribute{
+					CategoryID: categoryID,
+					Key:        field.column,
+					Name:       field.name,
+					Type:       models.SpecTypeText,
+					Filterable: field.filterable,
+					Position:   1000 + i,
+				}
+				if err := checkSpecKey(tx, categoryID, attribute.Key, 0); errors.Is(err, ErrSpecKeyTaken) {
+					report.Skipped = append(report.Skipped, field.column+": key is used by a subcategory")
+					continue
+				} else if err != nil {
+					return err
+				}
+				if err := tx.Create(&attribute).Error; err != nil {
+					return err
+				}
+				report.AttributesCreated = append(report.AttributesCreated, attribute.Key)
+			}
+
+			var rows []struct {
+				ID    uint
+				SKU   string `gorm:"column:sku"`
+				Value string
+			}
+			err := tx.Model(&models.Product{}).
+				Select("id, sku, "+field.column+" AS value").
+				Where("category_id IN ("+categorySubtreeSQL+")", categoryID).
+				Where(field.column + " <> ''").
+				Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			for _, row := range rows {
+				value, number, err := specValue(attribute, row.Value)
+				if err != nil {
+					report.Skipped = append(report.Skipped, row.SKU+" "+attribute.Key+": "+err.Error())
+					continue
+				}
+				spec := models.ProductSpec{ProductID: row.ID, AttributeID: attribute.ID, Value: value, Number: number}
+				result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&spec)
+				if result.Error != nil {
+					return result.Error
+				}
+				report.ValuesCopied += result.RowsAffected
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// normalizeSpecAttribute trims and validates an attribute, deriving its key
+// from the name when missing.
+func normalizeSpecAttribute(a *models.SpecAttribute) error {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Unit = strings.TrimSpace(a.Unit)
+	if a.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSpecAttribute)
+	}
+	key := a.Key
+	if key == "" {
+		key = a.Name
+	}
+	a.Key = utils.Slugify(key)
+	if len(a.Key) > maxSpecKeyLength {
+		a.Key = strings.TrimRight(a.Key[:maxSpecKeyLength], "-")
+	}
+	if a.Key == "" {
+		return fmt.Errorf("%w: key must contain letters or digits", ErrInvalidSpecAttribute)
+	}
+
+	if a.Type == "" {
+		a.Type = models.SpecTypeText
+	}
+	switch a.Type {
+	case models.SpecTypeText, models.SpecTypeNumber, models.SpecTypeBoolean:
+		a.Options = nil
+	case models.SpecTypeEnum:
+		seen := map[string]bool{}
+		var options []string
+		for _, option := range a.Options {
+			option = strings.TrimSpace(option)
+			if option != "" && !seen[strings.ToLower(option)] {
+				seen[strings.ToLower(option)] = true
+				options = append(options, option)
+			}
+		}
+		if len(options) == 0 {
+			return fmt.Errorf("%w: enum attributes need options", ErrInvalidSpecAttribute)
+		}
+		a.Options = options
+	default:
+		return fmt.Errorf("%w: type must be text, number, boolean or enum", ErrInvalidSpecAttribute)
+	}
+	return nil
+}
+
+// checkSpecKey returns ErrSpecKeyTaken when another attribute of the
+// category, its ancestors or its descendants uses key.
+func checkSpecKey(tx *gorm.DB, categoryID uint, key string, selfID uint) error {
+	var taken int64
+	err := tx.Model(&models.SpecAttribute{}).
+		Where("key = ? AND id <> ?", key, selfID).
+		Where("category_id IN (SELECT id FROM ("+categoryPathSQL+") AS path) OR category_id IN ("+categorySubtreeSQL+")",
+			categoryID, maxCategoryDepth, categoryID).
+		Count(&taken).Error
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrSpecKeyTaken
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInStock = errors.New("the product is in stock")
+
+type StockAlertRepository struct {
+	db *gorm.DB
+}
+
+func NewStockAlertRepository(db *gorm.DB) *StockAlertRepository {
+	return &StockAlertRepository{db: db}
+}
+
+// Subscribe asks for a notification when the alert's product, or variant,
+// visible under f, is back in stock. Subscribing again while waiting
+// returns the existing alert.
+func (r *StockAlertRepository) Subscribe(alert *models.StockAlert, f ProductFilter) error {
+	var product models.Product
+	if err := f.filtered(r.db.Model(&models.Product{}), facetNone).
+		Select("products.id", "products.stock").
+		First(&product, alert.ProductID).Error; err != nil {
+		return err
+	}
+	stock := product.Stock
+	if alert.VariantID != nil {
+		var variant models.ProductVariant
+		if err := r.db.Select("id", "product_id", "stock").First(&variant, *alert.VariantID).Error; err != nil {
+			return err
+		}
+		if variant.ProductID != alert.ProductID {
+			return ErrVariantMismatch
+		}
+		stock = variant.Stock
+	}
+	if stock > 0 {
+		return ErrInStock
+	}
+
+	query := r.db.Where("user_id = ? AND product_id = ? AND notified_at IS NULL", alert.UserID, alert.ProductID)
+	if alert.VariantID != nil {
+		query = query.Where("variant_id = ?", *alert.VariantID)
+	} else {
+		query = query.Where("variant_id IS NULL")
+	}
+	var existing models.StockAlert
+	result := query.Limit(1).Find(&existing)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		*alert = existing
+		return nil
+	}
+	return r.db.Omit(clause.Associations).Create(alert).Error
+}
+
+// ListByUser returns a user's alerts with their products, newest first.
+func (r *StockAlertRepository) ListByUser(userID uint) ([]models.StockAlert, error) {
+	alerts := []models.StockAlert{}
+	err := r.db.Preload("Product").Preload("Variant").
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Find(&alerts).Error
+	return alerts, err
+}
+
+// Delete removes one of a user's alerts.
+func (r *StockAlertRepository) Delete(id, userID uint) error {
+	result := r.db.Unscoped().Where("user_id = ?", userID).Delete(&models.StockAlert{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Restocked notifies the users waiting for a product, or its variants,
+// that have stock again, and returns how many were notified. Call it after
+// stock was added and handed to waiting back-orders; alerts for what is
+// still out of stock keep waiting.
+func (r *StockAlertRepository) Restocked(productID uint) (int, error) {
+	notified := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Select("id", "name", "stock").First(&product, productID).Error; err != nil {
+			return err
+		}
+		if product.Stock <= 0 {
+			return nil
+		}
+
+		var alerts []models.StockAlert
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Variant").
+			Where("product_id = ? AND notified_at IS NULL", productID).
+			Order("id").Find(&alerts).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, alert := range alerts {
+			title := product.Name + " is back in stock"
+			if alert.VariantID != nil {
+				if alert.Variant == nil || alert.Variant.Stock <= 0 || !alert.Variant.IsActive {
+					continue
+				}
+				title = fmt.Sprintf("%s (%s) is back in stock", product.Name, alert.Variant.SKU)
+			}
+
+			notification := models.Notification{
+				UserID: alert.UserID,
+				Type:   models.NotificationBackInStock,
+				Title:  title,
+				Link:   fmt.Sprintf("/products/%d", productID),
+			}
+			if err := tx.Create(&notification).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.StockAlert{}).Where("id = ?", alert.ID).Update("notified_at", now).Error; err != nil {
+				return err
+			}
+			notified++
+		}
+		return nil
+	})
+	return notified, err
+}
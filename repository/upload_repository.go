@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+)
+
+// UploadRef is a database row that links to uploaded files.
+type UploadRef struct {
+	Table string
+	ID    uint
+	URLs  []string // the file and any resized versions
+	// ReleasedAt is when the row, or the product it belongs to, was
+	// soft-deleted; nil while it is live.
+	ReleasedAt *time.Time
+}
+
+// UploadRepository finds the rows that link to uploaded files.
+type UploadRepository struct {
+	db *gorm.DB
+}
+
+func NewUploadRepository(db *gorm.DB) *UploadRepository {
+	return &UploadRepository{db: db}
+}
+
+// References calls fn for every product image, avatar, return photo and
+// review photo, including soft-deleted ones.
+func (r *UploadRepository) References(fn func(UploadRef) error) error {
+	if err := r.productImages(fn); err != nil {
+		return err
+	}
+	if err := r.reviewPhotos(fn); err != nil {
+		return err
+	}
+
+	rows, err := r.db.Unscoped().Model(&models.User{}).
+		Select("id, avatar, deleted_at").Where("avatar <> ''").Rows()
+	if err != nil {
+		return err
+	}
+	if err := scanRefs(rows, "users", fn); err != nil {
+		return err
+	}
+
+	rows, err = r.db.Unscoped().Model(&models.ReturnPhoto{}).
+		Select("id, url, deleted_at").Rows()
+	if err != nil {
+		return err
+	}
+	return scanRefs(rows, "return_photos", fn)
+}
+
+// productImages releases the images of soft-deleted products along with
+// soft-deleted images.
+func (r *UploadRepository) productImages(fn func(UploadRef) error) error {
+	rows, err := r.db.Unscoped().Table("product_images").
+		Select("product_images.id, product_images.url, product_images.renditions, " +
+			"product_images.deleted_at, products.deleted_at").
+		Joins("LEFT JOIN products ON products.id = product_images.product_id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	return scanImageRefs(rows, "product_images", fn)
+}
+
+// reviewPhotos releases the photos of soft-deleted reviews along with
+// soft-deleted photos.
+func (r *UploadRepository) reviewPhotos(fn func(UploadRef) error) error {
+	rows, err := r.db.Unscoped().Table("review_photos").
+		Select("review_photos.id, review_photos.url, review_photos.renditions, " +
+			"review_photos.deleted_at, reviews.deleted_at").
+		Joins("LEFT JOIN reviews ON reviews.id = review_photos.review_id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	return scanImageRefs(rows, "review_photos", fn)
+}
+
+// scanImageRefs reads (id, url, renditions, deleted_at, parent deleted_at)
+// rows.
+func scanImageRefs(rows *sql.Rows, table string, fn func(UploadRef) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			ref        = UploadRef{Table: table}
+			url        string
+			renditions sql.NullString
+			releasedAt sql.NullTime
+			parentAt   sql.NullTime
+		)
+		if err := rows.Scan(&ref.ID, &url, &renditions, &releasedAt, &parentAt); err != nil {
+			return err
+		}
+		ref.URLs = []string{url}
+		if renditions.Valid && renditions.String != "" {
+			var list []models.ImageRendition
+			if err := json.Unmarshal([]byte(renditions.String), &list); err == nil {
+				for _, rendition := range list {
+					ref.URLs = append(ref.URLs, rendition.URL)
+					if rendition.WebPURL != "" {
+						ref.URLs = append(ref.URLs, rendition.WebPURL)
+					}
+				}
+			}
+		}
+		if !releasedAt.Valid {
+			releasedAt = parentAt
+		}
+		if releasedAt.Valid {
+			ref.ReleasedAt = &releasedAt.Time
+		}
+		if err := fn(ref); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanRefs reads (id, url, deleted_at) rows.
+func scanRefs(rows *sql.Rows, table string, fn func(UploadRef) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			ref        = UploadRef{Table: table}
+			url        string
+			releasedAt sql.NullTime
+		)
+		if err := rows.Scan(&ref.ID, &url, &releasedAt); err != nil {
+			return err
+		}
+		ref.URLs = []string{url}
+		if releasedAt.Valid {
+			ref.ReleasedAt = &releasedAt.Time
+		}
+		if err := fn(ref); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
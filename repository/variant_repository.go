@@ -0,0 +1,514 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Errors returned by VariantRepository for changes that don't fit the
+// product's options and variants.
+var (
+	ErrInvalidOption   = errors.New("option needs a name and distinct, non-empty values")
+	ErrOptionInUse     = errors.New("variants use this option; delete them first")
+	ErrNoOptions       = errors.New("product has no options with values to combine")
+	ErrDuplicateSKU    = errors.New("SKU is already used by another variant")
+	ErrVariantStock    = errors.New("stock cannot be negative")
+	ErrTooManyVariants = errors.New("too many combinations to generate")
+)
+
+// maxGeneratedVariants bounds the combinations Generate creates at once.
+const maxGeneratedVariants = 1000
+
+type VariantRepository struct {
+	db *gorm.DB
+}
+
+func NewVariantRepository(db *gorm.DB) *VariantRepository {
+	return &VariantRepository{db: db}
+}
+
+// VariantMatrix is the options of a product with all its variants, enough
+// for a storefront to map every combination of choices to a variant.
+type VariantMatrix struct {
+	Options  []models.ProductOption  `json:"options"`
+	Variants []models.ProductVariant `json:"variants"`
+}
+
+// options loads a product's options with their values in display order.
+func options(db *gorm.DB, productID uint) ([]models.ProductOption, error) {
+	opts := []models.ProductOption{}
+	err := db.Preload("Values", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position, id")
+	}).Where("product_id = ?", productID).Order("position, id").Find(&opts).Error
+	return opts, err
+}
+
+// Matrix returns the product's options and variants. Variant prices are
+// resolved for groupIDs when priced; the per-group price list is only
+// included with withPrices (admins).
+func (r *VariantRepository) Matrix(productID uint, groupIDs []uint, priced, withPrices bool) (*VariantMatrix, error) {
+	opts, err := options(r.db, productID)
+	if err != nil {
+		return nil, err
+	}
+	variants := []models.ProductVariant{}
+	err = r.db.Preload("Values").
+		Preload("Images", func(db *gorm.DB) *gorm.DB {
+			return db.Order(`"order", id`)
+		}).
+		Preload("Prices").
+		Where("product_id = ?", productID).
+		Order("id").
+		Find(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range variants {
+		v := &variants[i]
+		if priced {
+			v.Price, err = r.price(v, groupIDs)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !withPrices {
+			v.Prices = nil
+		}
+	}
+	return &VariantMatrix{Options: opts, Variants: variants}, nil
+}
+
+// Price returns the variant's price for groupIDs: a group override, then a
+// default override, then the product's own price.
+func (r *VariantRepository) Price(variantID uint, groupIDs []uint) (float64, error) {
+	var variant models.ProductVariant
+	if err := r.db.Preload("Prices").First(&variant, variantID).Error; err != nil {
+		return 0, err
+	}
+	return r.price(&variant, groupIDs)
+}
+
+func (r *VariantRepository) price(v *models.ProductVariant, groupIDs []uint) (float64, error) {
+	inGroups := make(map[uint]bool, len(groupIDs))
+	for _, id := range groupIDs {
+		inGroups[id] = true
+	}
+	var fallback float64
+	for _, p := range v.Prices {
+		switch {
+		case p.GroupID != nil && inGroups[*p.GroupID] && p.Price > 0:
+			return p.Price, nil
+		case p.GroupID == nil && p.Price > 0:
+			fallback = p.Price
+		}
+	}
+	if fallback > 0 {
+		return fallback, nil
+	}
+
+	var price float64
+	expr, args := priceExpr(groupIDs)
+	err := r.db.Model(&models.Product{}).Select(expr, args...).Where("products.id = ?", v.ProductID).Scan(&price).Error
+	return price, err
+}
+
+// GetVariant returns a variant with its option values.
+func (r *VariantRepository) GetVariant(id uint) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := r.db.Preload("Values").Preload("Prices").First(&variant, id).Error
+	return &variant, err
+}
+
+// HasVariants reports whether the product has any variants.
+func (r *VariantRepository) HasVariants(productID uint) (bool, error) {
+	var n int64
+	err := r.db.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&n).Error
+	return n > 0, err
+}
+
+// CreateOption adds an option with its values to a product.
+func (r *VariantRepository) CreateOption(productID uint, option *models.ProductOption) error {
+	option.ID = 0
+	option.ProductID = productID
+	option.Name = strings.TrimSpace(option.Name)
+	if option.Name == "" || len(option.Values) == 0 {
+		return ErrInvalidOption
+	}
+	seen := map[string]bool{}
+	for i := range option.Values {
+		v := &option.Values[i]
+		v.ID = 0
+		v.Value = strings.TrimSpace(v.Value)
+		if v.Value == "" || seen[strings.ToLower(v.Value)] {
+			return ErrInvalidOption
+		}
+		seen[strings.ToLower(v.Value)] = true
+		if v.Position == 0 {
+			v.Position = i
+		}
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&models.Product{}, productID).Error; err != nil {
+			return err
+		}
+		// Existing variants would lack a value of the new option
+		var variants int64
+		if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&variants).Error; err != nil {
+			return err
+		}
+		if variants > 0 {
+			return ErrOptionInUse
+		}
+		return tx.Create(option).Error
+	})
+}
+
+// DeleteOption removes an option and its values. Options of a product
+// with variants cannot be deleted.
+func (r *VariantRepository) DeleteOption(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var option models.ProductOption
+		if err := tx.First(&option, id).Error; err != nil {
+			return err
+		}
+		var variants int64
+		if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", option.ProductID).Count(&variants).Error; err != nil {
+			return err
+		}
+		if variants > 0 {
+			return ErrOptionInUse
+		}
+		if err := tx.Unscoped().Where("option_id = ?", id).Delete(&models.ProductOptionValue{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&option).Error
+	})
+}
+
+// AddOptionValue adds a value to an option. Existing variants are kept;
+// Generate creates the new combinations.
+func (r *VariantRepository) AddOptionValue(optionID uint, value *models.ProductOptionValue) error {
+	value.ID = 0
+	value.OptionID = optionID
+	value.Value = strings.TrimSpace(value.Value)
+	if value.Value == "" {
+		return ErrInvalidOption
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&models.ProductOption{}, optionID).Error; err != nil {
+			return err
+		}
+		var taken int64
+		err := tx.Model(&models.ProductOptionValue{}).
+			Where("option_id = ? AND LOWER(value) = LOWER(?)", optionID, value.Value).
+			Count(&taken).Error
+		if err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrInvalidOption
+		}
+		return tx.Create(value).Error
+	})
+}
+
+// DeleteOptionValue removes a value no variant uses.
+func (r *VariantRepository) DeleteOptionValue(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var used int64
+		if err := tx.Table("product_variant_values").Where("product_option_value_id = ?", id).Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return ErrOptionInUse
+		}
+		result := tx.Unscoped().Delete(&models.ProductOptionValue{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// GenerateDefaults are applied to the variants Generate creates. IsActive
+// defaults to true.
+type GenerateDefaults struct {
+	Stock    int   `json:"stock"`
+	IsActive *bool `json:"is_active"`
+}
+
+// Generate creates a variant for every combination of the product's option
+// values that has none yet, and returns the created variants. SKUs are the
+// product SKU followed by the slugs of the values, e.g. "K100-red-large".
+func (r *VariantRepository) Generate(productID uint, defaults GenerateDefaults) ([]models.ProductVariant, error) {
+	if defaults.Stock < 0 {
+		return nil, ErrVariantStock
+	}
+	created := []models.ProductVariant{}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var product models.Product
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "sku").First(&product, productID).Error; err != nil {
+			return err
+		}
+		opts, err := options(tx, productID)
+		if err != nil {
+			return err
+		}
+		total := 1
+		for _, o := range opts {
+			total *= len(o.Values)
+			if total > maxGeneratedVariants {
+				return ErrTooManyVariants
+			}
+		}
+		if len(opts) == 0 || total == 0 {
+			return ErrNoOptions
+		}
+
+		var existing []string
+		if err := tx.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Pluck("signature", &existing).Error; err != nil {
+			return err
+		}
+		have := make(map[string]bool, len(existing))
+		for _, s := range existing {
+			have[s] = true
+		}
+
+		for _, combo := range combinations(opts) {
+			signature := variantSignature(combo)
+			if have[signature] {
+				continue
+			}
+			parts := []string{product.SKU}
+			for _, v := range combo {
+				if slug := utils.Slugify(v.Value); slug != "" {
+					parts = append(parts, slug)
+				} else {
+					parts = append(parts, strconv.FormatUint(uint64(v.ID), 10))
+				}
+			}
+			sku, err := freeVariantSKU(tx, strings.Join(parts, "-"))
+			if err != nil {
+				return err
+			}
+
+			variant := models.ProductVariant{
+				ProductID: productID,
+				Signature: signature,
+				SKU:       sku,
+				Stock:     defaults.Stock,
+				IsActive:  true,
+			}
+			if err := tx.Omit("Values").Create(&variant).Error; err != nil {
+				return err
+			}
+			// IsActive false is a zero value that Create leaves to the default
+			if defaults.IsActive != nil && !*defaults.IsActive {
+				if err := tx.Model(&variant).Update("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&variant).Association("Values").Append(combo); err != nil {
+				return err
+			}
+			variant.Values = combo
+			created = append(created, variant)
+		}
+		return syncProductStock(tx, productID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// combinations returns the cartesian product of the options' values.
+func combinations(opts []models.ProductOption) [][]models.ProductOptionValue {
+	combos := [][]models.ProductOptionValue{{}}
+	for _, o := range opts {
+		var next [][]models.ProductOptionValue
+		for _, combo := range combos {
+			for _, v := range o.Values {
+				c := make([]models.ProductOptionValue, len(combo), len(combo)+1)
+				copy(c, combo)
+				next = append(next, append(c, v))
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// variantSignature identifies a combination by its sorted value IDs.
+func variantSignature(values []models.ProductOptionValue) string {
+	ids := make([]int, len(values))
+	for i, v := range values {
+		ids[i] = int(v.ID)
+	}
+	sort.Ints(ids)
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, "-")
+}
+
+// freeVariantSKU appends -2, -3, ... to sku until no variant uses it.
+func freeVariantSKU(tx *gorm.DB, sku string) (string, error) {
+	var taken []string
+	err := tx.Model(&models.ProductVariant{}).Where("sku = ? OR sku LIKE ?", sku, likePrefix(sku+"-")).Pluck("sku", &taken).Error
+	if err != nil {
+		return "", err
+	}
+	used := make(map[string]bool, len(taken))
+	for _, s := range taken {
+		used[s] = true
+	}
+	candidate := sku
+	for n := 2; used[candidate]; n++ {
+		candidate = fmt.Sprintf("%s-%d", sku, n)
+	}
+	return candidate, nil
+}
+
+// VariantChanges are the editable fields of a variant. Nil fields are
+// left unchanged; Prices, when given, replace the variant's overrides.
+type VariantChanges struct {
+	SKU      *string `json:"sku"`
+	Barcode  *string `json:"barcode"`
+	Stock    *int    `json:"stock"`
+	IsActive *bool   `json:"is_active"`
+	Prices   *[]struct {
+		GroupID *uint   `json:"group_id"`
+		Price   float64 `json:"price"`
+	} `json:"prices"`
+}
+
+// UpdateVariant applies changes to a variant and keeps the product's stock
+// in step with its variants.
+func (r *VariantRepository) UpdateVariant(id uint, changes VariantChanges) (*models.ProductVariant, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var variant models.ProductVariant
+		if err := tx.First(&variant, id).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{}
+		if changes.SKU != nil {
+			sku := strings.TrimSpace(*changes.SKU)
+			var taken int64
+			if err := tx.Model(&models.ProductVariant{}).Where("sku = ? AND id <> ?", sku, id).Count(&taken).Error; err != nil {
+				return err
+			}
+			if sku == "" || taken > 0 {
+				return ErrDuplicateSKU
+			}
+			updates["sku"] = sku
+		}
+		if changes.Barcode != nil {
+			updates["barcode"] = strings.TrimSpace(*changes.Barcode)
+		}
+		if changes.Stock != nil {
+			if *changes.Stock < 0 {
+				return ErrVariantStock
+			}
+			updates["stock"] = *changes.Stock
+		}
+		if changes.IsActive != nil {
+			updates["is_active"] = *changes.IsActive
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&variant).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+
+		if changes.Prices != nil {
+			if err := tx.Unscoped().Where("variant_id = ?", id).Delete(&models.VariantPrice{}).Error; err != nil {
+				return err
+			}
+			for _, p := range *changes.Prices {
+				price := models.VariantPrice{VariantID: id, GroupID: p.GroupID, Price: p.Price}
+				if err := tx.Create(&price).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return syncProductStock(tx, variant.ProductID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.GetVariant(id)
+}
+
+// DeleteVariant removes a variant. Its images stay with the product.
+func (r *VariantRepository) DeleteVariant(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var variant models.ProductVariant
+		if err := tx.First(&variant, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&variant).Association("Values").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("variant_id = ?", id).Delete(&models.VariantPrice{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ProductImage{}).Where("variant_id = ?", id).Update("variant_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&variant).Error; err != nil {
+			return err
+		}
+		return syncProductStock(tx, variant.ProductID)
+	})
+}
+
+// AddStock adds quantity units (negative to take them) to a variant and
+// returns its product's ID.
+func (r *VariantRepository) AddStock(variantID uint, quantity int) (uint, error) {
+	var productID uint
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		productID, err = adjustVariantStock(tx, variantID, quantity)
+		return err
+	})
+	return productID, err
+}
+
+// adjustVariantStock changes a variant's stock by delta and recomputes its
+// product's stock.
+func adjustVariantStock(tx *gorm.DB, variantID uint, delta int) (uint, error) {
+	var variant models.ProductVariant
+	if err := tx.Select("id", "product_id").First(&variant, variantID).Error; err != nil {
+		return 0, err
+	}
+	err := tx.Model(&models.ProductVariant{}).Where("id = ?", variantID).
+		Update("stock", gorm.Expr("stock + ?", delta)).Error
+	if err != nil {
+		return 0, err
+	}
+	return variant.ProductID, syncProductStock(tx, variant.ProductID)
+}
+
+// syncProductStock sets the stock of a product with variants to the sum of
+// their stock. Products without variants are left alone.
+func syncProductStock(tx *gorm.DB, productID uint) error {
+	return tx.Exec(`UPDATE products SET stock = (
+		SELECT COALESCE(SUM(GREATEST(stock, 0)), 0) FROM product_variants WHERE product_id = ? AND deleted_at IS NULL
+	) WHERE id = ? AND EXISTS (SELECT 1 FROM product_variants WHERE product_id = ? AND deleted_at IS NULL)`,
+		productID, productID, productID).Error
+}
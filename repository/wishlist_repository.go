@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aminasadiam/Kasra/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWishlistItemExists = errors.New("the product is already in this wishlist")
+	ErrVariantMismatch    = errors.New("the variant does not belong to the product")
+)
+
+type WishlistRepository struct {
+	db *gorm.DB
+}
+
+func NewWishlistRepository(db *gorm.DB) *WishlistRepository {
+	return &WishlistRepository{db: db}
+}
+
+// WishlistEntry is a saved product as shown in a wishlist.
+type WishlistEntry struct {
+	ProductListItem
+	ItemID         uint      `json:"item_id"`
+	VariantID      *uint     `json:"variant_id,omitempty"`
+	VariantSKU     string    `json:"variant_sku,omitempty"`
+	VariantInStock *bool     `json:"variant_in_stock,omitempty"`
+	AddedAt        time.Time `json:"added_at"`
+}
+
+func (r *WishlistRepository) Create(wishlist *models.Wishlist) error {
+	return r.db.Omit("User", "Items").Create(wishlist).Error
+}
+
+func (r *WishlistRepository) GetByID(id uint) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	if err := r.db.First(&wishlist, id).Error; err != nil {
+		return nil, err
+	}
+	return &wishlist, nil
+}
+
+// GetByToken returns the wishlist shared under token.
+func (r *WishlistRepository) GetByToken(token string) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	if err := r.db.Where("share_token = ?", token).First(&wishlist).Error; err != nil {
+		return nil, err
+	}
+	return &wishlist, nil
+}
+
+// ListByUser returns a user's wishlists with their item counts, oldest
+// first.
+func (r *WishlistRepository) ListByUser(userID uint) ([]models.Wishlist, error) {
+	wishlists := []models.Wishlist{}
+	err := r.db.Model(&models.Wishlist{}).
+		Select(`wishlists.*, (SELECT COUNT(*) FROM wishlist_items
+			WHERE wishlist_items.wishlist_id = wishlists.id AND wishlist_items.deleted_at IS NULL) AS item_count`).
+		Where("user_id = ?", userID).
+		Order("created_at, id").
+		Find(&wishlists).Error
+	return wishlists, err
+}
+
+// Rename changes a wishlist's name.
+func (r *WishlistRepository) Rename(wishlist *models.Wishlist) error {
+	return r.db.Model(wishlist).Update("name", wishlist.Name).Error
+}
+
+// Delete removes a wishlist and its items for good.
+func (r *WishlistRepository) Delete(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("wishlist_id = ?", id).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Wishlist{}, id).Error
+	})
+}
+
+// Share gives a wishlist a new share token, so links shared before stop
+// working.
+func (r *WishlistRepository) Share(wishlist *models.Wishlist) error {
+	data := make([]byte, 16)
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(data)
+	if err := r.db.Model(wishlist).Update("share_token", token).Error; err != nil {
+		return err
+	}
+	wishlist.ShareToken = &token
+	return nil
+}
+
+// Unshare removes a wishlist's share token.
+func (r *WishlistRepository) Unshare(wishlist *models.Wishlist) error {
+	if err := r.db.Model(wishlist).Update("share_token", nil).Error; err != nil {
+		return err
+	}
+	wishlist.ShareToken = nil
+	return nil
+}
+
+// AddItem saves a product visible under f, optionally one of its variants,
+// in a wishlist.
+func (r *WishlistRepository) AddItem(item *models.WishlistItem, f ProductFilter) error {
+	var count int64
+	if err := f.filtered(r.db.Model(&models.Product{}), facetNone).
+		Where("products.id = ?", item.ProductID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if item.VariantID != nil {
+		var variant models.ProductVariant
+		if err := r.db.Select("id", "product_id").First(&variant, *item.VariantID).Error; err != nil {
+			return err
+		}
+		if variant.ProductID != item.ProductID {
+			return ErrVariantMismatch
+		}
+	}
+
+	query := r.db.Model(&models.WishlistItem{}).
+		Where("wishlist_id = ? AND product_id = ?", item.WishlistID, item.ProductID)
+	if item.VariantID != nil {
+		query = query.Where("variant_id = ?", *item.VariantID)
+	} else {
+		query = query.Where("variant_id IS NULL")
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrWishlistItemExists
+	}
+	return r.db.Omit("Product", "Variant").Create(item).Error
+}
+
+// RemoveItem deletes an item from a wishlist.
+func (r *WishlistRepository) RemoveItem(wishlistID, itemID uint) error {
+	result := r.db.Unscoped().Where("wishlist_id = ?", wishlistID).Delete(&models.WishlistItem{}, itemID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Items returns the items of a wishlist whose products are visible under f,
+// most recently added first.
+func (r *WishlistRepository) Items(wishlistID uint, f ProductFilter, withStock bool) ([]WishlistEntry, error) {
+	columns, args := listColumns(f, withStock)
+	columns = append(columns, "wishlist_items.id AS item_id", "wishlist_items.variant_id",
+		"wishlist_items.created_at AS added_at", "product_variants.sku AS variant_sku",
+		"CASE WHEN product_variants.id IS NULL THEN NULL ELSE product_variants.stock > 0 END AS variant_in_stock")
+
+	entries := []WishlistEntry{}
+	err := listJoins(f.filtered(r.db.Model(&models.Product{}), facetNone)).
+		Joins("JOIN wishlist_items ON wishlist_items.product_id = products.id AND wishlist_items.deleted_at IS NULL").
+		Joins("LEFT JOIN product_variants ON product_variants.id = wishlist_items.variant_id AND product_variants.deleted_at IS NULL").
+		Where("wishlist_items.wishlist_id = ?", wishlistID).
+		Select(strings.Join(columns, ", "), args...).
+		Order("wishlist_items.created_at DESC, wishlist_items.id DESC").
+		Scan(&entries).Error
+	return entries, err
+}
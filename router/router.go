@@ -1,15 +1,18 @@
 package router
 
 import (
+	"context"
 	"log"
 	"net/http"
-	"path/filepath"
-	"strings"
 
 	"github.com/aminasadiam/Kasra/config"
 	"github.com/aminasadiam/Kasra/database"
 	"github.com/aminasadiam/Kasra/handler"
 	"github.com/aminasadiam/Kasra/middleware"
+	"github.com/aminasadiam/Kasra/models"
+	"github.com/aminasadiam/Kasra/publishing"
+	"github.com/aminasadiam/Kasra/storage"
+	"github.com/aminasadiam/Kasra/uploadgc"
 )
 
 func Serve(cfg *config.Configuration) error {
@@ -19,17 +22,52 @@ func Serve(cfg *config.Configuration) error {
 		return err
 	}
 
+	store, err := storage.New(cfg)
+	if err != nil {
+		return err
+	}
+
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(db, cfg)
-	userHandler := handler.NewUserHandler(db)
-	productHandler := handler.NewProductHandler(db)
+	userHandler := handler.NewUserHandler(db, store)
+	productHandler := handler.NewProductHandler(db, store)
 	categoryHandler := handler.NewCategoryHandler(db)
-	orderHandler := handler.NewOrderHandler(db)
+	specHandler := handler.NewSpecHandler(db)
+	variantHandler := handler.NewVariantHandler(db)
+	catalogHandler := handler.NewCatalogHandler(db)
+	orderHandler := handler.NewOrderHandler(db, cfg)
 	walletHandler := handler.NewWalletHandler(db)
 	roleHandler := handler.NewRoleHandler(db)
 	permissionHandler := handler.NewPermissionHandler(db)
 	groupHandler := handler.NewGroupHandler(db)
 	brandHandler := handler.NewBrandHandler(db)
+	backorderHandler := handler.NewBackorderHandler(db)
+	returnHandler := handler.NewReturnHandler(db, store, cfg)
+	shipmentHandler := handler.NewShipmentHandler(db)
+	reviewHandler := handler.NewReviewHandler(db, store)
+	questionHandler := handler.NewQuestionHandler(db)
+	notificationHandler := handler.NewNotificationHandler(db)
+	relationHandler := handler.NewRelationHandler(db)
+	wishlistHandler := handler.NewWishlistHandler(db)
+	stockAlertHandler := handler.NewStockAlertHandler(db)
+	revisionHandler := handler.NewRevisionHandler(db, cfg)
+	publishingHandler := handler.NewPublishingHandler(db)
+
+	// Imports left running by a previous run will not resume
+	if err := catalogHandler.FailInterrupted(); err != nil {
+		log.Printf("failed to close interrupted import jobs: %v", err)
+	}
+
+	// Uploads no row links to any more
+	if cfg.UploadGCInterval > 0 {
+		collector := uploadgc.NewCollector(db, store)
+		go collector.Schedule(context.Background(), cfg.UploadGCInterval, cfg.UploadGCGrace, cfg.UploadGCDelete)
+	}
+
+	// Scheduled product publishing
+	if cfg.PublishInterval > 0 {
+		go publishing.NewScheduler(db).Schedule(context.Background(), cfg.PublishInterval)
+	}
 
 	mux := http.NewServeMux()
 
@@ -49,7 +87,9 @@ func Serve(cfg *config.Configuration) error {
 	// Middleware
 	// --------------------
 	authMiddleware := middleware.AuthMiddleware(cfg)
+	optionalAuthMiddleware := middleware.OptionalAuthMiddleware(cfg)
 	adminMiddleware := middleware.AdminMiddleware(db)
+	publisherMiddleware := middleware.PermissionMiddleware(db, models.PermissionPublishProducts)
 
 	// --------------------
 	// Auth routes
@@ -75,8 +115,13 @@ func Serve(cfg *config.Configuration) error {
 	// --------------------
 	// Product routes (public for get, authenticated admin for create/update/delete)
 	// --------------------
-	mux.Handle("GET /api/products", http.HandlerFunc(productHandler.GetAll))
-	mux.Handle("GET /api/products/{id}", http.HandlerFunc(productHandler.GetByID))
+	mux.Handle("GET /api/products", optionalAuthMiddleware(http.HandlerFunc(productHandler.GetAll)))
+	mux.Handle("GET /api/products/suggest", optionalAuthMiddleware(http.HandlerFunc(productHandler.Suggest)))
+	mux.Handle("GET /api/products/compatible", optionalAuthMiddleware(http.HandlerFunc(productHandler.Compatible)))
+	mux.Handle("GET /api/products/compare", optionalAuthMiddleware(http.HandlerFunc(productHandler.Compare)))
+	mux.Handle("GET /api/products/{id}", optionalAuthMiddleware(http.HandlerFunc(productHandler.GetByID)))
+	mux.Handle("GET /api/products/{id}/variants", optionalAuthMiddleware(http.HandlerFunc(productHandler.Variants)))
+	mux.Handle("GET /api/products/{id}/relations", optionalAuthMiddleware(http.HandlerFunc(productHandler.Relations)))
 	mux.Handle("POST /api/products", authMiddleware(adminMiddleware(http.HandlerFunc(productHandler.Create))))
 	mux.Handle("PUT /api/products/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(productHandler.Update))))
 	mux.Handle("DELETE /api/products/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(productHandler.Delete))))
@@ -84,6 +129,29 @@ func Serve(cfg *config.Configuration) error {
 	mux.Handle("POST /api/products/{id}/images", authMiddleware(adminMiddleware(http.HandlerFunc(productHandler.UploadImage))))
 	mux.Handle("DELETE /api/products/{id}/images/{imageId}", authMiddleware(adminMiddleware(http.HandlerFunc(productHandler.DeleteImage))))
 	mux.Handle("POST /api/products/{id}/prices", authMiddleware(adminMiddleware(http.HandlerFunc(productHandler.AddPrice))))
+	mux.Handle("POST /api/products/{id}/stock", authMiddleware(adminMiddleware(http.HandlerFunc(productHandler.ReceiveStock))))
+
+	// Product change history
+	mux.Handle("GET /api/products/{id}/revisions", authMiddleware(adminMiddleware(http.HandlerFunc(revisionHandler.List))))
+	mux.Handle("GET /api/products/{id}/revisions/{revisionId}", authMiddleware(adminMiddleware(http.HandlerFunc(revisionHandler.Get))))
+	mux.Handle("POST /api/products/{id}/revisions/{revisionId}/revert", authMiddleware(adminMiddleware(http.HandlerFunc(revisionHandler.Revert))))
+
+	// Publishing workflow: admins write and submit, publishers decide
+	mux.Handle("POST /api/products/{id}/submit", authMiddleware(adminMiddleware(http.HandlerFunc(publishingHandler.Submit))))
+	mux.Handle("POST /api/products/{id}/unarchive", authMiddleware(adminMiddleware(http.HandlerFunc(publishingHandler.Unarchive))))
+	mux.Handle("POST /api/products/{id}/publish", authMiddleware(publisherMiddleware(http.HandlerFunc(publishingHandler.Publish))))
+	mux.Handle("POST /api/products/{id}/reject", authMiddleware(publisherMiddleware(http.HandlerFunc(publishingHandler.Reject))))
+	mux.Handle("POST /api/products/{id}/archive", authMiddleware(publisherMiddleware(http.HandlerFunc(publishingHandler.Archive))))
+	mux.Handle("PUT /api/products/{id}/schedule", authMiddleware(publisherMiddleware(http.HandlerFunc(publishingHandler.Schedule))))
+
+	// Product options and variants
+	mux.Handle("POST /api/admin/products/{id}/options", authMiddleware(adminMiddleware(http.HandlerFunc(variantHandler.CreateOption))))
+	mux.Handle("DELETE /api/admin/options/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(variantHandler.DeleteOption))))
+	mux.Handle("POST /api/admin/options/{id}/values", authMiddleware(adminMiddleware(http.HandlerFunc(variantHandler.AddOptionValue))))
+	mux.Handle("DELETE /api/admin/option-values/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(variantHandler.DeleteOptionValue))))
+	mux.Handle("POST /api/admin/products/{id}/variants/generate", authMiddleware(adminMiddleware(http.HandlerFunc(variantHandler.Generate))))
+	mux.Handle("PUT /api/admin/variants/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(variantHandler.UpdateVariant))))
+	mux.Handle("DELETE /api/admin/variants/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(variantHandler.DeleteVariant))))
 
 	// --------------------
 	// Category routes
@@ -91,10 +159,33 @@ func Serve(cfg *config.Configuration) error {
 	mux.Handle("GET /api/admin/categories", http.HandlerFunc(categoryHandler.GetAll))
 	mux.Handle("GET /api/admin/categories/{id}", authMiddleware(http.HandlerFunc(categoryHandler.GetByID)))
 	mux.Handle("GET /api/admin/categories/slug/{slug}", authMiddleware(http.HandlerFunc(categoryHandler.GetBySlug)))
+	mux.Handle("GET /api/categories/tree", http.HandlerFunc(categoryHandler.Tree))
+	mux.Handle("GET /api/categories/{id}/tree", http.HandlerFunc(categoryHandler.Subtree))
+	mux.Handle("GET /api/categories/{id}/breadcrumbs", http.HandlerFunc(categoryHandler.Breadcrumbs))
+	mux.Handle("POST /api/admin/categories/{id}/move", authMiddleware(adminMiddleware(http.HandlerFunc(categoryHandler.Move))))
 	mux.Handle("POST /api/admin/categories", authMiddleware(adminMiddleware(http.HandlerFunc(categoryHandler.Create))))
 	mux.Handle("PUT /api/admin/categories/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(categoryHandler.Update))))
 	mux.Handle("DELETE /api/admin/categories/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(categoryHandler.Delete))))
 
+	// Category spec schemas and product spec values
+	mux.Handle("GET /api/categories/{id}/specs", http.HandlerFunc(specHandler.Schema))
+	mux.Handle("POST /api/admin/categories/{id}/specs", authMiddleware(adminMiddleware(http.HandlerFunc(specHandler.CreateAttribute))))
+	mux.Handle("POST /api/admin/categories/{id}/specs/migrate-legacy", authMiddleware(adminMiddleware(http.HandlerFunc(specHandler.MigrateLegacy))))
+	mux.Handle("PUT /api/admin/specs/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(specHandler.UpdateAttribute))))
+	mux.Handle("DELETE /api/admin/specs/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(specHandler.DeleteAttribute))))
+	mux.Handle("PUT /api/products/{id}/specs", authMiddleware(adminMiddleware(http.HandlerFunc(specHandler.SetProductSpecs))))
+
+	// Bulk import and export
+	mux.Handle("POST /api/admin/products/import", authMiddleware(adminMiddleware(http.HandlerFunc(catalogHandler.Import))))
+	mux.Handle("GET /api/admin/products/imports", authMiddleware(adminMiddleware(http.HandlerFunc(catalogHandler.ListImports))))
+	mux.Handle("GET /api/admin/products/imports/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(catalogHandler.GetImport))))
+	mux.Handle("GET /api/admin/products/export", authMiddleware(adminMiddleware(http.HandlerFunc(catalogHandler.Export))))
+
+	// Related products, accessories and spare parts
+	mux.Handle("POST /api/admin/products/{id}/relations", authMiddleware(adminMiddleware(http.HandlerFunc(relationHandler.Create))))
+	mux.Handle("PUT /api/admin/relations/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(relationHandler.Update))))
+	mux.Handle("DELETE /api/admin/relations/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(relationHandler.Delete))))
+
 	// --------------------
 	// Brand routes (public for get, authenticated admin for create/update/delete)
 	// --------------------
@@ -110,9 +201,102 @@ func Serve(cfg *config.Configuration) error {
 	mux.Handle("GET /api/orders", authMiddleware(http.HandlerFunc(orderHandler.GetAllForUser)))
 	mux.Handle("GET /api/orders/{id}", authMiddleware(http.HandlerFunc(orderHandler.GetByID)))
 	mux.Handle("POST /api/orders", authMiddleware(http.HandlerFunc(orderHandler.Create)))
+	mux.Handle("GET /api/orders/{id}/invoice.pdf", authMiddleware(http.HandlerFunc(orderHandler.Invoice)))
+	mux.Handle("POST /api/orders/{id}/reorder", authMiddleware(http.HandlerFunc(orderHandler.Reorder)))
+	mux.Handle("POST /api/orders/{id}/checkout", authMiddleware(http.HandlerFunc(orderHandler.Checkout)))
 	mux.Handle("PUT /api/orders/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(orderHandler.Update))))
 	mux.Handle("DELETE /api/orders/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(orderHandler.Delete))))
 
+	mux.Handle("GET /api/admin/orders", authMiddleware(adminMiddleware(http.HandlerFunc(orderHandler.GetAll))))
+	mux.Handle("GET /api/admin/orders/export", authMiddleware(adminMiddleware(http.HandlerFunc(orderHandler.Export))))
+	mux.Handle("GET /api/admin/backorders", authMiddleware(adminMiddleware(http.HandlerFunc(backorderHandler.GetAll))))
+	mux.Handle("POST /api/admin/products/{id}/allocate-backorders", authMiddleware(adminMiddleware(http.HandlerFunc(backorderHandler.Allocate))))
+	mux.Handle("GET /api/admin/orders/{id}/packing-slip.pdf", authMiddleware(adminMiddleware(http.HandlerFunc(orderHandler.PackingSlip))))
+
+	// --------------------
+	// Shipment routes
+	// --------------------
+	mux.Handle("GET /api/orders/{id}/shipments", authMiddleware(http.HandlerFunc(shipmentHandler.GetByOrder)))
+	mux.Handle("POST /api/admin/orders/{id}/shipments", authMiddleware(adminMiddleware(http.HandlerFunc(shipmentHandler.Create))))
+	mux.Handle("PUT /api/admin/shipments/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(shipmentHandler.Update))))
+	mux.Handle("POST /api/admin/shipments/{id}/deliver", authMiddleware(adminMiddleware(http.HandlerFunc(shipmentHandler.Deliver))))
+	mux.Handle("DELETE /api/admin/shipments/{id}", authMiddleware(adminMiddleware(http.HandlerFunc(shipmentHandler.Delete))))
+
+	// --------------------
+	// Return (RMA) routes
+	// --------------------
+	mux.Handle("POST /api/orders/{id}/returns", authMiddleware(http.HandlerFunc(returnHandler.Create)))
+	mux.Handle("GET /api/returns", authMiddleware(http.HandlerFunc(returnHandler.GetAllForUser)))
+	mux.Handle("GET /api/returns/{id}", authMiddleware(http.HandlerFunc(returnHandler.GetByID)))
+	mux.Handle("POST /api/returns/{id}/cancel", authMiddleware(http.HandlerFunc(returnHandler.Cancel)))
+	mux.Handle("POST /api/returns/{id}/photos", authMiddleware(http.HandlerFunc(returnHandler.UploadPhoto)))
+
+	mux.Handle("GET /api/admin/returns", authMiddleware(adminMiddleware(http.HandlerFunc(returnHandler.GetAll))))
+	mux.Handle("POST /api/admin/returns/{id}/approve", authMiddleware(adminMiddleware(http.HandlerFunc(returnHandler.Approve))))
+	mux.Handle("POST /api/admin/returns/{id}/reject", authMiddleware(adminMiddleware(http.HandlerFunc(returnHandler.Reject))))
+	mux.Handle("POST /api/admin/returns/{id}/receive", authMiddleware(adminMiddleware(http.HandlerFunc(returnHandler.Receive))))
+
+	// --------------------
+	// Review routes
+	// --------------------
+	mux.Handle("GET /api/products/{id}/reviews", optionalAuthMiddleware(http.HandlerFunc(reviewHandler.List)))
+	mux.Handle("POST /api/products/{id}/reviews", authMiddleware(http.HandlerFunc(reviewHandler.Create)))
+	mux.Handle("GET /api/reviews", authMiddleware(http.HandlerFunc(reviewHandler.Mine)))
+	mux.Handle("PUT /api/reviews/{id}", authMiddleware(http.HandlerFunc(reviewHandler.Update)))
+	mux.Handle("DELETE /api/reviews/{id}", authMiddleware(http.HandlerFunc(reviewHandler.Delete)))
+	mux.Handle("POST /api/reviews/{id}/photos", authMiddleware(http.HandlerFunc(reviewHandler.UploadPhoto)))
+	mux.Handle("PUT /api/reviews/{id}/vote", authMiddleware(http.HandlerFunc(reviewHandler.Vote)))
+	mux.Handle("DELETE /api/reviews/{id}/vote", authMiddleware(http.HandlerFunc(reviewHandler.Unvote)))
+
+	mux.Handle("GET /api/admin/reviews", authMiddleware(adminMiddleware(http.HandlerFunc(reviewHandler.GetAll))))
+	mux.Handle("POST /api/admin/reviews/{id}/approve", authMiddleware(adminMiddleware(http.HandlerFunc(reviewHandler.Approve))))
+	mux.Handle("POST /api/admin/reviews/{id}/reject", authMiddleware(adminMiddleware(http.HandlerFunc(reviewHandler.Reject))))
+
+	// --------------------
+	// Product Q&A routes
+	// --------------------
+	mux.Handle("GET /api/products/{id}/questions", http.HandlerFunc(questionHandler.List))
+	mux.Handle("POST /api/products/{id}/questions", authMiddleware(http.HandlerFunc(questionHandler.Create)))
+	mux.Handle("GET /api/questions", authMiddleware(http.HandlerFunc(questionHandler.Mine)))
+	mux.Handle("DELETE /api/questions/{id}", authMiddleware(http.HandlerFunc(questionHandler.Delete)))
+	mux.Handle("POST /api/questions/{id}/answers", authMiddleware(http.HandlerFunc(questionHandler.Answer)))
+	mux.Handle("DELETE /api/answers/{id}", authMiddleware(http.HandlerFunc(questionHandler.DeleteAnswer)))
+
+	mux.Handle("GET /api/admin/questions", authMiddleware(adminMiddleware(http.HandlerFunc(questionHandler.GetAll))))
+	mux.Handle("POST /api/admin/questions/{id}/approve", authMiddleware(adminMiddleware(http.HandlerFunc(questionHandler.Approve))))
+	mux.Handle("POST /api/admin/questions/{id}/reject", authMiddleware(adminMiddleware(http.HandlerFunc(questionHandler.Reject))))
+	mux.Handle("GET /api/admin/answers", authMiddleware(adminMiddleware(http.HandlerFunc(questionHandler.GetAllAnswers))))
+	mux.Handle("POST /api/admin/answers/{id}/approve", authMiddleware(adminMiddleware(http.HandlerFunc(questionHandler.ApproveAnswer))))
+	mux.Handle("POST /api/admin/answers/{id}/reject", authMiddleware(adminMiddleware(http.HandlerFunc(questionHandler.RejectAnswer))))
+
+	// --------------------
+	// Notification routes
+	// --------------------
+	mux.Handle("GET /api/notifications", authMiddleware(http.HandlerFunc(notificationHandler.List)))
+	mux.Handle("POST /api/notifications/{id}/read", authMiddleware(http.HandlerFunc(notificationHandler.MarkRead)))
+	mux.Handle("POST /api/notifications/read-all", authMiddleware(http.HandlerFunc(notificationHandler.MarkAllRead)))
+
+	// --------------------
+	// Wishlist routes
+	// --------------------
+	mux.Handle("GET /api/wishlists", authMiddleware(http.HandlerFunc(wishlistHandler.List)))
+	mux.Handle("POST /api/wishlists", authMiddleware(http.HandlerFunc(wishlistHandler.Create)))
+	mux.Handle("GET /api/wishlists/{id}", authMiddleware(http.HandlerFunc(wishlistHandler.Get)))
+	mux.Handle("PUT /api/wishlists/{id}", authMiddleware(http.HandlerFunc(wishlistHandler.Update)))
+	mux.Handle("DELETE /api/wishlists/{id}", authMiddleware(http.HandlerFunc(wishlistHandler.Delete)))
+	mux.Handle("POST /api/wishlists/{id}/items", authMiddleware(http.HandlerFunc(wishlistHandler.AddItem)))
+	mux.Handle("DELETE /api/wishlists/{id}/items/{itemId}", authMiddleware(http.HandlerFunc(wishlistHandler.RemoveItem)))
+	mux.Handle("POST /api/wishlists/{id}/share", authMiddleware(http.HandlerFunc(wishlistHandler.Share)))
+	mux.Handle("DELETE /api/wishlists/{id}/share", authMiddleware(http.HandlerFunc(wishlistHandler.Unshare)))
+	mux.Handle("GET /api/wishlists/shared/{token}", optionalAuthMiddleware(http.HandlerFunc(wishlistHandler.Shared)))
+
+	// --------------------
+	// Stock alert routes
+	// --------------------
+	mux.Handle("POST /api/products/{id}/notify-me", authMiddleware(http.HandlerFunc(stockAlertHandler.Subscribe)))
+	mux.Handle("GET /api/stock-alerts", authMiddleware(http.HandlerFunc(stockAlertHandler.List)))
+	mux.Handle("DELETE /api/stock-alerts/{id}", authMiddleware(http.HandlerFunc(stockAlertHandler.Delete)))
+
 	// --------------------
 	// Wallet routes
 	// --------------------
@@ -158,66 +342,16 @@ func Serve(cfg *config.Configuration) error {
 	mux.Handle("DELETE /api/admin/groups/{id}/users/{userId}", authMiddleware(adminMiddleware(http.HandlerFunc(groupHandler.RemoveUser))))
 
 	// --------------------
-	// Avatar static assets (BEST PRACTICE)
-	// --------------------
-	avatarFS := http.FileServer(http.Dir("./uploads/avatars"))
-
-	mux.Handle("GET /api/assets/avatar/",
-		http.StripPrefix("/api/assets/avatar/",
-			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				// Add CORS headers
-				w.Header().Set("Access-Control-Allow-Origin", "*")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-				// Handle OPTIONS requests
-				if r.Method == "OPTIONS" {
-					w.WriteHeader(http.StatusOK)
-					return
-				}
-
-				ext := strings.ToLower(filepath.Ext(r.URL.Path))
-				switch ext {
-				case ".png", ".jpg", ".jpeg", ".webp":
-					w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-					avatarFS.ServeHTTP(w, r)
-				default:
-					http.NotFound(w, r)
-				}
-			}),
-		),
-	)
-
+	// Static assets (uploaded files)
 	// --------------------
-	// Product images static assets
-	// --------------------
-	productImagesFS := http.FileServer(http.Dir("./uploads/products"))
-
-	mux.Handle("GET /api/assets/products/",
-		http.StripPrefix("/api/assets/products/",
-			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				// Add CORS headers
-				w.Header().Set("Access-Control-Allow-Origin", "*")
-				w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-				w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-				// Handle OPTIONS requests
-				if r.Method == "OPTIONS" {
-					w.WriteHeader(http.StatusOK)
-					return
-				}
-
-				ext := strings.ToLower(filepath.Ext(r.URL.Path))
-				switch ext {
-				case ".png", ".jpg", ".jpeg", ".webp", ".gif", ".avif":
-					w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-					productImagesFS.ServeHTTP(w, r)
-				default:
-					http.NotFound(w, r)
-				}
-			}),
-		),
-	)
+	var private []string
+	if cfg.SignedURLs {
+		private = append(private, handler.ReturnPhotosDir)
+	}
+	assets := storage.NewServer(store, private...)
+	mux.Handle("GET /api/assets/{key...}", assets.Handler(""))
+	// Avatars uploaded before storage keys matched their directory
+	mux.Handle("GET /api/assets/avatar/{key...}", assets.Handler("avatars/"))
 
 	// --------------------
 	// Global middleware
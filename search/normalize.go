@@ -0,0 +1,91 @@
+// Package search prepares Persian and Latin text for PostgreSQL full-text
+// search. PostgreSQL ships no Persian dictionary, so text is indexed with the
+// "simple" configuration after folding the spelling variants that would
+// otherwise keep equal words apart: Arabic yeh/kaf, Persian and Arabic-Indic
+// digits, diacritics, tatweel and zero-width non-joiners.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+const zwnj = '\u200c' // zero-width non-joiner
+
+// fold maps a rune to its canonical form. It returns -1 for runes that are
+// dropped. Zero-width non-joiners are kept; callers decide how to split them.
+func fold(r rune) rune {
+	switch {
+	case r == 'ي' || r == 'ى' || r == 'ئ':
+		return 'ی'
+	case r == 'ك':
+		return 'ک'
+	case r == 'ة' || r == 'ۀ' || r == 'ە':
+		return 'ه'
+	case r == 'أ' || r == 'إ' || r == 'ٱ' || r == 'آ':
+		return 'ا'
+	case r == 'ؤ':
+		return 'و'
+	case r >= '۰' && r <= '۹':
+		return '0' + (r - '۰')
+	case r >= '٠' && r <= '٩':
+		return '0' + (r - '٠')
+	case r >= '\u064b' && r <= '\u065f', r == '\u0670', r == '\u0640':
+		// Harakat, superscript alef and tatweel
+		return -1
+	case r == '\u200d' || r == '\u200e' || r == '\u200f' || r == '\ufeff':
+		// Zero-width joiner, direction marks and BOM
+		return -1
+	}
+	return unicode.ToLower(r)
+}
+
+// Normalize folds s into its canonical searchable form. Zero-width
+// non-joiners become spaces so "چای‌ساز" matches "چای ساز".
+func Normalize(s string) string {
+	s = strings.Map(fold, s)
+	s = strings.ReplaceAll(s, string(zwnj), " ")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Document normalizes s for indexing. Words written with a zero-width
+// non-joiner are indexed both split and joined, so "چایساز" matches as well.
+func Document(s string) string {
+	doc := Normalize(s)
+	for _, word := range strings.Fields(strings.Map(fold, s)) {
+		if strings.ContainsRune(word, zwnj) {
+			doc += " " + strings.ReplaceAll(word, string(zwnj), "")
+		}
+	}
+	return doc
+}
+
+// Terms splits a normalized query into letter/digit tokens.
+func Terms(s string) []string {
+	return strings.FieldsFunc(Normalize(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+}
+
+// Query builds a to_tsquery expression matching documents that contain every
+// term of s as a word prefix, so results show up while the user is still
+// typing. It returns "" when s has no terms.
+func Query(s string) string {
+	terms := Terms(s)
+	for i, t := range terms {
+		terms[i] = t + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// NormalizeFunctionSQL creates search_normalize(text), the SQL counterpart of
+// Normalize used by trigram indexes and queries. Keep both in sync.
+const NormalizeFunctionSQL = `CREATE OR REPLACE FUNCTION search_normalize(s text) RETURNS text
+LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURNS NULL ON NULL INPUT AS $$
+	SELECT btrim(regexp_replace(lower(
+		translate(
+			regexp_replace(replace(s, U&'\200C', ' '), '[\u064B-\u065F\u0670\u0640\u200D\u200E\u200F\uFEFF]', '', 'g'),
+			'يىئكةۀەأإٱآؤ۰۱۲۳۴۵۶۷۸۹٠١٢٣٤٥٦٧٨٩',
+			'یییکهههااااو01234567890123456789'
+		)), '\s+', ' ', 'g'))
+$$`
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+	"unicode"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"arabic yeh", "چاي", "چای"},
+		{"alef maksura and hamza yeh", "مبلى ئ", "مبلی ی"},
+		{"arabic kaf", "كتري برقي", "کتری برقی"},
+		{"teh marbuta and heh", "مدرسة خانۀ", "مدرسه خانه"},
+		{"alef variants", "آب أ إ ٱ", "اب ا ا ا"},
+		{"waw with hamza", "مؤسسه", "موسسه"},
+		{"persian digits", "۱۲۳۴۵۶۷۸۹۰", "1234567890"},
+		{"arabic-indic digits", "٠١٢٣٤٥٦٧٨٩", "0123456789"},
+		{"mixed digits", "مدل X۲۰٠", "مدل x200"},
+		{"zwnj splits words", "چای\u200cساز", "چای ساز"},
+		{"zwnj at edges", "\u200cمی\u200c\u200cخواهم\u200c", "می خواهم"},
+		{"zero-width joiner and marks", "ا\u200dب\u200eپ\u200f\ufeff", "ابپ"},
+		{"diacritics", "ک\u0650تاب\u064f", "کتاب"},
+		{"tatweel", "ک\u0640\u0640تاب", "کتاب"},
+		{"latin lower case", "Bosch SMS-46", "bosch sms-46"},
+		{"whitespace", "  یخچال \t\n ساید  ", "یخچال ساید"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.in); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocument(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"چای\u200cساز برقی", "چای ساز برقی چایساز"},
+		{"كتري", "کتری"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Document(tt.in); got != tt.want {
+			t.Errorf("Document(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"چای\u200cساز", "چای:* & ساز:*"},
+		{"SMS-46 ۱۲", "sms:* & 46:* & 12:*"},
+		{"' & | !", ""},
+	}
+	for _, tt := range tests {
+		if got := Query(tt.in); got != tt.want {
+			t.Errorf("Query(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestNormalizeFunctionSQL checks that search_normalize drops and translates
+// exactly the runes fold does.
+func TestNormalizeFunctionSQL(t *testing.T) {
+	m := regexp.MustCompile(`'\[([^\]]*)\]', '', 'g'\),\s*'([^']*)',\s*'([^']*)'`).FindStringSubmatch(NormalizeFunctionSQL)
+	if m == nil {
+		t.Fatal("could not find the dropped runes and translate tables in NormalizeFunctionSQL")
+	}
+	from, to := []rune(m[2]), []rune(m[3])
+	if len(from) != len(to) {
+		t.Fatalf("translate tables differ in length: %d and %d runes", len(from), len(to))
+	}
+	translate := make(map[rune]rune, len(from))
+	for i, r := range from {
+		translate[r] = to[i]
+	}
+	dropped := sqlRuneClass(t, m[1])
+
+	// sql emulates the function for one rune other than a ZWNJ
+	sql := func(r rune) rune {
+		if dropped[r] {
+			return -1
+		}
+		if to, ok := translate[r]; ok {
+			return to
+		}
+		return unicode.ToLower(r)
+	}
+	show := func(r rune) string {
+		if r < 0 {
+			return "nothing"
+		}
+		return strconv.QuoteRune(r)
+	}
+	check := func(r rune) {
+		if got, want := sql(r), fold(r); got != want {
+			t.Errorf("U+%04X: search_normalize gives %s, Normalize %s", r, show(got), show(want))
+		}
+	}
+	for r := rune(0x0600); r <= 0x06ff; r++ {
+		check(r)
+	}
+	for r := rune(0x2000); r <= 0x206f; r++ {
+		if r != zwnj {
+			check(r)
+		}
+	}
+	check('\ufeff')
+	for r := rune('A'); r <= 'z'; r++ {
+		check(r)
+	}
+}
+
+// sqlRuneClass expands a regular expression bracket expression written with
+// \uXXXX escapes and ranges.
+func sqlRuneClass(t *testing.T, class string) map[rune]bool {
+	var runes []rune
+	for _, m := range regexp.MustCompile(`\\u([0-9A-Fa-f]{4})|-`).FindAllStringSubmatch(class, -1) {
+		if m[0] == "-" {
+			runes = append(runes, -1)
+			continue
+		}
+		n, err := strconv.ParseUint(m[1], 16, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runes = append(runes, rune(n))
+	}
+
+	set := make(map[rune]bool)
+	for i := 0; i < len(runes); i++ {
+		if i+2 < len(runes) && runes[i+1] == -1 {
+			for r := runes[i]; r <= runes[i+2]; r++ {
+				set[r] = true
+			}
+			i += 2
+			continue
+		}
+		set[runes[i]] = true
+	}
+	if len(set) == 0 {
+		t.Fatalf("no runes in class %q", class)
+	}
+	return set
+}
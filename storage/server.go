@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// servedExts are the file types the asset routes serve.
+var servedExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".webp": true, ".gif": true, ".avif": true,
+}
+
+// Server serves stored files on the asset routes. Files under private
+// prefixes are only served with a valid signature from Local.SignedURL;
+// S3 signed URLs point at the bucket instead.
+type Server struct {
+	store   Storage
+	private []string
+}
+
+func NewServer(store Storage, private ...string) *Server {
+	return &Server{store: store, private: private}
+}
+
+// Handler serves the file whose key is dir followed by the {key...} path
+// value of the route.
+func (s *Server) Handler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+
+		key := dir + r.PathValue("key")
+		if validKey(key) != nil || !servedExts[strings.ToLower(path.Ext(key))] {
+			http.NotFound(w, r)
+			return
+		}
+
+		private := s.isPrivate(key)
+		if private && !s.verify(key, r) {
+			http.NotFound(w, r)
+			return
+		}
+
+		obj, err := s.store.Open(r.Context(), key)
+		if err != nil {
+			if !errors.Is(err, ErrNotFound) {
+				log.Printf("failed to open stored file %s: %v", key, err)
+				http.Error(w, "Failed to read file", http.StatusBadGateway)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		defer obj.Close()
+
+		if private {
+			w.Header().Set("Cache-Control", "private, no-store")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		contentType := obj.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(path.Ext(key))
+		}
+		w.Header().Set("Content-Type", contentType)
+
+		// Local files support range and conditional requests
+		if rs, ok := obj.ReadCloser.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, key, obj.ModTime, rs)
+			return
+		}
+		if obj.Size >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+		}
+		if !obj.ModTime.IsZero() {
+			w.Header().Set("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+		}
+		io.Copy(w, obj)
+	})
+}
+
+func (s *Server) isPrivate(key string) bool {
+	for _, prefix := range s.private {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) verify(key string, r *http.Request) bool {
+	local, ok := s.store.(*Local)
+	if !ok {
+		return false
+	}
+	q := r.URL.Query()
+	return local.Verify(key, q.Get("expires"), q.Get("signature"))
+}
@@ -0,0 +1,120 @@
+// Package storage keeps uploaded files on the local disk or in an
+// S3-compatible bucket, and builds the public and signed URLs they are
+// served from.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aminasadiam/Kasra/config"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid file key")
+)
+
+// Object is an opened stored file. Close it when done.
+type Object struct {
+	io.ReadCloser
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// FileInfo describes a stored file.
+type FileInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage keeps files under slash-separated keys such as
+// "products/product_1_1700000000_large.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open returns ErrNotFound for a missing file.
+	Open(ctx context.Context, key string) (*Object, error)
+	// Delete removes a file; a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every file whose key starts with prefix.
+	List(ctx context.Context, prefix string, fn func(FileInfo) error) error
+	// URL is where the file is publicly served.
+	URL(key string) string
+	// SignedURL is a URL to the file that stops working after ttl.
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// New returns the storage backend chosen in the configuration.
+func New(cfg *config.Configuration) (Storage, error) {
+	switch cfg.StorageBackend {
+	case "", "local":
+		return NewLocal(cfg.StorageDir, cfg.StoragePublicURL, cfg.SigningKey), nil
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+			PublicURL: cfg.StoragePublicURL,
+		})
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.StorageBackend)
+}
+
+// legacyDirs maps URL directories of files stored before keys matched
+// their directories.
+var legacyDirs = map[string]string{
+	"avatar/": "avatars/",
+}
+
+// Key returns the key of a file from a URL built by s.URL or s.SignedURL
+// for the local backend. It returns false for URLs of files kept elsewhere.
+func Key(s Storage, fileURL string) (string, bool) {
+	rest, ok := strings.CutPrefix(fileURL, s.URL(""))
+	if !ok {
+		return "", false
+	}
+	rest, _, _ = strings.Cut(rest, "?")
+	key, err := url.PathUnescape(rest)
+	if err != nil {
+		return "", false
+	}
+	for old, dir := range legacyDirs {
+		if after, ok := strings.CutPrefix(key, old); ok {
+			key = dir + after
+		}
+	}
+	if validKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// validKey rejects empty, absolute and non-canonical keys, so a key can
+// never point outside the storage root.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") ||
+		path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// joinURL appends a key to a base URL, escaping each path segment.
+func joinURL(base, key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return base + "/" + strings.Join(segments, "/")
+}
@@ -0,0 +1,177 @@
+// Package uploadgc finds uploaded files that no database row links to any
+// more, and rows whose files are gone.
+package uploadgc
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/aminasadiam/Kasra/repository"
+	"github.com/aminasadiam/Kasra/storage"
+	"gorm.io/gorm"
+)
+
+// Dirs are the storage directories holding uploads.
+var Dirs = []string{"products/", "avatars/", "returns/", "reviews/"}
+
+// Orphan is a stored file no live row links to.
+type Orphan struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Deleted bool      `json:"deleted"`
+}
+
+// Missing is a live row linking to a file that is not stored.
+type Missing struct {
+	Table string `json:"table"`
+	ID    uint   `json:"id"`
+	URL   string `json:"url"`
+}
+
+// Report is the outcome of one run.
+type Report struct {
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Files       int       `json:"files"`
+	Orphans     []Orphan  `json:"orphans"`
+	OrphanBytes int64     `json:"orphan_bytes"`
+	Deleted     int       `json:"deleted"`
+	Missing     []Missing `json:"missing"`
+}
+
+// Collector cross-references stored files with the rows linking to them.
+type Collector struct {
+	uploads *repository.UploadRepository
+	store   storage.Storage
+}
+
+func NewCollector(db *gorm.DB, store storage.Storage) *Collector {
+	return &Collector{uploads: repository.NewUploadRepository(db), store: store}
+}
+
+// Run scans the upload directories. A file is an orphan when no row links
+// to it, or only rows (or products) soft-deleted more than grace ago, and
+// it was itself stored more than grace ago, which spares uploads whose row
+// is still being written. With del set orphans are deleted.
+func (c *Collector) Run(ctx context.Context, grace time.Duration, del bool) (*Report, error) {
+	report := &Report{StartedAt: time.Now(), Orphans: []Orphan{}, Missing: []Missing{}}
+	cutoff := report.StartedAt.Add(-grace)
+
+	// Rows are read before files are listed, so a row and file created in
+	// between are never taken for a row with a missing file.
+	referenced := map[string]bool{}
+	var live []repository.UploadRef
+	err := c.uploads.References(func(ref repository.UploadRef) error {
+		if ref.ReleasedAt != nil && ref.ReleasedAt.Before(cutoff) {
+			return nil
+		}
+		for _, u := range ref.URLs {
+			if key, ok := c.key(u); ok {
+				referenced[key] = true
+			}
+		}
+		live = append(live, ref)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stored := map[string]bool{}
+	for _, dir := range Dirs {
+		err := c.store.List(ctx, dir, func(f storage.FileInfo) error {
+			report.Files++
+			stored[f.Key] = true
+			if referenced[f.Key] || f.ModTime.After(cutoff) {
+				return nil
+			}
+			report.Orphans = append(report.Orphans, Orphan{Key: f.Key, Size: f.Size, ModTime: f.ModTime})
+			report.OrphanBytes += f.Size
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ref := range live {
+		for _, u := range ref.URLs {
+			// Only files known to be ours can be missing; others may be
+			// external links from imports.
+			key, ok := storage.Key(c.store, u)
+			if ok && !stored[key] {
+				report.Missing = append(report.Missing, Missing{Table: ref.Table, ID: ref.ID, URL: u})
+			}
+		}
+	}
+
+	if del {
+		for i := range report.Orphans {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			orphan := &report.Orphans[i]
+			if err := c.store.Delete(ctx, orphan.Key); err != nil {
+				log.Printf("failed to delete orphaned upload %s: %v", orphan.Key, err)
+				continue
+			}
+			orphan.Deleted = true
+			report.Deleted++
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// key finds the stored file a URL links to. URLs under another base URL
+// (say from before STORAGE_PUBLIC_URL changed) are matched on their last
+// two path segments, so their files are never taken for orphans.
+func (c *Collector) key(fileURL string) (string, bool) {
+	if key, ok := storage.Key(c.store, fileURL); ok {
+		return key, true
+	}
+	u, err := url.Parse(fileURL)
+	if err != nil || u.Path == "" {
+		return "", false
+	}
+	dir := path.Base(path.Dir(u.Path)) + "/"
+	if dir == "avatar/" {
+		dir = "avatars/"
+	}
+	for _, d := range Dirs {
+		if dir == d {
+			return dir + path.Base(u.Path), true
+		}
+	}
+	return "", false
+}
+
+// Schedule runs the collector every interval until ctx is done, logging a
+// summary of each run.
+func (c *Collector) Schedule(ctx context.Context, interval, grace time.Duration, del bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := c.Run(ctx, grace, del)
+		if err != nil {
+			log.Printf("upload garbage collection failed: %v", err)
+			continue
+		}
+		log.Printf("upload garbage collection: %d files, %d orphans (%d bytes), %d deleted, %d rows with missing files",
+			report.Files, len(report.Orphans), report.OrphanBytes, report.Deleted, len(report.Missing))
+		for _, m := range report.Missing {
+			log.Printf("upload garbage collection: %s %d links to missing file %s", m.Table, m.ID, m.URL)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Pagination describes a requested page and, once filled in, the totals of
+// the collection it was taken from.
+type Pagination struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// ParsePagination reads "page" and "page_size" from the query string,
+// falling back to sane defaults and clamping the page size.
+func ParsePagination(r *http.Request) Pagination {
+	q := r.URL.Query()
+
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	size, err := strconv.Atoi(q.Get("page_size"))
+	if err != nil || size < 1 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+
+	return Pagination{Page: page, PageSize: size}
+}
+
+// Offset returns the number of rows to skip for the current page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// SetTotal records the collection size and derives the page count.
+func (p *Pagination) SetTotal(total int64) {
+	p.Total = total
+	if p.PageSize > 0 {
+		p.TotalPages = int((total + int64(p.PageSize) - 1) / int64(p.PageSize))
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// persianLatin transliterates Persian (and the Arabic variants of its
+// letters) into Latin for URL slugs.
+var persianLatin = map[rune]string{
+	'آ': "a", 'ا': "a", 'أ': "a", 'إ': "e", 'ٱ': "a",
+	'ب': "b", 'پ': "p", 'ت': "t", 'ث': "s", 'ج': "j",
+	'چ': "ch", 'ح': "h", 'خ': "kh", 'د': "d", 'ذ': "z",
+	'ر': "r", 'ز': "z", 'ژ': "zh", 'س': "s", 'ش': "sh",
+	'ص': "s", 'ض': "z", 'ط': "t", 'ظ': "z", 'ع': "a",
+	'غ': "gh", 'ف': "f", 'ق': "gh", 'ک': "k", 'ك': "k",
+	'گ': "g", 'ل': "l", 'م': "m", 'ن': "n", 'و': "v",
+	'ؤ': "v", 'ه': "h", 'ة': "h", 'ۀ': "h", 'ی': "i",
+	'ي': "i", 'ى': "i", 'ئ': "i", 'ء': "",
+	'۰': "0", '۱': "1", '۲': "2", '۳': "3", '۴': "4",
+	'۵': "5", '۶': "6", '۷': "7", '۸': "8", '۹': "9",
+	'٠': "0", '١': "1", '٢': "2", '٣': "3", '٤': "4",
+	'٥': "5", '٦': "6", '٧': "7", '٨': "8", '٩': "9",
+}
+
+// maxSlugLength keeps slugs well inside URL and index limits.
+const maxSlugLength = 100
+
+// Slugify turns s into a lower-case, hyphen-separated ASCII slug, spelling
+// Persian letters out in Latin. Diacritics are dropped and every other run
+// of non-alphanumeric characters becomes a single hyphen. The result is
+// empty when s has nothing to transliterate.
+func Slugify(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		var part string
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			part = string(r)
+		case persianLatin[r] != "":
+			part = persianLatin[r]
+		case unicode.Is(unicode.Mn, r), r == 'ء', r == 'ـ':
+			// diacritics, hamza and tatweel vanish without splitting words
+			continue
+		default:
+			hyphen = b.Len() > 0
+			continue
+		}
+		if hyphen {
+			b.WriteByte('-')
+			hyphen = false
+		}
+		b.WriteString(part)
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+	return slug
+}
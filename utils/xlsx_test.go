@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestXLSXRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		cells []interface{}
+		want  []string
+	}{
+		{"numbers", []interface{}{42, uint(7), int64(-3), 12.5}, []string{"42", "7", "-3", "12.5"}},
+		{"text", []interface{}{"plain", "  padded  ", "line\nbreak"}, []string{"plain", "  padded  ", "line\nbreak"}},
+		{"escaped", []interface{}{`<a href="x">&</a>`}, []string{`<a href="x">&</a>`}},
+		{"persian", []interface{}{"یخچال ساید بای ساید", "۱۲۳"}, []string{"یخچال ساید بای ساید", "۱۲۳"}},
+		{"gaps", []interface{}{"a", nil, "", "d"}, []string{"a", "", "", "d"}},
+		{"trailing empty cells", []interface{}{"a", "", nil}, []string{"a"}},
+		{"empty row", []interface{}{}, nil},
+		{"other types", []interface{}{true, float32(1.5)}, []string{"true", "1.5"}},
+	}
+
+	var buf bytes.Buffer
+	x, err := NewXLSXWriter(&buf, `Orders & "Returns"`)
+	if err != nil {
+		t.Fatalf("NewXLSXWriter: %v", err)
+	}
+	for _, tt := range tests {
+		if err := x.WriteRow(tt.cells); err != nil {
+			t.Fatalf("WriteRow(%s): %v", tt.name, err)
+		}
+		if err := x.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+	}
+	if err := x.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	rows, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX: %v", err)
+	}
+	if len(rows) != len(tests) {
+		t.Fatalf("got %d rows, want %d", len(rows), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(rows[i], tt.want) {
+				t.Errorf("row %d = %q, want %q", i+1, rows[i], tt.want)
+			}
+		})
+	}
+}
+
+func TestXLSXWriterParts(t *testing.T) {
+	var buf bytes.Buffer
+	x, err := NewXLSXWriter(&buf, "Sheet")
+	if err != nil {
+		t.Fatalf("NewXLSXWriter: %v", err)
+	}
+	if err := x.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("output is not a zip archive: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{
+		"[Content_Types].xml",
+		"_rels/.rels",
+		"xl/_rels/workbook.xml.rels",
+		"xl/workbook.xml",
+		"xl/worksheets/sheet1.xml",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("parts = %q, want %q", names, want)
+	}
+}
+
+func TestReadXLSXSharedStrings(t *testing.T) {
+	sheet := `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+<row r="3"><c r="B3" t="b"><v>1</v></c><c r="C3"><v>9.75</v></c></row>
+</sheetData></worksheet>`
+	shared := `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>sku</t></si><si><r><t>rich </t></r><r><t>text</t></r></si>
+</sst>`
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"xl/worksheets/sheet1.xml": sheet,
+		"xl/sharedStrings.xml":     shared,
+	} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := ReadXLSX(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadXLSX: %v", err)
+	}
+	want := [][]string{{"sku", "", "rich text"}, nil, {"", "true", "9.75"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestXLSXColumns(t *testing.T) {
+	tests := []struct {
+		index int
+		ref   string
+	}{
+		{0, "A"},
+		{25, "Z"},
+		{26, "AA"},
+		{51, "AZ"},
+		{52, "BA"},
+		{701, "ZZ"},
+		{702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumn(tt.index); got != tt.ref {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", tt.index, got, tt.ref)
+		}
+		if got := xlsxColumnIndex(tt.ref + "12"); got != tt.index {
+			t.Errorf("xlsxColumnIndex(%q) = %d, want %d", tt.ref+"12", got, tt.index)
+		}
+	}
+	if got := xlsxColumnIndex("12"); got != -1 {
+		t.Errorf("xlsxColumnIndex without letters = %d, want -1", got)
+	}
+}
@@ -1,6 +1,7 @@
 import { Component, createSignal, onMount, For, Show } from "solid-js";
 import { A } from "@solidjs/router";
 import { usersApi, productsApi, ordersApi, categoriesApi } from "../utils/api";
+import { productListItems } from "../types/api";
 
 const AdminDashboard: Component = () => {
   const [stats, setStats] = createSignal({
@@ -24,7 +25,9 @@ const AdminDashboard: Component = () => {
       ]);
 
       const users = Array.isArray(uRes.data) ? uRes.data : [];
-      const products = Array.isArray(pRes.data) ? pRes.data : [];
+      const productCount =
+        (pRes.data as any)?.pagination?.total ??
+        productListItems(pRes.data).length;
       const orders = Array.isArray(oRes.data) ? oRes.data : [];
       const categories = Array.isArray(cRes.data) ? cRes.data : [];
 
@@ -38,7 +41,7 @@ const AdminDashboard: Component = () => {
 
       setStats({
         users: users.length,
-        products: products.length,
+        products: productCount,
         orders: orders.length,
         categories: categories.length,
         totalRevenue,
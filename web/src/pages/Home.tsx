@@ -5,6 +5,7 @@ import { productsApi, categoriesApi, brandsApi } from "../utils/api";
 import {
   Product,
   normalizeProduct,
+  productListItems,
   Category,
   normalizeCategory,
   Brand,
@@ -136,8 +137,8 @@ const Home = () => {
 
   const [products] = createResource<Product[]>(async () => {
     try {
-      const response = await productsApi.getAll();
-      const payload = Array.isArray(response.data) ? response.data : [];
+      const response = await productsApi.getAll({ page_size: 8 });
+      const payload = productListItems(response.data);
       return payload.map(normalizeProduct);
     } catch (error) {
       console.log("Error loading products:", error);
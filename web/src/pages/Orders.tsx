@@ -6,7 +6,9 @@ import { Order, normalizeOrder } from "../types/api";
 const statusStyles: Record<string, string> = {
   pending: "bg-amber-100 text-amber-700",
   paid: "bg-green-100 text-green-700",
+  partially_shipped: "bg-sky-100 text-sky-700",
   shipped: "bg-blue-100 text-blue-700",
+  delivered: "bg-emerald-100 text-emerald-700",
   cancelled: "bg-red-100 text-red-700",
 };
 
@@ -10,7 +10,12 @@ import {
 import { useAuth } from "../store/auth";
 import { useCart } from "../store/cart";
 import { productsApi, getImageUrl } from "../utils/api";
-import { Product, normalizeProduct, ProductImage } from "../types/api";
+import {
+  Product,
+  normalizeProduct,
+  productListItems,
+  ProductImage,
+} from "../types/api";
 
 const formatPrice = (value?: number) =>
   `${Intl.NumberFormat("fa-IR").format(value ?? 0)} تومان`;
@@ -75,8 +80,9 @@ const ProductDetail = () => {
     if (!current?.categoryId) return [];
     const response = await productsApi.getAll({
       categoryId: current.categoryId,
+      page_size: 5,
     });
-    const payload = Array.isArray(response.data) ? response.data : [];
+    const payload = productListItems(response.data);
     return payload
       .map(normalizeProduct)
       .filter((item) => item.id !== current?.id && item.isActive !== false)
@@ -14,6 +14,7 @@ import {
   Category,
   normalizeCategory,
   normalizeProduct,
+  productListItems,
   Brand,
   Product,
 } from "../types/api";
@@ -154,8 +155,8 @@ const Products = () => {
       params.search = trimmedSearch;
     }
 
-    const response = await productsApi.getAll(params);
-    const payload = Array.isArray(response.data) ? response.data : [];
+    const response = await productsApi.getAllPages(params);
+    const payload = productListItems(response.data);
     return payload.map(normalizeProduct);
   });
 
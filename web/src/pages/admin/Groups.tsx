@@ -7,6 +7,7 @@ import {
   createMemo,
 } from "solid-js";
 import { adminApi, productsApi, usersApi } from "../../utils/api";
+import { productListItems } from "../../types/api";
 
 const Groups: Component = () => {
   const [groups, setGroups] = createSignal<any[]>([]);
@@ -33,7 +34,7 @@ const Groups: Component = () => {
     try {
       const [gRes, pRes, uRes] = await Promise.all([
         adminApi.groups.getAll(),
-        productsApi.getAll(),
+        productsApi.getAllPages(),
         usersApi.getAll(),
       ]);
 
@@ -48,9 +49,7 @@ const Groups: Component = () => {
 
       setGroups(normalizedGroups);
 
-      setProducts(
-        Array.isArray(pRes.data) ? pRes.data : pRes.data?.items ?? []
-      );
+      setProducts(productListItems(pRes.data));
 
       setUsers(Array.isArray(uRes.data) ? uRes.data : uRes.data?.items ?? []);
     } catch (e) {
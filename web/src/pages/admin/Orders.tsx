@@ -83,6 +83,8 @@ const Orders: Component = () => {
     completed: "bg-green-100 text-green-800",
     cancelled: "bg-red-100 text-red-800",
     shipped: "bg-purple-100 text-purple-800",
+    partially_shipped: "bg-indigo-100 text-indigo-800",
+    delivered: "bg-emerald-100 text-emerald-800",
   };
 
   const getStatusColor = (status: string) => {
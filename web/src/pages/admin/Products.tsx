@@ -12,6 +12,7 @@ import {
   adminApi,
   getImageUrl,
 } from "../../utils/api";
+import { productListItems } from "../../types/api";
 import { A } from "@solidjs/router";
 import HtmlEditor from "../../components/HtmlEditor";
 
@@ -56,12 +57,20 @@ const Products: Component = () => {
     setLoading(true);
     try {
       const [pRes, cRes, gRes, bRes] = await Promise.all([
-        productsApi.getAll(),
+        productsApi.getAllPages(),
         categoriesApi.getAll(),
         adminApi.groups.getAll(),
         adminApi.brands.getAll(),
       ]);
-      setItems((pRes.data as any) || []);
+      // List items are slim; shape them like the full product the table reads
+      setItems(
+        productListItems(pRes.data).map((p: any) => ({
+          ...p,
+          Images: p.image ? [{ url: p.image }] : [],
+          Brand: p.brand_name ? { name: p.brand_name } : undefined,
+          Category: p.category_name ? { name: p.category_name } : undefined,
+        })) as any
+      );
       setCategories((cRes.data as any) || []);
       setGroups((gRes.data as any) || []);
       setBrands((bRes.data as any) || []);
@@ -417,10 +426,11 @@ const Products: Component = () => {
       }
 
       // Handle groups
+      const current: any = await productsApi.getById(productId);
       const existingGroups =
-        items()
-          .find((p: any) => (p.ID ?? p.id) === productId)
-          ?.Groups?.map((g: any) => g.ID ?? g.id) || [];
+        (current.data?.Groups ?? current.data?.groups)?.map(
+          (g: any) => g.ID ?? g.id
+        ) || [];
 
       for (const gid of existingGroups) {
         try {
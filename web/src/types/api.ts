@@ -12,12 +12,24 @@ export interface Brand {
   description?: string;
   logo?: string;
 }
+export interface ImageRendition {
+  name: "thumbnail" | "medium" | "large";
+  width: number;
+  height: number;
+  url: string;
+  webp_url?: string;
+}
 export interface ProductImage {
   id: number;
   url: string;
   alt?: string;
   isPrimary: boolean;
   order: number;
+  width?: number;
+  height?: number;
+  renditions?: ImageRendition[];
+  srcset?: string;
+  webp_srcset?: string;
 }
 export interface ProductSize {
   id: number;
@@ -36,6 +48,7 @@ export interface ProductPrice {
   groupId?: number;
   price: number;
 }
+export type ProductStatus = "draft" | "in_review" | "published" | "archived";
 export interface Product {
   id: number;
   name: string;
@@ -51,6 +64,9 @@ export interface Product {
   capacity?: string;
   features?: string;
   isActive: boolean;
+  status?: ProductStatus; // storefront products are always published
+  publishAt?: string;
+  unpublishAt?: string;
   categoryId?: number;
   category?: Category;
   brandId?: number;
@@ -59,8 +75,302 @@ export interface Product {
   sizes?: ProductSize[];
   colors?: ProductColor[];
   prices?: ProductPrice[];
+  specs?: ProductSpec[];
+  options?: ProductOption[];
+  variants?: ProductVariant[];
+  rating_average: number;
+  rating_count: number;
+  relations?: Partial<Record<RelationType, RelatedProduct[]>>;
   price: number; // dynamic/calculated price
 }
+export type RelationType =
+  | "related"
+  | "accessory"
+  | "spare_part"
+  | "replacement_for"
+  | "upsell";
+export interface RelatedProduct {
+  relation_id: number;
+  type: RelationType;
+  note?: string;
+  position: number;
+  id: number;
+  name: string;
+  sku: string;
+  model_number?: string;
+  brand_name?: string;
+  image?: string;
+  price?: number;
+  in_stock: boolean;
+  stock?: number;
+  status?: ProductStatus; // admins only
+  rating_average: number;
+  rating_count: number;
+}
+export interface ComparedProduct {
+  id: number;
+  name: string;
+  sku: string;
+  model_number?: string;
+  brand_id?: number;
+  brand_name?: string;
+  category_id?: number;
+  category_name?: string;
+  image?: string;
+  price?: number;
+  in_stock: boolean;
+  stock?: number;
+  status?: ProductStatus; // admins only
+  stock_policy: string;
+  rating_average: number;
+  rating_count: number;
+  warranty?: string;
+  dimensions?: string;
+  weight?: number;
+}
+export interface ComparisonRow {
+  key: string; // product field, or "spec.<key>"
+  label?: string;
+  group: "general" | "specs";
+  unit?: string;
+  values: (string | number | boolean | null)[]; // aligned with products
+  differs: boolean;
+}
+export interface Comparison {
+  products: ComparedProduct[];
+  rows: ComparisonRow[];
+}
+export interface SpecAttribute {
+  id: number;
+  category_id: number;
+  key: string;
+  name: string;
+  type: "text" | "number" | "boolean" | "enum";
+  unit?: string;
+  options?: string[];
+  required: boolean;
+  filterable: boolean;
+  position: number;
+}
+export interface ProductSpec {
+  id: number;
+  product_id: number;
+  attribute_id: number;
+  attribute?: SpecAttribute;
+  value: string;
+  number?: number;
+}
+export interface ProductOptionValue {
+  id: number;
+  option_id: number;
+  value: string;
+  hex_code?: string;
+  position: number;
+}
+export interface ProductOption {
+  id: number;
+  product_id: number;
+  name: string;
+  position: number;
+  values: ProductOptionValue[];
+}
+export interface ProductVariant {
+  id: number;
+  product_id: number;
+  signature: string;
+  sku: string;
+  barcode?: string;
+  stock: number;
+  is_active: boolean;
+  values: ProductOptionValue[];
+  images?: ProductImage[];
+  price?: number;
+}
+export interface ReviewPhoto {
+  id: number;
+  review_id: number;
+  url: string;
+  renditions?: ImageRendition[];
+}
+export interface Review {
+  id: number;
+  product_id: number;
+  product?: Product;
+  user_id: number;
+  author_name?: string;
+  rating: number;
+  title?: string;
+  body?: string;
+  status: "pending" | "approved" | "rejected";
+  moderation_note?: string;
+  helpful_count: number;
+  unhelpful_count: number;
+  photos?: ReviewPhoto[];
+  my_vote?: boolean;
+  created_at: string;
+}
+export interface ReviewSummary {
+  average: number;
+  count: number;
+  distribution: Record<1 | 2 | 3 | 4 | 5, number>;
+}
+export interface ProductAnswer {
+  id: number;
+  question_id: number;
+  user_id: number;
+  author_name?: string;
+  is_staff: boolean;
+  is_verified_buyer: boolean;
+  body: string;
+  status: "pending" | "approved" | "rejected";
+  moderation_note?: string;
+  created_at: string;
+}
+export interface ProductQuestion {
+  id: number;
+  product_id: number;
+  product?: Product;
+  user_id: number;
+  author_name?: string;
+  body: string;
+  status: "pending" | "approved" | "rejected";
+  moderation_note?: string;
+  answers?: ProductAnswer[];
+  created_at: string;
+}
+export interface Notification {
+  id: number;
+  type: "question_answered" | "back_in_stock";
+  title: string;
+  body?: string;
+  link?: string;
+  read_at?: string;
+  created_at: string;
+}
+export interface Wishlist {
+  id: number;
+  name: string;
+  share_token?: string;
+  item_count: number;
+  created_at: string;
+}
+export interface WishlistItem {
+  item_id: number;
+  variant_id?: number;
+  variant_sku?: string;
+  variant_in_stock?: boolean;
+  added_at: string;
+  id: number;
+  name: string;
+  sku: string;
+  model_number?: string;
+  brand_name?: string;
+  category_name?: string;
+  image?: string;
+  price?: number;
+  in_stock: boolean;
+  stock?: number;
+  status?: ProductStatus; // admins only
+  rating_average: number;
+  rating_count: number;
+}
+export interface SharedWishlist {
+  name: string;
+  owner: string;
+  items: WishlistItem[];
+}
+export interface StockAlert {
+  id: number;
+  product_id: number;
+  product?: Product;
+  variant_id?: number;
+  variant?: ProductVariant;
+  notified_at?: string;
+  created_at: string;
+}
+export type RevisionAction =
+  | "baseline"
+  | "create"
+  | "update"
+  | "prices"
+  | "images"
+  | "variants"
+  | "import"
+  | "revert";
+export interface FieldChange {
+  field: string; // e.g. "name", "prices.group:3", "variants.40.sku"
+  old: unknown;
+  new: unknown;
+}
+export interface ProductSnapshot {
+  name: string;
+  description: string;
+  sku: string;
+  model_number: string;
+  warranty: string;
+  weight: number;
+  dimensions: string;
+  power: string;
+  material: string;
+  capacity: string;
+  features: string;
+  is_active: boolean;
+  stock_policy: string;
+  available_at: string | null;
+  backorder_limit: number;
+  category_id: number | null;
+  brand_id: number | null;
+  prices: { group_id: number | null; price: number }[];
+  images: {
+    id: number;
+    url: string;
+    alt: string;
+    is_primary: boolean;
+    order: number;
+    variant_id: number | null;
+  }[];
+  variants: {
+    id: number;
+    label: string;
+    sku: string;
+    barcode: string;
+    is_active: boolean;
+    prices: { group_id: number | null; price: number }[];
+  }[];
+}
+export interface ProductRevision {
+  id: number;
+  product_id: number;
+  user_id?: number;
+  username?: string;
+  action: RevisionAction;
+  snapshot?: ProductSnapshot; // single revisions only
+  changes: FieldChange[];
+  reverted_from?: number;
+  created_at: string;
+}
+export interface ImportRowError {
+  row: number;
+  sku?: string;
+  column?: string;
+  message: string;
+}
+export interface ImportJob {
+  id: number;
+  filename: string;
+  format: "csv" | "xlsx";
+  dry_run: boolean;
+  status: "pending" | "running" | "completed" | "failed";
+  total: number;
+  processed: number;
+  created: number;
+  updated: number;
+  failed: number;
+  errors: ImportRowError[];
+  error?: string;
+  started_at?: string;
+  finished_at?: string;
+}
 export interface OrderDetail {
   id: number;
   productId: number;
@@ -151,7 +461,11 @@ export const normalizeProduct = (raw: any): Product => ({
   name: raw?.name ?? raw?.Name ?? "",
   description: raw?.description ?? raw?.Description,
   sku: raw?.sku ?? raw?.SKU ?? "",
-  stock: parseNumber(raw?.stock ?? raw?.Stock, 0),
+  // List items only carry an in_stock flag
+  stock: parseNumber(
+    raw?.stock ?? raw?.Stock ?? (raw?.in_stock === undefined ? 0 : raw.in_stock ? 1 : 0),
+    0
+  ),
   modelNumber: raw?.model_number ?? raw?.ModelNumber,
   warranty: raw?.warranty ?? raw?.Warranty,
   weight:
@@ -164,18 +478,27 @@ export const normalizeProduct = (raw: any): Product => ({
   capacity: raw?.capacity ?? raw?.Capacity,
   features: raw?.features ?? raw?.Features,
   isActive: Boolean(raw?.is_active ?? raw?.IsActive ?? true),
+  status: raw?.status ?? raw?.Status,
+  publishAt: raw?.publish_at ?? raw?.PublishAt,
+  unpublishAt: raw?.unpublish_at ?? raw?.UnpublishAt,
   categoryId: raw?.category_id ?? raw?.CategoryID,
   category:
     raw?.category ?? raw?.Category
       ? normalizeCategory(raw?.category ?? raw?.Category)
+      : raw?.category_name
+      ? normalizeCategory({ id: raw.category_id, name: raw.category_name })
       : undefined,
   brandId: raw?.brand_id ?? raw?.BrandID,
   brand:
     raw?.brand ?? raw?.Brand
       ? normalizeBrand(raw?.brand ?? raw?.Brand)
+      : raw?.brand_name
+      ? normalizeBrand({ id: raw.brand_id, name: raw.brand_name })
       : undefined,
   images: Array.isArray(raw?.images ?? raw?.Images)
     ? (raw?.images ?? raw?.Images).map(normalizeProductImage)
+    : raw?.image
+    ? [normalizeProductImage({ url: raw.image, is_primary: true })]
     : undefined,
   sizes: Array.isArray(raw?.sizes ?? raw?.Sizes)
     ? (raw?.sizes ?? raw?.Sizes).map(normalizeProductSize)
@@ -186,8 +509,59 @@ export const normalizeProduct = (raw: any): Product => ({
   prices: Array.isArray(raw?.prices ?? raw?.Prices)
     ? (raw?.prices ?? raw?.Prices).map(normalizeProductPrice)
     : undefined,
+  rating_average: parseNumber(raw?.rating_average, 0),
+  rating_count: parseNumber(raw?.rating_count, 0),
+  relations: raw?.relations,
   price: parseNumber(raw?.price ?? raw?.Price, 0),
 });
+// The product listing wraps its items as { products, facets, pagination, next_cursor }
+export const productListItems = (data: any): any[] =>
+  Array.isArray(data) ? data : Array.isArray(data?.products) ? data.products : [];
+// Reviews, questions and notifications keep their snake_case fields; only
+// gorm.Model's ID and CreatedAt need renaming
+export const normalizeReview = (raw: any): Review => ({
+  ...raw,
+  id: parseId(raw?.id ?? raw?.ID),
+  created_at: raw?.created_at ?? raw?.CreatedAt,
+  photos: Array.isArray(raw?.photos)
+    ? raw.photos.map((p: any) => ({ ...p, id: parseId(p?.id ?? p?.ID) }))
+    : undefined,
+});
+export const normalizeQuestion = (raw: any): ProductQuestion => ({
+  ...raw,
+  id: parseId(raw?.id ?? raw?.ID),
+  created_at: raw?.created_at ?? raw?.CreatedAt,
+  answers: Array.isArray(raw?.answers)
+    ? raw.answers.map((a: any) => ({
+        ...a,
+        id: parseId(a?.id ?? a?.ID),
+        created_at: a?.created_at ?? a?.CreatedAt,
+      }))
+    : undefined,
+});
+export const normalizeNotification = (raw: any): Notification => ({
+  ...raw,
+  id: parseId(raw?.id ?? raw?.ID),
+  created_at: raw?.created_at ?? raw?.CreatedAt,
+});
+export const normalizeWishlist = (raw: any): Wishlist => ({
+  ...raw,
+  id: parseId(raw?.id ?? raw?.ID),
+  item_count: parseNumber(raw?.item_count, 0),
+  created_at: raw?.created_at ?? raw?.CreatedAt,
+});
+export const normalizeStockAlert = (raw: any): StockAlert => ({
+  ...raw,
+  id: parseId(raw?.id ?? raw?.ID),
+  product: raw?.product ? normalizeProduct(raw.product) : undefined,
+  created_at: raw?.created_at ?? raw?.CreatedAt,
+});
+export const normalizeRevision = (raw: any): ProductRevision => ({
+  ...raw,
+  id: parseId(raw?.id ?? raw?.ID),
+  changes: raw?.changes ?? [],
+  created_at: raw?.created_at ?? raw?.CreatedAt,
+});
 export const normalizeOrderDetail = (raw: any): OrderDetail => ({
   id: parseId(raw?.id ?? raw?.ID),
   productId: parseId(raw?.product_id ?? raw?.ProductID),
@@ -151,6 +151,21 @@ export const usersApi = {
 
 export const productsApi = {
   getAll: (params?: any) => api.get("/products", params),
+  // Follows next_cursor to load every page of the listing
+  getAllPages: async (params?: any) => {
+    const items: any[] = [];
+    let cursor: string | undefined;
+    do {
+      const response: any = await api.get("/products", {
+        ...params,
+        page_size: 100,
+        cursor,
+      });
+      items.push(...(response.data?.products ?? []));
+      cursor = response.data?.next_cursor || undefined;
+    } while (cursor);
+    return { success: true, data: items };
+  },
   getById: (id: number | string) => api.get(`/products/${id}`),
   create: (payload: any) => api.post("/products", payload),
   update: (id: number | string, payload: any) =>